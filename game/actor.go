@@ -1,6 +1,7 @@
 package game
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
 	"maps"
@@ -48,9 +49,11 @@ func (p Policy[Ac]) ValidateForLegalActions(legalActions []Ac, checkUnique bool)
 	return nil
 }
 
-type SelectFunc[Ac, Ag comparable] func(Policy[Ac], Ag, *rand.Rand) (Ac, error)
+// SelectFunc は、policyから行動を1つ選ぶ。
+// 第3引数は、プレイアウトの初期状態からの手数(0始まり)で、手数に応じて選び方を変える為に使う。
+type SelectFunc[Ac, Ag comparable] func(Policy[Ac], Ag, int, *rand.Rand) (Ac, error)
 
-func MaxSelectFunc[Ac, Ag comparable](policy Policy[Ac], agent Ag, rng *rand.Rand) (Ac, error) {
+func MaxSelectFunc[Ac, Ag comparable](policy Policy[Ac], agent Ag, stepIdx int, rng *rand.Rand) (Ac, error) {
 	if len(policy) == 0 {
 		var zero Ac
 		return zero, errors.New("policyが空です: len(policy) > 0 であるべき")
@@ -79,7 +82,7 @@ func MaxSelectFunc[Ac, Ag comparable](policy Policy[Ac], agent Ag, rng *rand.Ran
 	return action, nil
 }
 
-func WeightedRandomSelectFunc[Ac, Ag comparable](policy Policy[Ac], agent Ag, rng *rand.Rand) (Ac, error) {
+func WeightedRandomSelectFunc[Ac, Ag comparable](policy Policy[Ac], agent Ag, stepIdx int, rng *rand.Rand) (Ac, error) {
 	n := len(policy)
 	actions := make([]Ac, 0, n)
 	ws := make([]float32, 0, n)
@@ -96,4 +99,155 @@ func WeightedRandomSelectFunc[Ac, Ag comparable](policy Policy[Ac], agent Ag, rn
 	return actions[idx], nil
 }
 
+// NewTemperatureSelectFunc は、policyを温度tauで調整した分布 p^(1/tau) に比例して行動を選ぶSelectFuncを返す。
+// tau = 1 で WeightedRandomSelectFunc と同じ分布になり、tauが0に近付く程、MaxSelectFunc に近付く。
+func NewTemperatureSelectFunc[Ac, Ag comparable](tau float32) (SelectFunc[Ac, Ag], error) {
+	if tau <= 0 || math.IsNaN(float64(tau)) || math.IsInf(float64(tau), 0) {
+		return nil, fmt.Errorf("tauが不正(<=0/NaN/Inf): tau = %g", tau)
+	}
+
+	return func(policy Policy[Ac], agent Ag, stepIdx int, rng *rand.Rand) (Ac, error) {
+		n := len(policy)
+		actions := make([]Ac, 0, n)
+		logs := make([]float64, 0, n)
+		maxLog := math.Inf(-1)
+		for a, p := range policy {
+			// log(0) = -Inf となり、exp後の重みは0になる
+			l := math.Log(float64(p)) / float64(tau)
+			actions = append(actions, a)
+			logs = append(logs, l)
+			maxLog = max(maxLog, l)
+		}
+
+		if math.IsInf(maxLog, -1) {
+			var zero Ac
+			return zero, errors.New("policyの確率が全て0、またはpolicyが空です")
+		}
+
+		// オーバーフローを防ぐ為、最大値を引いてからexpを取る
+		ws := make([]float32, n)
+		for i, l := range logs {
+			ws[i] = float32(math.Exp(l - maxLog))
+		}
+
+		idx, err := randx.IndexByWeights(ws, rng)
+		if err != nil {
+			var zero Ac
+			return zero, err
+		}
+		return actions[idx], nil
+	}, nil
+}
+
+// NewStepSwitchSelectFunc は、手数がswitchStep未満の間はbeforeで、switchStep以降はafterで行動を選ぶSelectFuncを返す。
+// 自己対局で、序盤は探索の訪問比率に従って多様な手を選び、k手目以降は最善手を選ぶ、といった使い方をする。
+func NewStepSwitchSelectFunc[Ac, Ag comparable](switchStep int, before, after SelectFunc[Ac, Ag]) (SelectFunc[Ac, Ag], error) {
+	if switchStep < 0 {
+		return nil, fmt.Errorf("switchStepが不正: switchStep = %d: switchStep >= 0 であるべき", switchStep)
+	}
+
+	if before == nil || after == nil {
+		return nil, errors.New("beforeまたはafterがnilです")
+	}
+
+	return func(policy Policy[Ac], agent Ag, stepIdx int, rng *rand.Rand) (Ac, error) {
+		if stepIdx < switchStep {
+			return before(policy, agent, stepIdx, rng)
+		}
+		return after(policy, agent, stepIdx, rng)
+	}, nil
+}
+
+// NewTemperatureScheduleSelectFunc は、手数がgreedyStep未満の間は温度tauで、greedyStep以降は最大の確率の行動を選ぶSelectFuncを返す。
+func NewTemperatureScheduleSelectFunc[Ac, Ag comparable](tau float32, greedyStep int) (SelectFunc[Ac, Ag], error) {
+	temperatureFunc, err := NewTemperatureSelectFunc[Ac, Ag](tau)
+	if err != nil {
+		return nil, err
+	}
+	return NewStepSwitchSelectFunc(greedyStep, temperatureFunc, MaxSelectFunc[Ac, Ag])
+}
+
+// NewEpsilonGreedySelectFunc は、確率epsilonで全ての行動から一様ランダムに、それ以外は最大の確率の行動を選ぶSelectFuncを返す。
+func NewEpsilonGreedySelectFunc[Ac, Ag comparable](epsilon float32) (SelectFunc[Ac, Ag], error) {
+	if epsilon < 0 || epsilon > 1 || math.IsNaN(float64(epsilon)) {
+		return nil, fmt.Errorf("epsilonが不正: epsilon = %g: 0 <= epsilon <= 1 であるべき", epsilon)
+	}
+
+	return func(policy Policy[Ac], agent Ag, stepIdx int, rng *rand.Rand) (Ac, error) {
+		if rng.Float32() < epsilon {
+			if len(policy) == 0 {
+				var zero Ac
+				return zero, errors.New("policyが空です: len(policy) > 0 であるべき")
+			}
+			return randx.Choice(slices.Collect(maps.Keys(policy)), rng)
+		}
+		return MaxSelectFunc(policy, agent, stepIdx, rng)
+	}, nil
+}
+
+// sortedByProbability は、policyの行動を確率の降順に並べて返す。
+func sortedByProbability[Ac comparable](policy Policy[Ac]) []Ac {
+	actions := slices.Collect(maps.Keys(policy))
+	slices.SortStableFunc(actions, func(a, b Ac) int {
+		return cmp.Compare(policy[b], policy[a])
+	})
+	return actions
+}
+
+// weightedRandomSelect は、actionsの中から、policyの確率に比例して行動を選ぶ。
+func weightedRandomSelect[Ac comparable](policy Policy[Ac], actions []Ac, rng *rand.Rand) (Ac, error) {
+	ws := make([]float32, len(actions))
+	for i, a := range actions {
+		ws[i] = policy[a]
+	}
+
+	idx, err := randx.IndexByWeights(ws, rng)
+	if err != nil {
+		var zero Ac
+		return zero, err
+	}
+	return actions[idx], nil
+}
+
+// NewTopKSelectFunc は、確率の大きい上位k個の行動の中から、確率に比例して行動を選ぶSelectFuncを返す。
+// 行動の数がk未満の場合は、全ての行動から選ぶ。
+func NewTopKSelectFunc[Ac, Ag comparable](k int) (SelectFunc[Ac, Ag], error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("kが不正: k = %d: k > 0 であるべき", k)
+	}
+
+	return func(policy Policy[Ac], agent Ag, stepIdx int, rng *rand.Rand) (Ac, error) {
+		actions := sortedByProbability(policy)
+		return weightedRandomSelect(policy, actions[:min(k, len(actions))], rng)
+	}, nil
+}
+
+// NewTopPSelectFunc は、確率の大きい順に、累積確率がp以上になるまでの行動の中から、確率に比例して行動を選ぶSelectFuncを返す。
+// (nucleus sampling) policyの合計が1でない場合は、合計で正規化した累積確率で判定する。
+func NewTopPSelectFunc[Ac, Ag comparable](p float32) (SelectFunc[Ac, Ag], error) {
+	if p <= 0 || p > 1 || math.IsNaN(float64(p)) {
+		return nil, fmt.Errorf("pが不正: p = %g: 0 < p <= 1 であるべき", p)
+	}
+
+	return func(policy Policy[Ac], agent Ag, stepIdx int, rng *rand.Rand) (Ac, error) {
+		actions := sortedByProbability(policy)
+
+		var sum float32
+		for _, a := range actions {
+			sum += policy[a]
+		}
+
+		var cum float32
+		n := len(actions)
+		for i, a := range actions {
+			cum += policy[a]
+			if cum >= p*sum {
+				n = i + 1
+				break
+			}
+		}
+		return weightedRandomSelect(policy, actions[:n], rng)
+	}, nil
+}
+
 type ActorCriticName string
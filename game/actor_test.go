@@ -99,7 +99,7 @@ func TestMaxSelectFunc(t *testing.T) {
 		policy := game.Policy[string]{"戦う": 0.7, "逃げる": 0.2, "防御": 0.1}
 		// 最大値が1つの場合、常にその行動が選ばれる
 		for range 100 {
-			got, err := game.MaxSelectFunc(policy, "勇者", rng)
+			got, err := game.MaxSelectFunc(policy, "勇者", 0, rng)
 			if err != nil {
 				t.Fatalf("予期せぬエラー: %v", err)
 			}
@@ -114,7 +114,7 @@ func TestMaxSelectFunc(t *testing.T) {
 		n := 10000
 		got := make([]string, n)
 		for i := range n {
-			v, err := game.MaxSelectFunc(policy, "勇者", rng)
+			v, err := game.MaxSelectFunc(policy, "勇者", 0, rng)
 			if err != nil {
 				t.Fatalf("予期せぬエラー: %v", err)
 			}
@@ -138,7 +138,7 @@ func TestMaxSelectFunc(t *testing.T) {
 
 	t.Run("異常_空のpolicy", func(t *testing.T) {
 		policy := game.Policy[string]{}
-		_, err := game.MaxSelectFunc(policy, "勇者", rng)
+		_, err := game.MaxSelectFunc(policy, "勇者", 0, rng)
 		if err == nil {
 			t.Fatal("エラーを期待したが、nilが返された")
 		}
@@ -156,7 +156,7 @@ func TestWeightedRandomSelectFunc(t *testing.T) {
 		n := 10000
 		got := make([]string, n)
 		for i := range n {
-			v, err := game.WeightedRandomSelectFunc(policy, "プレイヤー", rng)
+			v, err := game.WeightedRandomSelectFunc(policy, "プレイヤー", 0, rng)
 			if err != nil {
 				t.Fatalf("予期せぬエラー: %v", err)
 			}
@@ -175,9 +175,284 @@ func TestWeightedRandomSelectFunc(t *testing.T) {
 
 	t.Run("異常_空のpolicy", func(t *testing.T) {
 		policy := game.Policy[string]{}
-		_, err := game.WeightedRandomSelectFunc(policy, "プレイヤー", rng)
+		_, err := game.WeightedRandomSelectFunc(policy, "プレイヤー", 0, rng)
 		if err == nil {
 			t.Fatal("エラーを期待したが、nilが返された")
 		}
 	})
 }
+
+// selectRatios は、selectFuncでn回選択した時の、各行動の選択比率を返す。
+func selectRatios(t *testing.T, selectFunc game.SelectFunc[string, string], policy game.Policy[string], stepIdx, n int) map[string]float64 {
+	t.Helper()
+	rng := randx.NewPCG()
+	got := make([]string, n)
+	for i := range n {
+		v, err := selectFunc(policy, "プレイヤー", stepIdx, rng)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		got[i] = v
+	}
+
+	ratios := map[string]float64{}
+	for a, c := range slicesx.Counts(got) {
+		ratios[a] = float64(c) / float64(n)
+	}
+	return ratios
+}
+
+func assertRatios(t *testing.T, got, want map[string]float64) {
+	t.Helper()
+	const eps = 0.03
+	for a, w := range want {
+		if math.Abs(got[a]-w) > eps {
+			t.Errorf("%s の選択比率の不一致: got = %.3f, want = %.3f(±%.3f)", a, got[a], w, eps)
+		}
+	}
+}
+
+func TestNewTemperatureSelectFunc(t *testing.T) {
+	policy := game.Policy[string]{"グー": 0.6, "パー": 0.3, "チョキ": 0.1}
+
+	tests := []struct {
+		name    string
+		tau     float32
+		want    map[string]float64
+		wantErr bool
+	}{
+		{
+			name: "正常_tau=1は重みに比例",
+			tau:  1.0,
+			want: map[string]float64{"グー": 0.6, "パー": 0.3, "チョキ": 0.1},
+		},
+		{
+			// p^2 = 0.36, 0.09, 0.01 → 合計0.46
+			name: "正常_tau=0.5で鋭くなる",
+			tau:  0.5,
+			want: map[string]float64{"グー": 0.36 / 0.46, "パー": 0.09 / 0.46, "チョキ": 0.01 / 0.46},
+		},
+		{
+			name: "正常_小さいtauでもオーバーフローしない",
+			tau:  0.001,
+			want: map[string]float64{"グー": 1.0, "パー": 0.0, "チョキ": 0.0},
+		},
+		{
+			name:    "異常_tau=0",
+			tau:     0.0,
+			wantErr: true,
+		},
+		{
+			name:    "異常_NaN",
+			tau:     float32(math.NaN()),
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := game.NewTemperatureSelectFunc[string, string](tc.tau)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("エラーを期待したが、nilが返された")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			assertRatios(t, selectRatios(t, f, policy, 0, 10000), tc.want)
+		})
+	}
+
+	t.Run("異常_確率が全て0", func(t *testing.T) {
+		f, err := game.NewTemperatureSelectFunc[string, string](1.0)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		_, err = f(game.Policy[string]{"グー": 0.0}, "プレイヤー", 0, randx.NewPCG())
+		if err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestNewTemperatureScheduleSelectFunc(t *testing.T) {
+	policy := game.Policy[string]{"グー": 0.6, "パー": 0.3, "チョキ": 0.1}
+	f, err := game.NewTemperatureScheduleSelectFunc[string, string](1.0, 3)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		stepIdx int
+		want    map[string]float64
+	}{
+		{
+			name:    "正常_切り替え前は重みに比例",
+			stepIdx: 2,
+			want:    map[string]float64{"グー": 0.6, "パー": 0.3, "チョキ": 0.1},
+		},
+		{
+			name:    "正常_切り替え後は最大値",
+			stepIdx: 3,
+			want:    map[string]float64{"グー": 1.0, "パー": 0.0, "チョキ": 0.0},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assertRatios(t, selectRatios(t, f, policy, tc.stepIdx, 10000), tc.want)
+		})
+	}
+
+	t.Run("異常_負のswitchStep", func(t *testing.T) {
+		_, err := game.NewStepSwitchSelectFunc(-1, game.MaxSelectFunc[string, string], game.MaxSelectFunc[string, string])
+		if err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_nilのSelectFunc", func(t *testing.T) {
+		_, err := game.NewStepSwitchSelectFunc(0, nil, game.MaxSelectFunc[string, string])
+		if err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestNewEpsilonGreedySelectFunc(t *testing.T) {
+	policy := game.Policy[string]{"グー": 0.6, "パー": 0.3, "チョキ": 0.1}
+
+	tests := []struct {
+		name    string
+		epsilon float32
+		want    map[string]float64
+		wantErr bool
+	}{
+		{
+			name:    "正常_epsilon=0は最大値",
+			epsilon: 0.0,
+			want:    map[string]float64{"グー": 1.0, "パー": 0.0, "チョキ": 0.0},
+		},
+		{
+			// 0.7 + 0.3/3 = 0.8, 0.3/3 = 0.1
+			name:    "正常_epsilon=0.3",
+			epsilon: 0.3,
+			want:    map[string]float64{"グー": 0.8, "パー": 0.1, "チョキ": 0.1},
+		},
+		{
+			name:    "異常_範囲外",
+			epsilon: 1.5,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := game.NewEpsilonGreedySelectFunc[string, string](tc.epsilon)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("エラーを期待したが、nilが返された")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			assertRatios(t, selectRatios(t, f, policy, 0, 10000), tc.want)
+		})
+	}
+}
+
+func TestNewTopKSelectFunc(t *testing.T) {
+	policy := game.Policy[string]{"グー": 0.5, "パー": 0.3, "チョキ": 0.2}
+
+	tests := []struct {
+		name    string
+		k       int
+		want    map[string]float64
+		wantErr bool
+	}{
+		{
+			name: "正常_k=2",
+			k:    2,
+			want: map[string]float64{"グー": 0.5 / 0.8, "パー": 0.3 / 0.8, "チョキ": 0.0},
+		},
+		{
+			name: "正常_kが行動数より大きい",
+			k:    10,
+			want: map[string]float64{"グー": 0.5, "パー": 0.3, "チョキ": 0.2},
+		},
+		{
+			name:    "異常_k=0",
+			k:       0,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := game.NewTopKSelectFunc[string, string](tc.k)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("エラーを期待したが、nilが返された")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			assertRatios(t, selectRatios(t, f, policy, 0, 10000), tc.want)
+		})
+	}
+}
+
+func TestNewTopPSelectFunc(t *testing.T) {
+	policy := game.Policy[string]{"グー": 0.5, "パー": 0.3, "チョキ": 0.2}
+
+	tests := []struct {
+		name    string
+		p       float32
+		want    map[string]float64
+		wantErr bool
+	}{
+		{
+			name: "正常_p=0.5は先頭のみ",
+			p:    0.5,
+			want: map[string]float64{"グー": 1.0, "パー": 0.0, "チョキ": 0.0},
+		},
+		{
+			name: "正常_p=0.7",
+			p:    0.7,
+			want: map[string]float64{"グー": 0.5 / 0.8, "パー": 0.3 / 0.8, "チョキ": 0.0},
+		},
+		{
+			name: "正常_p=1は全て",
+			p:    1.0,
+			want: map[string]float64{"グー": 0.5, "パー": 0.3, "チョキ": 0.2},
+		},
+		{
+			name:    "異常_p=0",
+			p:       0.0,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := game.NewTopPSelectFunc[string, string](tc.p)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("エラーを期待したが、nilが返された")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			assertRatios(t, selectRatios(t, f, policy, 0, 10000), tc.want)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sw965/omw/slicesx"
+)
+
+// ActionCodec は、行動と、モデルの出力ベクトル上のインデックスを相互に変換する。
+// Sizeは出力ベクトルの長さで、Indexは 0 <= index < Size を返すべき。
+type ActionCodec[Ac comparable] interface {
+	Index(Ac) (int, error)
+	Decode(int) (Ac, error)
+	Size() int
+}
+
+// SliceActionCodec は、行動のスライスの並び順をそのままインデックスとするActionCodec。
+type SliceActionCodec[Ac comparable] struct {
+	actions    []Ac
+	indexByAct map[Ac]int
+}
+
+// NewSliceActionCodec は、actionsの並び順でインデックスを割り当てるSliceActionCodecを返す。
+// actionsには、ゲームに登場し得る全ての行動を重複無く渡すべき。
+func NewSliceActionCodec[Ac comparable](actions []Ac) (*SliceActionCodec[Ac], error) {
+	if len(actions) == 0 {
+		return nil, errors.New("actionsが空です: len(actions) > 0 であるべき")
+	}
+
+	if !slicesx.IsUnique(actions) {
+		return nil, errors.New("actionsが重複しています")
+	}
+
+	indexByAct := make(map[Ac]int, len(actions))
+	for i, a := range actions {
+		indexByAct[a] = i
+	}
+	return &SliceActionCodec[Ac]{actions: append([]Ac(nil), actions...), indexByAct: indexByAct}, nil
+}
+
+func (c *SliceActionCodec[Ac]) Index(a Ac) (int, error) {
+	idx, ok := c.indexByAct[a]
+	if !ok {
+		return 0, fmt.Errorf("codecに存在しない行動: action = %v", a)
+	}
+	return idx, nil
+}
+
+func (c *SliceActionCodec[Ac]) Decode(idx int) (Ac, error) {
+	if idx < 0 || idx >= len(c.actions) {
+		var zero Ac
+		return zero, fmt.Errorf("インデックスが範囲外: index = %d: 0 <= index < %d であるべき", idx, len(c.actions))
+	}
+	return c.actions[idx], nil
+}
+
+func (c *SliceActionCodec[Ac]) Size() int {
+	return len(c.actions)
+}
+
+// EncodePolicy は、policyを正規化し、長さcodec.Size()の密ベクトル(学習のターゲット)に変換する。
+func EncodePolicy[Ac comparable](policy Policy[Ac], codec ActionCodec[Ac]) ([]float32, error) {
+	if codec == nil {
+		return nil, errors.New("codecがnilです")
+	}
+
+	normalized, err := policy.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	return normalized.ToDense(codec.Index, codec.Size())
+}
+
+// DecodePolicy は、モデルの出力ベクトルから合法手の確率を取り出し、正規化したPolicyを返す。
+// 出力ベクトルの長さは、codec.Size()と一致するべき。出力は非負(softmax後等)である事を前提とする。
+func DecodePolicy[Ac comparable](output []float32, legalActions []Ac, codec ActionCodec[Ac]) (Policy[Ac], error) {
+	if codec == nil {
+		return nil, errors.New("codecがnilです")
+	}
+
+	if len(output) != codec.Size() {
+		return nil, fmt.Errorf("出力ベクトルの長さが不一致: len(output) = %d, codec.Size() = %d", len(output), codec.Size())
+	}
+
+	policy, err := NewPolicyFromDense(output, legalActions, codec.Index)
+	if err != nil {
+		return nil, err
+	}
+	return policy.MaskToLegalActions(legalActions)
+}
@@ -0,0 +1,92 @@
+package game_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sw965/crow/game"
+)
+
+func TestSliceActionCodec(t *testing.T) {
+	codec, err := game.NewSliceActionCodec([]string{"グー", "パー", "チョキ"})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if codec.Size() != 3 {
+		t.Errorf("Sizeの不一致: got = %d, want = 3", codec.Size())
+	}
+
+	for i, want := range []string{"グー", "パー", "チョキ"} {
+		idx, err := codec.Index(want)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if idx != i {
+			t.Errorf("Indexの不一致: action = %s, got = %d, want = %d", want, idx, i)
+		}
+
+		got, err := codec.Decode(idx)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if got != want {
+			t.Errorf("Decodeの不一致: got = %s, want = %s", got, want)
+		}
+	}
+
+	t.Run("異常_存在しない行動", func(t *testing.T) {
+		if _, err := codec.Index("ビーム"); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_範囲外のインデックス", func(t *testing.T) {
+		if _, err := codec.Decode(3); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_重複した行動", func(t *testing.T) {
+		if _, err := game.NewSliceActionCodec([]string{"グー", "グー"}); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestEncodeDecodePolicy(t *testing.T) {
+	codec, err := game.NewSliceActionCodec([]string{"グー", "パー", "チョキ"})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	t.Run("正常_EncodePolicyは正規化する", func(t *testing.T) {
+		got, err := game.EncodePolicy(game.Policy[string]{"グー": 3.0, "チョキ": 1.0}, codec)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		want := []float32{0.75, 0.0, 0.25}
+		for i := range want {
+			if math.Abs(float64(got[i]-want[i])) > 1e-6 {
+				t.Fatalf("got = %v, want = %v", got, want)
+			}
+		}
+	})
+
+	t.Run("正常_DecodePolicyは合法手でマスクする", func(t *testing.T) {
+		got, err := game.DecodePolicy([]float32{0.5, 0.3, 0.2}, []string{"パー", "チョキ"}, codec)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		want := game.Policy[string]{"パー": 0.6, "チョキ": 0.4}
+		if !equalPolicies(got, want, 1e-6) {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+	})
+
+	t.Run("異常_出力ベクトルの長さの不一致", func(t *testing.T) {
+		if _, err := game.DecodePolicy([]float32{0.5, 0.5}, []string{"グー"}, codec); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
@@ -2,7 +2,13 @@ package game
 
 import (
 	"errors"
+	"fmt"
 	"maps"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/sw965/omw/mathx/randx"
+	"github.com/sw965/omw/slicesx"
 )
 
 // PlayPermutationFunc は、ActorCriticの並び(permIdx番目)1組分の全対局を実行し、
@@ -53,6 +59,54 @@ func NewCrossPlayoutRecorder[R any, Ag comparable](
 	}
 }
 
+// PlayAssignmentFunc は、agents[i] に accrPerm[i] を割り当てた1組分の全対局を、rngs のワーカー数で並列に実行し、全試合の記録を返す。
+// accrNameByAgent は、その割り当てでの「エージェント→ActorCritic名」の対応で、記録に残す為に渡す。
+type PlayAssignmentFunc[A, R any, Ag comparable] func(accrPerm []A, accrNameByAgent map[Ag]ActorCriticName, rngs []*rand.Rand, initStepsCap int) ([]R, error)
+
+// NewPermutationCrossPlayoutRecorder は、accrs から len(agents) 個を選ぶ全ての並びを agents に割り当てて対戦させる、
+// CrossPlayoutRecorder を返す。nameFunc は、ActorCritic の名前を返す。numInits は1組あたりの対局数、p はワーカー数。
+// 逐次手番・同時手番の各 Engine は、割り当て1組分の対戦の実行方法だけを playFunc で渡す。
+func NewPermutationCrossPlayoutRecorder[A, R any, Ag comparable](
+	agents []Ag,
+	accrs []A,
+	nameFunc func(A) ActorCriticName,
+	numInits, p int,
+	playFunc PlayAssignmentFunc[A, R, Ag],
+	resultScoreFromRecordFunc ResultScoreFromRecordFunc[R, Ag],
+) (*CrossPlayoutRecorder[R, Ag], error) {
+	agentsN := len(agents)
+	if len(accrs) < agentsN {
+		return nil, fmt.Errorf("ActorCriticが不足しています: len(accrs) = %d: %d 以上であるべき", len(accrs), agentsN)
+	}
+
+	rngs, err := randx.NewPCGs(p)
+	if err != nil {
+		return nil, err
+	}
+
+	accrPerms := slices.Collect(slicesx.Permutations(accrs, agentsN))
+	accrNames := make([]ActorCriticName, len(accrs))
+	for i, accr := range accrs {
+		accrNames[i] = nameFunc(accr)
+	}
+
+	playPermutationFunc := func(permIdx, initStepsCap int) ([]R, map[Ag]ActorCriticName, error) {
+		accrPerm := accrPerms[permIdx]
+		accrNameByAgent := make(map[Ag]ActorCriticName, agentsN)
+		for i, agent := range agents {
+			accrNameByAgent[agent] = nameFunc(accrPerm[i])
+		}
+
+		records, err := playFunc(accrPerm, accrNameByAgent, rngs, initStepsCap)
+		if err != nil {
+			return nil, nil, err
+		}
+		return records, accrNameByAgent, nil
+	}
+
+	return NewCrossPlayoutRecorder(accrNames, len(accrPerms), numInits, playPermutationFunc, resultScoreFromRecordFunc), nil
+}
+
 func (cp *CrossPlayoutRecorder[R, Ag]) NumGames() int {
 	return cp.numGames
 }
@@ -0,0 +1,62 @@
+package game
+
+import (
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/sw965/omw/parallel"
+)
+
+// IsTerminalFunc は、状態が終局しているかを返す。
+type IsTerminalFunc[S any] func(S) (bool, error)
+
+// PlayoutStepFunc は、1局のプレイアウトを1手進め、次の状態を返す。
+// stop が true の場合、返した状態を最終状態として対局を打ち切る(投了など)。
+type PlayoutStepFunc[S any] func(state S, stepIdx int) (next S, stop bool, err error)
+
+// NewPlayoutStepFunc は、gameIdx 番目の対局の PlayoutStepFunc を返す。
+// 対局毎の状態(記録中のステップ等)は、返す関数に持たせる。rng はその対局を担当するワーカーの乱数。
+type NewPlayoutStepFunc[S any] func(gameIdx int, rng *rand.Rand) PlayoutStepFunc[S]
+
+// RunPlayouts は、逐次手番・同時手番に共通するプレイアウトの進行を担う。
+// inits の各状態から、終局するまで PlayoutStepFunc で1手ずつ進め、各対局の最終状態を返す。
+// 対局は len(rngs) 個のワーカーで並列に進め、各ワーカーは自分の rng だけを使う。
+// maxSteps > 0 の場合、その手数に達しても終局しなければエラーを返す。
+func RunPlayouts[S any](inits []S, rngs []*rand.Rand, maxSteps int, isTerminalFunc IsTerminalFunc[S], newStepFunc NewPlayoutStepFunc[S]) ([]S, error) {
+	if maxSteps < 0 {
+		return nil, fmt.Errorf("maxStepsが不正: maxSteps = %d: maxSteps >= 0 であるべき", maxSteps)
+	}
+
+	finals := make([]S, len(inits))
+	err := parallel.For(len(inits), len(rngs), func(workerID, idx int) error {
+		stepFunc := newStepFunc(idx, rngs[workerID])
+		state := inits[idx]
+		for stepIdx := 0; ; stepIdx++ {
+			isEnd, err := isTerminalFunc(state)
+			if err != nil {
+				return err
+			}
+
+			if isEnd {
+				break
+			}
+
+			if maxSteps > 0 && stepIdx >= maxSteps {
+				return fmt.Errorf("手数がMaxSteps(%d)に達してもゲームが終了しませんでした", maxSteps)
+			}
+
+			next, stop, err := stepFunc(state, stepIdx)
+			if err != nil {
+				return err
+			}
+
+			state = next
+			if stop {
+				break
+			}
+		}
+		finals[idx] = state
+		return nil
+	})
+	return finals, err
+}
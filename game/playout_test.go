@@ -0,0 +1,55 @@
+package game_test
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/omw/mathx/randx"
+)
+
+// countdownIsTerminal は、1手毎に1減る状態を、0 以下で終局とする。
+func countdownIsTerminal(s int) (bool, error) {
+	return s <= 0, nil
+}
+
+func TestRunPlayouts(t *testing.T) {
+	rngs, err := randx.NewPCGs(2)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	inits := []int{0, 3, 5}
+	stepsByGame := make([]int, len(inits))
+	newStepFunc := func(gameIdx int, rng *rand.Rand) game.PlayoutStepFunc[int] {
+		return func(s, stepIdx int) (int, bool, error) {
+			stepsByGame[gameIdx] = stepIdx + 1
+			// 5 から始めた対局は、2手目で打ち切る
+			return s - 1, inits[gameIdx] == 5 && stepIdx == 1, nil
+		}
+	}
+
+	finals, err := game.RunPlayouts(inits, rngs, 0, countdownIsTerminal, newStepFunc)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if want := []int{0, 0, 3}; finals[0] != want[0] || finals[1] != want[1] || finals[2] != want[2] {
+		t.Errorf("最終状態の不一致: got = %v, want = %v", finals, want)
+	}
+	if want := []int{0, 3, 2}; stepsByGame[0] != want[0] || stepsByGame[1] != want[1] || stepsByGame[2] != want[2] {
+		t.Errorf("手数の不一致: got = %v, want = %v", stepsByGame, want)
+	}
+
+	t.Run("異常_maxStepsに達する", func(t *testing.T) {
+		if _, err := game.RunPlayouts(inits, rngs, 2, countdownIsTerminal, newStepFunc); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_maxStepsが負", func(t *testing.T) {
+		if _, err := game.RunPlayouts(inits, rngs, -1, countdownIsTerminal, newStepFunc); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Sum は、policyの確率の合計を返す。
+func (p Policy[Ac]) Sum() float32 {
+	var sum float32
+	for _, v := range p {
+		sum += v
+	}
+	return sum
+}
+
+// Normalize は、確率の合計が1になる様に正規化したPolicyを返す。
+// 負/NaN/Infの確率を含む場合、または合計が0の場合はエラーを返す。
+func (p Policy[Ac]) Normalize() (Policy[Ac], error) {
+	var sum float32
+	for a, v := range p {
+		if v < 0 || math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return nil, fmt.Errorf("確率が不正(負/NaN/Inf): action = %v, p = %f", a, v)
+		}
+		sum += v
+	}
+
+	if sum == 0 {
+		return nil, errors.New("policyの確率の合計が0です: 合計は正であるべき")
+	}
+
+	normalized := make(Policy[Ac], len(p))
+	for a, v := range p {
+		normalized[a] = v / sum
+	}
+	return normalized, nil
+}
+
+// Entropy は、policyのエントロピー -Σ p log p を返す(自然対数)。
+// 確率が0の行動は無視する。policyは正規化されている事を前提とする。
+func (p Policy[Ac]) Entropy() float32 {
+	var h float64
+	for _, v := range p {
+		if v > 0 {
+			h -= float64(v) * math.Log(float64(v))
+		}
+	}
+	return float32(h)
+}
+
+// TopK は、確率の大きい上位k個の行動のみを残したPolicyを返す。正規化はしない。
+// 確率が同じ行動の順序は不定。
+func (p Policy[Ac]) TopK(k int) (Policy[Ac], error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("kが不正: k = %d: k > 0 であるべき", k)
+	}
+
+	actions := sortedByProbability(p)
+	top := make(Policy[Ac], min(k, len(actions)))
+	for _, a := range actions[:min(k, len(actions))] {
+		top[a] = p[a]
+	}
+	return top, nil
+}
+
+// MaskToLegalActions は、合法手のみを残し、正規化したPolicyを返す。
+// policyに存在しない合法手の確率は0とする。合法手の確率の合計が0の場合はエラーを返す。
+func (p Policy[Ac]) MaskToLegalActions(legalActions []Ac) (Policy[Ac], error) {
+	if len(legalActions) == 0 {
+		return nil, errors.New("legalActionsが空です: len(legalActions) > 0 であるべき")
+	}
+
+	masked := make(Policy[Ac], len(legalActions))
+	for _, a := range legalActions {
+		masked[a] = p[a]
+	}
+	return masked.Normalize()
+}
+
+// ActionIndexFunc は、行動を密ベクトル上のインデックスに写す。
+type ActionIndexFunc[Ac comparable] func(Ac) (int, error)
+
+// ToDense は、policyを長さsizeの密ベクトルに変換する。policyに無い行動の要素は0になる。
+func (p Policy[Ac]) ToDense(indexFunc ActionIndexFunc[Ac], size int) ([]float32, error) {
+	if indexFunc == nil {
+		return nil, errors.New("indexFuncがnilです")
+	}
+
+	dense := make([]float32, size)
+	for a, v := range p {
+		idx, err := indexFunc(a)
+		if err != nil {
+			return nil, err
+		}
+
+		if idx < 0 || idx >= size {
+			return nil, fmt.Errorf("インデックスが範囲外: action = %v, index = %d: 0 <= index < %d であるべき", a, idx, size)
+		}
+		dense[idx] = v
+	}
+	return dense, nil
+}
+
+// NewPolicyFromDense は、密ベクトルから、actionsの各行動の確率を取り出したPolicyを返す。正規化はしない。
+// actionsに合法手を渡せば、合法手以外の出力を捨てる事が出来る。
+func NewPolicyFromDense[Ac comparable](dense []float32, actions []Ac, indexFunc ActionIndexFunc[Ac]) (Policy[Ac], error) {
+	if indexFunc == nil {
+		return nil, errors.New("indexFuncがnilです")
+	}
+
+	p := make(Policy[Ac], len(actions))
+	for _, a := range actions {
+		idx, err := indexFunc(a)
+		if err != nil {
+			return nil, err
+		}
+
+		if idx < 0 || idx >= len(dense) {
+			return nil, fmt.Errorf("インデックスが範囲外: action = %v, index = %d: 0 <= index < %d であるべき", a, idx, len(dense))
+		}
+		p[a] = dense[idx]
+	}
+	return p, nil
+}
+
+// MixPolicies は、lambda・p + (1-lambda)・q を返す。片方にしか無い行動の確率は、もう片方で0として扱う。
+// 探索結果と事前分布の混合や、ディリクレノイズの付加等に使う。
+func MixPolicies[Ac comparable](p, q Policy[Ac], lambda float32) (Policy[Ac], error) {
+	if lambda < 0 || lambda > 1 || math.IsNaN(float64(lambda)) {
+		return nil, fmt.Errorf("lambdaが不正: lambda = %g: 0 <= lambda <= 1 であるべき", lambda)
+	}
+
+	mixed := make(Policy[Ac], max(len(p), len(q)))
+	for a, v := range p {
+		mixed[a] += lambda * v
+	}
+	for a, v := range q {
+		mixed[a] += (1.0 - lambda) * v
+	}
+	return mixed, nil
+}
+
+// CrossEntropy は、targetに対するpのクロスエントロピー -Σ target log p を返す(自然対数)。
+// targetが正でpが0の行動がある場合は+Infを返す。
+func CrossEntropy[Ac comparable](target, p Policy[Ac]) float32 {
+	var ce float64
+	for a, t := range target {
+		if t <= 0 {
+			continue
+		}
+
+		v := p[a]
+		if v <= 0 {
+			return float32(math.Inf(1))
+		}
+		ce -= float64(t) * math.Log(float64(v))
+	}
+	return float32(ce)
+}
+
+// KLDivergence は、KL(p || q) = Σ p log(p/q) を返す(自然対数)。
+// pが正でqが0の行動がある場合は+Infを返す。
+func KLDivergence[Ac comparable](p, q Policy[Ac]) float32 {
+	var kl float64
+	for a, v := range p {
+		if v <= 0 {
+			continue
+		}
+
+		w := q[a]
+		if w <= 0 {
+			return float32(math.Inf(1))
+		}
+		kl += float64(v) * math.Log(float64(v)/float64(w))
+	}
+	return float32(kl)
+}
+
+// JSDivergence は、Jensen-Shannonダイバージェンス(自然対数)を返す。
+// 対称で、0 <= JS <= log 2 の範囲に収まる為、探索結果の変化の診断に使いやすい。
+func JSDivergence[Ac comparable](p, q Policy[Ac]) float32 {
+	// 0.5・p + 0.5・q の混合なので、エラーにはならない
+	m, _ := MixPolicies(p, q, 0.5)
+	return 0.5*KLDivergence(p, m) + 0.5*KLDivergence(q, m)
+}
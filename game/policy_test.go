@@ -0,0 +1,201 @@
+package game_test
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"testing"
+
+	"github.com/sw965/crow/game"
+)
+
+func equalPolicies(p, q game.Policy[string], eps float64) bool {
+	if len(p) != len(q) {
+		return false
+	}
+	for a, v := range p {
+		w, ok := q[a]
+		if !ok || math.Abs(float64(v-w)) > eps {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPolicyNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  game.Policy[string]
+		want    game.Policy[string]
+		wantErr bool
+	}{
+		{
+			name:   "正常",
+			policy: game.Policy[string]{"グー": 2.0, "パー": 1.0, "チョキ": 1.0},
+			want:   game.Policy[string]{"グー": 0.5, "パー": 0.25, "チョキ": 0.25},
+		},
+		{
+			name:    "異常_合計が0",
+			policy:  game.Policy[string]{"グー": 0.0},
+			wantErr: true,
+		},
+		{
+			name:    "異常_負の確率",
+			policy:  game.Policy[string]{"グー": 1.0, "パー": -0.5},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.policy.Normalize()
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("エラーを期待したが、nilが返された")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if !equalPolicies(got, tc.want, 1e-6) {
+				t.Errorf("got = %v, want = %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPolicyTopKAndMask(t *testing.T) {
+	policy := game.Policy[string]{"グー": 0.5, "パー": 0.3, "チョキ": 0.2}
+
+	t.Run("正常_TopK", func(t *testing.T) {
+		got, err := policy.TopK(2)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		want := game.Policy[string]{"グー": 0.5, "パー": 0.3}
+		if !maps.Equal(got, want) {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+	})
+
+	t.Run("異常_TopKのk=0", func(t *testing.T) {
+		if _, err := policy.TopK(0); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("正常_MaskToLegalActions", func(t *testing.T) {
+		got, err := policy.MaskToLegalActions([]string{"パー", "チョキ", "ビーム"})
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		want := game.Policy[string]{"パー": 0.6, "チョキ": 0.4, "ビーム": 0.0}
+		if !equalPolicies(got, want, 1e-6) {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+	})
+
+	t.Run("異常_MaskToLegalActionsで合計が0", func(t *testing.T) {
+		if _, err := policy.MaskToLegalActions([]string{"ビーム"}); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestPolicyDense(t *testing.T) {
+	actions := []string{"グー", "パー", "チョキ"}
+	indexFunc := func(a string) (int, error) {
+		for i, v := range actions {
+			if v == a {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("不明な行動: %s", a)
+	}
+
+	policy := game.Policy[string]{"グー": 0.7, "チョキ": 0.3}
+	dense, err := policy.ToDense(indexFunc, len(actions))
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	want := []float32{0.7, 0.0, 0.3}
+	for i := range want {
+		if dense[i] != want[i] {
+			t.Fatalf("dense = %v, want = %v", dense, want)
+		}
+	}
+
+	got, err := game.NewPolicyFromDense(dense, []string{"グー", "チョキ"}, indexFunc)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if !maps.Equal(got, policy) {
+		t.Errorf("往復の不一致: got = %v, want = %v", got, policy)
+	}
+
+	t.Run("異常_範囲外のインデックス", func(t *testing.T) {
+		if _, err := policy.ToDense(indexFunc, 2); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_不明な行動", func(t *testing.T) {
+		if _, err := (game.Policy[string]{"ビーム": 1.0}).ToDense(indexFunc, 3); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestPolicyDivergences(t *testing.T) {
+	p := game.Policy[string]{"表": 0.5, "裏": 0.5}
+	q := game.Policy[string]{"表": 0.9, "裏": 0.1}
+	d := game.Policy[string]{"表": 1.0}
+	const eps = 1e-5
+
+	tests := []struct {
+		name string
+		got  float32
+		want float64
+	}{
+		{name: "正常_一様分布のエントロピー", got: p.Entropy(), want: math.Log(2)},
+		{name: "正常_決定的な分布のエントロピー", got: d.Entropy(), want: 0.0},
+		{name: "正常_同じ分布のKL", got: game.KLDivergence(p, p), want: 0.0},
+		{name: "正常_KL", got: game.KLDivergence(p, q), want: 0.5*math.Log(0.5/0.9) + 0.5*math.Log(0.5/0.1)},
+		{name: "正常_クロスエントロピー", got: game.CrossEntropy(p, q), want: -0.5*math.Log(0.9) - 0.5*math.Log(0.1)},
+		{name: "正常_JSは最大でlog2", got: game.JSDivergence(d, game.Policy[string]{"裏": 1.0}), want: math.Log(2)},
+		{name: "正常_同じ分布のJS", got: game.JSDivergence(q, q), want: 0.0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if math.Abs(float64(tc.got)-tc.want) > eps {
+				t.Errorf("got = %f, want = %f", tc.got, tc.want)
+			}
+		})
+	}
+
+	t.Run("準正常_サポート外のKLはInf", func(t *testing.T) {
+		if got := game.KLDivergence(p, d); !math.IsInf(float64(got), 1) {
+			t.Errorf("got = %f, want = +Inf", got)
+		}
+	})
+
+	t.Run("正常_MixPolicies", func(t *testing.T) {
+		got, err := game.MixPolicies(d, p, 0.5)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		want := game.Policy[string]{"表": 0.75, "裏": 0.25}
+		if !equalPolicies(got, want, 1e-6) {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+	})
+
+	t.Run("異常_MixPoliciesのlambdaが範囲外", func(t *testing.T) {
+		if _, err := game.MixPolicies(p, q, 1.5); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package game
+
+import (
+	"fmt"
+)
+
+// RewardByAgent は、1回の遷移で各エージェントが得た報酬。
+// 報酬の無いエージェントは、キーを省略してよい(0として扱う)。
+type RewardByAgent[Ag comparable] map[Ag]float32
+
+// Trajectory は、1試合分の記録を、1エージェントの手番の系列として見たもの。
+// 価値のターゲット(n-stepリターン、TD(λ)リターン等)の計算に使う。
+// Rewards, Discounts, Values の長さは、そのエージェントの手番の数と一致するべき。
+type Trajectory struct {
+	// Rewards[j] は、j番目の手番から、次の手番の直前まで(最後の手番はゲーム終了まで)に得た報酬を、
+	// j番目の手番の時点まで割り引いた合計。
+	Rewards []float32
+	// Discounts[j] は、j番目の手番から、次の手番(最後の手番はゲーム終了)までの割引率。
+	// 経過した手数をkとすると、γ^k になる。
+	Discounts []float32
+	// Values[j] は、j番目の手番での探索値(ブートストラップに使う)。
+	Values []float32
+	// Outcome は、ゲーム終了時の結果スコア。
+	Outcome float32
+}
+
+// TrajectoryStepFunc は、記録の i 番目のステップを、1体のエージェントから見た値を返す。
+// acting は、そのエージェントがそのステップで行動したか。reward は、そのステップの遷移で得た報酬。
+// value は、行動したステップでの探索値で、行動しなかったステップでは使わない。
+type TrajectoryStepFunc func(i int) (acting bool, reward, value float32)
+
+// NewTrajectory は、n ステップの記録から、1体のエージェントが行動したステップの系列を Trajectory として返す。
+// 2つ目の返り値は、系列の各手番に対応するステップのインデックス。
+// 報酬は、行動しなかったステップで得たものも含め、次に行動するステップまでの分をまとめて割り引く。
+// gamma は [0, 1] にクリッピングする。
+func NewTrajectory(n int, stepFunc TrajectoryStepFunc, outcome, gamma float32) (Trajectory, []int) {
+	gamma = clipUnit(gamma)
+
+	idxs := make([]int, 0, n)
+	rewards := make([]float32, n)
+	values := make([]float32, n)
+	for i := range n {
+		acting, reward, value := stepFunc(i)
+		if acting {
+			idxs = append(idxs, i)
+		}
+		rewards[i] = reward
+		values[i] = value
+	}
+
+	m := len(idxs)
+	traj := Trajectory{
+		Rewards:   make([]float32, m),
+		Discounts: make([]float32, m),
+		Values:    make([]float32, m),
+		Outcome:   outcome,
+	}
+
+	for j, idx := range idxs {
+		end := n
+		if j+1 < m {
+			end = idxs[j+1]
+		}
+
+		var reward float32
+		var discount float32 = 1.0
+		for k := idx; k < end; k++ {
+			reward += discount * rewards[k]
+			discount *= gamma
+		}
+
+		traj.Rewards[j] = reward
+		traj.Discounts[j] = discount
+		traj.Values[j] = values[idx]
+	}
+	return traj, idxs
+}
+
+// ElmoValue は、結果スコア z と探索値 v を alpha * z + (1 - alpha) * v でブレンドした、価値のターゲットを返す。
+// alpha は [0, 1] にクリッピングする。
+func ElmoValue(alpha, z, v float32) float32 {
+	alpha = clipUnit(alpha)
+	return alpha*z + (1.0-alpha)*v
+}
+
+// clipUnit は、x を [0, 1] にクリッピングする。
+func clipUnit(x float32) float32 {
+	if x < 0.0 {
+		return 0.0
+	} else if x > 1.0 {
+		return 1.0
+	}
+	return x
+}
+
+func (t Trajectory) Validate() error {
+	n := len(t.Values)
+	if len(t.Rewards) != n || len(t.Discounts) != n {
+		return fmt.Errorf("長さが不一致: len(Rewards) = %d, len(Discounts) = %d, len(Values) = %d", len(t.Rewards), len(t.Discounts), n)
+	}
+	return nil
+}
+
+// value は、j番目の手番の探索値を返す。系列の終端(j == len(Values))では、結果スコアを返す。
+func (t Trajectory) value(j int) float32 {
+	if j >= len(t.Values) {
+		return t.Outcome
+	}
+	return t.Values[j]
+}
+
+// NStepReturns は、各手番のn-stepリターンを返す。
+// nは、このエージェント自身の手番の数で数える。n手先の手番の探索値でブートストラップし、
+// n手先がゲーム終了後になる場合は、結果スコアを使う。
+func (t Trajectory) NStepReturns(n int) ([]float32, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+
+	if n <= 0 {
+		return nil, fmt.Errorf("nが不正: n = %d: n > 0 であるべき", n)
+	}
+
+	m := len(t.Values)
+	returns := make([]float32, m)
+	for j := range m {
+		end := min(j+n, m)
+		var g float32
+		var discount float32 = 1.0
+		for k := j; k < end; k++ {
+			g += discount * t.Rewards[k]
+			discount *= t.Discounts[k]
+		}
+		returns[j] = g + discount*t.value(end)
+	}
+	return returns, nil
+}
+
+// LambdaReturns は、各手番のTD(λ)リターンを返す。
+// λ = 0 で1-stepリターン、λ = 1 で割引された結果スコア(モンテカルロリターン)に一致する。
+// 範囲外のλはクリッピングする。
+func (t Trajectory) LambdaReturns(lambda float32) ([]float32, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+
+	if lambda < 0.0 {
+		lambda = 0.0
+	} else if lambda > 1.0 {
+		lambda = 1.0
+	}
+
+	m := len(t.Values)
+	returns := make([]float32, m)
+	// 終端から再帰的に計算する: G_j = R_j + D_j * ((1-λ)*V_{j+1} + λ*G_{j+1})
+	g := t.Outcome
+	for j := m - 1; j >= 0; j-- {
+		next := (1.0-lambda)*t.value(j+1) + lambda*g
+		g = t.Rewards[j] + t.Discounts[j]*next
+		returns[j] = g
+	}
+	return returns, nil
+}
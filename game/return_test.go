@@ -0,0 +1,127 @@
+package game_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sw965/crow/game"
+)
+
+func TestTrajectoryReturns(t *testing.T) {
+	// 2回の手番を持つ系列
+	traj := game.Trajectory{
+		Rewards:   []float32{1.0, 0.0},
+		Discounts: []float32{0.25, 0.25},
+		Values:    []float32{0.1, 0.3},
+		Outcome:   1.0,
+	}
+
+	tests := []struct {
+		name        string
+		returnsFunc func() ([]float32, error)
+		want        []float32
+	}{
+		// G_0 = R_0 + D_0 * V_1, G_1 = R_1 + D_1 * Outcome
+		{name: "正常_1-step", returnsFunc: func() ([]float32, error) { return traj.NStepReturns(1) }, want: []float32{1.075, 0.25}},
+		// nが系列より長い場合は、結果スコアまで割り引いた合計
+		{name: "正常_n-stepが系列より長い", returnsFunc: func() ([]float32, error) { return traj.NStepReturns(5) }, want: []float32{1.0625, 0.25}},
+		{name: "正常_λ=0は1-stepと一致", returnsFunc: func() ([]float32, error) { return traj.LambdaReturns(0.0) }, want: []float32{1.075, 0.25}},
+		{name: "正常_λ=1はモンテカルロリターンと一致", returnsFunc: func() ([]float32, error) { return traj.LambdaReturns(1.0) }, want: []float32{1.0625, 0.25}},
+		// G_0 = R_0 + D_0 * (0.5*V_1 + 0.5*G_1)
+		{name: "正常_λ=0.5", returnsFunc: func() ([]float32, error) { return traj.LambdaReturns(0.5) }, want: []float32{1.06875, 0.25}},
+		{name: "準正常_λが1超過", returnsFunc: func() ([]float32, error) { return traj.LambdaReturns(2.0) }, want: []float32{1.0625, 0.25}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.returnsFunc()
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("長さの不一致: got = %d, want = %d", len(got), len(tc.want))
+			}
+			for i := range got {
+				if math.Abs(float64(got[i]-tc.want[i])) > 0.0001 {
+					t.Errorf("returns[%d]の不一致: got = %f, want = %f", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+
+	t.Run("異常_nが0", func(t *testing.T) {
+		if _, err := traj.NStepReturns(0); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_長さが不一致", func(t *testing.T) {
+		invalid := game.Trajectory{Rewards: []float32{0.0}, Discounts: []float32{1.0}}
+		if _, err := invalid.LambdaReturns(0.5); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestNewTrajectory(t *testing.T) {
+	// 4ステップの記録で、エージェントはステップ0と2で行動する。報酬は全てのステップで1
+	acting := []bool{true, false, true, false}
+	values := []float32{0.1, 0.9, 0.3, 0.9}
+	stepFunc := func(i int) (bool, float32, float32) {
+		return acting[i], 1.0, values[i]
+	}
+
+	traj, idxs := game.NewTrajectory(len(acting), stepFunc, 1.0, 0.5)
+	wantIdxs := []int{0, 2}
+	want := game.Trajectory{
+		// 次の手番までの2ステップ分の報酬を割り引いた合計: 1 + 0.5 * 1
+		Rewards:   []float32{1.5, 1.5},
+		Discounts: []float32{0.25, 0.25},
+		Values:    []float32{0.1, 0.3},
+		Outcome:   1.0,
+	}
+
+	if len(idxs) != len(wantIdxs) || idxs[0] != wantIdxs[0] || idxs[1] != wantIdxs[1] {
+		t.Fatalf("インデックスの不一致: got = %v, want = %v", idxs, wantIdxs)
+	}
+
+	for j := range wantIdxs {
+		if math.Abs(float64(traj.Rewards[j]-want.Rewards[j])) > 0.0001 ||
+			math.Abs(float64(traj.Discounts[j]-want.Discounts[j])) > 0.0001 ||
+			traj.Values[j] != want.Values[j] {
+			t.Errorf("手番 %d の不一致: got = %+v, want = %+v", j, traj, want)
+		}
+	}
+
+	if traj.Outcome != want.Outcome {
+		t.Errorf("結果スコアの不一致: got = %f, want = %f", traj.Outcome, want.Outcome)
+	}
+
+	t.Run("準正常_gammaが1超過", func(t *testing.T) {
+		traj, _ := game.NewTrajectory(len(acting), stepFunc, 1.0, 2.0)
+		if traj.Discounts[0] != 1.0 {
+			t.Errorf("割引率がクリッピングされていない: got = %f, want = 1.0", traj.Discounts[0])
+		}
+	})
+}
+
+func TestElmoValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		alpha float32
+		want  float32
+	}{
+		{name: "正常_alpha=0.5", alpha: 0.5, want: 0.6},
+		{name: "準正常_alphaが負", alpha: -1.0, want: 0.2},
+		{name: "準正常_alphaが1超過", alpha: 2.0, want: 1.0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := game.ElmoValue(tc.alpha, 1.0, 0.2)
+			if math.Abs(float64(got-tc.want)) > 0.0001 {
+				t.Errorf("値の不一致: got = %f, want = %f", got, tc.want)
+			}
+		})
+	}
+}
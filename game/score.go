@@ -2,6 +2,7 @@ package game
 
 import (
 	"fmt"
+	"math"
 	"sort"
 )
 
@@ -100,3 +101,113 @@ func StandardResultScoreByAgentFunc[Ag comparable](ranks RankByAgent[Ag]) (Resul
 	}
 	return scores, nil
 }
+
+// PointByAgent は、得点制のゲームにおける、各エージェントの得点。
+type PointByAgent[Ag comparable] map[Ag]float32
+type PointByAgentFunc[S any, Ag comparable] func(S) (PointByAgent[Ag], error)
+
+// PointResultScoreByAgentFunc は、順位に加えて得点も使い、結果スコアを計算する。
+// 勝敗だけでなく、得点差(勝ち方の大きさ)を結果スコアに反映したい場合に使う。
+type PointResultScoreByAgentFunc[Ag comparable] func(RankByAgent[Ag], PointByAgent[Ag]) (ResultScoreByAgent[Ag], error)
+
+// EvaluateResultScoreByAgent は、state の順位から結果スコアを計算する。逐次手番・同時手番の各 Engine が共通で使う。
+// pointResultScoreFunc が nil でない場合は resultScoreFunc の代わりに使い、順位と pointFunc の得点から計算する。
+// 関数が nil でない事は、呼び出し側の Engine.Validate で確認済みである事を前提とする。
+func EvaluateResultScoreByAgent[S any, Ag comparable](
+	state S,
+	rankFunc RankByAgentFunc[S, Ag],
+	resultScoreFunc ResultScoreByAgentFunc[Ag],
+	pointFunc PointByAgentFunc[S, Ag],
+	pointResultScoreFunc PointResultScoreByAgentFunc[Ag],
+) (ResultScoreByAgent[Ag], error) {
+	rankByAgent, err := rankFunc(state)
+	if err != nil {
+		return nil, err
+	}
+
+	if pointResultScoreFunc != nil {
+		points, err := pointFunc(state)
+		if err != nil {
+			return nil, err
+		}
+		return pointResultScoreFunc(rankByAgent, points)
+	}
+	return resultScoreFunc(rankByAgent)
+}
+
+// normalizedPointDifferences は、各エージェントの得点と、他のエージェントの平均得点との差を、
+// scaleで [0, 1] に正規化した値を返す。差が0なら0.5、+scale以上なら1、-scale以下なら0。
+// エージェントが1体の場合、他のエージェントの平均得点は0とする。
+func normalizedPointDifferences[Ag comparable](ranks RankByAgent[Ag], points PointByAgent[Ag], scale float32) (ResultScoreByAgent[Ag], error) {
+	if len(points) != len(ranks) {
+		return nil, fmt.Errorf("rankとpointのエージェント数が不一致: len(ranks) = %d, len(points) = %d", len(ranks), len(points))
+	}
+
+	var sum float32
+	for agent := range ranks {
+		p, ok := points[agent]
+		if !ok {
+			return nil, fmt.Errorf("エージェントの得点が存在しません: agent = %v", agent)
+		}
+		sum += p
+	}
+
+	n := len(points)
+	diffs := ResultScoreByAgent[Ag]{}
+	for agent, p := range points {
+		var othersMean float32
+		if n > 1 {
+			othersMean = (sum - p) / float32(n-1)
+		}
+		d := 0.5 + (p-othersMean)/(2.0*scale)
+		diffs[agent] = max(0.0, min(d, 1.0))
+	}
+	return diffs, nil
+}
+
+// NewPointDifferenceResultScoreByAgentFunc は、得点差を正規化した値を結果スコアとする関数を返す。
+// 各エージェントの結果スコアは、他のエージェントの平均得点との差を scale で [0, 1] に写した値(差が0なら0.5)。
+// 順位は、ゲームが終了しているかの確認にだけ使う。
+func NewPointDifferenceResultScoreByAgentFunc[Ag comparable](scale float32) (PointResultScoreByAgentFunc[Ag], error) {
+	if scale <= 0 || math.IsNaN(float64(scale)) || math.IsInf(float64(scale), 0) {
+		return nil, fmt.Errorf("scaleが不正(<=0/NaN/Inf): scale = %g", scale)
+	}
+
+	return func(ranks RankByAgent[Ag], points PointByAgent[Ag]) (ResultScoreByAgent[Ag], error) {
+		if err := ranks.Validate(); err != nil {
+			return nil, err
+		}
+		return normalizedPointDifferences(ranks, points, scale)
+	}, nil
+}
+
+// NewMarginBonusResultScoreByAgentFunc は、勝敗(StandardResultScoreByAgentFunc)の結果スコアに、
+// 得点差のボーナスを混ぜた値を結果スコアとする関数を返す。
+// 結果スコアは (1-bonusWeight)*勝敗のスコア + bonusWeight*正規化した得点差 で、[0, 1] に収まる。
+func NewMarginBonusResultScoreByAgentFunc[Ag comparable](scale, bonusWeight float32) (PointResultScoreByAgentFunc[Ag], error) {
+	if scale <= 0 || math.IsNaN(float64(scale)) || math.IsInf(float64(scale), 0) {
+		return nil, fmt.Errorf("scaleが不正(<=0/NaN/Inf): scale = %g", scale)
+	}
+
+	if bonusWeight < 0 || bonusWeight > 1 || math.IsNaN(float64(bonusWeight)) {
+		return nil, fmt.Errorf("bonusWeightが不正: bonusWeight = %g: 0 <= bonusWeight <= 1 であるべき", bonusWeight)
+	}
+
+	return func(ranks RankByAgent[Ag], points PointByAgent[Ag]) (ResultScoreByAgent[Ag], error) {
+		standards, err := StandardResultScoreByAgentFunc(ranks)
+		if err != nil {
+			return nil, err
+		}
+
+		diffs, err := normalizedPointDifferences(ranks, points, scale)
+		if err != nil {
+			return nil, err
+		}
+
+		scores := ResultScoreByAgent[Ag]{}
+		for agent, s := range standards {
+			scores[agent] = (1.0-bonusWeight)*s + bonusWeight*diffs[agent]
+		}
+		return scores, nil
+	}, nil
+}
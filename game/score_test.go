@@ -325,3 +325,134 @@ func TestStandardResultScoreByAgentFunc(t *testing.T) {
 		})
 	}
 }
+
+func TestNewPointDifferenceResultScoreByAgentFunc(t *testing.T) {
+	f, err := game.NewPointDifferenceResultScoreByAgentFunc[string](10.0)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		ranks  game.RankByAgent[string]
+		points game.PointByAgent[string]
+		want   map[string]float32
+	}{
+		{
+			name:   "二人用ゲーム_5点差",
+			ranks:  game.RankByAgent[string]{"黒": 1, "白": 2},
+			points: game.PointByAgent[string]{"黒": 15, "白": 10},
+			want:   map[string]float32{"黒": 0.75, "白": 0.25},
+		},
+		{
+			name:   "二人用ゲーム_scale以上の点差はクリップ",
+			ranks:  game.RankByAgent[string]{"黒": 1, "白": 2},
+			points: game.PointByAgent[string]{"黒": 40, "白": 0},
+			want:   map[string]float32{"黒": 1.0, "白": 0.0},
+		},
+		{
+			// 他のエージェントの平均得点との差を使う
+			name:   "三人用ゲーム",
+			ranks:  game.RankByAgent[string]{"A": 1, "B": 2, "C": 3},
+			points: game.PointByAgent[string]{"A": 6, "B": 3, "C": 0},
+			want:   map[string]float32{"A": 0.725, "B": 0.5, "C": 0.275},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := f(tc.ranks, tc.points)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			for agent, want := range tc.want {
+				if math.Abs(float64(got[agent]-want)) > 0.0001 {
+					t.Errorf("%s の結果スコアの不一致: got = %f, want = %f", agent, got[agent], want)
+				}
+			}
+		})
+	}
+
+	t.Run("異常_得点が不足", func(t *testing.T) {
+		_, err := f(game.RankByAgent[string]{"黒": 1, "白": 2}, game.PointByAgent[string]{"黒": 1})
+		if err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_scaleが0", func(t *testing.T) {
+		if _, err := game.NewPointDifferenceResultScoreByAgentFunc[string](0.0); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestNewMarginBonusResultScoreByAgentFunc(t *testing.T) {
+	f, err := game.NewMarginBonusResultScoreByAgentFunc[string](10.0, 0.2)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	// 勝敗のスコア(1, 0)と、得点差のスコア(0.75, 0.25)を 0.8:0.2 で混ぜる
+	got, err := f(game.RankByAgent[string]{"黒": 1, "白": 2}, game.PointByAgent[string]{"黒": 15, "白": 10})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	want := map[string]float32{"黒": 0.95, "白": 0.05}
+	for agent, w := range want {
+		if math.Abs(float64(got[agent]-w)) > 0.0001 {
+			t.Errorf("%s の結果スコアの不一致: got = %f, want = %f", agent, got[agent], w)
+		}
+	}
+
+	// 引き分けでも、得点差があれば結果スコアに差が付く
+	got, err = f(game.RankByAgent[string]{"黒": 1, "白": 1}, game.PointByAgent[string]{"黒": 12, "白": 10})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if got["黒"] <= got["白"] {
+		t.Errorf("得点の多い方の結果スコアが大きくない: got = %v", got)
+	}
+
+	t.Run("異常_bonusWeightが範囲外", func(t *testing.T) {
+		if _, err := game.NewMarginBonusResultScoreByAgentFunc[string](10.0, 1.5); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestEvaluateResultScoreByAgent(t *testing.T) {
+	// 状態は、エージェント"A"の得点。"A"が1位、"B"が2位で終了している
+	rankFunc := func(s int) (game.RankByAgent[string], error) {
+		return game.RankByAgent[string]{"A": 1, "B": 2}, nil
+	}
+	pointFunc := func(s int) (game.PointByAgent[string], error) {
+		return game.PointByAgent[string]{"A": float32(s), "B": 0}, nil
+	}
+	pointResultScoreFunc, err := game.NewPointDifferenceResultScoreByAgentFunc[string](6.0)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	tests := []struct {
+		name                 string
+		pointResultScoreFunc game.PointResultScoreByAgentFunc[string]
+		want                 float32
+	}{
+		{name: "正常_順位だけ", want: 1.0},
+		// 0.5 + 3/(2*6) = 0.75
+		{name: "正常_得点を使う", pointResultScoreFunc: pointResultScoreFunc, want: 0.75},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			scores, err := game.EvaluateResultScoreByAgent(3, rankFunc, game.StandardResultScoreByAgentFunc[string], pointFunc, tc.pointResultScoreFunc)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if math.Abs(float64(scores["A"]-tc.want)) > 0.0001 {
+				t.Errorf("結果スコアの不一致: got = %f, want = %f", scores["A"], tc.want)
+			}
+		})
+	}
+}
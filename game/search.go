@@ -0,0 +1,114 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// SearchStats は、1つの局面での、1体のエージェントの行動選択に関する探索の統計。
+// 探索を伴う PolicyValueFunc が、記録する各ステップに付ける。
+type SearchStats[Ac, Ag comparable] struct {
+	// Simulations は、探索で行ったシミュレーションの回数。
+	Simulations int
+	// VisitsByAction は、ルートノードでの各行動の訪問回数。
+	VisitsByAction map[Ac]int
+	// QByAction は、ルートノードでの各行動の平均価値。訪問していない行動の値は意味を持たない。
+	QByAction map[Ac]float32
+	// PriorByAction は、ルートノードでの各行動の事前確率(PolicyFuncの出力)。
+	PriorByAction map[Ac]float32
+	// RootValueByAgent は、探索で得た、ルートノードでの各エージェントの価値。
+	RootValueByAgent map[Ag]float32
+}
+
+// VisitPolicy は、訪問回数を正規化したPolicyを返す。
+func (s *SearchStats[Ac, Ag]) VisitPolicy() (Policy[Ac], error) {
+	policy := make(Policy[Ac], len(s.VisitsByAction))
+	for a, n := range s.VisitsByAction {
+		policy[a] = float32(n)
+	}
+	return policy.Normalize()
+}
+
+// PriorPolicy は、事前確率を正規化したPolicyを返す。
+func (s *SearchStats[Ac, Ag]) PriorPolicy() (Policy[Ac], error) {
+	return Policy[Ac](s.PriorByAction).Normalize()
+}
+
+// SoftQPolicy は、訪問した行動の平均価値に温度tauのソフトマックスを適用したPolicyを返す。
+// 訪問回数ではなく価値に基づく、方策の学習のターゲット(soft-Q target)に使う。
+func (s *SearchStats[Ac, Ag]) SoftQPolicy(tau float32) (Policy[Ac], error) {
+	if tau <= 0 || math.IsNaN(float64(tau)) {
+		return nil, fmt.Errorf("温度が不正: tau = %g: tau > 0 であるべき", tau)
+	}
+
+	maxQ := float32(math.Inf(-1))
+	for a, n := range s.VisitsByAction {
+		if n > 0 {
+			maxQ = max(maxQ, s.QByAction[a])
+		}
+	}
+
+	if math.IsInf(float64(maxQ), -1) {
+		return nil, errors.New("訪問した行動がありません")
+	}
+
+	policy := Policy[Ac]{}
+	for a, n := range s.VisitsByAction {
+		if n > 0 {
+			// オーバーフローを避ける為、最大値を引いてから指数を取る
+			policy[a] = float32(math.Exp(float64((s.QByAction[a] - maxQ) / tau)))
+		}
+	}
+	return policy.Normalize()
+}
+
+// PolicySurprise は、訪問回数の分布の、事前確率からのKLダイバージェンス KL(visit || prior) を返す。
+// 探索で事前確率から大きく変わった局面ほど大きくなり、学習時のサンプルの重み付けに使う。
+func (s *SearchStats[Ac, Ag]) PolicySurprise() (float32, error) {
+	visit, err := s.VisitPolicy()
+	if err != nil {
+		return 0.0, err
+	}
+
+	prior, err := s.PriorPolicy()
+	if err != nil {
+		return 0.0, err
+	}
+	return KLDivergence(visit, prior), nil
+}
+
+// TransformSearchStats は、statsの行動をfで写したSearchStatsを返す。statsがnilの場合はnilを返す。
+// 異なる行動が同じ行動に写された場合、エラーを返す。
+func TransformSearchStats[Ac, Ag comparable](stats *SearchStats[Ac, Ag], f ActionMapFunc[Ac]) (*SearchStats[Ac, Ag], error) {
+	if stats == nil {
+		return nil, nil
+	}
+
+	visits := make(map[Ac]int, len(stats.VisitsByAction))
+	for a, n := range stats.VisitsByAction {
+		ta := f(a)
+		if _, ok := visits[ta]; ok {
+			return nil, fmt.Errorf("対称変換で複数の行動が同じ行動に写されました: action = %v, transformed = %v", a, ta)
+		}
+		visits[ta] = n
+	}
+
+	qs, err := TransformPolicy(Policy[Ac](stats.QByAction), f)
+	if err != nil {
+		return nil, err
+	}
+
+	priors, err := TransformPolicy(Policy[Ac](stats.PriorByAction), f)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SearchStats[Ac, Ag]{
+		Simulations:      stats.Simulations,
+		VisitsByAction:   visits,
+		QByAction:        qs,
+		PriorByAction:    priors,
+		RootValueByAgent: stats.RootValueByAgent,
+	}, nil
+}
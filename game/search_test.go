@@ -0,0 +1,136 @@
+package game_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sw965/crow/game"
+)
+
+func newTestSearchStats() *game.SearchStats[string, int] {
+	return &game.SearchStats[string, int]{
+		Simulations:      8,
+		VisitsByAction:   map[string]int{"a": 6, "b": 2, "c": 0},
+		QByAction:        map[string]float32{"a": 0.6, "b": 0.4, "c": 0.0},
+		PriorByAction:    map[string]float32{"a": 0.25, "b": 0.25, "c": 0.5},
+		RootValueByAgent: map[int]float32{0: 0.55, 1: 0.45},
+	}
+}
+
+func TestSearchStatsVisitPolicy(t *testing.T) {
+	stats := newTestSearchStats()
+
+	got, err := stats.VisitPolicy()
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	want := game.Policy[string]{"a": 0.75, "b": 0.25, "c": 0.0}
+	if !equalPolicies(got, want, 1e-5) {
+		t.Errorf("VisitPolicyの不一致: got = %v, want = %v", got, want)
+	}
+
+	t.Run("異常_訪問回数が全て0", func(t *testing.T) {
+		empty := &game.SearchStats[string, int]{VisitsByAction: map[string]int{"a": 0}}
+		if _, err := empty.VisitPolicy(); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestSearchStatsSoftQPolicy(t *testing.T) {
+	stats := newTestSearchStats()
+
+	tests := []struct {
+		name    string
+		tau     float32
+		want    game.Policy[string]
+		wantErr bool
+	}{
+		{
+			name: "正常_訪問した行動だけのソフトマックス",
+			tau:  0.1,
+			// exp(0.6/0.1) : exp(0.4/0.1) = 1 : exp(-2)
+			want: game.Policy[string]{"a": float32(1.0 / (1.0 + math.Exp(-2.0))), "b": float32(math.Exp(-2.0) / (1.0 + math.Exp(-2.0)))},
+		},
+		{
+			name:    "異常_温度が0",
+			tau:     0.0,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := stats.SoftQPolicy(tc.tau)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("エラーを期待したが、nilが返された")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if !equalPolicies(got, tc.want, 1e-5) {
+				t.Errorf("SoftQPolicyの不一致: got = %v, want = %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSearchStatsPolicySurprise(t *testing.T) {
+	stats := newTestSearchStats()
+
+	got, err := stats.PolicySurprise()
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	// KL(visit || prior) = 0.75 log(0.75/0.25) + 0.25 log(0.25/0.25)
+	want := 0.75 * math.Log(3.0)
+	if math.Abs(float64(got)-want) > 1e-5 {
+		t.Errorf("PolicySurpriseの不一致: got = %f, want = %f", got, want)
+	}
+
+	// 探索で事前確率が変わらなければ0
+	stats.PriorByAction = map[string]float32{"a": 0.75, "b": 0.25, "c": 0.0}
+	got, err = stats.PolicySurprise()
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if math.Abs(float64(got)) > 1e-5 {
+		t.Errorf("PolicySurpriseの不一致: got = %f, want = 0", got)
+	}
+}
+
+func TestTransformSearchStats(t *testing.T) {
+	stats := newTestSearchStats()
+	upper := map[string]string{"a": "A", "b": "B", "c": "C"}
+
+	got, err := game.TransformSearchStats(stats, func(a string) string { return upper[a] })
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	for a, ta := range upper {
+		if got.VisitsByAction[ta] != stats.VisitsByAction[a] || got.QByAction[ta] != stats.QByAction[a] || got.PriorByAction[ta] != stats.PriorByAction[a] {
+			t.Errorf("行動 %s -> %s の統計の不一致: got = %+v", a, ta, got)
+		}
+	}
+	if got.Simulations != stats.Simulations || len(got.RootValueByAgent) != len(stats.RootValueByAgent) {
+		t.Errorf("行動に依らない統計の不一致: got = %+v", got)
+	}
+
+	t.Run("正常_nil", func(t *testing.T) {
+		got, err := game.TransformSearchStats[string, int](nil, func(a string) string { return a })
+		if err != nil || got != nil {
+			t.Errorf("nilを期待した: got = %v, err = %v", got, err)
+		}
+	})
+
+	t.Run("異常_複数の行動が同じ行動に写される", func(t *testing.T) {
+		if _, err := game.TransformSearchStats(stats, func(string) string { return "x" }); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
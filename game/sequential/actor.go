@@ -32,10 +32,24 @@ func UniformPolicyNoValueFunc[S any, Ac comparable](state S, legalActions []Ac)
 	return policy, 0.0, err
 }
 
+// PolicyValueStatsFunc は、PolicyValueFunc に加えて、探索の統計を返す。統計が無い場合は nil を返してもよい。
+type PolicyValueStatsFunc[S any, Ac, Ag comparable] func(S, []Ac) (game.Policy[Ac], float32, *game.SearchStats[Ac, Ag], error)
+
+// PolicyValueFunc は、探索の統計を捨てる PolicyValueFunc を返す。
+func (f PolicyValueStatsFunc[S, Ac, Ag]) PolicyValueFunc() PolicyValueFunc[S, Ac] {
+	return func(state S, legalActions []Ac) (game.Policy[Ac], float32, error) {
+		policy, value, _, err := f(state, legalActions)
+		return policy, value, err
+	}
+}
+
 type ActorCritic[S any, Ac, Ag comparable] struct {
 	Name            game.ActorCriticName
 	PolicyValueFunc PolicyValueFunc[S, Ac]
 	SelectFunc      game.SelectFunc[Ac, Ag]
+	// PolicyValueStatsFunc は任意。設定した場合、RecordPlayouts は PolicyValueFunc の代わりにこれを使い、
+	// 探索の統計を Step.SearchStats に記録する。PolicyValueFunc と同じ方策と価値を返すべき。
+	PolicyValueStatsFunc PolicyValueStatsFunc[S, Ac, Ag]
 }
 
 func NewRandomActorCritic[S any, Ac, Ag comparable]() ActorCritic[S, Ac, Ag] {
@@ -11,6 +11,9 @@ type TransitionFunc[S any, Ac comparable] func(S, Ac) (S, error)
 type EqualFunc[S any] func(S, S) bool
 type CurrentAgentFunc[S any, Ag comparable] func(S) Ag
 
+// RewardFunc は、遷移(状態, 行動, 遷移後の状態)で各エージェントが得た報酬を返す。
+type RewardFunc[S any, Ac, Ag comparable] func(S, Ac, S) (game.RewardByAgent[Ag], error)
+
 type Rule[S any, Ac, Ag comparable] struct {
 	LegalActionsFunc LegalActionsFunc[S, Ac]
 	TransitionFunc   TransitionFunc[S, Ac]
@@ -39,6 +42,14 @@ type Engine[S any, Ac, Ag comparable] struct {
 	RankByAgentFunc        game.RankByAgentFunc[S, Ag]
 	ResultScoreByAgentFunc game.ResultScoreByAgentFunc[Ag]
 	Agents                 []Ag
+	// RewardFunc は、途中の報酬を持つゲームの為の任意の関数。nilの場合、途中の報酬は無いものとする。
+	// 設定した場合、RecordPlayouts は各ステップの報酬を Step.RewardByAgent に記録する。
+	RewardFunc RewardFunc[S, Ac, Ag]
+	// PointByAgentFunc と PointResultScoreByAgentFunc は、得点制のゲームの為の任意の関数。
+	// PointResultScoreByAgentFunc を設定した場合、EvaluateResultScoreByAgent は ResultScoreByAgentFunc の代わりに、
+	// 順位と得点から結果スコアを計算する。その場合、ResultScoreByAgentFunc は nil でもよい。
+	PointByAgentFunc            game.PointByAgentFunc[S, Ag]
+	PointResultScoreByAgentFunc game.PointResultScoreByAgentFunc[Ag]
 	// MaxSteps はプレイアウト1回あたりの手数の上限。
 	// 状態が循環し得るゲームでプレイアウトが終了しなくなるのを防ぐ。
 	// 0の場合は無制限。上限に達した場合、Playouts / RecordPlayouts はエラーを返す。
@@ -54,10 +65,14 @@ func (e Engine[S, Ac, Ag]) Validate() error {
 		return errors.New("RankByAgentFuncがnilです")
 	}
 
-	if e.ResultScoreByAgentFunc == nil {
+	if e.ResultScoreByAgentFunc == nil && e.PointResultScoreByAgentFunc == nil {
 		return errors.New("ResultScoreByAgentFuncがnilです")
 	}
 
+	if e.PointResultScoreByAgentFunc != nil && e.PointByAgentFunc == nil {
+		return errors.New("PointByAgentFuncがnilです: PointResultScoreByAgentFuncを使う場合は必要")
+	}
+
 	if len(e.Agents) == 0 {
 		return errors.New("agentsが空です: 1体以上のエージェントが必要")
 	}
@@ -70,13 +85,15 @@ func (e Engine[S, Ac, Ag]) IsTerminal(state S) (bool, error) {
 }
 
 func (e Engine[S, Ac, Ag]) EvaluateResultScoreByAgent(state S) (game.ResultScoreByAgent[Ag], error) {
-	rankByAgent, err := e.RankByAgentFunc(state)
-	if err != nil {
-		return nil, err
-	}
-	return e.ResultScoreByAgentFunc(rankByAgent)
+	return game.EvaluateResultScoreByAgent(state, e.RankByAgentFunc, e.ResultScoreByAgentFunc, e.PointByAgentFunc, e.PointResultScoreByAgentFunc)
 }
 
 func (e *Engine[S, Ac, Ag]) SetStandardResultScoreByAgentFunc() {
 	e.ResultScoreByAgentFunc = game.StandardResultScoreByAgentFunc[Ag]
 }
+
+// SetPointResultScoreByAgentFunc は、得点から結果スコアを計算する関数を設定する。
+func (e *Engine[S, Ac, Ag]) SetPointResultScoreByAgentFunc(pointFunc game.PointByAgentFunc[S, Ag], f game.PointResultScoreByAgentFunc[Ag]) {
+	e.PointByAgentFunc = pointFunc
+	e.PointResultScoreByAgentFunc = f
+}
@@ -7,185 +7,333 @@ import (
 	"slices"
 
 	"github.com/sw965/crow/game"
-	"github.com/sw965/omw/mathx/randx"
-	"github.com/sw965/omw/parallel"
-	"github.com/sw965/omw/slicesx"
 )
 
 func (e *Engine[S, Ac, Ag]) Playouts(inits []S, accr ActorCritic[S, Ac, Ag], rngs []*rand.Rand) ([]S, error) {
-	if err := e.Validate(); err != nil {
-		return nil, err
-	}
+	finals, _, err := e.playouts(inits, accr, rngs)
+	return finals, err
+}
 
-	if err := accr.Validate(); err != nil {
+// PlayoutReturns は、プレイアウトを行い、各試合の結果スコアに途中の報酬(RewardFunc)の合計を加えたものを返す。
+// RewardFuncがnilの場合、結果スコアと一致する。
+func (e *Engine[S, Ac, Ag]) PlayoutReturns(inits []S, accr ActorCritic[S, Ac, Ag], rngs []*rand.Rand) ([]game.ResultScoreByAgent[Ag], error) {
+	finals, rewardSums, err := e.playouts(inits, accr, rngs)
+	if err != nil {
 		return nil, err
 	}
 
-	n := len(inits)
-	p := len(rngs)
-	finals := make([]S, n)
+	returns := make([]game.ResultScoreByAgent[Ag], len(finals))
+	for i, final := range finals {
+		scores, err := e.EvaluateResultScoreByAgent(final)
+		if err != nil {
+			return nil, err
+		}
 
-	err := parallel.For(n, p, func(workerID, idx int) error {
-		rng := rngs[workerID]
-		state := inits[idx]
-		numSteps := 0
-		for {
-			isEnd, err := e.IsTerminal(state)
-			if err != nil {
-				return err
-			}
+		for agent, r := range rewardSums[i] {
+			scores[agent] += r
+		}
+		returns[i] = scores
+	}
+	return returns, nil
+}
 
-			if isEnd {
-				break
-			}
+// playouts は、各試合の最終状態と、途中の報酬の合計を返す。RewardFuncがnilの場合、報酬の合計はnil。
+func (e *Engine[S, Ac, Ag]) playouts(inits []S, accr ActorCritic[S, Ac, Ag], rngs []*rand.Rand) ([]S, []game.RewardByAgent[Ag], error) {
+	if err := e.Validate(); err != nil {
+		return nil, nil, err
+	}
 
-			if e.MaxSteps > 0 && numSteps >= e.MaxSteps {
-				return fmt.Errorf("手数がMaxSteps(%d)に達してもゲームが終了しませんでした", e.MaxSteps)
-			}
+	if err := accr.Validate(); err != nil {
+		return nil, nil, err
+	}
 
+	rewardSums := make([]game.RewardByAgent[Ag], len(inits))
+	newStepFunc := func(gameIdx int, rng *rand.Rand) game.PlayoutStepFunc[S] {
+		return func(state S, stepIdx int) (S, bool, error) {
 			legalActions := e.Rule.LegalActionsFunc(state)
 			// policy.ValidateForLegalActionsでもlegalActionsの空チェックをするが、PolicyFuncを安全に呼ぶ為に、ここでもチェックする
 			if len(legalActions) == 0 {
-				return errors.New("ゲームが終了していないのに合法手がありません")
+				return state, false, errors.New("ゲームが終了していないのに合法手がありません")
 			}
 
 			policy, _, err := accr.PolicyValueFunc(state, legalActions)
 			if err != nil {
-				return err
+				return state, false, err
 			}
 
 			// legalActionsがユニークならば、policyは合法手のみを持つ事が保障される
 			// 第2引数がtrueならば、legalActionsがユニーク性をチェックするが、一手毎にチェックするのは、計算コストの観点から見送る
 			err = policy.ValidateForLegalActions(legalActions, false)
 			if err != nil {
-				return err
+				return state, false, err
 			}
 
 			agent := e.Rule.CurrentAgentFunc(state)
-			action, err := accr.SelectFunc(policy, agent, rng)
+			action, err := accr.SelectFunc(policy, agent, stepIdx, rng)
 			if err != nil {
-				return err
+				return state, false, err
 			}
 
-			state, err = e.Rule.TransitionFunc(state, action)
+			next, err := e.Rule.TransitionFunc(state, action)
 			if err != nil {
-				return err
+				return state, false, err
 			}
-			numSteps++
+
+			if e.RewardFunc != nil {
+				rewards, err := e.RewardFunc(state, action, next)
+				if err != nil {
+					return state, false, err
+				}
+
+				if rewardSums[gameIdx] == nil {
+					rewardSums[gameIdx] = game.RewardByAgent[Ag]{}
+				}
+				for agent, r := range rewards {
+					rewardSums[gameIdx][agent] += r
+				}
+			}
+			return next, false, nil
 		}
-		finals[idx] = state
-		return nil
-	})
-	return finals, err
+	}
+
+	finals, err := game.RunPlayouts(inits, rngs, e.MaxSteps, e.IsTerminal, newStepFunc)
+	return finals, rewardSums, err
 }
 
 func (e *Engine[S, Ac, Ag]) RecordPlayouts(inits []S, accr ActorCritic[S, Ac, Ag], rngs []*rand.Rand, initStepsCap int) ([]Record[S, Ac, Ag], error) {
+	return e.RecordPlayoutsWithConfig(inits, accr, rngs, initStepsCap, RecordConfig[S, Ac]{})
+}
+
+// RecordConfig は、RecordPlayoutsWithConfig での、探索量のランダム化(playout-cap randomization)と投了の設定。
+// ゼロ値の場合、全ての手で ActorCritic.PolicyValueFunc を使い、投了せずに終局まで指す。
+type RecordConfig[S any, Ac comparable] struct {
+	// FastPolicyValueFunc は、探索量を抑えた安価な PolicyValueFunc。
+	// nilでない場合、各手で確率 FullSearchProbability で ActorCritic.PolicyValueFunc(完全な探索)を使い、
+	// それ以外の手ではこちらを使って、Step.FastSearch を true にする。
+	FastPolicyValueFunc   PolicyValueFunc[S, Ac]
+	FullSearchProbability float32
+
+	// ResignConsecutiveSteps は、手番のエージェントの価値が ResignThreshold 未満の手が、
+	// そのエージェントの手で何手続いたら投了するか。0の場合は投了しない。
+	ResignConsecutiveSteps int
+	ResignThreshold        float32
+	// NoResignProbability は、誤った投了の割合を測る為に、投了せずに終局まで指す対局の割合。
+	NoResignProbability float32
+}
+
+func (c RecordConfig[S, Ac]) Validate() error {
+	if c.FullSearchProbability < 0.0 || c.FullSearchProbability > 1.0 {
+		return fmt.Errorf("FullSearchProbabilityが不正: FullSearchProbability = %g: 0 <= FullSearchProbability <= 1 であるべき", c.FullSearchProbability)
+	}
+
+	if c.ResignConsecutiveSteps < 0 {
+		return fmt.Errorf("ResignConsecutiveStepsが不正: ResignConsecutiveSteps = %d: ResignConsecutiveSteps >= 0 であるべき", c.ResignConsecutiveSteps)
+	}
+
+	if c.NoResignProbability < 0.0 || c.NoResignProbability > 1.0 {
+		return fmt.Errorf("NoResignProbabilityが不正: NoResignProbability = %g: 0 <= NoResignProbability <= 1 であるべき", c.NoResignProbability)
+	}
+	return nil
+}
+
+// RecordPlayoutsWithConfig は、config に従って探索量をランダム化し、投了ありで対局を記録する。
+// 投了した対局は、投了の条件を満たした手(Step.Resign が true)で終わる。その手の Action は選ばれたが、指されていない。
+// 投了した対局の結果スコアは、投了したエージェントを最下位、それ以外のエージェントを同率1位として計算する。
+func (e *Engine[S, Ac, Ag]) RecordPlayoutsWithConfig(inits []S, accr ActorCritic[S, Ac, Ag], rngs []*rand.Rand, initStepsCap int, config RecordConfig[S, Ac]) ([]Record[S, Ac, Ag], error) {
 	if err := e.Validate(); err != nil {
 		return nil, err
 	}
 
-	n := len(inits)
-	p := len(rngs)
-	records := make([]Record[S, Ac, Ag], n)
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 
-	err := parallel.For(n, p, func(workerID, idx int) error {
-		rng := rngs[workerID]
-		state := inits[idx]
-		steps := make([]Step[S, Ac, Ag], 0, initStepsCap)
+	if config.ResignConsecutiveSteps > 0 && len(e.Agents) < 2 {
+		return nil, fmt.Errorf("エージェントが不足しています: len(Agents) = %d: 投了するには 2 以上であるべき", len(e.Agents))
+	}
 
-		for {
-			isEnd, err := e.IsTerminal(state)
-			if err != nil {
-				return err
-			}
-			if isEnd {
-				break
-			}
+	records := make([]Record[S, Ac, Ag], len(inits))
+	resignAgents := make([]Ag, len(inits))
+	newStepFunc := func(gameIdx int, rng *rand.Rand) game.PlayoutStepFunc[S] {
+		record := &records[gameIdx]
+		record.Steps = make([]Step[S, Ac, Ag], 0, initStepsCap)
 
-			if e.MaxSteps > 0 && len(steps) >= e.MaxSteps {
-				return fmt.Errorf("手数がMaxSteps(%d)に達してもゲームが終了しませんでした", e.MaxSteps)
-			}
+		resignEnabled := config.ResignConsecutiveSteps > 0
+		record.ResignDisabled = resignEnabled && rng.Float32() < config.NoResignProbability
+		lowValueStepsByAgent := map[Ag]int{}
+		resignMarked := false
 
+		return func(state S, stepIdx int) (S, bool, error) {
 			legalActions := e.Rule.LegalActionsFunc(state)
 			if len(legalActions) == 0 {
-				return errors.New("ゲームが終了していないのに合法手がありません")
+				return state, false, errors.New("ゲームが終了していないのに合法手がありません")
 			}
 
-			policy, value, err := accr.PolicyValueFunc(state, legalActions)
+			var policy game.Policy[Ac]
+			var value float32
+			var stats *game.SearchStats[Ac, Ag]
+			var err error
+			fastSearch := config.FastPolicyValueFunc != nil && rng.Float32() >= config.FullSearchProbability
+			switch {
+			case fastSearch:
+				policy, value, err = config.FastPolicyValueFunc(state, legalActions)
+			case accr.PolicyValueStatsFunc != nil:
+				policy, value, stats, err = accr.PolicyValueStatsFunc(state, legalActions)
+			default:
+				policy, value, err = accr.PolicyValueFunc(state, legalActions)
+			}
 			if err != nil {
-				return err
+				return state, false, err
 			}
 
 			if err := policy.ValidateForLegalActions(legalActions, false); err != nil {
-				return err
+				return state, false, err
 			}
 
 			agent := e.Rule.CurrentAgentFunc(state)
-			action, err := accr.SelectFunc(policy, agent, rng)
+			action, err := accr.SelectFunc(policy, agent, stepIdx, rng)
 			if err != nil {
-				return err
+				return state, false, err
 			}
 
-			steps = append(steps, Step[S, Ac, Ag]{
-				State:  state,
-				Agent:  agent,
-				Action: action,
-				Policy: policy,
-				Value:  value,
-			})
+			resign := false
+			if resignEnabled {
+				if value < config.ResignThreshold {
+					lowValueStepsByAgent[agent]++
+				} else {
+					lowValueStepsByAgent[agent] = 0
+				}
+				// 投了を無効にした対局では、最初に条件を満たした手だけに印を付ける
+				resign = !resignMarked && lowValueStepsByAgent[agent] >= config.ResignConsecutiveSteps
+				resignMarked = resignMarked || resign
+			}
+
+			if resign && !record.ResignDisabled {
+				record.Steps = append(record.Steps, Step[S, Ac, Ag]{
+					State:       state,
+					Agent:       agent,
+					Action:      action,
+					Policy:      policy,
+					Value:       value,
+					FastSearch:  fastSearch,
+					Resign:      true,
+					SearchStats: stats,
+				})
+				resignAgents[gameIdx] = agent
+				record.Resigned = true
+				return state, true, nil
+			}
 
-			state, err = e.Rule.TransitionFunc(state, action)
+			next, err := e.Rule.TransitionFunc(state, action)
 			if err != nil {
-				return err
+				return state, false, err
+			}
+
+			var rewards game.RewardByAgent[Ag]
+			if e.RewardFunc != nil {
+				rewards, err = e.RewardFunc(state, action, next)
+				if err != nil {
+					return state, false, err
+				}
 			}
+
+			record.Steps = append(record.Steps, Step[S, Ac, Ag]{
+				State:         state,
+				Agent:         agent,
+				Action:        action,
+				Policy:        policy,
+				Value:         value,
+				RewardByAgent: rewards,
+				FastSearch:    fastSearch,
+				Resign:        resign,
+				SearchStats:   stats,
+			})
+			return next, false, nil
 		}
+	}
 
-		scores, err := e.EvaluateResultScoreByAgent(state)
+	finals, err := game.RunPlayouts(inits, rngs, e.MaxSteps, e.IsTerminal, newStepFunc)
+	if err != nil {
+		return records, err
+	}
+
+	for i := range records {
+		var scores game.ResultScoreByAgent[Ag]
+		if records[i].Resigned {
+			scores, err = e.resignResultScoreByAgent(resignAgents[i])
+		} else {
+			scores, err = e.EvaluateResultScoreByAgent(finals[i])
+		}
 		if err != nil {
-			return err
+			return records, err
 		}
 
-		records[idx] = Record[S, Ac, Ag]{
-			Steps:              steps,
-			FinalState:         state,
-			ResultScoreByAgent: scores,
+		records[i].FinalState = finals[i]
+		records[i].ResultScoreByAgent = scores
+	}
+	return records, nil
+}
+
+// resignResultScoreByAgent は、agent が投了した場合の結果スコアを返す。
+// 得点制のゲームでも、終局していない状態の得点は使わず、ResultScoreByAgentFunc(nilの場合は標準の結果スコア)で計算する。
+func (e *Engine[S, Ac, Ag]) resignResultScoreByAgent(agent Ag) (game.ResultScoreByAgent[Ag], error) {
+	winners := make([]Ag, 0, len(e.Agents)-1)
+	for _, a := range e.Agents {
+		if a != agent {
+			winners = append(winners, a)
 		}
-		return nil
-	})
+	}
+
+	ranks, err := game.NewRankByAgent([][]Ag{winners, {agent}})
+	if err != nil {
+		return nil, err
+	}
 
-	return records, err
+	if e.ResultScoreByAgentFunc != nil {
+		return e.ResultScoreByAgentFunc(ranks)
+	}
+	return game.StandardResultScoreByAgentFunc(ranks)
 }
 
-// NewCrossPlayoutRecorderは、複数のActorCriticを総当たりで対戦させる game.CrossPlayoutRecorder を返す。
-// 総当たりの進行とスコアの集計は共通実装(game側)が担い、ここでは並び1組分の対戦の実行方法だけを定義する。
-func (e *Engine[S, Ac, Ag]) NewCrossPlayoutRecorder(inits []S, accrs []ActorCritic[S, Ac, Ag], p int) (*game.CrossPlayoutRecorder[Record[S, Ac, Ag], Ag], error) {
-	agentsN := len(e.Agents)
-	if len(accrs) < agentsN {
-		return nil, fmt.Errorf("ActorCriticが不足しています: len(accrs) = %d: %d 以上であるべき", len(accrs), agentsN)
+// FalseResign は、投了を無効にして終局まで指した対局で、投了の条件を満たしたエージェントが、
+// 投了した場合よりも良い結果スコアを得たかどうかを返す。
+// 投了を無効にしていない対局や、投了の条件を満たした手が無い対局では false を返す。
+func (e *Engine[S, Ac, Ag]) FalseResign(r Record[S, Ac, Ag]) (bool, error) {
+	if !r.ResignDisabled {
+		return false, nil
+	}
+
+	i := slices.IndexFunc(r.Steps, func(s Step[S, Ac, Ag]) bool { return s.Resign })
+	if i < 0 {
+		return false, nil
 	}
 
-	accrPerms := slices.Collect(slicesx.Permutations(accrs, agentsN))
-	// TODO: 暫定的にpanicでガードしている。エラーの扱いを決めたら見直す。
-	rngs, err := randx.NewPCGs(p)
+	agent := r.Steps[i].Agent
+	scores, err := e.resignResultScoreByAgent(agent)
 	if err != nil {
-		panic(err)
+		return false, err
 	}
+	return r.ResultScoreByAgent[agent] > scores[agent], nil
+}
 
-	accrNames := make([]game.ActorCriticName, len(accrs))
-	for i, accr := range accrs {
-		accrNames[i] = accr.Name
+// NewCrossPlayoutRecorderは、複数のActorCriticを総当たりで対戦させる game.CrossPlayoutRecorder を返す。
+// 並びの列挙・総当たりの進行・スコアの集計は共通実装(game.NewPermutationCrossPlayoutRecorder)が担い、
+// ここでは並び1組分の対戦の実行方法だけを定義する。
+func (e *Engine[S, Ac, Ag]) NewCrossPlayoutRecorder(inits []S, accrs []ActorCritic[S, Ac, Ag], p int) (*game.CrossPlayoutRecorder[Record[S, Ac, Ag], Ag], error) {
+	agentsN := len(e.Agents)
+	nameFunc := func(accr ActorCritic[S, Ac, Ag]) game.ActorCriticName {
+		return accr.Name
 	}
 
-	playPermutationFunc := func(permIdx, initStepsCap int) ([]Record[S, Ac, Ag], map[Ag]game.ActorCriticName, error) {
-		accrPerm := accrPerms[permIdx]
-		accrNameByAgent := make(map[Ag]game.ActorCriticName, agentsN)
+	playFunc := func(accrPerm []ActorCritic[S, Ac, Ag], accrNameByAgent map[Ag]game.ActorCriticName, rngs []*rand.Rand, initStepsCap int) ([]Record[S, Ac, Ag], error) {
 		pvFuncByAgent := make(map[Ag]PolicyValueFunc[S, Ac], agentsN)
+		pvStatsFuncByAgent := make(map[Ag]PolicyValueStatsFunc[S, Ac, Ag], agentsN)
 		selectFuncByAgent := make(map[Ag]game.SelectFunc[Ac, Ag], agentsN)
 
 		for i, agent := range e.Agents {
 			accr := accrPerm[i]
-			accrNameByAgent[agent] = accr.Name
 			pvFuncByAgent[agent] = accr.PolicyValueFunc
+			pvStatsFuncByAgent[agent] = accr.PolicyValueStatsFunc
 			selectFuncByAgent[agent] = accr.SelectFunc
 		}
 
@@ -194,31 +342,42 @@ func (e *Engine[S, Ac, Ag]) NewCrossPlayoutRecorder(inits []S, accrs []ActorCrit
 			return pvFuncByAgent[agent](state, legalActions)
 		}
 
-		selectFunc := func(p game.Policy[Ac], agent Ag, rng *rand.Rand) (Ac, error) {
-			return selectFuncByAgent[agent](p, agent, rng)
+		selectFunc := func(p game.Policy[Ac], agent Ag, stepIdx int, rng *rand.Rand) (Ac, error) {
+			return selectFuncByAgent[agent](p, agent, stepIdx, rng)
+		}
+
+		// 探索の統計を返すActorCriticの手番では、その統計も記録する
+		pvStatsFunc := func(state S, legalActions []Ac) (game.Policy[Ac], float32, *game.SearchStats[Ac, Ag], error) {
+			agent := e.Rule.CurrentAgentFunc(state)
+			if f := pvStatsFuncByAgent[agent]; f != nil {
+				return f(state, legalActions)
+			}
+			policy, value, err := pvFuncByAgent[agent](state, legalActions)
+			return policy, value, nil, err
 		}
 
 		wrapperActor := ActorCritic[S, Ac, Ag]{
-			PolicyValueFunc: pvFunc,
-			SelectFunc:      selectFunc,
+			PolicyValueFunc:      pvFunc,
+			SelectFunc:           selectFunc,
+			PolicyValueStatsFunc: pvStatsFunc,
 		}
 
 		records, err := e.RecordPlayouts(inits, wrapperActor, rngs, initStepsCap)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 
 		for i := range records {
 			records[i].ActorCriticNameByAgent = accrNameByAgent
 		}
-		return records, accrNameByAgent, nil
+		return records, nil
 	}
 
 	resultScoreFromRecordFunc := func(r Record[S, Ac, Ag]) game.ResultScoreByAgent[Ag] {
 		return r.ResultScoreByAgent
 	}
 
-	return game.NewCrossPlayoutRecorder(accrNames, len(accrPerms), len(inits), playPermutationFunc, resultScoreFromRecordFunc), nil
+	return game.NewPermutationCrossPlayoutRecorder(e.Agents, accrs, nameFunc, len(inits), p, playFunc, resultScoreFromRecordFunc)
 }
 
 type Step[S any, Ac, Ag comparable] struct {
@@ -227,6 +386,14 @@ type Step[S any, Ac, Ag comparable] struct {
 	Action Ac
 	Policy game.Policy[Ac]
 	Value  float32
+	// RewardByAgent は、このステップの遷移で各エージェントが得た報酬。Engine.RewardFunc が nil の場合は nil。
+	RewardByAgent game.RewardByAgent[Ag]
+	// FastSearch は、Policy が安価な探索によるもので、方策の学習に使うべきでない場合に true になる。
+	FastSearch bool
+	// Resign は、この手で投了の条件を満たした場合に true になる。
+	Resign bool
+	// SearchStats は、ActorCritic.PolicyValueStatsFunc が返した探索の統計。無い場合は nil。
+	SearchStats *game.SearchStats[Ac, Ag]
 }
 
 type Record[S any, Ac, Ag comparable] struct {
@@ -234,36 +401,146 @@ type Record[S any, Ac, Ag comparable] struct {
 	FinalState             S
 	ResultScoreByAgent     game.ResultScoreByAgent[Ag]
 	ActorCriticNameByAgent map[Ag]game.ActorCriticName
+	// Resigned は、投了で終わった対局の場合に true になる。その場合、FinalState は終局していない。
+	Resigned bool
+	// ResignDisabled は、誤った投了の割合を測る為に、投了せずに終局まで指した対局の場合に true になる。
+	ResignDisabled bool
 }
 
 func (r Record[S, Ac, Ag]) ElmoSteps(alpha float32) []Step[S, Ac, Ag] {
-	// alpha が範囲外の場合はクリッピングするか、呼び出し側の責任とする
-	if alpha < 0.0 {
-		alpha = 0.0
-	} else if alpha > 1.0 {
-		alpha = 1.0
+	// Policy 等は元のステップの参照をそのまま使い、メモリを節約する
+	elmoSteps := slices.Clone(r.Steps)
+	for i, step := range elmoSteps {
+		elmoSteps[i].Value = game.ElmoValue(alpha, r.ResultScoreByAgent[step.Agent], step.Value)
 	}
+	return elmoSteps
+}
 
-	elmoSteps := make([]Step[S, Ac, Ag], len(r.Steps))
+// AugmentSteps は、各ステップに全ての対称変換を適用したステップを返す。
+// 返り値の長さは len(steps) * len(symmetryFuncs) で、ステップ毎に symmetryFuncs の順に並ぶ。
+// 元のステップも含めたい場合は、symmetryFuncsに game.IdentitySymmetryFunc を含める事。
+// 対称変換はゲームの結果を変えない前提の為、Valueはそのまま引き継ぐ。
+func AugmentSteps[S any, Ac, Ag comparable](steps []Step[S, Ac, Ag], symmetryFuncs []game.SymmetryFunc[S, Ac]) ([]Step[S, Ac, Ag], error) {
+	augmented := make([]Step[S, Ac, Ag], 0, len(steps)*len(symmetryFuncs))
+	for _, step := range steps {
+		for _, f := range symmetryFuncs {
+			state, actionMapFunc, err := f(step.State)
+			if err != nil {
+				return nil, err
+			}
 
-	for i, step := range r.Steps {
-		// 1. そのステップの手番エージェントの、実際のゲーム結果(Z)を取得
-		z := r.ResultScoreByAgent[step.Agent]
+			policy, err := game.TransformPolicy(step.Policy, actionMapFunc)
+			if err != nil {
+				return nil, err
+			}
 
-		// 2. そのステップでの探索評価値(V_search)を取得
-		v := step.Value
+			stats, err := game.TransformSearchStats(step.SearchStats, actionMapFunc)
+			if err != nil {
+				return nil, err
+			}
 
-		// 3. ブレンドして新しいターゲット価値を計算
-		newValue := alpha*z + (1.0-alpha)*v
+			augmented = append(augmented, Step[S, Ac, Ag]{
+				State:         state,
+				Agent:         step.Agent,
+				Action:        actionMapFunc(step.Action),
+				Policy:        policy,
+				Value:         step.Value,
+				RewardByAgent: step.RewardByAgent,
+				FastSearch:    step.FastSearch,
+				Resign:        step.Resign,
+				SearchStats:   stats,
+			})
+		}
+	}
+	return augmented, nil
+}
+
+func (r Record[S, Ac, Ag]) AugmentedSteps(symmetryFuncs []game.SymmetryFunc[S, Ac]) ([]Step[S, Ac, Ag], error) {
+	return AugmentSteps(r.Steps, symmetryFuncs)
+}
+
+// Trajectory は、agentの手番の系列を game.Trajectory として返す。
+// 2つ目の返り値は、各手番に対応する Steps のインデックス。
+// 報酬は、他のエージェントの手番で得たものも含め、次の自分の手番までの分をまとめて割り引く。
+func (r Record[S, Ac, Ag]) Trajectory(agent Ag, gamma float32) (game.Trajectory, []int) {
+	return game.NewTrajectory(len(r.Steps), func(i int) (bool, float32, float32) {
+		step := r.Steps[i]
+		return step.Agent == agent, step.RewardByAgent[agent], step.Value
+	}, r.ResultScoreByAgent[agent], gamma)
+}
+
+// targetSteps は、各エージェントの Trajectory から returnsFunc で計算したリターンを、Valueに設定したステップを返す。
+func (r Record[S, Ac, Ag]) targetSteps(gamma float32, returnsFunc func(game.Trajectory) ([]float32, error)) ([]Step[S, Ac, Ag], error) {
+	targetSteps := slices.Clone(r.Steps)
+	done := map[Ag]bool{}
+	for _, step := range r.Steps {
+		agent := step.Agent
+		if done[agent] {
+			continue
+		}
+		done[agent] = true
 
-		// 4. 新しい Step を作成 (Policy は元のマップの参照をそのまま使い、メモリを節約)
-		elmoSteps[i] = Step[S, Ac, Ag]{
-			State:  step.State,
-			Agent:  step.Agent,
-			Action: step.Action,
-			Policy: step.Policy,
-			Value:  newValue,
+		traj, idxs := r.Trajectory(agent, gamma)
+		returns, err := returnsFunc(traj)
+		if err != nil {
+			return nil, err
+		}
+
+		for j, idx := range idxs {
+			targetSteps[idx].Value = returns[j]
 		}
 	}
-	return elmoSteps
+	return targetSteps, nil
+}
+
+// DiscountedOutcomeSteps は、ゲーム終了までの報酬と結果スコアを、gammaで割り引いた合計をValueとするステップを返す。
+// gamma = 1 かつ報酬が無い場合、ElmoSteps(1.0) と一致する。
+func (r Record[S, Ac, Ag]) DiscountedOutcomeSteps(gamma float32) ([]Step[S, Ac, Ag], error) {
+	return r.TDLambdaSteps(1.0, gamma)
+}
+
+// NStepSteps は、n-stepリターンをValueとするステップを返す。
+// nは、各エージェント自身の手番の数で数え、n手先の自分の手番の探索値(Step.Value)でブートストラップする。
+func (r Record[S, Ac, Ag]) NStepSteps(n int, gamma float32) ([]Step[S, Ac, Ag], error) {
+	return r.targetSteps(gamma, func(traj game.Trajectory) ([]float32, error) {
+		return traj.NStepReturns(n)
+	})
+}
+
+// TDLambdaSteps は、TD(λ)リターンをValueとするステップを返す。
+// ブートストラップには、各エージェント自身の手番の探索値(Step.Value)を使う。
+func (r Record[S, Ac, Ag]) TDLambdaSteps(lambda, gamma float32) ([]Step[S, Ac, Ag], error) {
+	return r.targetSteps(gamma, func(traj game.Trajectory) ([]float32, error) {
+		return traj.LambdaReturns(lambda)
+	})
+}
+
+// DensePolicyTarget は、Policyを、codecのインデックスに従った密ベクトル(方策の学習のターゲット)に変換する。
+func (s Step[S, Ac, Ag]) DensePolicyTarget(codec game.ActionCodec[Ac]) ([]float32, error) {
+	return game.EncodePolicy(s.Policy, codec)
+}
+
+// DensePolicyTargets は、各ステップの DensePolicyTarget を返す。
+func DensePolicyTargets[S any, Ac, Ag comparable](steps []Step[S, Ac, Ag], codec game.ActionCodec[Ac]) ([][]float32, error) {
+	targets := make([][]float32, len(steps))
+	for i, step := range steps {
+		target, err := step.DensePolicyTarget(codec)
+		if err != nil {
+			return nil, fmt.Errorf("steps[%d]: %w", i, err)
+		}
+		targets[i] = target
+	}
+	return targets, nil
+}
+
+// PolicyTrainingSteps は、方策の学習に使えるステップ(FastSearch が false のもの)だけを返す。
+// 価値の学習には、安価な探索の手も含めた全てのステップを使ってよい。
+func PolicyTrainingSteps[S any, Ac, Ag comparable](steps []Step[S, Ac, Ag]) []Step[S, Ac, Ag] {
+	trainingSteps := make([]Step[S, Ac, Ag], 0, len(steps))
+	for _, step := range steps {
+		if !step.FastSearch {
+			trainingSteps = append(trainingSteps, step)
+		}
+	}
+	return trainingSteps
 }
@@ -239,6 +239,171 @@ func TestEngineRecordElmoSteps(t *testing.T) {
 	}
 }
 
+func TestAugmentSteps(t *testing.T) {
+	engine := ttt.NewEngine()
+	accr := sequential.NewRandomActorCritic[ttt.State, ttt.Action, ttt.Mark]()
+	rngs, err := randx.NewPCGs(1)
+	if err != nil {
+		panic(err)
+	}
+
+	records, err := engine.RecordPlayouts([]ttt.State{ttt.NewInitialState()}, accr, rngs, 9)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	record := records[0]
+
+	symmetryFuncs := ttt.SymmetryFuncs()
+	augmented, err := record.AugmentedSteps(symmetryFuncs)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	want := len(record.Steps) * len(symmetryFuncs)
+	if len(augmented) != want {
+		t.Fatalf("len(augmented)の不一致: got = %d, want = %d", len(augmented), want)
+	}
+
+	for i, step := range augmented {
+		// 変換後のPolicyは、変換後の状態の合法手に対して妥当であるはず
+		legalActions := engine.Rule.LegalActionsFunc(step.State)
+		if err := step.Policy.ValidateForLegalActions(legalActions, true); err != nil {
+			t.Errorf("augmented[%d]のPolicyが不正: %v", i, err)
+		}
+
+		if _, ok := step.Policy[step.Action]; !ok {
+			t.Errorf("augmented[%d]のActionがPolicyに存在しない: action = %v", i, step.Action)
+		}
+
+		org := record.Steps[i/len(symmetryFuncs)]
+		if step.Agent != org.Agent || step.Value != org.Value {
+			t.Errorf("augmented[%d]のAgentまたはValueが元のステップと一致しない", i)
+		}
+	}
+
+	// 先頭の対称変換は恒等変換なので、元のステップと一致するはず
+	for i, org := range record.Steps {
+		step := augmented[i*len(symmetryFuncs)]
+		if step.State != org.State || step.Action != org.Action || !maps.Equal(step.Policy, org.Policy) {
+			t.Errorf("augmented[%d]が恒等変換の結果と一致しない", i*len(symmetryFuncs))
+		}
+	}
+
+	t.Run("異常_行動の写像が一対一ではない", func(t *testing.T) {
+		collapse := func(s ttt.State) (ttt.State, game.ActionMapFunc[ttt.Action], error) {
+			return s, func(ttt.Action) ttt.Action { return ttt.Action{} }, nil
+		}
+		_, err := sequential.AugmentSteps(record.Steps, []game.SymmetryFunc[ttt.State, ttt.Action]{collapse})
+		if err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestRecordTargetSteps(t *testing.T) {
+	// AとBが交互に手番を持ち、Aは1手目で報酬1、Bは3手目で報酬2を得る
+	record := sequential.Record[int, int, string]{
+		Steps: []sequential.Step[int, int, string]{
+			{Agent: "A", Value: 0.1, RewardByAgent: game.RewardByAgent[string]{"A": 1.0}},
+			{Agent: "B", Value: 0.2},
+			{Agent: "A", Value: 0.3, RewardByAgent: game.RewardByAgent[string]{"B": 2.0}},
+			{Agent: "B", Value: 0.4},
+		},
+		ResultScoreByAgent: game.ResultScoreByAgent[string]{"A": 1.0, "B": 0.0},
+	}
+	const gamma = 0.5
+
+	tests := []struct {
+		name        string
+		targetsFunc func() ([]sequential.Step[int, int, string], error)
+		want        []float32
+	}{
+		{
+			name:        "正常_1-step",
+			targetsFunc: func() ([]sequential.Step[int, int, string], error) { return record.NStepSteps(1, gamma) },
+			want:        []float32{1.075, 1.1, 0.25, 0.0},
+		},
+		{
+			name:        "正常_割引された結果",
+			targetsFunc: func() ([]sequential.Step[int, int, string], error) { return record.DiscountedOutcomeSteps(gamma) },
+			want:        []float32{1.0625, 1.0, 0.25, 0.0},
+		},
+		{
+			name:        "正常_TD(λ)",
+			targetsFunc: func() ([]sequential.Step[int, int, string], error) { return record.TDLambdaSteps(0.5, gamma) },
+			want:        []float32{1.06875, 1.05, 0.25, 0.0},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			steps, err := tc.targetsFunc()
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if len(steps) != len(tc.want) {
+				t.Fatalf("len(steps)の不一致: got = %d, want = %d", len(steps), len(tc.want))
+			}
+			for i, step := range steps {
+				if math.Abs(float64(step.Value-tc.want[i])) > 0.0001 {
+					t.Errorf("steps[%d].Valueの不一致: got = %f, want = %f", i, step.Value, tc.want[i])
+				}
+				if step.Agent != record.Steps[i].Agent {
+					t.Errorf("steps[%d].Agentの不一致: got = %s, want = %s", i, step.Agent, record.Steps[i].Agent)
+				}
+			}
+		})
+	}
+
+	// 元の記録は変更されない
+	if record.Steps[0].Value != 0.1 {
+		t.Errorf("元の記録のValueが変更された: got = %f, want = 0.1", record.Steps[0].Value)
+	}
+
+	// 報酬が無く、gamma = 1 の場合、割引された結果は ElmoSteps(1.0) と一致する
+	noReward := sequential.Record[int, int, string]{
+		Steps: []sequential.Step[int, int, string]{
+			{Agent: "A", Value: 0.1},
+			{Agent: "B", Value: 0.2},
+		},
+		ResultScoreByAgent: game.ResultScoreByAgent[string]{"A": 1.0, "B": 0.0},
+	}
+	discounted, err := noReward.DiscountedOutcomeSteps(1.0)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	for i, step := range noReward.ElmoSteps(1.0) {
+		if math.Abs(float64(discounted[i].Value-step.Value)) > 0.0001 {
+			t.Errorf("steps[%d]: ElmoSteps(1.0)と一致しない: got = %f, want = %f", i, discounted[i].Value, step.Value)
+		}
+	}
+}
+
+func TestEngineRecordPlayouts_RewardFunc(t *testing.T) {
+	engine := ttt.NewEngine()
+	// 手を指したエージェントが、毎手1の報酬を得る
+	engine.RewardFunc = func(s ttt.State, a ttt.Action, next ttt.State) (game.RewardByAgent[ttt.Mark], error) {
+		return game.RewardByAgent[ttt.Mark]{s.Turn: 1.0}, nil
+	}
+
+	accr := sequential.NewRandomActorCritic[ttt.State, ttt.Action, ttt.Mark]()
+	rngs, err := randx.NewPCGs(1)
+	if err != nil {
+		panic(err)
+	}
+
+	records, err := engine.RecordPlayouts([]ttt.State{ttt.NewInitialState()}, accr, rngs, 9)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	for i, step := range records[0].Steps {
+		if step.RewardByAgent[step.Agent] != 1.0 {
+			t.Errorf("Steps[%d]の報酬の不一致: got = %f, want = 1.0", i, step.RewardByAgent[step.Agent])
+		}
+	}
+}
+
 // 終了しないゲームでも、MaxStepsを設定すればプレイアウトがエラーで止まる事を確認する
 func TestEnginePlayouts_MaxSteps(t *testing.T) {
 	// 常に同じ状態に戻る、終了しないゲーム
@@ -410,3 +575,285 @@ func TestEngineCrossPlayoutRecorderNext(t *testing.T) {
 		t.Errorf("平均スコアの合計の不一致: got = %f, want = 1.0", sum)
 	}
 }
+
+func TestEnginePlayoutReturns(t *testing.T) {
+	// 3手で終了する一人用ゲーム。毎手1の報酬を得て、得点は手数と一致する
+	engine := sequential.Engine[int, int, string]{
+		Rule: sequential.Rule[int, int, string]{
+			LegalActionsFunc: func(int) []int { return []int{0} },
+			TransitionFunc:   func(s int, a int) (int, error) { return s + 1, nil },
+			EqualFunc:        func(a, b int) bool { return a == b },
+			CurrentAgentFunc: func(int) string { return "A" },
+		},
+		RankByAgentFunc: func(s int) (game.RankByAgent[string], error) {
+			if s < 3 {
+				return game.RankByAgent[string]{}, nil
+			}
+			return game.RankByAgent[string]{"A": 1}, nil
+		},
+		RewardFunc: func(s, a, next int) (game.RewardByAgent[string], error) {
+			return game.RewardByAgent[string]{"A": 1.0}, nil
+		},
+		Agents: []string{"A"},
+	}
+	engine.SetStandardResultScoreByAgentFunc()
+
+	accr := sequential.NewRandomActorCritic[int, int, string]()
+	rngs, err := randx.NewPCGs(1)
+	if err != nil {
+		panic(err)
+	}
+
+	// 報酬の合計(3) + 結果スコア(1)
+	returns, err := engine.PlayoutReturns([]int{0}, accr, rngs)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if math.Abs(float64(returns[0]["A"])-4.0) > 0.0001 {
+		t.Errorf("リターンの不一致: got = %f, want = 4.0", returns[0]["A"])
+	}
+
+	// 得点から結果スコアを計算する場合、ResultScoreByAgentFuncの代わりに使われる
+	pointFunc := func(s int) (game.PointByAgent[string], error) {
+		return game.PointByAgent[string]{"A": float32(s)}, nil
+	}
+	f, err := game.NewPointDifferenceResultScoreByAgentFunc[string](6.0)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	engine.SetPointResultScoreByAgentFunc(pointFunc, f)
+	engine.ResultScoreByAgentFunc = nil
+
+	if err := engine.Validate(); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	// 0.5 + 3/(2*6) = 0.75
+	scores, err := engine.EvaluateResultScoreByAgent(3)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if math.Abs(float64(scores["A"])-0.75) > 0.0001 {
+		t.Errorf("結果スコアの不一致: got = %f, want = 0.75", scores["A"])
+	}
+
+	t.Run("異常_PointByAgentFuncがnil", func(t *testing.T) {
+		e := engine
+		e.PointByAgentFunc = nil
+		if err := e.Validate(); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestDensePolicyTargets(t *testing.T) {
+	engine := ttt.NewEngine()
+	rngs, err := randx.NewPCGs(1)
+	if err != nil {
+		panic(err)
+	}
+
+	records, err := engine.RecordPlayouts([]ttt.State{ttt.NewInitialState()}, sequential.NewRandomActorCritic[ttt.State, ttt.Action, ttt.Mark](), rngs, 1)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	codec := ttt.NewActionCodec()
+	steps := records[0].Steps
+	targets, err := sequential.DensePolicyTargets(steps, codec)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	for i, step := range steps {
+		if len(targets[i]) != codec.Size() {
+			t.Fatalf("targets[%d]の長さの不一致: got = %d, want = %d", i, len(targets[i]), codec.Size())
+		}
+
+		// 一様ランダム方策なので、合法手(空きマス)に等しい確率が割り当てられる
+		legalActions := engine.Rule.LegalActionsFunc(step.State)
+		want := 1.0 / float32(len(legalActions))
+		for _, a := range legalActions {
+			idx, err := codec.Index(a)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if math.Abs(float64(targets[i][idx]-want)) > 1e-6 {
+				t.Errorf("targets[%d][%d]の不一致: got = %f, want = %f", i, idx, targets[i][idx], want)
+			}
+		}
+
+		// 往復で元のpolicyに戻る
+		policy, err := game.DecodePolicy(targets[i], legalActions, codec)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		for a, p := range step.Policy {
+			if math.Abs(float64(policy[a]-p)) > 1e-6 {
+				t.Errorf("steps[%d]の往復の不一致: action = %v, got = %f, want = %f", i, a, policy[a], p)
+			}
+		}
+	}
+}
+
+// constantValueFunc は、一様な方策と一定の価値を返す PolicyValueFunc を返す。
+func constantValueFunc(v float32) sequential.PolicyValueFunc[ttt.State, ttt.Action] {
+	return func(state ttt.State, legalActions []ttt.Action) (game.Policy[ttt.Action], float32, error) {
+		policy, err := sequential.UniformPolicyFunc(state, legalActions)
+		return policy, v, err
+	}
+}
+
+func TestEngineRecordPlayoutsWithConfig(t *testing.T) {
+	engine := ttt.NewEngine()
+	rngs, err := randx.NewPCGs(2)
+	if err != nil {
+		panic(err)
+	}
+
+	n := 200
+	inits := make([]ttt.State, n)
+	for i := range inits {
+		inits[i] = ttt.NewInitialState()
+	}
+
+	t.Run("統計_探索量のランダム化", func(t *testing.T) {
+		// 完全な探索は価値1、安価な探索は価値0を返すので、Valueでどちらを使ったか分かる
+		accr := sequential.NewRandomActorCritic[ttt.State, ttt.Action, ttt.Mark]()
+		accr.PolicyValueFunc = constantValueFunc(1.0)
+		config := sequential.RecordConfig[ttt.State, ttt.Action]{
+			FastPolicyValueFunc:   constantValueFunc(0.0),
+			FullSearchProbability: 0.25,
+		}
+
+		records, err := engine.RecordPlayoutsWithConfig(inits, accr, rngs, 9, config)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		var total, full int
+		for _, record := range records {
+			if record.Resigned || record.ResignDisabled {
+				t.Errorf("投了が無効なのに、投了の印が付いている")
+			}
+			for _, step := range record.Steps {
+				if step.FastSearch != (step.Value == 0.0) {
+					t.Fatalf("FastSearchの不一致: FastSearch = %t, Value = %f", step.FastSearch, step.Value)
+				}
+				total++
+				if !step.FastSearch {
+					full++
+				}
+			}
+
+			policySteps := sequential.PolicyTrainingSteps(record.Steps)
+			for _, step := range policySteps {
+				if step.FastSearch {
+					t.Errorf("PolicyTrainingStepsに安価な探索のステップが含まれている")
+				}
+			}
+		}
+
+		ratio := float64(full) / float64(total)
+		if math.Abs(ratio-0.25) > 0.05 {
+			t.Errorf("完全な探索の割合の不一致: got = %.3f, want = 0.250(±0.050)", ratio)
+		}
+	})
+
+	t.Run("正常_投了", func(t *testing.T) {
+		// 全ての局面で価値0なので、先手は自分の2手目で投了する
+		accr := sequential.NewRandomActorCritic[ttt.State, ttt.Action, ttt.Mark]()
+		accr.PolicyValueFunc = constantValueFunc(0.0)
+		config := sequential.RecordConfig[ttt.State, ttt.Action]{
+			ResignConsecutiveSteps: 2,
+			ResignThreshold:        0.1,
+		}
+
+		records, err := engine.RecordPlayoutsWithConfig(inits[:10], accr, rngs, 9, config)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		for i, record := range records {
+			if !record.Resigned || record.ResignDisabled {
+				t.Fatalf("records[%d]: 投了していない: Resigned = %t, ResignDisabled = %t", i, record.Resigned, record.ResignDisabled)
+			}
+			if len(record.Steps) != 3 {
+				t.Fatalf("records[%d]の手数の不一致: got = %d, want = 3", i, len(record.Steps))
+			}
+
+			last := record.Steps[2]
+			if !last.Resign {
+				t.Errorf("records[%d]: 最後の手に投了の印が付いていない", i)
+			}
+			// 投了した手は指されていないので、最終状態は最後のステップの状態と一致する
+			if !engine.Rule.EqualFunc(record.FinalState, last.State) {
+				t.Errorf("records[%d]: FinalStateが投了した局面と一致しない", i)
+			}
+
+			winner := record.Steps[1].Agent
+			if record.ResultScoreByAgent[last.Agent] != 0.0 || record.ResultScoreByAgent[winner] != 1.0 {
+				t.Errorf("records[%d]のスコアの不一致: got = %v", i, record.ResultScoreByAgent)
+			}
+		}
+	})
+
+	t.Run("正常_投了を無効にした対局", func(t *testing.T) {
+		accr := sequential.NewRandomActorCritic[ttt.State, ttt.Action, ttt.Mark]()
+		accr.PolicyValueFunc = constantValueFunc(0.0)
+		config := sequential.RecordConfig[ttt.State, ttt.Action]{
+			ResignConsecutiveSteps: 2,
+			ResignThreshold:        0.1,
+			NoResignProbability:    1.0,
+		}
+
+		records, err := engine.RecordPlayoutsWithConfig(inits[:50], accr, rngs, 9, config)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		for i, record := range records {
+			if record.Resigned || !record.ResignDisabled {
+				t.Fatalf("records[%d]: 終局まで指していない: Resigned = %t, ResignDisabled = %t", i, record.Resigned, record.ResignDisabled)
+			}
+			isEnd, err := engine.IsTerminal(record.FinalState)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if !isEnd {
+				t.Errorf("records[%d].FinalStateがゲーム終了状態ではない", i)
+			}
+
+			// 最初に投了の条件を満たした手だけに印が付く
+			for j, step := range record.Steps {
+				if step.Resign != (j == 2) {
+					t.Errorf("records[%d].Steps[%d].Resignの不一致: got = %t", i, j, step.Resign)
+				}
+			}
+
+			// 投了するはずだったエージェントが負けなかった場合が、誤った投了
+			falseResign, err := engine.FalseResign(record)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			want := record.ResultScoreByAgent[record.Steps[2].Agent] > 0.0
+			if falseResign != want {
+				t.Errorf("records[%d]: FalseResignの不一致: got = %t, want = %t", i, falseResign, want)
+			}
+		}
+	})
+
+	t.Run("異常_設定が不正", func(t *testing.T) {
+		accr := sequential.NewRandomActorCritic[ttt.State, ttt.Action, ttt.Mark]()
+		configs := []sequential.RecordConfig[ttt.State, ttt.Action]{
+			{FullSearchProbability: 1.5},
+			{ResignConsecutiveSteps: -1},
+			{NoResignProbability: -0.1},
+		}
+		for i, config := range configs {
+			if _, err := engine.RecordPlayoutsWithConfig(inits[:1], accr, rngs, 9, config); err == nil {
+				t.Errorf("configs[%d]: エラーを期待したが、nilが返された", i)
+			}
+		}
+	})
+}
@@ -32,10 +32,27 @@ func UniformPolicyNoValueFunc[S any, Ac, Ag comparable](state S, legalActionsByA
 	return policyByAgent, valueByAgent, nil
 }
 
+// SearchStatsByAgent は、各エージェントの行動選択に関する探索の統計。
+type SearchStatsByAgent[Ac, Ag comparable] map[Ag]*game.SearchStats[Ac, Ag]
+
+// PolicyValueStatsFunc は、PolicyValueFunc に加えて、探索の統計を返す。統計が無い場合は nil を返してもよい。
+type PolicyValueStatsFunc[S any, Ac, Ag comparable] func(S, LegalActionsByAgent[Ac, Ag]) (PolicyByAgent[Ac, Ag], ValueByAgent[Ag], SearchStatsByAgent[Ac, Ag], error)
+
+// PolicyValueFunc は、探索の統計を捨てる PolicyValueFunc を返す。
+func (f PolicyValueStatsFunc[S, Ac, Ag]) PolicyValueFunc() PolicyValueFunc[S, Ac, Ag] {
+	return func(state S, legalActionsByAgent LegalActionsByAgent[Ac, Ag]) (PolicyByAgent[Ac, Ag], ValueByAgent[Ag], error) {
+		policyByAgent, valueByAgent, _, err := f(state, legalActionsByAgent)
+		return policyByAgent, valueByAgent, err
+	}
+}
+
 type ActorCritic[S any, Ac, Ag comparable] struct {
 	Name            game.ActorCriticName
 	PolicyValueFunc PolicyValueFunc[S, Ac, Ag]
 	SelectFunc      game.SelectFunc[Ac, Ag]
+	// PolicyValueStatsFunc は任意。設定した場合、RecordPlayouts は PolicyValueFunc の代わりにこれを使い、
+	// 探索の統計を Step.SearchStatsByAgent に記録する。PolicyValueFunc と同じ方策と価値を返すべき。
+	PolicyValueStatsFunc PolicyValueStatsFunc[S, Ac, Ag]
 }
 
 func NewRandomActorCritic[S any, Ac, Ag comparable]() ActorCritic[S, Ac, Ag] {
@@ -55,3 +72,22 @@ func (a ActorCritic[S, Ac, Ag]) Validate() error {
 	}
 	return nil
 }
+
+// DecodePolicyByAgent は、各エージェントのモデルの出力ベクトルから、合法手でマスクして正規化したPolicyByAgentを返す。
+// legalActionsByAgent の全てのエージェントについて、出力ベクトルが存在するべき。
+func DecodePolicyByAgent[Ac, Ag comparable](outputByAgent map[Ag][]float32, legalActionsByAgent LegalActionsByAgent[Ac, Ag], codec game.ActionCodec[Ac]) (PolicyByAgent[Ac, Ag], error) {
+	policyByAgent := make(PolicyByAgent[Ac, Ag], len(legalActionsByAgent))
+	for agent, legalActions := range legalActionsByAgent {
+		output, ok := outputByAgent[agent]
+		if !ok {
+			return nil, fmt.Errorf("エージェントの出力ベクトルが存在しません: agent = %v", agent)
+		}
+
+		policy, err := game.DecodePolicy(output, legalActions, codec)
+		if err != nil {
+			return nil, fmt.Errorf("agent = %v: %w", agent, err)
+		}
+		policyByAgent[agent] = policy
+	}
+	return policyByAgent, nil
+}
@@ -7,79 +7,108 @@ import (
 	"slices"
 
 	"github.com/sw965/crow/game"
-	"github.com/sw965/omw/mathx/randx"
-	"github.com/sw965/omw/parallel"
-	"github.com/sw965/omw/slicesx"
 )
 
 func (e *Engine[S, Ac, Ag]) Playouts(inits []S, accr ActorCritic[S, Ac, Ag], rngs []*rand.Rand) ([]S, error) {
-	if err := e.Validate(); err != nil {
-		return nil, err
-	}
+	finals, _, err := e.playouts(inits, accr, rngs)
+	return finals, err
+}
 
-	if err := accr.Validate(); err != nil {
+// PlayoutReturns は、プレイアウトを行い、各試合の結果スコアに途中の報酬(RewardFunc)の合計を加えたものを返す。
+// RewardFuncがnilの場合、結果スコアと一致する。
+func (e *Engine[S, Ac, Ag]) PlayoutReturns(inits []S, accr ActorCritic[S, Ac, Ag], rngs []*rand.Rand) ([]game.ResultScoreByAgent[Ag], error) {
+	finals, rewardSums, err := e.playouts(inits, accr, rngs)
+	if err != nil {
 		return nil, err
 	}
 
-	n := len(inits)
-	p := len(rngs)
-	finals := make([]S, n)
+	returns := make([]game.ResultScoreByAgent[Ag], len(finals))
+	for i, final := range finals {
+		scores, err := e.EvaluateResultScoreByAgent(final)
+		if err != nil {
+			return nil, err
+		}
 
-	err := parallel.For(n, p, func(workerID, idx int) error {
-		rng := rngs[workerID]
-		state := inits[idx]
-		numSteps := 0
-		for {
-			isEnd, err := e.IsTerminal(state)
-			if err != nil {
-				return err
-			}
+		for agent, r := range rewardSums[i] {
+			scores[agent] += r
+		}
+		returns[i] = scores
+	}
+	return returns, nil
+}
 
-			if isEnd {
-				break
-			}
+// playouts は、各試合の最終状態と、途中の報酬の合計を返す。RewardFuncがnilの場合、報酬の合計はnil。
+func (e *Engine[S, Ac, Ag]) playouts(inits []S, accr ActorCritic[S, Ac, Ag], rngs []*rand.Rand) ([]S, []game.RewardByAgent[Ag], error) {
+	if err := e.Validate(); err != nil {
+		return nil, nil, err
+	}
 
-			if e.MaxSteps > 0 && numSteps >= e.MaxSteps {
-				return fmt.Errorf("手数がMaxSteps(%d)に達してもゲームが終了しませんでした", e.MaxSteps)
-			}
+	if err := accr.Validate(); err != nil {
+		return nil, nil, err
+	}
 
+	rewardSums := make([]game.RewardByAgent[Ag], len(inits))
+	newStepFunc := func(gameIdx int, rng *rand.Rand) game.PlayoutStepFunc[S] {
+		return func(state S, stepIdx int) (S, bool, error) {
 			legalActionsByAgent := e.Rule.LegalActionsByAgentFunc(state)
 			if len(legalActionsByAgent) == 0 {
-				return errors.New("ゲームが終了していないのに合法手がありません")
+				return state, false, errors.New("ゲームが終了していないのに合法手がありません")
 			}
 
 			policyByAgent, _, err := accr.PolicyValueFunc(state, legalActionsByAgent)
 			if err != nil {
-				return err
+				return state, false, err
 			}
 
-			jointAction := make(JointAction[Ac, Ag], len(e.Agents))
-			for _, agent := range e.Agents {
-				legalActions := legalActionsByAgent[agent]
-				policy := policyByAgent[agent]
+			jointAction, err := e.selectJointAction(legalActionsByAgent, policyByAgent, accr.SelectFunc, stepIdx, rng)
+			if err != nil {
+				return state, false, err
+			}
+
+			next, err := e.Rule.TransitionFunc(state, jointAction)
+			if err != nil {
+				return state, false, err
+			}
 
-				err = policy.ValidateForLegalActions(legalActions, false)
+			if e.RewardFunc != nil {
+				rewards, err := e.RewardFunc(state, jointAction, next)
 				if err != nil {
-					return err
+					return state, false, err
 				}
 
-				action, err := accr.SelectFunc(policy, agent, rng)
-				if err != nil {
-					return err
+				if rewardSums[gameIdx] == nil {
+					rewardSums[gameIdx] = game.RewardByAgent[Ag]{}
+				}
+				for agent, r := range rewards {
+					rewardSums[gameIdx][agent] += r
 				}
-				jointAction[agent] = action
 			}
+			return next, false, nil
+		}
+	}
 
-			state, err = e.Rule.TransitionFunc(state, jointAction)
-			if err != nil {
-				return err
-			}
-			numSteps++
+	finals, err := game.RunPlayouts(inits, rngs, e.MaxSteps, e.IsTerminal, newStepFunc)
+	return finals, rewardSums, err
+}
+
+// selectJointAction は、各エージェントの方策を検証し、selectFunc で選んだ行動の組を返す。
+func (e *Engine[S, Ac, Ag]) selectJointAction(legalActionsByAgent LegalActionsByAgent[Ac, Ag], policyByAgent PolicyByAgent[Ac, Ag], selectFunc game.SelectFunc[Ac, Ag], stepIdx int, rng *rand.Rand) (JointAction[Ac, Ag], error) {
+	jointAction := make(JointAction[Ac, Ag], len(e.Agents))
+	for _, agent := range e.Agents {
+		legalActions := legalActionsByAgent[agent]
+		policy := policyByAgent[agent]
+
+		if err := policy.ValidateForLegalActions(legalActions, false); err != nil {
+			return nil, err
 		}
-		finals[idx] = state
-		return nil
-	})
-	return finals, err
+
+		action, err := selectFunc(policy, agent, stepIdx, rng)
+		if err != nil {
+			return nil, err
+		}
+		jointAction[agent] = action
+	}
+	return jointAction, nil
 }
 
 func (e *Engine[S, Ac, Ag]) RecordPlayouts(inits []S, accr ActorCritic[S, Ac, Ag], rngs []*rand.Rand, initStepsCap int) ([]Record[S, Ac, Ag], error) {
@@ -87,113 +116,95 @@ func (e *Engine[S, Ac, Ag]) RecordPlayouts(inits []S, accr ActorCritic[S, Ac, Ag
 		return nil, err
 	}
 
-	n := len(inits)
-	p := len(rngs)
-	records := make([]Record[S, Ac, Ag], n)
-
-	err := parallel.For(n, p, func(workerID, idx int) error {
-		rng := rngs[workerID]
-		state := inits[idx]
-		steps := make([]Step[S, Ac, Ag], 0, initStepsCap)
-
-		for {
-			isEnd, err := e.IsTerminal(state)
-			if err != nil {
-				return err
-			}
-			if isEnd {
-				break
-			}
-
-			if e.MaxSteps > 0 && len(steps) >= e.MaxSteps {
-				return fmt.Errorf("手数がMaxSteps(%d)に達してもゲームが終了しませんでした", e.MaxSteps)
-			}
+	records := make([]Record[S, Ac, Ag], len(inits))
+	newStepFunc := func(gameIdx int, rng *rand.Rand) game.PlayoutStepFunc[S] {
+		record := &records[gameIdx]
+		record.Steps = make([]Step[S, Ac, Ag], 0, initStepsCap)
 
+		return func(state S, stepIdx int) (S, bool, error) {
 			legalActionsByAgent := e.Rule.LegalActionsByAgentFunc(state)
 			if len(legalActionsByAgent) == 0 {
-				return errors.New("ゲームが終了していないのに合法手がありません")
+				return state, false, errors.New("ゲームが終了していないのに合法手がありません")
 			}
 
-			policyByAgent, valueByAgent, err := accr.PolicyValueFunc(state, legalActionsByAgent)
+			var policyByAgent PolicyByAgent[Ac, Ag]
+			var valueByAgent ValueByAgent[Ag]
+			var statsByAgent SearchStatsByAgent[Ac, Ag]
+			var err error
+			if accr.PolicyValueStatsFunc != nil {
+				policyByAgent, valueByAgent, statsByAgent, err = accr.PolicyValueStatsFunc(state, legalActionsByAgent)
+			} else {
+				policyByAgent, valueByAgent, err = accr.PolicyValueFunc(state, legalActionsByAgent)
+			}
 			if err != nil {
-				return err
+				return state, false, err
 			}
 
-			jointAction := make(JointAction[Ac, Ag], len(e.Agents))
-			for _, agent := range e.Agents {
-				legalActions := legalActionsByAgent[agent]
-				policy := policyByAgent[agent]
+			jointAction, err := e.selectJointAction(legalActionsByAgent, policyByAgent, accr.SelectFunc, stepIdx, rng)
+			if err != nil {
+				return state, false, err
+			}
 
-				if err := policy.ValidateForLegalActions(legalActions, false); err != nil {
-					return err
-				}
+			next, err := e.Rule.TransitionFunc(state, jointAction)
+			if err != nil {
+				return state, false, err
+			}
 
-				action, err := accr.SelectFunc(policy, agent, rng)
+			var rewards game.RewardByAgent[Ag]
+			if e.RewardFunc != nil {
+				rewards, err = e.RewardFunc(state, jointAction, next)
 				if err != nil {
-					return err
+					return state, false, err
 				}
-				jointAction[agent] = action
 			}
 
-			steps = append(steps, Step[S, Ac, Ag]{
-				State:         state,
-				JointAction:   jointAction,
-				PolicyByAgent: policyByAgent,
-				ValueByAgent:  valueByAgent,
+			record.Steps = append(record.Steps, Step[S, Ac, Ag]{
+				State:              state,
+				JointAction:        jointAction,
+				PolicyByAgent:      policyByAgent,
+				ValueByAgent:       valueByAgent,
+				RewardByAgent:      rewards,
+				SearchStatsByAgent: statsByAgent,
 			})
-
-			state, err = e.Rule.TransitionFunc(state, jointAction)
-			if err != nil {
-				return err
-			}
+			return next, false, nil
 		}
+	}
 
-		scores, err := e.EvaluateResultScoreByAgent(state)
-		if err != nil {
-			return err
-		}
+	finals, err := game.RunPlayouts(inits, rngs, e.MaxSteps, e.IsTerminal, newStepFunc)
+	if err != nil {
+		return records, err
+	}
 
-		records[idx] = Record[S, Ac, Ag]{
-			Steps:              steps,
-			FinalState:         state,
-			ResultScoreByAgent: scores,
+	for i := range records {
+		scores, err := e.EvaluateResultScoreByAgent(finals[i])
+		if err != nil {
+			return records, err
 		}
-		return nil
-	})
 
-	return records, err
+		records[i].FinalState = finals[i]
+		records[i].ResultScoreByAgent = scores
+	}
+	return records, nil
 }
 
 // NewCrossPlayoutRecorderは、複数のActorCriticを総当たりで対戦させる game.CrossPlayoutRecorder を返す。
-// 総当たりの進行とスコアの集計は共通実装(game側)が担い、ここでは並び1組分の対戦の実行方法だけを定義する。
+// 並びの列挙・総当たりの進行・スコアの集計は共通実装(game.NewPermutationCrossPlayoutRecorder)が担い、
+// ここでは並び1組分の対戦の実行方法だけを定義する。
 func (e *Engine[S, Ac, Ag]) NewCrossPlayoutRecorder(inits []S, accrs []ActorCritic[S, Ac, Ag], p int) (*game.CrossPlayoutRecorder[Record[S, Ac, Ag], Ag], error) {
 	agentsN := len(e.Agents)
-	if len(accrs) < agentsN {
-		return nil, fmt.Errorf("ActorCriticが不足しています: len(accrs) = %d: %d 以上であるべき", len(accrs), agentsN)
-	}
-
-	accrPerms := slices.Collect(slicesx.Permutations(accrs, agentsN))
-	// TODO: 暫定的にpanicでガードしている。エラーの扱いを決めたら見直す。
-	rngs, err := randx.NewPCGs(p)
-	if err != nil {
-		panic(err)
+	nameFunc := func(accr ActorCritic[S, Ac, Ag]) game.ActorCriticName {
+		return accr.Name
 	}
 
-	accrNames := make([]game.ActorCriticName, len(accrs))
-	for i, accr := range accrs {
-		accrNames[i] = accr.Name
-	}
-
-	playPermutationFunc := func(permIdx, initStepsCap int) ([]Record[S, Ac, Ag], map[Ag]game.ActorCriticName, error) {
-		accrPerm := accrPerms[permIdx]
-		accrNameByAgent := make(map[Ag]game.ActorCriticName, agentsN)
+	playFunc := func(accrPerm []ActorCritic[S, Ac, Ag], accrNameByAgent map[Ag]game.ActorCriticName, rngs []*rand.Rand, initStepsCap int) ([]Record[S, Ac, Ag], error) {
 		pvFuncByAgent := make(map[Ag]PolicyValueFunc[S, Ac, Ag], agentsN)
+		pvStatsFuncByAgent := make(map[Ag]PolicyValueStatsFunc[S, Ac, Ag], agentsN)
 		selectFuncByAgent := make(map[Ag]game.SelectFunc[Ac, Ag], agentsN)
 
 		for i, agent := range e.Agents {
 			accr := accrPerm[i]
-			accrNameByAgent[agent] = accr.Name
 			pvFuncByAgent[agent] = accr.PolicyValueFunc
+			pvStatsFuncByAgent[agent] = accr.PolicyValueStatsFunc
 			selectFuncByAgent[agent] = accr.SelectFunc
 		}
 
@@ -212,31 +223,65 @@ func (e *Engine[S, Ac, Ag]) NewCrossPlayoutRecorder(inits []S, accrs []ActorCrit
 			return policyByAgent, valueByAgent, nil
 		}
 
-		selectFunc := func(p game.Policy[Ac], agent Ag, rng *rand.Rand) (Ac, error) {
-			return selectFuncByAgent[agent](p, agent, rng)
+		selectFunc := func(p game.Policy[Ac], agent Ag, stepIdx int, rng *rand.Rand) (Ac, error) {
+			return selectFuncByAgent[agent](p, agent, stepIdx, rng)
+		}
+
+		// 探索の統計を返すActorCriticのエージェントでは、その統計も記録する
+		pvStatsFunc := func(state S, legalActionsByAgent LegalActionsByAgent[Ac, Ag]) (PolicyByAgent[Ac, Ag], ValueByAgent[Ag], SearchStatsByAgent[Ac, Ag], error) {
+			policyByAgent := make(PolicyByAgent[Ac, Ag], agentsN)
+			valueByAgent := make(ValueByAgent[Ag], agentsN)
+			statsByAgent := SearchStatsByAgent[Ac, Ag]{}
+
+			for _, agent := range e.Agents {
+				if f := pvStatsFuncByAgent[agent]; f != nil {
+					actorPolicyByAgent, actorValueByAgent, actorStatsByAgent, err := f(state, legalActionsByAgent)
+					if err != nil {
+						return nil, nil, nil, err
+					}
+					policyByAgent[agent] = actorPolicyByAgent[agent]
+					valueByAgent[agent] = actorValueByAgent[agent]
+					if stats, ok := actorStatsByAgent[agent]; ok {
+						statsByAgent[agent] = stats
+					}
+					continue
+				}
+
+				actorPolicyByAgent, actorValueByAgent, err := pvFuncByAgent[agent](state, legalActionsByAgent)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				policyByAgent[agent] = actorPolicyByAgent[agent]
+				valueByAgent[agent] = actorValueByAgent[agent]
+			}
+			if len(statsByAgent) == 0 {
+				statsByAgent = nil
+			}
+			return policyByAgent, valueByAgent, statsByAgent, nil
 		}
 
 		wrapperActor := ActorCritic[S, Ac, Ag]{
-			PolicyValueFunc: pvFunc,
-			SelectFunc:      selectFunc,
+			PolicyValueFunc:      pvFunc,
+			SelectFunc:           selectFunc,
+			PolicyValueStatsFunc: pvStatsFunc,
 		}
 
 		records, err := e.RecordPlayouts(inits, wrapperActor, rngs, initStepsCap)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 
 		for i := range records {
 			records[i].ActorCriticNameByAgent = accrNameByAgent
 		}
-		return records, accrNameByAgent, nil
+		return records, nil
 	}
 
 	resultScoreFromRecordFunc := func(r Record[S, Ac, Ag]) game.ResultScoreByAgent[Ag] {
 		return r.ResultScoreByAgent
 	}
 
-	return game.NewCrossPlayoutRecorder(accrNames, len(accrPerms), len(inits), playPermutationFunc, resultScoreFromRecordFunc), nil
+	return game.NewPermutationCrossPlayoutRecorder(e.Agents, accrs, nameFunc, len(inits), p, playFunc, resultScoreFromRecordFunc)
 }
 
 type Step[S any, Ac, Ag comparable] struct {
@@ -244,6 +289,10 @@ type Step[S any, Ac, Ag comparable] struct {
 	JointAction   JointAction[Ac, Ag]
 	PolicyByAgent PolicyByAgent[Ac, Ag]
 	ValueByAgent  ValueByAgent[Ag]
+	// RewardByAgent は、このステップの遷移で各エージェントが得た報酬。Engine.RewardFunc が nil の場合は nil。
+	RewardByAgent game.RewardByAgent[Ag]
+	// SearchStatsByAgent は、ActorCritic.PolicyValueStatsFunc が返した探索の統計。無い場合は nil。
+	SearchStatsByAgent SearchStatsByAgent[Ac, Ag]
 }
 
 type Record[S any, Ac, Ag comparable] struct {
@@ -254,28 +303,139 @@ type Record[S any, Ac, Ag comparable] struct {
 }
 
 func (r Record[S, Ac, Ag]) ElmoSteps(alpha float32) []Step[S, Ac, Ag] {
-	if alpha < 0.0 {
-		alpha = 0.0
-	} else if alpha > 1.0 {
-		alpha = 1.0
+	elmoSteps := slices.Clone(r.Steps)
+	for i, step := range elmoSteps {
+		newValueByAgent := make(ValueByAgent[Ag], len(step.ValueByAgent))
+		for agent, v := range step.ValueByAgent {
+			newValueByAgent[agent] = game.ElmoValue(alpha, r.ResultScoreByAgent[agent], v)
+		}
+		elmoSteps[i].ValueByAgent = newValueByAgent
 	}
+	return elmoSteps
+}
 
-	elmoSteps := make([]Step[S, Ac, Ag], len(r.Steps))
+// AugmentSteps は、各ステップに全ての対称変換を適用したステップを返す。
+// 返り値の長さは len(steps) * len(symmetryFuncs) で、ステップ毎に symmetryFuncs の順に並ぶ。
+// 元のステップも含めたい場合は、symmetryFuncsに game.IdentitySymmetryFunc を含める事。
+// 対称変換は全エージェントの行動に同じ様に適用し、ValueByAgentはそのまま引き継ぐ。
+func AugmentSteps[S any, Ac, Ag comparable](steps []Step[S, Ac, Ag], symmetryFuncs []game.SymmetryFunc[S, Ac]) ([]Step[S, Ac, Ag], error) {
+	augmented := make([]Step[S, Ac, Ag], 0, len(steps)*len(symmetryFuncs))
+	for _, step := range steps {
+		for _, f := range symmetryFuncs {
+			state, actionMapFunc, err := f(step.State)
+			if err != nil {
+				return nil, err
+			}
 
-	for i, step := range r.Steps {
-		newValueByAgent := make(ValueByAgent[Ag], len(step.ValueByAgent))
+			jointAction := make(JointAction[Ac, Ag], len(step.JointAction))
+			for agent, action := range step.JointAction {
+				jointAction[agent] = actionMapFunc(action)
+			}
 
-		for agent, v := range step.ValueByAgent {
-			z := r.ResultScoreByAgent[agent]
-			newValueByAgent[agent] = alpha*z + (1.0-alpha)*v
+			policyByAgent := make(PolicyByAgent[Ac, Ag], len(step.PolicyByAgent))
+			for agent, policy := range step.PolicyByAgent {
+				transformed, err := game.TransformPolicy(policy, actionMapFunc)
+				if err != nil {
+					return nil, err
+				}
+				policyByAgent[agent] = transformed
+			}
+
+			var statsByAgent SearchStatsByAgent[Ac, Ag]
+			if step.SearchStatsByAgent != nil {
+				statsByAgent = make(SearchStatsByAgent[Ac, Ag], len(step.SearchStatsByAgent))
+				for agent, stats := range step.SearchStatsByAgent {
+					transformed, err := game.TransformSearchStats(stats, actionMapFunc)
+					if err != nil {
+						return nil, err
+					}
+					statsByAgent[agent] = transformed
+				}
+			}
+
+			augmented = append(augmented, Step[S, Ac, Ag]{
+				State:              state,
+				JointAction:        jointAction,
+				PolicyByAgent:      policyByAgent,
+				ValueByAgent:       step.ValueByAgent,
+				RewardByAgent:      step.RewardByAgent,
+				SearchStatsByAgent: statsByAgent,
+			})
+		}
+	}
+	return augmented, nil
+}
+
+func (r Record[S, Ac, Ag]) AugmentedSteps(symmetryFuncs []game.SymmetryFunc[S, Ac]) ([]Step[S, Ac, Ag], error) {
+	return AugmentSteps(r.Steps, symmetryFuncs)
+}
+
+// Trajectory は、agentから見た系列を game.Trajectory として返す。
+// ValueByAgent に agent の価値があるステップを、agent が行動したステップとみなす。
+// 全エージェントが毎ステップ価値を持つ場合、系列の長さは len(Steps) と一致する。
+// FromSequentialActorCritic で作った記録では、手番のステップだけになり、逐次手番の記録と同じ系列になる。
+// 2つ目の返り値は、系列の各手番に対応するステップのインデックス。
+func (r Record[S, Ac, Ag]) Trajectory(agent Ag, gamma float32) (game.Trajectory, []int) {
+	return game.NewTrajectory(len(r.Steps), func(i int) (bool, float32, float32) {
+		step := r.Steps[i]
+		value, ok := step.ValueByAgent[agent]
+		return ok, step.RewardByAgent[agent], value
+	}, r.ResultScoreByAgent[agent], gamma)
+}
+
+// targetSteps は、各エージェントの Trajectory から returnsFunc で計算したリターンを、ValueByAgentに設定したステップを返す。
+// 行動しなかったステップの ValueByAgent には、そのエージェントの価値を含めない。
+func (r Record[S, Ac, Ag]) targetSteps(gamma float32, returnsFunc func(game.Trajectory) ([]float32, error)) ([]Step[S, Ac, Ag], error) {
+	targetSteps := slices.Clone(r.Steps)
+	for i := range targetSteps {
+		targetSteps[i].ValueByAgent = make(ValueByAgent[Ag], len(r.Steps[i].ValueByAgent))
+	}
+
+	for agent := range r.ResultScoreByAgent {
+		traj, idxs := r.Trajectory(agent, gamma)
+		returns, err := returnsFunc(traj)
+		if err != nil {
+			return nil, err
 		}
 
-		elmoSteps[i] = Step[S, Ac, Ag]{
-			State:         step.State,
-			JointAction:   step.JointAction,
-			PolicyByAgent: step.PolicyByAgent,
-			ValueByAgent:  newValueByAgent,
+		for j, idx := range idxs {
+			targetSteps[idx].ValueByAgent[agent] = returns[j]
 		}
 	}
-	return elmoSteps
+	return targetSteps, nil
+}
+
+// DiscountedOutcomeSteps は、ゲーム終了までの報酬と結果スコアを、gammaで割り引いた合計をValueByAgentとするステップを返す。
+// gamma = 1 かつ報酬が無い場合、ElmoSteps(1.0) と一致する。
+func (r Record[S, Ac, Ag]) DiscountedOutcomeSteps(gamma float32) ([]Step[S, Ac, Ag], error) {
+	return r.TDLambdaSteps(1.0, gamma)
+}
+
+// NStepSteps は、n-stepリターンをValueByAgentとするステップを返す。
+// nステップ先の探索値(Step.ValueByAgent)でブートストラップする。
+func (r Record[S, Ac, Ag]) NStepSteps(n int, gamma float32) ([]Step[S, Ac, Ag], error) {
+	return r.targetSteps(gamma, func(traj game.Trajectory) ([]float32, error) {
+		return traj.NStepReturns(n)
+	})
+}
+
+// TDLambdaSteps は、TD(λ)リターンをValueByAgentとするステップを返す。
+func (r Record[S, Ac, Ag]) TDLambdaSteps(lambda, gamma float32) ([]Step[S, Ac, Ag], error) {
+	return r.targetSteps(gamma, func(traj game.Trajectory) ([]float32, error) {
+		return traj.LambdaReturns(lambda)
+	})
+}
+
+// DensePolicyTargetByAgent は、各エージェントのPolicyを、codecのインデックスに従った密ベクトル(方策の学習のターゲット)に変換する。
+// 全エージェントで行動の型が共通の為、codecも共通とする。
+func (s Step[S, Ac, Ag]) DensePolicyTargetByAgent(codec game.ActionCodec[Ac]) (map[Ag][]float32, error) {
+	targetByAgent := make(map[Ag][]float32, len(s.PolicyByAgent))
+	for agent, policy := range s.PolicyByAgent {
+		target, err := game.EncodePolicy(policy, codec)
+		if err != nil {
+			return nil, fmt.Errorf("agent = %v: %w", agent, err)
+		}
+		targetByAgent[agent] = target
+	}
+	return targetByAgent, nil
 }
@@ -0,0 +1,256 @@
+package simultaneous
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+)
+
+// FromSequential は、逐次手番の engine を、同じ状態・行動・エージェントの型を持つ同時手番の Engine に変換する。
+// 各状態で、手番のエージェントは engine の合法手を、それ以外のエージェントは noop だけを合法手として持つ。
+// 遷移では手番のエージェントの行動だけを engine に渡し、他のエージェントの行動は noop であるべき。
+// noop は、どのエージェントの合法手にも含まれない値であるべき。
+//
+// 変換した Engine により、dpuct や同時手番の自己対戦の道具を、逐次手番のゲームにもそのまま使える。
+// 記録は Record.ToSequential で逐次手番の記録に戻せる。
+func FromSequential[S any, Ac, Ag comparable](engine sequential.Engine[S, Ac, Ag], noop Ac) Engine[S, Ac, Ag] {
+	legalActionsByAgent := func(state S) LegalActionsByAgent[Ac, Ag] {
+		legalActions := engine.Rule.LegalActionsFunc(state)
+		if len(legalActions) == 0 {
+			return LegalActionsByAgent[Ac, Ag]{}
+		}
+
+		mover := engine.Rule.CurrentAgentFunc(state)
+		legalActionsByAgent := make(LegalActionsByAgent[Ac, Ag], len(engine.Agents))
+		for _, agent := range engine.Agents {
+			legalActionsByAgent[agent] = []Ac{noop}
+		}
+		legalActionsByAgent[mover] = legalActions
+		return legalActionsByAgent
+	}
+
+	// moverAction は、jointAction から手番のエージェントの行動を取り出す。
+	moverAction := func(state S, jointAction JointAction[Ac, Ag]) (Ac, error) {
+		mover := engine.Rule.CurrentAgentFunc(state)
+		for agent, action := range jointAction {
+			if agent != mover && action != noop {
+				return noop, fmt.Errorf("手番でないエージェントの行動がnoopではありません: agent = %v, action = %v", agent, action)
+			}
+		}
+
+		action, ok := jointAction[mover]
+		if !ok {
+			return noop, fmt.Errorf("手番のエージェントの行動がありません: agent = %v", mover)
+		}
+		return action, nil
+	}
+
+	transition := func(state S, jointAction JointAction[Ac, Ag]) (S, error) {
+		action, err := moverAction(state, jointAction)
+		if err != nil {
+			var zero S
+			return zero, err
+		}
+		return engine.Rule.TransitionFunc(state, action)
+	}
+
+	var rewardFunc RewardFunc[S, Ac, Ag]
+	if engine.RewardFunc != nil {
+		rewardFunc = func(state S, jointAction JointAction[Ac, Ag], next S) (game.RewardByAgent[Ag], error) {
+			action, err := moverAction(state, jointAction)
+			if err != nil {
+				return nil, err
+			}
+			return engine.RewardFunc(state, action, next)
+		}
+	}
+
+	return Engine[S, Ac, Ag]{
+		Rule: Rule[S, Ac, Ag]{
+			LegalActionsByAgentFunc: legalActionsByAgent,
+			TransitionFunc:          transition,
+			EqualFunc:               EqualFunc[S](engine.Rule.EqualFunc),
+		},
+		RankByAgentFunc:             engine.RankByAgentFunc,
+		ResultScoreByAgentFunc:      engine.ResultScoreByAgentFunc,
+		Agents:                      engine.Agents,
+		RewardFunc:                  rewardFunc,
+		PointByAgentFunc:            engine.PointByAgentFunc,
+		PointResultScoreByAgentFunc: engine.PointResultScoreByAgentFunc,
+		MaxSteps:                    engine.MaxSteps,
+	}
+}
+
+// FromSequentialActorCritic は、逐次手番の accr を、FromSequential で変換した Engine の ActorCritic に変換する。
+// 手番のエージェントの方策と価値には accr の出力を使い、それ以外のエージェントの方策は noop に確率1を割り当てる。
+// ValueByAgent と SearchStatsByAgent は、手番のエージェントの分だけを持つ。
+// Record.Trajectory と replay.ReplayBuffer.AddSimultaneousSteps は、価値を持たないエージェントを行動しなかったものとして扱う為、
+// 変換した記録から作る学習データは、逐次手番の記録から作るものと一致する。
+func FromSequentialActorCritic[S any, Ac, Ag comparable](engine sequential.Engine[S, Ac, Ag], accr sequential.ActorCritic[S, Ac, Ag], noop Ac) ActorCritic[S, Ac, Ag] {
+	policyByAgent := func(state S, legalActionsByAgent LegalActionsByAgent[Ac, Ag]) (Ag, PolicyByAgent[Ac, Ag]) {
+		mover := engine.Rule.CurrentAgentFunc(state)
+		policyByAgent := make(PolicyByAgent[Ac, Ag], len(legalActionsByAgent))
+		for agent := range legalActionsByAgent {
+			if agent != mover {
+				policyByAgent[agent] = game.Policy[Ac]{noop: 1.0}
+			}
+		}
+		return mover, policyByAgent
+	}
+
+	converted := ActorCritic[S, Ac, Ag]{
+		Name: accr.Name,
+		PolicyValueFunc: func(state S, legalActionsByAgent LegalActionsByAgent[Ac, Ag]) (PolicyByAgent[Ac, Ag], ValueByAgent[Ag], error) {
+			mover, policyByAgent := policyByAgent(state, legalActionsByAgent)
+			policy, value, err := accr.PolicyValueFunc(state, legalActionsByAgent[mover])
+			if err != nil {
+				return nil, nil, err
+			}
+			policyByAgent[mover] = policy
+			return policyByAgent, ValueByAgent[Ag]{mover: value}, nil
+		},
+		SelectFunc: accr.SelectFunc,
+	}
+
+	if accr.PolicyValueStatsFunc != nil {
+		converted.PolicyValueStatsFunc = func(state S, legalActionsByAgent LegalActionsByAgent[Ac, Ag]) (PolicyByAgent[Ac, Ag], ValueByAgent[Ag], SearchStatsByAgent[Ac, Ag], error) {
+			mover, policyByAgent := policyByAgent(state, legalActionsByAgent)
+			policy, value, stats, err := accr.PolicyValueStatsFunc(state, legalActionsByAgent[mover])
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			policyByAgent[mover] = policy
+
+			var statsByAgent SearchStatsByAgent[Ac, Ag]
+			if stats != nil {
+				statsByAgent = SearchStatsByAgent[Ac, Ag]{mover: stats}
+			}
+			return policyByAgent, ValueByAgent[Ag]{mover: value}, statsByAgent, nil
+		}
+	}
+	return converted
+}
+
+// ToSequential は、各状態で高々1体のエージェントだけが noop 以外の合法手を持つ同時手番の Engine を、逐次手番の Engine に変換する。
+// noop 以外の合法手を持つエージェントを手番とし、他のエージェントには noop を行動させて遷移する。
+// 手番のエージェントがいない状態では、Agents[0] を手番とし、合法手は無いものとする。
+// 複数のエージェントが noop 以外の合法手を持つ状態は逐次手番で表せない為、その状態からの遷移はエラーを返す。
+//
+// FromSequential で変換した Engine を ToSequential で戻すと、元の engine と同じ合法手・手番・遷移を持つ。
+func (e Engine[S, Ac, Ag]) ToSequential(noop Ac) (sequential.Engine[S, Ac, Ag], error) {
+	if len(e.Agents) == 0 {
+		return sequential.Engine[S, Ac, Ag]{}, errors.New("agentsが空です: 1体以上のエージェントが必要")
+	}
+
+	isNoop := func(legalActions []Ac) bool {
+		return len(legalActions) == 0 || (len(legalActions) == 1 && legalActions[0] == noop)
+	}
+
+	// movers は、noop 以外の合法手を持つエージェントを、Agents の順に返す。
+	movers := func(legalActionsByAgent LegalActionsByAgent[Ac, Ag]) []Ag {
+		var movers []Ag
+		for _, agent := range e.Agents {
+			if !isNoop(legalActionsByAgent[agent]) {
+				movers = append(movers, agent)
+			}
+		}
+		return movers
+	}
+
+	currentAgent := func(state S) Ag {
+		if m := movers(e.Rule.LegalActionsByAgentFunc(state)); len(m) != 0 {
+			return m[0]
+		}
+		return e.Agents[0]
+	}
+
+	legalActions := func(state S) []Ac {
+		legalActionsByAgent := e.Rule.LegalActionsByAgentFunc(state)
+		if m := movers(legalActionsByAgent); len(m) != 0 {
+			return legalActionsByAgent[m[0]]
+		}
+		return nil
+	}
+
+	toJointAction := func(state S, action Ac) (JointAction[Ac, Ag], error) {
+		legalActionsByAgent := e.Rule.LegalActionsByAgentFunc(state)
+		m := movers(legalActionsByAgent)
+		switch len(m) {
+		case 0:
+			return nil, errors.New("noop以外の合法手を持つエージェントがいません")
+		case 1:
+		default:
+			return nil, fmt.Errorf("複数のエージェントが同時に行動する状態は逐次手番に変換できません: agents = %v", m)
+		}
+
+		jointAction := make(JointAction[Ac, Ag], len(legalActionsByAgent))
+		for agent := range legalActionsByAgent {
+			jointAction[agent] = noop
+		}
+		jointAction[m[0]] = action
+		return jointAction, nil
+	}
+
+	transition := func(state S, action Ac) (S, error) {
+		jointAction, err := toJointAction(state, action)
+		if err != nil {
+			var zero S
+			return zero, err
+		}
+		return e.Rule.TransitionFunc(state, jointAction)
+	}
+
+	var rewardFunc sequential.RewardFunc[S, Ac, Ag]
+	if e.RewardFunc != nil {
+		rewardFunc = func(state S, action Ac, next S) (game.RewardByAgent[Ag], error) {
+			jointAction, err := toJointAction(state, action)
+			if err != nil {
+				return nil, err
+			}
+			return e.RewardFunc(state, jointAction, next)
+		}
+	}
+
+	return sequential.Engine[S, Ac, Ag]{
+		Rule: sequential.Rule[S, Ac, Ag]{
+			LegalActionsFunc: legalActions,
+			TransitionFunc:   transition,
+			EqualFunc:        sequential.EqualFunc[S](e.Rule.EqualFunc),
+			CurrentAgentFunc: currentAgent,
+		},
+		RankByAgentFunc:             e.RankByAgentFunc,
+		ResultScoreByAgentFunc:      e.ResultScoreByAgentFunc,
+		Agents:                      e.Agents,
+		RewardFunc:                  rewardFunc,
+		PointByAgentFunc:            e.PointByAgentFunc,
+		PointResultScoreByAgentFunc: e.PointResultScoreByAgentFunc,
+		MaxSteps:                    e.MaxSteps,
+	}, nil
+}
+
+// ToSequential は、FromSequential で変換した Engine の記録を、逐次手番の記録に変換する。
+// 各ステップの手番は currentAgentFunc で求め、その手番のエージェントの行動・方策・価値・探索の統計を引き継ぐ。
+func (r Record[S, Ac, Ag]) ToSequential(currentAgentFunc sequential.CurrentAgentFunc[S, Ag]) sequential.Record[S, Ac, Ag] {
+	steps := make([]sequential.Step[S, Ac, Ag], len(r.Steps))
+	for i, step := range r.Steps {
+		agent := currentAgentFunc(step.State)
+		steps[i] = sequential.Step[S, Ac, Ag]{
+			State:         step.State,
+			Agent:         agent,
+			Action:        step.JointAction[agent],
+			Policy:        step.PolicyByAgent[agent],
+			Value:         step.ValueByAgent[agent],
+			RewardByAgent: step.RewardByAgent,
+			SearchStats:   step.SearchStatsByAgent[agent],
+		}
+	}
+
+	return sequential.Record[S, Ac, Ag]{
+		Steps:                  steps,
+		FinalState:             r.FinalState,
+		ResultScoreByAgent:     r.ResultScoreByAgent,
+		ActorCriticNameByAgent: r.ActorCriticNameByAgent,
+	}
+}
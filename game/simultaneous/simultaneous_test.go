@@ -6,7 +6,9 @@ import (
 	"testing"
 
 	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
 	"github.com/sw965/crow/game/simultaneous"
+	"github.com/sw965/crow/internal/ttt"
 	"github.com/sw965/omw/mathx/randx"
 )
 
@@ -384,3 +386,298 @@ func TestRecordElmoSteps(t *testing.T) {
 		})
 	}
 }
+
+func TestRecordNStepSteps(t *testing.T) {
+	record := simultaneous.Record[int, int, string]{
+		Steps: []simultaneous.Step[int, int, string]{
+			{
+				ValueByAgent:  simultaneous.ValueByAgent[string]{"A": 0.2, "B": 0.8},
+				RewardByAgent: game.RewardByAgent[string]{"A": 1.0},
+			},
+			{
+				ValueByAgent: simultaneous.ValueByAgent[string]{"A": 0.4, "B": 0.6},
+			},
+		},
+		ResultScoreByAgent: game.ResultScoreByAgent[string]{"A": 1.0, "B": 0.0},
+	}
+
+	steps, err := record.NStepSteps(1, 0.5)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	// G_t = r_t + γ * V_{t+1}(最後のステップは結果スコア)
+	want := []simultaneous.ValueByAgent[string]{
+		{"A": 1.2, "B": 0.3},
+		{"A": 0.5, "B": 0.0},
+	}
+	for i, step := range steps {
+		for agent, v := range want[i] {
+			if math.Abs(float64(step.ValueByAgent[agent]-v)) > 0.0001 {
+				t.Errorf("steps[%d]の%sの価値の不一致: got = %f, want = %f", i, agent, step.ValueByAgent[agent], v)
+			}
+		}
+	}
+
+	// 元の記録は変更されない
+	if record.Steps[0].ValueByAgent["A"] != 0.2 {
+		t.Errorf("元の記録のValueByAgentが変更された: got = %f, want = 0.2", record.Steps[0].ValueByAgent["A"])
+	}
+}
+
+func TestRecordTDLambdaSteps_FromSequential(t *testing.T) {
+	// FromSequentialActorCritic の記録の様に、偶数の状態は"A"、奇数の状態は"B"の手番で、
+	// 手番でないエージェントは noop の方策だけを持ち、価値を持たない
+	currentAgentFunc := func(state int) string {
+		if state%2 == 0 {
+			return "A"
+		}
+		return "B"
+	}
+
+	values := []float32{0.1, 0.7, 0.3, 0.9, 0.5}
+	steps := make([]simultaneous.Step[int, int, string], len(values))
+	for i, v := range values {
+		mover := currentAgentFunc(i)
+		other := currentAgentFunc(i + 1)
+		steps[i] = simultaneous.Step[int, int, string]{
+			State:         i,
+			JointAction:   simultaneous.JointAction[int, string]{mover: i, other: -1},
+			PolicyByAgent: simultaneous.PolicyByAgent[int, string]{mover: {i: 1.0}, other: {-1: 1.0}},
+			ValueByAgent:  simultaneous.ValueByAgent[string]{mover: v},
+			RewardByAgent: game.RewardByAgent[string]{"A": float32(i) * 0.1},
+		}
+	}
+	record := simultaneous.Record[int, int, string]{
+		Steps:              steps,
+		ResultScoreByAgent: game.ResultScoreByAgent[string]{"A": 1.0, "B": 0.0},
+	}
+
+	got, err := record.TDLambdaSteps(0.5, 0.9)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	want, err := record.ToSequential(currentAgentFunc).TDLambdaSteps(0.5, 0.9)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	for i, step := range got {
+		mover := want[i].Agent
+		if len(step.ValueByAgent) != 1 {
+			t.Errorf("steps[%d]: 手番でないエージェントの価値が含まれている: got = %v", i, step.ValueByAgent)
+		}
+		if math.Abs(float64(step.ValueByAgent[mover]-want[i].Value)) > 0.0001 {
+			t.Errorf("steps[%d]の%sの価値の不一致: got = %f, want = %f", i, mover, step.ValueByAgent[mover], want[i].Value)
+		}
+	}
+}
+
+func TestDensePolicyByAgent(t *testing.T) {
+	codec, err := game.NewSliceActionCodec(HANDS)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	step := simultaneous.Step[RockPaperScissors, Hand, int]{
+		PolicyByAgent: simultaneous.PolicyByAgent[Hand, int]{
+			agent1: {ROCK: 1.0},
+			agent2: {PAPER: 0.5, SCISSORS: 0.5},
+		},
+	}
+
+	targetByAgent, err := step.DensePolicyTargetByAgent(codec)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	wantByAgent := map[int][]float32{
+		agent1: {1.0, 0.0, 0.0},
+		agent2: {0.0, 0.5, 0.5},
+	}
+	for agent, want := range wantByAgent {
+		got := targetByAgent[agent]
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("agent = %d: got = %v, want = %v", agent, got, want)
+			}
+		}
+	}
+
+	legalActionsByAgent := simultaneous.LegalActionsByAgent[Hand, int]{
+		agent1: {ROCK, PAPER},
+		agent2: HANDS,
+	}
+	policyByAgent, err := simultaneous.DecodePolicyByAgent(targetByAgent, legalActionsByAgent, codec)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if policyByAgent[agent1][ROCK] != 1.0 || policyByAgent[agent1][PAPER] != 0.0 || len(policyByAgent[agent1]) != 2 {
+		t.Errorf("agent1のpolicyの不一致: got = %v", policyByAgent[agent1])
+	}
+	if policyByAgent[agent2][PAPER] != 0.5 || policyByAgent[agent2][SCISSORS] != 0.5 {
+		t.Errorf("agent2のpolicyの不一致: got = %v", policyByAgent[agent2])
+	}
+
+	t.Run("異常_エージェントの出力ベクトルが存在しない", func(t *testing.T) {
+		_, err := simultaneous.DecodePolicyByAgent(map[int][]float32{agent1: {1.0, 0.0, 0.0}}, legalActionsByAgent, codec)
+		if err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+var tttNoop = ttt.Action{Row: -1, Col: -1}
+
+func TestFromSequential(t *testing.T) {
+	seqEngine := ttt.NewEngine()
+	engine := simultaneous.FromSequential(seqEngine, tttNoop)
+	if err := engine.Validate(); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	init := ttt.NewInitialState()
+	legalActionsByAgent := engine.Rule.LegalActionsByAgentFunc(init)
+	if len(legalActionsByAgent[ttt.Cross]) != 9 {
+		t.Errorf("手番の合法手数の不一致: got = %d, want = 9", len(legalActionsByAgent[ttt.Cross]))
+	}
+	if got := legalActionsByAgent[ttt.Nought]; len(got) != 1 || got[0] != tttNoop {
+		t.Errorf("手番でないエージェントの合法手の不一致: got = %v, want = [%v]", got, tttNoop)
+	}
+
+	action := ttt.Action{Row: 1, Col: 1}
+	got, err := engine.Rule.TransitionFunc(init, simultaneous.JointAction[ttt.Action, ttt.Mark]{ttt.Cross: action, ttt.Nought: tttNoop})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	want, err := seqEngine.Rule.TransitionFunc(init, action)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if got != want {
+		t.Errorf("遷移の不一致: got = %v, want = %v", got, want)
+	}
+
+	t.Run("異常_手番でないエージェントがnoop以外", func(t *testing.T) {
+		_, err := engine.Rule.TransitionFunc(init, simultaneous.JointAction[ttt.Action, ttt.Mark]{ttt.Cross: action, ttt.Nought: action})
+		if err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_手番のエージェントの行動が無い", func(t *testing.T) {
+		_, err := engine.Rule.TransitionFunc(init, simultaneous.JointAction[ttt.Action, ttt.Mark]{ttt.Nought: tttNoop})
+		if err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	// 変換した Engine の記録を逐次手番の記録に戻すと、元の engine で同じ手順を辿れる
+	accr := simultaneous.FromSequentialActorCritic(seqEngine, sequential.NewRandomActorCritic[ttt.State, ttt.Action, ttt.Mark](), tttNoop)
+	rngs, err := randx.NewPCGs(4)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	inits := make([]ttt.State, 32)
+	for i := range inits {
+		inits[i] = init
+	}
+
+	records, err := engine.RecordPlayouts(inits, accr, rngs, 9)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	for i, r := range records {
+		seqRecord := r.ToSequential(seqEngine.Rule.CurrentAgentFunc)
+		state := init
+		for j, step := range seqRecord.Steps {
+			if step.State != state || step.Agent != state.Turn {
+				t.Fatalf("records[%d].Steps[%d]: 状態か手番が一致しない", i, j)
+			}
+			if len(step.Policy) != len(seqEngine.Rule.LegalActionsFunc(state)) {
+				t.Fatalf("records[%d].Steps[%d]: 方策が手番の合法手と一致しない: got = %v", i, j, step.Policy)
+			}
+
+			state, err = seqEngine.Rule.TransitionFunc(state, step.Action)
+			if err != nil {
+				t.Fatalf("records[%d].Steps[%d]: 予期せぬエラー: %v", i, j, err)
+			}
+		}
+
+		if state != seqRecord.FinalState {
+			t.Errorf("records[%d]: 最終状態の不一致", i)
+		}
+
+		scores, err := seqEngine.EvaluateResultScoreByAgent(state)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		for agent, score := range scores {
+			if seqRecord.ResultScoreByAgent[agent] != score {
+				t.Errorf("records[%d]: 結果スコアの不一致: got = %v, want = %v", i, seqRecord.ResultScoreByAgent, scores)
+			}
+		}
+	}
+}
+
+func TestEngineToSequential(t *testing.T) {
+	seqEngine := ttt.NewEngine()
+	back, err := simultaneous.FromSequential(seqEngine, tttNoop).ToSequential(tttNoop)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	// 元の engine と、合法手・手番・遷移が一致する事を、ランダムな手順で確かめる
+	rng := randx.NewPCG()
+	for range 50 {
+		state := ttt.NewInitialState()
+		for {
+			want := seqEngine.Rule.LegalActionsFunc(state)
+			got := back.Rule.LegalActionsFunc(state)
+			if len(got) != len(want) {
+				t.Fatalf("合法手の不一致: got = %v, want = %v", got, want)
+			}
+			if len(want) == 0 {
+				break
+			}
+
+			if got, want := back.Rule.CurrentAgentFunc(state), seqEngine.Rule.CurrentAgentFunc(state); got != want {
+				t.Fatalf("手番の不一致: got = %v, want = %v", got, want)
+			}
+
+			action := want[rng.IntN(len(want))]
+			next, err := back.Rule.TransitionFunc(state, action)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			wantNext, err := seqEngine.Rule.TransitionFunc(state, action)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if next != wantNext {
+				t.Fatalf("遷移の不一致: got = %v, want = %v", next, wantNext)
+			}
+			state = next
+		}
+	}
+
+	t.Run("異常_複数のエージェントが同時に行動する", func(t *testing.T) {
+		rps, err := newRPSEngine().ToSequential("")
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if _, err := rps.Rule.TransitionFunc(RockPaperScissors{}, ROCK); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_Agentsが空", func(t *testing.T) {
+		engine := newRPSEngine()
+		engine.Agents = nil
+		if _, err := engine.ToSequential(""); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
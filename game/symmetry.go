@@ -0,0 +1,32 @@
+package game
+
+import (
+	"fmt"
+)
+
+// ActionMapFunc は、対称変換で行動を写す。
+type ActionMapFunc[Ac comparable] func(Ac) Ac
+
+// SymmetryFunc は、対称変換を1つ適用した状態と、同じ変換で行動を写す関数を返す。
+// 盤面の回転・反転の様に、ゲームの結果(ランク)を変えない変換である事を前提とする。
+// ActionMapFuncは、変換前の状態の合法手を、変換後の状態の合法手へ一対一に写すべき。
+type SymmetryFunc[S any, Ac comparable] func(S) (S, ActionMapFunc[Ac], error)
+
+// IdentitySymmetryFunc は、何も変換しない対称変換(恒等変換)。
+func IdentitySymmetryFunc[S any, Ac comparable](state S) (S, ActionMapFunc[Ac], error) {
+	return state, func(a Ac) Ac { return a }, nil
+}
+
+// TransformPolicy は、policyのキー(行動)をfで写したPolicyを返す。
+// 異なる行動が同じ行動に写された場合、確率が失われる為、エラーを返す。
+func TransformPolicy[Ac comparable](policy Policy[Ac], f ActionMapFunc[Ac]) (Policy[Ac], error) {
+	transformed := make(Policy[Ac], len(policy))
+	for a, p := range policy {
+		ta := f(a)
+		if _, ok := transformed[ta]; ok {
+			return nil, fmt.Errorf("対称変換で複数の行動が同じ行動に写されました: action = %v, transformed = %v", a, ta)
+		}
+		transformed[ta] = p
+	}
+	return transformed, nil
+}
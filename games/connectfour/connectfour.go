@@ -0,0 +1,225 @@
+// Package connectfour は、重力付きの並べゲーム(Connect Four、四目並べ)の sequential.Engine を提供する。
+// 盤面の大きさと揃える数は Config で変えられる。
+//
+// 既知の理論値:
+//   - 標準の6行7列・4目は先手必勝(Allen, Allis 1988)。最善手は中央の列。
+//   - 4行4列・4目は引き分け。4行5列、5行4列も引き分け。
+//   - 4行4列・3目は先手必勝。3行3列・3目は引き分け。
+package connectfour
+
+import (
+	"fmt"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+)
+
+// Disc は、盤面のマスの状態、及びエージェント(手番)を表す。
+type Disc int8
+
+const (
+	EmptyDisc Disc = iota
+	Red            // 先手
+	Yellow         // 後手
+)
+
+func (d Disc) String() string {
+	switch d {
+	case Red:
+		return "R"
+	case Yellow:
+		return "Y"
+	default:
+		return "-"
+	}
+}
+
+func opponent(d Disc) Disc {
+	switch d {
+	case Red:
+		return Yellow
+	case Yellow:
+		return Red
+	default:
+		return EmptyDisc
+	}
+}
+
+// MaxRows と MaxCols は、盤面の大きさの上限。
+const (
+	MaxRows = 8
+	MaxCols = 8
+)
+
+// Board は、盤面。Board[0] が最下段で、Config の大きさの外側は常に EmptyDisc。
+type Board [MaxRows][MaxCols]Disc
+
+// Action は、石を落とす列(0始まり)。
+type Action int
+
+type State struct {
+	Board Board
+	Turn  Disc
+}
+
+type Config struct {
+	Rows int
+	Cols int
+	// ConnectN は、勝ちに必要な、縦・横・斜めに連続する石の数。
+	ConnectN int
+}
+
+// NewDefaultConfig は、標準の6行7列・4目の設定を返す。
+func NewDefaultConfig() Config {
+	return Config{Rows: 6, Cols: 7, ConnectN: 4}
+}
+
+func (c Config) Validate() error {
+	if c.Rows < 1 || c.Rows > MaxRows {
+		return fmt.Errorf("Rowsが不正: Rows = %d: 1 <= Rows <= %d であるべき", c.Rows, MaxRows)
+	}
+
+	if c.Cols < 1 || c.Cols > MaxCols {
+		return fmt.Errorf("Colsが不正: Cols = %d: 1 <= Cols <= %d であるべき", c.Cols, MaxCols)
+	}
+
+	if c.ConnectN < 2 || (c.ConnectN > c.Rows && c.ConnectN > c.Cols) {
+		return fmt.Errorf("ConnectNが不正: ConnectN = %d: 2 <= ConnectN <= max(Rows, Cols) であるべき", c.ConnectN)
+	}
+	return nil
+}
+
+// NewInitialState は、空の盤面(Redが先手)を返す。
+func NewInitialState() State {
+	return State{Turn: Red}
+}
+
+// height は、列 col に積まれている石の数を返す。
+func (c Config) height(b Board, col int) int {
+	for r := range c.Rows {
+		if b[r][col] == EmptyDisc {
+			return r
+		}
+	}
+	return c.Rows
+}
+
+// winner は、ConnectN 個揃っている石を返す。揃っていない場合は EmptyDisc を返す。
+func (c Config) winner(b Board) Disc {
+	// 右、上、右上、右下
+	dirs := [4][2]int{{0, 1}, {1, 0}, {1, 1}, {-1, 1}}
+	for r := range c.Rows {
+		for col := range c.Cols {
+			d := b[r][col]
+			if d == EmptyDisc {
+				continue
+			}
+
+			for _, dir := range dirs {
+				n := 1
+				rr, cc := r+dir[0], col+dir[1]
+				for n < c.ConnectN && rr >= 0 && rr < c.Rows && cc < c.Cols && b[rr][cc] == d {
+					n++
+					rr, cc = rr+dir[0], cc+dir[1]
+				}
+
+				if n == c.ConnectN {
+					return d
+				}
+			}
+		}
+	}
+	return EmptyDisc
+}
+
+func (c Config) isFull(b Board) bool {
+	for col := range c.Cols {
+		if b[c.Rows-1][col] == EmptyDisc {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Config) legalActions(s State) []Action {
+	if c.winner(s.Board) != EmptyDisc {
+		return nil
+	}
+
+	actions := make([]Action, 0, c.Cols)
+	for col := range c.Cols {
+		if s.Board[c.Rows-1][col] == EmptyDisc {
+			actions = append(actions, Action(col))
+		}
+	}
+	return actions
+}
+
+func (c Config) transition(s State, a Action) (State, error) {
+	col := int(a)
+	if col < 0 || col >= c.Cols {
+		return State{}, fmt.Errorf("actionが範囲外: action = %d: 0 <= action < %d であるべき", a, c.Cols)
+	}
+
+	h := c.height(s.Board, col)
+	if h == c.Rows {
+		return State{}, fmt.Errorf("列が埋まっています: action = %d", a)
+	}
+
+	if s.Turn != Red && s.Turn != Yellow {
+		return State{}, fmt.Errorf("turnが不正: turn = %v: RedまたはYellowであるべき", s.Turn)
+	}
+
+	next := s
+	next.Board[h][col] = s.Turn
+	next.Turn = opponent(s.Turn)
+	return next, nil
+}
+
+func (c Config) rankByAgent(s State) (game.RankByAgent[Disc], error) {
+	if w := c.winner(s.Board); w != EmptyDisc {
+		return game.RankByAgent[Disc]{w: 1, opponent(w): 2}, nil
+	}
+
+	if c.isFull(s.Board) {
+		return game.RankByAgent[Disc]{Red: 1, Yellow: 1}, nil
+	}
+	return game.RankByAgent[Disc]{}, nil
+}
+
+// NewEngine は、config の盤面の Connect Four のゲームエンジンを返す。
+func NewEngine(config Config) (sequential.Engine[State, Action, Disc], error) {
+	if err := config.Validate(); err != nil {
+		return sequential.Engine[State, Action, Disc]{}, err
+	}
+
+	e := sequential.Engine[State, Action, Disc]{
+		Rule: sequential.Rule[State, Action, Disc]{
+			LegalActionsFunc: config.legalActions,
+			TransitionFunc:   config.transition,
+			EqualFunc:        func(s1, s2 State) bool { return s1 == s2 },
+			CurrentAgentFunc: func(s State) Disc { return s.Turn },
+		},
+		RankByAgentFunc: config.rankByAgent,
+		Agents:          []Disc{Red, Yellow},
+	}
+	e.SetStandardResultScoreByAgentFunc()
+	return e, nil
+}
+
+// SymmetryFuncs は、恒等変換と左右反転の2つの対称変換を返す。
+func SymmetryFuncs(config Config) []game.SymmetryFunc[State, Action] {
+	mirror := func(col int) int { return config.Cols - 1 - col }
+	return []game.SymmetryFunc[State, Action]{
+		game.IdentitySymmetryFunc[State, Action],
+		func(s State) (State, game.ActionMapFunc[Action], error) {
+			next := State{Turn: s.Turn}
+			for r := range config.Rows {
+				for col := range config.Cols {
+					next.Board[r][mirror(col)] = s.Board[r][col]
+				}
+			}
+			return next, func(a Action) Action { return Action(mirror(int(a))) }, nil
+		},
+	}
+}
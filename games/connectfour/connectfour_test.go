@@ -0,0 +1,231 @@
+package connectfour_test
+
+import (
+	"testing"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/games/connectfour"
+	"github.com/sw965/crow/games/internal/solver"
+	"github.com/sw965/crow/mcts/puct"
+	"github.com/sw965/crow/pucb"
+	"github.com/sw965/omw/mathx/randx"
+)
+
+// play は、初期状態から actions を順に指した状態を返す。
+func play(t *testing.T, engine sequential.Engine[connectfour.State, connectfour.Action, connectfour.Disc], actions ...connectfour.Action) connectfour.State {
+	t.Helper()
+	state := connectfour.NewInitialState()
+	for _, a := range actions {
+		var err error
+		state, err = engine.Rule.TransitionFunc(state, a)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+	}
+	return state
+}
+
+func TestRankByAgent(t *testing.T) {
+	engine, err := connectfour.NewEngine(connectfour.NewDefaultConfig())
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		actions []connectfour.Action
+		want    game.RankByAgent[connectfour.Disc]
+	}{
+		{
+			name:    "横一列で勝ち",
+			actions: []connectfour.Action{0, 0, 1, 1, 2, 2, 3},
+			want:    game.RankByAgent[connectfour.Disc]{connectfour.Red: 1, connectfour.Yellow: 2},
+		},
+		{
+			name:    "縦一列で勝ち",
+			actions: []connectfour.Action{0, 1, 2, 1, 2, 1, 2, 1},
+			want:    game.RankByAgent[connectfour.Disc]{connectfour.Yellow: 1, connectfour.Red: 2},
+		},
+		{
+			name:    "右上がりの斜めで勝ち",
+			actions: []connectfour.Action{0, 1, 1, 2, 2, 3, 2, 3, 3, 6, 3},
+			want:    game.RankByAgent[connectfour.Disc]{connectfour.Red: 1, connectfour.Yellow: 2},
+		},
+		{
+			name:    "右下がりの斜めで勝ち",
+			actions: []connectfour.Action{6, 5, 5, 4, 4, 3, 4, 3, 3, 0, 3},
+			want:    game.RankByAgent[connectfour.Disc]{connectfour.Red: 1, connectfour.Yellow: 2},
+		},
+		{
+			name:    "進行中",
+			actions: []connectfour.Action{3, 3, 3},
+			want:    game.RankByAgent[connectfour.Disc]{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := engine.RankByAgentFunc(play(t, engine, tc.actions...))
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			if len(got) != len(tc.want) {
+				t.Fatalf("要素数の不一致: got = %v, want = %v", got, tc.want)
+			}
+			for agent, rank := range tc.want {
+				if got[agent] != rank {
+					t.Errorf("%v のrankの不一致: got = %d, want = %d", agent, got[agent], rank)
+				}
+			}
+		})
+	}
+}
+
+func TestTransition(t *testing.T) {
+	config := connectfour.Config{Rows: 2, Cols: 2, ConnectN: 2}
+	engine, err := connectfour.NewEngine(config)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	state := play(t, engine, 0, 0)
+	if got := engine.Rule.LegalActionsFunc(state); len(got) != 1 || got[0] != 1 {
+		t.Errorf("埋まった列が合法手に含まれている: got = %v", got)
+	}
+
+	t.Run("異常_埋まった列", func(t *testing.T) {
+		if _, err := engine.Rule.TransitionFunc(state, 0); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_範囲外の列", func(t *testing.T) {
+		if _, err := engine.Rule.TransitionFunc(state, 2); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_ConnectNが盤面より大きい", func(t *testing.T) {
+		if _, err := connectfour.NewEngine(connectfour.Config{Rows: 3, Cols: 3, ConnectN: 4}); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestSolvedValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		config connectfour.Config
+		want   float32
+		long   bool
+	}{
+		{name: "理論値_3行3列3目は引き分け", config: connectfour.Config{Rows: 3, Cols: 3, ConnectN: 3}, want: 0.5},
+		{name: "理論値_4行4列3目は先手必勝", config: connectfour.Config{Rows: 4, Cols: 4, ConnectN: 3}, want: 1.0},
+		{name: "理論値_4行4列4目は引き分け", config: connectfour.Config{Rows: 4, Cols: 4, ConnectN: 4}, want: 0.5, long: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.long && testing.Short() {
+				t.Skip("全探索に時間が掛かる為、-short では省略する")
+			}
+
+			engine, err := connectfour.NewEngine(tc.config)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			s, err := solver.New(&engine)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			scores, err := s.Solve(connectfour.NewInitialState())
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if scores[connectfour.Red] != tc.want {
+				t.Errorf("先手の結果スコアの不一致: got = %f, want = %f", scores[connectfour.Red], tc.want)
+			}
+		})
+	}
+}
+
+func TestSymmetryFuncs(t *testing.T) {
+	config := connectfour.NewDefaultConfig()
+	engine, err := connectfour.NewEngine(config)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	fs := connectfour.SymmetryFuncs(config)
+	state := play(t, engine, 0, 1, 0)
+	mirrored, actionMapFunc, err := fs[1](state)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	// 反転前に指した手を写して指すと、反転後に指した手と同じ局面になる
+	next, err := engine.Rule.TransitionFunc(state, 2)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	want, _, err := fs[1](next)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	got, err := engine.Rule.TransitionFunc(mirrored, actionMapFunc(2))
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if got != want {
+		t.Error("左右反転が行動の写し方と一致しない")
+	}
+}
+
+// 縦に3つ並べた局面で、探索が4つ目を置く手を最も多く訪問する事を確かめる。
+func TestSearchFindsWinningMove(t *testing.T) {
+	engine, err := connectfour.NewEngine(connectfour.NewDefaultConfig())
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	mcts := puct.Engine[connectfour.State, connectfour.Action, connectfour.Disc]{
+		Game:         engine,
+		PUCBFunc:     pucb.NewAlphaGoFunc(1.25),
+		NextNodesCap: 7,
+		VirtualValue: 0.5,
+	}
+	mcts.SetUniformPolicyFunc()
+	mcts.SetPlayout(sequential.NewRandomActorCritic[connectfour.State, connectfour.Action, connectfour.Disc]())
+
+	state := play(t, engine, 2, 3, 2, 3, 2, 4)
+	rootNode, err := mcts.NewNode(state)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	rngs, err := randx.NewPCGs(4)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if _, err := mcts.Search(rootNode, 3000, rngs); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	var bestAction connectfour.Action
+	bestVisits := -1
+	for action, calc := range rootNode.VirtualSelector() {
+		if calc.Visits() > bestVisits {
+			bestVisits = calc.Visits()
+			bestAction = action
+		}
+	}
+	if bestAction != 2 {
+		t.Errorf("最も訪問された手の不一致: got = %d, want = 2", bestAction)
+	}
+}
@@ -0,0 +1,11 @@
+// Package games は、crow のエンジンの実例、ベンチマーク、探索アルゴリズムの回帰テストの題材として使える、
+// 理論値が知られたゲームの実装を、サブパッケージとしてまとめる。
+//
+//	connectfour  Connect Four(逐次手番、盤面の大きさと揃える数を変えられる)
+//	othello      オセロ(逐次手番、パスあり、石の数を得点とする)
+//	nim          ニム(逐次手番、3人以上でも遊べる、ミゼールルールあり)
+//	kuhn         クーンポーカー(逐次手番、配る札が確率的に決まる、不完全情報)
+//	goofspiel    ゴフスピール(同時手番、賞品札の順番を確率的に決められる)
+//
+// 各パッケージの理論値は、パッケージのドキュメントに記載し、テストで確かめている。
+package games
@@ -0,0 +1,184 @@
+// Package goofspiel は、2人の同時手番ゲームであるゴフスピール(GOPS)の simultaneous.Engine を提供する。
+//
+// 各プレイヤーは 1〜NumCards の札を1枚ずつ持ち、毎ラウンド、公開された賞品札に対して手札を1枚ずつ同時に出す。
+// 大きい札を出したプレイヤーが賞品札の数だけ得点し、同じ札の場合は賞品は捨てられる。
+// 全ての札を出し終えた時点の得点で順位を決める。得点は PointByAgentFunc で得られる。
+//
+// 賞品札の順番は、NewInitialState では昇順に、NewRandomInitialState では乱数で決まる(確率的なゲーム)。
+//
+// 既知の理論値:
+//   - 双方の立場が対称な零和ゲームなので、ゲームの値は引き分け(結果スコア 0.5)。
+//   - NumCards = 2 では、1 を出すのが支配戦略。
+package goofspiel
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"math/rand/v2"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/simultaneous"
+)
+
+// Player は、エージェントを表す。
+type Player int8
+
+const (
+	First Player = iota
+	Second
+)
+
+// Action は、出す札の数(1〜NumCards)。
+type Action int
+
+// MaxCards は、NumCards の上限。
+const MaxCards = 16
+
+// Hand は、手札の集合。i ビット目が札 i+1 を持っている事を表す。
+type Hand uint32
+
+func (h Hand) Has(a Action) bool {
+	return a >= 1 && a <= MaxCards && h&(1<<(a-1)) != 0
+}
+
+func (h Hand) Len() int {
+	return bits.OnesCount32(uint32(h))
+}
+
+type State struct {
+	Hands [2]Hand
+	// Prizes は、各ラウンドの賞品札。Prizes[Round] が現在の賞品札。
+	Prizes [MaxCards]int
+	Round  int
+	Points [2]int
+}
+
+type Config struct {
+	NumCards int
+}
+
+// NewDefaultConfig は、13枚の設定を返す。
+func NewDefaultConfig() Config {
+	return Config{NumCards: 13}
+}
+
+func (c Config) Validate() error {
+	if c.NumCards < 1 || c.NumCards > MaxCards {
+		return fmt.Errorf("NumCardsが不正: NumCards = %d: 1 <= NumCards <= %d であるべき", c.NumCards, MaxCards)
+	}
+	return nil
+}
+
+// NewInitialState は、賞品札を昇順に並べた開始局面を返す。
+func (c Config) NewInitialState() State {
+	full := Hand(1<<c.NumCards - 1)
+	s := State{Hands: [2]Hand{full, full}}
+	for i := range c.NumCards {
+		s.Prizes[i] = i + 1
+	}
+	return s
+}
+
+// NewRandomInitialState は、rng で賞品札の順番を決めた開始局面を返す。
+func (c Config) NewRandomInitialState(rng *rand.Rand) State {
+	s := c.NewInitialState()
+	rng.Shuffle(c.NumCards, func(i, j int) {
+		s.Prizes[i], s.Prizes[j] = s.Prizes[j], s.Prizes[i]
+	})
+	return s
+}
+
+// Prize は、現在の賞品札を返す。終局している場合は0を返す。
+func (s State) Prize() int {
+	if s.Round >= MaxCards {
+		return 0
+	}
+	return s.Prizes[s.Round]
+}
+
+func (c Config) legalActionsByAgent(s State) simultaneous.LegalActionsByAgent[Action, Player] {
+	if s.Round >= c.NumCards {
+		return simultaneous.LegalActionsByAgent[Action, Player]{}
+	}
+
+	legalActionsByAgent := simultaneous.LegalActionsByAgent[Action, Player]{}
+	for _, p := range []Player{First, Second} {
+		actions := make([]Action, 0, s.Hands[p].Len())
+		for a := Action(1); a <= Action(c.NumCards); a++ {
+			if s.Hands[p].Has(a) {
+				actions = append(actions, a)
+			}
+		}
+		legalActionsByAgent[p] = actions
+	}
+	return legalActionsByAgent
+}
+
+func (c Config) transition(s State, jointAction simultaneous.JointAction[Action, Player]) (State, error) {
+	if s.Round >= c.NumCards {
+		return State{}, errors.New("ゲームは既に終了しています")
+	}
+
+	next := s
+	for _, p := range []Player{First, Second} {
+		a, ok := jointAction[p]
+		if !ok {
+			return State{}, fmt.Errorf("行動がありません: player = %d", p)
+		}
+
+		if !s.Hands[p].Has(a) {
+			return State{}, fmt.Errorf("手札にない札です: player = %d, action = %d", p, a)
+		}
+		next.Hands[p] &^= 1 << (a - 1)
+	}
+
+	prize := s.Prizes[s.Round]
+	switch first, second := jointAction[First], jointAction[Second]; {
+	case first > second:
+		next.Points[First] += prize
+	case first < second:
+		next.Points[Second] += prize
+	}
+	next.Round++
+	return next, nil
+}
+
+func pointByAgent(s State) (game.PointByAgent[Player], error) {
+	return game.PointByAgent[Player]{First: float32(s.Points[First]), Second: float32(s.Points[Second])}, nil
+}
+
+func (c Config) rankByAgent(s State) (game.RankByAgent[Player], error) {
+	if s.Round < c.NumCards {
+		return game.RankByAgent[Player]{}, nil
+	}
+
+	switch {
+	case s.Points[First] > s.Points[Second]:
+		return game.RankByAgent[Player]{First: 1, Second: 2}, nil
+	case s.Points[First] < s.Points[Second]:
+		return game.RankByAgent[Player]{Second: 1, First: 2}, nil
+	default:
+		return game.RankByAgent[Player]{First: 1, Second: 1}, nil
+	}
+}
+
+// NewEngine は、config のゴフスピールのゲームエンジンを返す。
+func NewEngine(config Config) (simultaneous.Engine[State, Action, Player], error) {
+	if err := config.Validate(); err != nil {
+		return simultaneous.Engine[State, Action, Player]{}, err
+	}
+
+	e := simultaneous.Engine[State, Action, Player]{
+		Rule: simultaneous.Rule[State, Action, Player]{
+			LegalActionsByAgentFunc: config.legalActionsByAgent,
+			TransitionFunc:          config.transition,
+			EqualFunc:               func(s1, s2 State) bool { return s1 == s2 },
+		},
+		RankByAgentFunc:  config.rankByAgent,
+		PointByAgentFunc: pointByAgent,
+		Agents:           []Player{First, Second},
+	}
+	e.SetStandardResultScoreByAgentFunc()
+	return e, nil
+}
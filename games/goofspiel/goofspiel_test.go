@@ -0,0 +1,200 @@
+package goofspiel_test
+
+import (
+	"testing"
+
+	"github.com/sw965/crow/game/simultaneous"
+	"github.com/sw965/crow/games/goofspiel"
+	"github.com/sw965/crow/mcts/dpuct"
+	"github.com/sw965/crow/pucb"
+	"github.com/sw965/omw/mathx/randx"
+)
+
+type (
+	engine      = simultaneous.Engine[goofspiel.State, goofspiel.Action, goofspiel.Player]
+	jointAction = simultaneous.JointAction[goofspiel.Action, goofspiel.Player]
+)
+
+func newEngine(t *testing.T, config goofspiel.Config) engine {
+	t.Helper()
+	e, err := goofspiel.NewEngine(config)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	return e
+}
+
+// playAll は、各ラウンドで firsts[i], seconds[i] を出した終局の状態を返す。
+func playAll(t *testing.T, e engine, init goofspiel.State, firsts, seconds []goofspiel.Action) goofspiel.State {
+	t.Helper()
+	state := init
+	for i := range firsts {
+		var err error
+		state, err = e.Rule.TransitionFunc(state, jointAction{goofspiel.First: firsts[i], goofspiel.Second: seconds[i]})
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+	}
+	return state
+}
+
+func TestTransition(t *testing.T) {
+	config := goofspiel.Config{NumCards: 3}
+	e := newEngine(t, config)
+	init := config.NewInitialState()
+
+	// 賞品 1, 2, 3 に対し、1ラウンド目は引き分けで捨てられ、2ラウンド目は先手、3ラウンド目は後手が取る
+	state := playAll(t, e, init, []goofspiel.Action{1, 3, 2}, []goofspiel.Action{1, 2, 3})
+	if state.Points != [2]int{2, 3} {
+		t.Errorf("得点の不一致: got = %v, want = [2 3]", state.Points)
+	}
+
+	ranks, err := e.RankByAgentFunc(state)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if ranks[goofspiel.Second] != 1 || ranks[goofspiel.First] != 2 {
+		t.Errorf("順位の不一致: got = %v", ranks)
+	}
+
+	if got := e.Rule.LegalActionsByAgentFunc(state); len(got) != 0 {
+		t.Errorf("終局後に合法手がある: got = %v", got)
+	}
+
+	t.Run("異常_手札にない札", func(t *testing.T) {
+		next := playAll(t, e, init, []goofspiel.Action{1}, []goofspiel.Action{2})
+		if _, err := e.Rule.TransitionFunc(next, jointAction{goofspiel.First: 1, goofspiel.Second: 3}); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_行動が無いプレイヤー", func(t *testing.T) {
+		if _, err := e.Rule.TransitionFunc(init, jointAction{goofspiel.First: 1}); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_NumCardsが範囲外", func(t *testing.T) {
+		if _, err := goofspiel.NewEngine(goofspiel.Config{NumCards: goofspiel.MaxCards + 1}); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func permutations(actions []goofspiel.Action) [][]goofspiel.Action {
+	if len(actions) <= 1 {
+		return [][]goofspiel.Action{append([]goofspiel.Action(nil), actions...)}
+	}
+
+	var result [][]goofspiel.Action
+	for i, a := range actions {
+		rest := append(append([]goofspiel.Action(nil), actions[:i]...), actions[i+1:]...)
+		for _, p := range permutations(rest) {
+			result = append(result, append([]goofspiel.Action{a}, p...))
+		}
+	}
+	return result
+}
+
+// 全ての札の出し方の組で、先手と後手を入れ替えると得点も入れ替わる事を確かめる。
+// 立場が対称な零和ゲームなので、ゲームの値は引き分けになる。
+func TestSymmetricValue(t *testing.T) {
+	config := goofspiel.Config{NumCards: 4}
+	e := newEngine(t, config)
+
+	rng := randx.NewPCG()
+	init := config.NewRandomInitialState(rng)
+	orders := permutations([]goofspiel.Action{1, 2, 3, 4})
+	for _, firsts := range orders {
+		for _, seconds := range orders {
+			got := playAll(t, e, init, firsts, seconds)
+			swapped := playAll(t, e, init, seconds, firsts)
+			if got.Points[0] != swapped.Points[1] || got.Points[1] != swapped.Points[0] {
+				t.Fatalf("性質_対称性: firsts = %v, seconds = %v: %v と %v", firsts, seconds, got.Points, swapped.Points)
+			}
+		}
+	}
+}
+
+// NumCards = 2 では、1 を出すのが支配戦略である事を確かめる。
+func TestDominantStrategy(t *testing.T) {
+	config := goofspiel.Config{NumCards: 2}
+	e := newEngine(t, config)
+	init := config.NewInitialState()
+
+	score := func(first, second goofspiel.Action) float32 {
+		final := playAll(t, e, init, []goofspiel.Action{first, 3 - first}, []goofspiel.Action{second, 3 - second})
+		scores, err := e.EvaluateResultScoreByAgent(final)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		return scores[goofspiel.First]
+	}
+
+	for _, second := range []goofspiel.Action{1, 2} {
+		if score(1, second) <= score(2, second) {
+			t.Errorf("理論値_後手が %d の時、1 が 2 より良くない: %f, %f", second, score(1, second), score(2, second))
+		}
+	}
+
+	// 探索でも、双方が 1 を最も多く訪問する
+	mcts := dpuct.Engine[goofspiel.State, goofspiel.Action, goofspiel.Player]{
+		Game:         e,
+		PUCBFunc:     pucb.NewAlphaGoFunc(1.0),
+		NextNodesCap: 4,
+		VirtualValue: 0.5,
+	}
+	mcts.SetUniformPolicyFunc()
+	mcts.SetPlayout(simultaneous.NewRandomActorCritic[goofspiel.State, goofspiel.Action, goofspiel.Player]())
+
+	rootNode, err := mcts.NewNode(init)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	rngs, err := randx.NewPCGs(2)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if _, err := mcts.Search(rootNode, 2000, rngs); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	for agent, selector := range rootNode.VirtualSelectors() {
+		if selector[1].Visits() <= selector[2].Visits() {
+			t.Errorf("エージェント%d: 支配戦略の訪問数が少ない: 1 = %d, 2 = %d", agent, selector[1].Visits(), selector[2].Visits())
+		}
+	}
+}
+
+func TestRandomPlayouts(t *testing.T) {
+	config := goofspiel.NewDefaultConfig()
+	e := newEngine(t, config)
+
+	rng := randx.NewPCG()
+	inits := make([]goofspiel.State, 16)
+	for i := range inits {
+		inits[i] = config.NewRandomInitialState(rng)
+	}
+
+	rngs, err := randx.NewPCGs(4)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	records, err := e.RecordPlayouts(inits, simultaneous.NewRandomActorCritic[goofspiel.State, goofspiel.Action, goofspiel.Player](), rngs, config.NumCards)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	// 賞品の合計は 1+2+...+13 = 91 で、引き分けのラウンドの賞品は捨てられる
+	for i, r := range records {
+		if len(r.Steps) != config.NumCards {
+			t.Errorf("records[%d]: ラウンド数の不一致: got = %d, want = %d", i, len(r.Steps), config.NumCards)
+		}
+		if total := r.FinalState.Points[0] + r.FinalState.Points[1]; total > 91 {
+			t.Errorf("records[%d]: 得点の合計が賞品の合計を超えている: got = %d", i, total)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Package solver は、games のテストで既知の理論値を確かめる為の、全探索による厳密解法を提供する。
+// 小さな盤面でしか終わらない為、公開APIではない。
+package solver
+
+import (
+	"fmt"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+)
+
+// Solver は、完全情報の逐次手番ゲームを max^n 法(各手番のエージェントが自分の結果スコアを最大化する)で解く。
+// 2人零和ゲームでは、ミニマックス法と一致する。同じ局面は一度しか解かない。
+type Solver[S comparable, Ac, Ag comparable] struct {
+	engine *sequential.Engine[S, Ac, Ag]
+	memo   map[S]game.ResultScoreByAgent[Ag]
+}
+
+func New[S comparable, Ac, Ag comparable](engine *sequential.Engine[S, Ac, Ag]) (*Solver[S, Ac, Ag], error) {
+	if err := engine.Validate(); err != nil {
+		return nil, err
+	}
+	return &Solver[S, Ac, Ag]{engine: engine, memo: map[S]game.ResultScoreByAgent[Ag]{}}, nil
+}
+
+// Solve は、state から双方が最善を尽くした場合の各エージェントの結果スコアを返す。
+func (s *Solver[S, Ac, Ag]) Solve(state S) (game.ResultScoreByAgent[Ag], error) {
+	if scores, ok := s.memo[state]; ok {
+		return scores, nil
+	}
+
+	isEnd, err := s.engine.IsTerminal(state)
+	if err != nil {
+		return nil, err
+	}
+
+	if isEnd {
+		scores, err := s.engine.EvaluateResultScoreByAgent(state)
+		if err != nil {
+			return nil, err
+		}
+		s.memo[state] = scores
+		return scores, nil
+	}
+
+	legalActions := s.engine.Rule.LegalActionsFunc(state)
+	if len(legalActions) == 0 {
+		return nil, fmt.Errorf("終局していないのに合法手がありません: state = %v", state)
+	}
+
+	agent := s.engine.Rule.CurrentAgentFunc(state)
+	var best game.ResultScoreByAgent[Ag]
+	for _, a := range legalActions {
+		next, err := s.engine.Rule.TransitionFunc(state, a)
+		if err != nil {
+			return nil, err
+		}
+
+		scores, err := s.Solve(next)
+		if err != nil {
+			return nil, err
+		}
+
+		if best == nil || scores[agent] > best[agent] {
+			best = scores
+		}
+	}
+	s.memo[state] = best
+	return best, nil
+}
+
+// BestActions は、state で手番のエージェントの結果スコアを最大にする行動を全て返す。
+func (s *Solver[S, Ac, Ag]) BestActions(state S) ([]Ac, error) {
+	want, err := s.Solve(state)
+	if err != nil {
+		return nil, err
+	}
+
+	agent := s.engine.Rule.CurrentAgentFunc(state)
+	var actions []Ac
+	for _, a := range s.engine.Rule.LegalActionsFunc(state) {
+		next, err := s.engine.Rule.TransitionFunc(state, a)
+		if err != nil {
+			return nil, err
+		}
+
+		scores, err := s.Solve(next)
+		if err != nil {
+			return nil, err
+		}
+
+		if scores[agent] == want[agent] {
+			actions = append(actions, a)
+		}
+	}
+	return actions, nil
+}
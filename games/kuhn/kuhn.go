@@ -0,0 +1,243 @@
+// Package kuhn は、クーンポーカーの sequential.Engine を提供する。
+//
+// J, Q, K の3枚から1枚ずつ配り、双方が1枚ずつ賭けた状態から始める。
+// 各プレイヤーは Pass(チェック/フォールド) か Bet(ベット/コール) を選ぶ。
+// 配る札は NewInitialState で乱数によって決まる為、同じ手順でも対局ごとに結果が変わる、確率的なゲームである。
+// 状態は相手の札を含む為、不完全情報ゲームとして扱う場合は、方策が自分の札と手順だけを見る様にする事。
+// 各プレイヤーの収支(チップ)は PointByAgentFunc で得られる。
+//
+// 既知の理論値:
+//   - ナッシュ均衡での先手の期待収支は -1/18(Kuhn 1950)。GameValue を参照。
+//   - 均衡戦略は先手の1変数 alpha (0 <= alpha <= 1/3) で表せる。NewEquilibriumPolicyFunc を参照。
+package kuhn
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+)
+
+// Player は、エージェント(手番)を表す。
+type Player int8
+
+const (
+	First Player = iota
+	Second
+)
+
+func (p Player) String() string {
+	if p == First {
+		return "先手"
+	}
+	return "後手"
+}
+
+type Card int8
+
+const (
+	Jack Card = iota + 1
+	Queen
+	King
+)
+
+func (c Card) String() string {
+	switch c {
+	case Jack:
+		return "J"
+	case Queen:
+		return "Q"
+	case King:
+		return "K"
+	default:
+		return "-"
+	}
+}
+
+type Action int8
+
+const (
+	Pass Action = iota
+	Bet
+)
+
+func (a Action) String() string {
+	if a == Pass {
+		return "p"
+	}
+	return "b"
+}
+
+// GameValue は、ナッシュ均衡での先手の期待収支。
+const GameValue = -1.0 / 18.0
+
+// MaxActions は、1局の手数の上限。
+const MaxActions = 3
+
+type State struct {
+	// Cards は、各プレイヤーに配られた札。Cards[First] が先手の札。
+	Cards      [2]Card
+	History    [MaxActions]Action
+	NumActions int
+}
+
+// Actions は、それまでの手順を返す。
+func (s State) Actions() []Action {
+	return s.History[:s.NumActions]
+}
+
+func (s State) turn() Player {
+	return Player(s.NumActions % 2)
+}
+
+// NewInitialState は、rng で札を配った開始局面を返す。
+func NewInitialState(rng *rand.Rand) State {
+	deals := Deals()
+	return deals[rng.IntN(len(deals))]
+}
+
+// Deals は、全ての配り方(6通り、それぞれ確率 1/6)の開始局面を返す。期待値を厳密に計算する場合に使う。
+func Deals() []State {
+	cards := []Card{Jack, Queen, King}
+	deals := make([]State, 0, 6)
+	for _, c1 := range cards {
+		for _, c2 := range cards {
+			if c1 != c2 {
+				deals = append(deals, State{Cards: [2]Card{c1, c2}})
+			}
+		}
+	}
+	return deals
+}
+
+// isTerminal は、手順が終局しているかを返す。終局は pp, bp, bb, pbp, pbb の5通り。
+func isTerminal(actions []Action) bool {
+	switch len(actions) {
+	case 2:
+		return !(actions[0] == Pass && actions[1] == Bet)
+	case 3:
+		return true
+	default:
+		return false
+	}
+}
+
+func legalActions(s State) []Action {
+	if isTerminal(s.Actions()) {
+		return nil
+	}
+	return []Action{Pass, Bet}
+}
+
+func transition(s State, a Action) (State, error) {
+	if isTerminal(s.Actions()) {
+		return State{}, errors.New("ゲームは既に終了しています")
+	}
+
+	if a != Pass && a != Bet {
+		return State{}, fmt.Errorf("actionが不正: action = %d: PassまたはBetであるべき", a)
+	}
+
+	next := s
+	next.History[s.NumActions] = a
+	next.NumActions++
+	return next, nil
+}
+
+func pointByAgent(s State) (game.PointByAgent[Player], error) {
+	actions := s.Actions()
+	if !isTerminal(actions) {
+		return game.PointByAgent[Player]{First: 0, Second: 0}, nil
+	}
+
+	// 最後の手がPassで、その前がBetなら、最後に手番だったプレイヤーのフォールド
+	n := len(actions)
+	if actions[n-1] == Pass && actions[n-2] == Bet {
+		folder := Player((n - 1) % 2)
+		return game.PointByAgent[Player]{folder: -1, 1 - folder: 1}, nil
+	}
+
+	stake := float32(1)
+	if actions[n-1] == Bet {
+		stake = 2
+	}
+
+	if s.Cards[First] > s.Cards[Second] {
+		return game.PointByAgent[Player]{First: stake, Second: -stake}, nil
+	}
+	return game.PointByAgent[Player]{First: -stake, Second: stake}, nil
+}
+
+func rankByAgent(s State) (game.RankByAgent[Player], error) {
+	if !isTerminal(s.Actions()) {
+		return game.RankByAgent[Player]{}, nil
+	}
+
+	points, err := pointByAgent(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if points[First] > 0 {
+		return game.RankByAgent[Player]{First: 1, Second: 2}, nil
+	}
+	return game.RankByAgent[Player]{Second: 1, First: 2}, nil
+}
+
+// NewEngine は、クーンポーカーのゲームエンジンを返す。
+func NewEngine() sequential.Engine[State, Action, Player] {
+	e := sequential.Engine[State, Action, Player]{
+		Rule: sequential.Rule[State, Action, Player]{
+			LegalActionsFunc: legalActions,
+			TransitionFunc:   transition,
+			EqualFunc:        func(s1, s2 State) bool { return s1 == s2 },
+			CurrentAgentFunc: State.turn,
+		},
+		RankByAgentFunc:  rankByAgent,
+		PointByAgentFunc: pointByAgent,
+		Agents:           []Player{First, Second},
+	}
+	e.SetStandardResultScoreByAgentFunc()
+	return e
+}
+
+// NewEquilibriumPolicyFunc は、ナッシュ均衡の方策を返す。方策は手番のプレイヤーの札と手順だけを見る。
+//
+// 先手は J で確率 alpha、K で確率 3*alpha でベットし、Q ではチェックする。
+// チェックの後にベットされた場合、Q では確率 alpha+1/3 でコールし、J ではフォールド、K ではコールする。
+// 後手はベットされた場合、K でコール、Q で確率 1/3 でコール、J でフォールドする。
+// チェックされた場合、K でベット、Q でチェック、J で確率 1/3 でベットする。
+func NewEquilibriumPolicyFunc(alpha float32) (sequential.PolicyFunc[State, Action], error) {
+	if alpha < 0.0 || alpha > 1.0/3.0 {
+		return nil, fmt.Errorf("alphaが不正: alpha = %g: 0 <= alpha <= 1/3 であるべき", alpha)
+	}
+
+	betProbs := map[string][3]float32{
+		// 先手の1手目
+		"": {alpha, 0.0, 3.0 * alpha},
+		// 後手、ベットされた
+		"b": {0.0, 1.0 / 3.0, 1.0},
+		// 後手、チェックされた
+		"p": {1.0 / 3.0, 0.0, 1.0},
+		// 先手、チェックの後にベットされた
+		"pb": {0.0, alpha + 1.0/3.0, 1.0},
+	}
+
+	return func(s State, legalActions []Action) (game.Policy[Action], error) {
+		var key string
+		for _, a := range s.Actions() {
+			key += a.String()
+		}
+
+		probs, ok := betProbs[key]
+		if !ok || len(legalActions) == 0 {
+			return nil, fmt.Errorf("終局している: actions = %v", s.Actions())
+		}
+
+		card := s.Cards[s.turn()]
+		p := probs[card-Jack]
+		return game.Policy[Action]{Pass: 1.0 - p, Bet: p}, nil
+	}, nil
+}
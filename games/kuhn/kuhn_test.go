@@ -0,0 +1,197 @@
+package kuhn_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/games/kuhn"
+	"github.com/sw965/omw/mathx/randx"
+)
+
+type policyFunc = sequential.PolicyFunc[kuhn.State, kuhn.Action]
+
+// expectedPoint は、各プレイヤーが policyFuncs の方策に従う場合の、全ての配り方に渡る先手の期待収支を返す。
+func expectedPoint(t *testing.T, policyFuncs [2]policyFunc) float64 {
+	t.Helper()
+	engine := kuhn.NewEngine()
+
+	var walk func(s kuhn.State) float64
+	walk = func(s kuhn.State) float64 {
+		isEnd, err := engine.IsTerminal(s)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		if isEnd {
+			points, err := engine.PointByAgentFunc(s)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			return float64(points[kuhn.First])
+		}
+
+		legalActions := engine.Rule.LegalActionsFunc(s)
+		agent := engine.Rule.CurrentAgentFunc(s)
+		policy, err := policyFuncs[agent](s, legalActions)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		var v float64
+		for a, p := range policy {
+			next, err := engine.Rule.TransitionFunc(s, a)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			v += float64(p) * walk(next)
+		}
+		return v
+	}
+
+	deals := kuhn.Deals()
+	var sum float64
+	for _, s := range deals {
+		sum += walk(s)
+	}
+	return sum / float64(len(deals))
+}
+
+func alwaysPolicyFunc(action kuhn.Action) policyFunc {
+	return func(kuhn.State, []kuhn.Action) (game.Policy[kuhn.Action], error) {
+		return game.Policy[kuhn.Action]{action: 1.0}, nil
+	}
+}
+
+func TestPointByAgent(t *testing.T) {
+	engine := kuhn.NewEngine()
+
+	tests := []struct {
+		name    string
+		cards   [2]kuhn.Card
+		actions []kuhn.Action
+		want    float32
+	}{
+		{name: "正常_チェックで勝負", cards: [2]kuhn.Card{kuhn.King, kuhn.Jack}, actions: []kuhn.Action{kuhn.Pass, kuhn.Pass}, want: 1},
+		{name: "正常_後手がフォールド", cards: [2]kuhn.Card{kuhn.Jack, kuhn.King}, actions: []kuhn.Action{kuhn.Bet, kuhn.Pass}, want: 1},
+		{name: "正常_コールで勝負", cards: [2]kuhn.Card{kuhn.Queen, kuhn.King}, actions: []kuhn.Action{kuhn.Bet, kuhn.Bet}, want: -2},
+		{name: "正常_先手がフォールド", cards: [2]kuhn.Card{kuhn.King, kuhn.Jack}, actions: []kuhn.Action{kuhn.Pass, kuhn.Bet, kuhn.Pass}, want: -1},
+		{name: "正常_チェックの後にコールで勝負", cards: [2]kuhn.Card{kuhn.King, kuhn.Queen}, actions: []kuhn.Action{kuhn.Pass, kuhn.Bet, kuhn.Bet}, want: 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := kuhn.State{Cards: tc.cards}
+			for _, a := range tc.actions {
+				var err error
+				s, err = engine.Rule.TransitionFunc(s, a)
+				if err != nil {
+					t.Fatalf("予期せぬエラー: %v", err)
+				}
+			}
+
+			if got := engine.Rule.LegalActionsFunc(s); len(got) != 0 {
+				t.Fatalf("終局していない: legalActions = %v", got)
+			}
+
+			points, err := engine.PointByAgentFunc(s)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if points[kuhn.First] != tc.want || points[kuhn.Second] != -tc.want {
+				t.Errorf("収支の不一致: got = %v, want = 先手 %g", points, tc.want)
+			}
+
+			ranks, err := engine.RankByAgentFunc(s)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if (ranks[kuhn.First] == 1) != (tc.want > 0) {
+				t.Errorf("順位と収支が一致しない: ranks = %v", ranks)
+			}
+		})
+	}
+
+	t.Run("異常_終局後の手", func(t *testing.T) {
+		s := kuhn.State{Cards: [2]kuhn.Card{kuhn.King, kuhn.Jack}, History: [kuhn.MaxActions]kuhn.Action{kuhn.Pass, kuhn.Pass}, NumActions: 2}
+		if _, err := engine.Rule.TransitionFunc(s, kuhn.Bet); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestGameValue(t *testing.T) {
+	for _, alpha := range []float32{0.0, 1.0 / 6.0, 1.0 / 3.0} {
+		equilibrium, err := kuhn.NewEquilibriumPolicyFunc(alpha)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		if got := expectedPoint(t, [2]policyFunc{equilibrium, equilibrium}); math.Abs(got-kuhn.GameValue) > 1e-6 {
+			t.Errorf("理論値_alpha = %g: 先手の期待収支 got = %f, want = %f", alpha, got, kuhn.GameValue)
+		}
+
+		// 後手が均衡戦略なら、先手が戦略を変えても期待収支は理論値を超えない
+		for _, deviation := range []kuhn.Action{kuhn.Pass, kuhn.Bet} {
+			if got := expectedPoint(t, [2]policyFunc{alwaysPolicyFunc(deviation), equilibrium}); got > kuhn.GameValue+1e-6 {
+				t.Errorf("性質_alpha = %g, 先手が常に %v: 先手の期待収支 got = %f: %f 以下であるべき", alpha, deviation, got, kuhn.GameValue)
+			}
+		}
+	}
+
+	t.Run("異常_alphaが範囲外", func(t *testing.T) {
+		if _, err := kuhn.NewEquilibriumPolicyFunc(0.5); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+// 乱数で配った対局の平均収支が、理論値に近づく事を確かめる。
+func TestRandomDeals(t *testing.T) {
+	engine := kuhn.NewEngine()
+	equilibrium, err := kuhn.NewEquilibriumPolicyFunc(1.0 / 6.0)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	accr := sequential.ActorCritic[kuhn.State, kuhn.Action, kuhn.Player]{
+		Name: "equilibrium",
+		PolicyValueFunc: func(s kuhn.State, legalActions []kuhn.Action) (game.Policy[kuhn.Action], float32, error) {
+			policy, err := equilibrium(s, legalActions)
+			return policy, 0.0, err
+		},
+		SelectFunc: game.WeightedRandomSelectFunc[kuhn.Action, kuhn.Player],
+	}
+
+	rng := randx.NewPCG()
+	const n = 60000
+	inits := make([]kuhn.State, n)
+	for i := range inits {
+		inits[i] = kuhn.NewInitialState(rng)
+	}
+
+	rngs, err := randx.NewPCGs(4)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	finals, err := engine.Playouts(inits, accr, rngs)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	var sum float64
+	for _, s := range finals {
+		points, err := engine.PointByAgentFunc(s)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		sum += float64(points[kuhn.First])
+	}
+
+	// 1局の収支の標準偏差は1.5未満なので、平均の標準誤差は 1.5/sqrt(n) 未満
+	if got := sum / n; math.Abs(got-kuhn.GameValue) > 5*1.5/math.Sqrt(n) {
+		t.Errorf("統計_平均収支が理論値から離れている: got = %f, want ≈ %f", got, kuhn.GameValue)
+	}
+}
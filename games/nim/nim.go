@@ -0,0 +1,181 @@
+// Package nim は、複数人で遊べるニム(石取りゲーム)の sequential.Engine を提供する。
+//
+// 手番のプレイヤーは、1つの山から1個以上の石を取る。全ての山が空になった時点で終局する。
+// 通常ルールでは最後の石を取ったプレイヤーが1位で、他は同順の2位になる。
+// ミゼールルールでは最後の石を取ったプレイヤーが最下位で、他は同順の1位になる。
+//
+// 既知の理論値(2人の場合):
+//   - 通常ルールでは、山の大きさの排他的論理和(ニム和)が0でなければ手番のプレイヤーが必勝(Bouton 1901)。
+//   - ミゼールルールでは、全ての山が1以下なら空でない山の数が偶数の場合に、
+//     そうでなければニム和が0でない場合に、手番のプレイヤーが必勝。
+package nim
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+)
+
+// Player は、プレイヤーの番号(0始まり)。
+type Player int
+
+// MaxHeaps は、山の数の上限。
+const MaxHeaps = 8
+
+type Heaps [MaxHeaps]int
+
+type Action struct {
+	Heap  int
+	Count int
+}
+
+type State struct {
+	Heaps Heaps
+	Turn  Player
+	// LastMover は、直前に石を取ったプレイヤー。まだ誰も取っていない場合は -1。
+	LastMover Player
+}
+
+type Config struct {
+	// Heaps は、開始時の各山の石の数。
+	Heaps      []int
+	NumPlayers int
+	Misere     bool
+}
+
+// NewDefaultConfig は、山が 3, 4, 5 の2人の通常ルールの設定を返す。
+func NewDefaultConfig() Config {
+	return Config{Heaps: []int{3, 4, 5}, NumPlayers: 2}
+}
+
+func (c Config) Validate() error {
+	if len(c.Heaps) == 0 || len(c.Heaps) > MaxHeaps {
+		return fmt.Errorf("len(Heaps)が不正: len(Heaps) = %d: 1 <= len(Heaps) <= %d であるべき", len(c.Heaps), MaxHeaps)
+	}
+
+	total := 0
+	for i, h := range c.Heaps {
+		if h < 0 {
+			return fmt.Errorf("Heaps[%d]が不正: Heaps[%d] = %d: Heaps[%d] >= 0 であるべき", i, i, h, i)
+		}
+		total += h
+	}
+
+	if total == 0 {
+		return fmt.Errorf("石がありません: Heaps = %v", c.Heaps)
+	}
+
+	if c.NumPlayers < 2 {
+		return fmt.Errorf("NumPlayersが不正: NumPlayers = %d: NumPlayers >= 2 であるべき", c.NumPlayers)
+	}
+	return nil
+}
+
+// NewInitialState は、プレイヤー0が手番の開始局面を返す。
+func (c Config) NewInitialState() State {
+	s := State{LastMover: -1}
+	copy(s.Heaps[:], c.Heaps)
+	return s
+}
+
+func (c Config) agents() []Player {
+	agents := make([]Player, c.NumPlayers)
+	for i := range agents {
+		agents[i] = Player(i)
+	}
+	return agents
+}
+
+func legalActions(s State) []Action {
+	var actions []Action
+	for i, h := range s.Heaps {
+		for n := 1; n <= h; n++ {
+			actions = append(actions, Action{Heap: i, Count: n})
+		}
+	}
+	return actions
+}
+
+func (c Config) transition(s State, a Action) (State, error) {
+	if a.Heap < 0 || a.Heap >= MaxHeaps {
+		return State{}, fmt.Errorf("Heapが範囲外: action = %v: 0 <= Heap < %d であるべき", a, MaxHeaps)
+	}
+
+	if a.Count < 1 || a.Count > s.Heaps[a.Heap] {
+		return State{}, fmt.Errorf("Countが不正: action = %v: 1 <= Count <= %d であるべき", a, s.Heaps[a.Heap])
+	}
+
+	next := s
+	next.Heaps[a.Heap] -= a.Count
+	next.LastMover = s.Turn
+	next.Turn = (s.Turn + 1) % Player(c.NumPlayers)
+	return next, nil
+}
+
+func (c Config) rankByAgent(s State) (game.RankByAgent[Player], error) {
+	if s.Heaps != (Heaps{}) {
+		return game.RankByAgent[Player]{}, nil
+	}
+
+	if s.LastMover < 0 {
+		return nil, fmt.Errorf("石が無いのに、石を取ったプレイヤーがいません: state = %v", s)
+	}
+
+	others := slices.DeleteFunc(c.agents(), func(p Player) bool { return p == s.LastMover })
+	if c.Misere {
+		return game.NewRankByAgent([][]Player{others, {s.LastMover}})
+	}
+	return game.NewRankByAgent([][]Player{{s.LastMover}, others})
+}
+
+// NewEngine は、config のニムのゲームエンジンを返す。
+func NewEngine(config Config) (sequential.Engine[State, Action, Player], error) {
+	if err := config.Validate(); err != nil {
+		return sequential.Engine[State, Action, Player]{}, err
+	}
+
+	e := sequential.Engine[State, Action, Player]{
+		Rule: sequential.Rule[State, Action, Player]{
+			LegalActionsFunc: legalActions,
+			TransitionFunc:   config.transition,
+			EqualFunc:        func(s1, s2 State) bool { return s1 == s2 },
+			CurrentAgentFunc: func(s State) Player { return s.Turn },
+		},
+		RankByAgentFunc: config.rankByAgent,
+		Agents:          config.agents(),
+	}
+	e.SetStandardResultScoreByAgentFunc()
+	return e, nil
+}
+
+// NimSum は、山の大きさの排他的論理和を返す。
+func NimSum(heaps Heaps) int {
+	sum := 0
+	for _, h := range heaps {
+		sum ^= h
+	}
+	return sum
+}
+
+// IsWinning は、2人のニムで、heaps の局面の手番のプレイヤーが必勝かを返す。
+func IsWinning(heaps Heaps, misere bool) bool {
+	if misere {
+		nonEmpty := 0
+		allSmall := true
+		for _, h := range heaps {
+			if h > 0 {
+				nonEmpty++
+			}
+			if h > 1 {
+				allSmall = false
+			}
+		}
+
+		if allSmall {
+			return nonEmpty%2 == 0
+		}
+	}
+	return NimSum(heaps) != 0
+}
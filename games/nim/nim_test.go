@@ -0,0 +1,177 @@
+package nim_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/games/internal/solver"
+	"github.com/sw965/crow/games/nim"
+	"github.com/sw965/omw/mathx/randx"
+)
+
+func newEngine(t *testing.T, config nim.Config) sequential.Engine[nim.State, nim.Action, nim.Player] {
+	t.Helper()
+	e, err := nim.NewEngine(config)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	return e
+}
+
+// 2人のニムで、全探索の結果がニム和による必勝判定と一致する事を確かめる。
+func TestIsWinning(t *testing.T) {
+	for _, misere := range []bool{false, true} {
+		t.Run(fmt.Sprintf("理論値_Misere=%v", misere), func(t *testing.T) {
+			e := newEngine(t, nim.Config{Heaps: []int{1}, NumPlayers: 2, Misere: misere})
+			s, err := solver.New(&e)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			for a := range 5 {
+				for b := range 5 {
+					for c := range 5 {
+						heaps := nim.Heaps{a, b, c}
+						if heaps == (nim.Heaps{}) {
+							continue
+						}
+
+						scores, err := s.Solve(nim.State{Heaps: heaps, LastMover: -1})
+						if err != nil {
+							t.Fatalf("予期せぬエラー: %v", err)
+						}
+
+						got := scores[0] == 1.0
+						if want := nim.IsWinning(heaps, misere); got != want {
+							t.Errorf("heaps = %v: 全探索 = %v, IsWinning = %v", heaps[:3], got, want)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRankByAgent(t *testing.T) {
+	tests := []struct {
+		name   string
+		misere bool
+		want   map[nim.Player]int
+	}{
+		{name: "正常_通常ルール", misere: false, want: map[nim.Player]int{1: 1, 0: 2, 2: 2}},
+		{name: "正常_ミゼールルール", misere: true, want: map[nim.Player]int{0: 1, 2: 1, 1: 3}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config := nim.Config{Heaps: []int{1, 1}, NumPlayers: 3, Misere: tc.misere}
+			e := newEngine(t, config)
+
+			// プレイヤー0, 1 が1個ずつ取り、プレイヤー1が最後の石を取る
+			state := config.NewInitialState()
+			for _, a := range []nim.Action{{Heap: 0, Count: 1}, {Heap: 1, Count: 1}} {
+				var err error
+				state, err = e.Rule.TransitionFunc(state, a)
+				if err != nil {
+					t.Fatalf("予期せぬエラー: %v", err)
+				}
+			}
+
+			if state.Turn != 2 {
+				t.Errorf("手番の不一致: got = %d, want = 2", state.Turn)
+			}
+
+			ranks, err := e.RankByAgentFunc(state)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			for p, want := range tc.want {
+				if ranks[p] != want {
+					t.Errorf("プレイヤー%dの順位の不一致: got = %d, want = %d", p, ranks[p], want)
+				}
+			}
+		})
+	}
+}
+
+func TestTransition(t *testing.T) {
+	config := nim.NewDefaultConfig()
+	e := newEngine(t, config)
+	state := config.NewInitialState()
+
+	if got := len(e.Rule.LegalActionsFunc(state)); got != 3+4+5 {
+		t.Errorf("合法手の数の不一致: got = %d, want = 12", got)
+	}
+
+	tests := []struct {
+		name   string
+		action nim.Action
+	}{
+		{name: "異常_石より多く取る", action: nim.Action{Heap: 0, Count: 4}},
+		{name: "異常_0個取る", action: nim.Action{Heap: 0, Count: 0}},
+		{name: "異常_範囲外の山", action: nim.Action{Heap: nim.MaxHeaps, Count: 1}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := e.Rule.TransitionFunc(state, tc.action); err == nil {
+				t.Fatal("エラーを期待したが、nilが返された")
+			}
+		})
+	}
+
+	t.Run("異常_石が無い", func(t *testing.T) {
+		if _, err := nim.NewEngine(nim.Config{Heaps: []int{0, 0}, NumPlayers: 2}); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_1人", func(t *testing.T) {
+		if _, err := nim.NewEngine(nim.Config{Heaps: []int{1}, NumPlayers: 1}); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+// 4人のニムを最後まで指し、結果スコアの合計が人数によらず保たれる事を確かめる。
+func TestMultiPlayerPlayouts(t *testing.T) {
+	config := nim.Config{Heaps: []int{3, 4, 5}, NumPlayers: 4}
+	e := newEngine(t, config)
+
+	rngs, err := randx.NewPCGs(2)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	inits := make([]nim.State, 8)
+	for i := range inits {
+		inits[i] = config.NewInitialState()
+	}
+
+	accr := sequential.NewRandomActorCritic[nim.State, nim.Action, nim.Player]()
+	records, err := e.RecordPlayouts(inits, accr, rngs, 12)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	for i, r := range records {
+		if len(r.ResultScoreByAgent) != config.NumPlayers {
+			t.Fatalf("records[%d]: エージェント数の不一致: got = %d, want = %d", i, len(r.ResultScoreByAgent), config.NumPlayers)
+		}
+
+		var sum float32
+		for _, score := range r.ResultScoreByAgent {
+			sum += score
+		}
+		// 1位の1と、同順の3人の 1/3 ずつ
+		if sum < 1.999 || sum > 2.001 {
+			t.Errorf("records[%d]: 結果スコアの合計の不一致: got = %f, want = 2", i, sum)
+		}
+
+		last := r.Steps[len(r.Steps)-1].Agent
+		if r.ResultScoreByAgent[last] != 1.0 {
+			t.Errorf("records[%d]: 最後の石を取ったプレイヤーが1位でない", i)
+		}
+	}
+}
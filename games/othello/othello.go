@@ -0,0 +1,234 @@
+// Package othello は、オセロ(リバーシ)の sequential.Engine を提供する。盤面の大きさは Config で変えられる。
+//
+// 手番のエージェントに合法手が無く、相手にはある場合、合法手は PassAction だけになる。
+// 双方に合法手が無くなった時点で終局し、石の数で順位を決める。石の数は PointByAgentFunc で得られる。
+//
+// 既知の理論値:
+//   - 4x4 は後手(白)必勝。最善を尽くすと白が8石差(3-11)で勝つ。
+//   - 6x6 は後手(白)必勝。最善を尽くすと 16-20 で白が勝つ(Feinstein 1993)。
+//   - 8x8 は引き分けと報告されている(Takizawa 2023)。
+package othello
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+)
+
+// Color は、盤面のマスの状態、及びエージェント(手番)を表す。
+type Color int8
+
+const (
+	EmptyColor Color = iota
+	Black            // 先手
+	White            // 後手
+)
+
+func (c Color) String() string {
+	switch c {
+	case Black:
+		return "●"
+	case White:
+		return "○"
+	default:
+		return "-"
+	}
+}
+
+func opponent(c Color) Color {
+	switch c {
+	case Black:
+		return White
+	case White:
+		return Black
+	default:
+		return EmptyColor
+	}
+}
+
+// MaxSize は、盤面の一辺の上限。
+const MaxSize = 8
+
+// Board は、盤面。Config の大きさの外側は常に EmptyColor。
+type Board [MaxSize][MaxSize]Color
+
+// Action は、石を置くマスの番号(Row*Size+Col)。PassAction はパス。
+type Action int
+
+const PassAction Action = -1
+
+type State struct {
+	Board Board
+	Turn  Color
+}
+
+type Config struct {
+	// Size は、盤面の一辺。4以上 MaxSize 以下の偶数であるべき。
+	Size int
+}
+
+// NewDefaultConfig は、標準の8x8の設定を返す。
+func NewDefaultConfig() Config {
+	return Config{Size: 8}
+}
+
+func (c Config) Validate() error {
+	if c.Size < 4 || c.Size > MaxSize || c.Size%2 != 0 {
+		return fmt.Errorf("Sizeが不正: Size = %d: 4 <= Size <= %d の偶数であるべき", c.Size, MaxSize)
+	}
+	return nil
+}
+
+// NewInitialState は、中央の4マスに石を置いた開始局面(Blackが先手)を返す。
+func (c Config) NewInitialState() State {
+	h := c.Size / 2
+	s := State{Turn: Black}
+	s.Board[h-1][h-1] = White
+	s.Board[h][h] = White
+	s.Board[h-1][h] = Black
+	s.Board[h][h-1] = Black
+	return s
+}
+
+// Square は、マス(row, col)の Action を返す。
+func (c Config) Square(row, col int) Action {
+	return Action(row*c.Size + col)
+}
+
+var directions = [8][2]int{{-1, -1}, {-1, 0}, {-1, 1}, {0, -1}, {0, 1}, {1, -1}, {1, 0}, {1, 1}}
+
+// flips は、color が (row, col) に置いた場合に裏返る石の位置を返す。
+func (c Config) flips(b Board, color Color, row, col int) [][2]int {
+	if b[row][col] != EmptyColor {
+		return nil
+	}
+
+	opp := opponent(color)
+	var result [][2]int
+	for _, d := range directions {
+		r, cl := row+d[0], col+d[1]
+		n := 0
+		for r >= 0 && r < c.Size && cl >= 0 && cl < c.Size && b[r][cl] == opp {
+			r, cl = r+d[0], cl+d[1]
+			n++
+		}
+
+		if n == 0 || r < 0 || r >= c.Size || cl < 0 || cl >= c.Size || b[r][cl] != color {
+			continue
+		}
+
+		for i := 1; i <= n; i++ {
+			result = append(result, [2]int{row + d[0]*i, col + d[1]*i})
+		}
+	}
+	return result
+}
+
+// placeableActions は、color が石を置けるマスを返す。パスは含まない。
+func (c Config) placeableActions(b Board, color Color) []Action {
+	var actions []Action
+	for r := range c.Size {
+		for cl := range c.Size {
+			if len(c.flips(b, color, r, cl)) != 0 {
+				actions = append(actions, c.Square(r, cl))
+			}
+		}
+	}
+	return actions
+}
+
+func (c Config) legalActions(s State) []Action {
+	if actions := c.placeableActions(s.Board, s.Turn); len(actions) != 0 {
+		return actions
+	}
+
+	if len(c.placeableActions(s.Board, opponent(s.Turn))) != 0 {
+		return []Action{PassAction}
+	}
+	return nil
+}
+
+func (c Config) transition(s State, a Action) (State, error) {
+	if s.Turn != Black && s.Turn != White {
+		return State{}, fmt.Errorf("turnが不正: turn = %v: BlackまたはWhiteであるべき", s.Turn)
+	}
+
+	if a == PassAction {
+		if len(c.placeableActions(s.Board, s.Turn)) != 0 {
+			return State{}, errors.New("石を置けるマスがある為、パスできません")
+		}
+		return State{Board: s.Board, Turn: opponent(s.Turn)}, nil
+	}
+
+	if a < 0 || int(a) >= c.Size*c.Size {
+		return State{}, fmt.Errorf("actionが範囲外: action = %d: 0 <= action < %d であるべき", a, c.Size*c.Size)
+	}
+
+	row, col := int(a)/c.Size, int(a)%c.Size
+	flips := c.flips(s.Board, s.Turn, row, col)
+	if len(flips) == 0 {
+		return State{}, fmt.Errorf("石を置けないマスです: action = %d", a)
+	}
+
+	next := State{Board: s.Board, Turn: opponent(s.Turn)}
+	next.Board[row][col] = s.Turn
+	for _, f := range flips {
+		next.Board[f[0]][f[1]] = s.Turn
+	}
+	return next, nil
+}
+
+func (c Config) pointByAgent(s State) (game.PointByAgent[Color], error) {
+	points := game.PointByAgent[Color]{Black: 0, White: 0}
+	for r := range c.Size {
+		for cl := range c.Size {
+			if color := s.Board[r][cl]; color != EmptyColor {
+				points[color]++
+			}
+		}
+	}
+	return points, nil
+}
+
+func (c Config) rankByAgent(s State) (game.RankByAgent[Color], error) {
+	if len(c.legalActions(s)) != 0 {
+		return game.RankByAgent[Color]{}, nil
+	}
+
+	points, err := c.pointByAgent(s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case points[Black] > points[White]:
+		return game.RankByAgent[Color]{Black: 1, White: 2}, nil
+	case points[Black] < points[White]:
+		return game.RankByAgent[Color]{White: 1, Black: 2}, nil
+	default:
+		return game.RankByAgent[Color]{Black: 1, White: 1}, nil
+	}
+}
+
+// NewEngine は、config の盤面のオセロのゲームエンジンを返す。
+func NewEngine(config Config) (sequential.Engine[State, Action, Color], error) {
+	if err := config.Validate(); err != nil {
+		return sequential.Engine[State, Action, Color]{}, err
+	}
+
+	e := sequential.Engine[State, Action, Color]{
+		Rule: sequential.Rule[State, Action, Color]{
+			LegalActionsFunc: config.legalActions,
+			TransitionFunc:   config.transition,
+			EqualFunc:        func(s1, s2 State) bool { return s1 == s2 },
+			CurrentAgentFunc: func(s State) Color { return s.Turn },
+		},
+		RankByAgentFunc:  config.rankByAgent,
+		PointByAgentFunc: config.pointByAgent,
+		Agents:           []Color{Black, White},
+	}
+	e.SetStandardResultScoreByAgentFunc()
+	return e, nil
+}
@@ -0,0 +1,199 @@
+package othello_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/games/internal/solver"
+	"github.com/sw965/crow/games/othello"
+	"github.com/sw965/omw/mathx/randx"
+)
+
+type engine = sequential.Engine[othello.State, othello.Action, othello.Color]
+
+func newEngine(t *testing.T, config othello.Config) engine {
+	t.Helper()
+	e, err := othello.NewEngine(config)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	return e
+}
+
+func TestLegalActions(t *testing.T) {
+	config := othello.NewDefaultConfig()
+	e := newEngine(t, config)
+	state := config.NewInitialState()
+
+	// 開始局面の黒の合法手は d3, c4, f5, e6 の4つ
+	want := []othello.Action{config.Square(2, 3), config.Square(3, 2), config.Square(4, 5), config.Square(5, 4)}
+	got := e.Rule.LegalActionsFunc(state)
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("合法手の不一致: got = %v, want = %v", got, want)
+	}
+
+	next, err := e.Rule.TransitionFunc(state, config.Square(2, 3))
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if next.Board[3][3] != othello.Black {
+		t.Error("挟んだ石が裏返っていない")
+	}
+
+	points, err := e.PointByAgentFunc(next)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if points[othello.Black] != 4 || points[othello.White] != 1 {
+		t.Errorf("石の数の不一致: got = %v", points)
+	}
+
+	t.Run("異常_石を置けないマス", func(t *testing.T) {
+		if _, err := e.Rule.TransitionFunc(state, config.Square(0, 0)); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_置けるマスがあるのにパス", func(t *testing.T) {
+		if _, err := e.Rule.TransitionFunc(state, othello.PassAction); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_奇数のSize", func(t *testing.T) {
+		if _, err := othello.NewEngine(othello.Config{Size: 5}); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestPass(t *testing.T) {
+	config := othello.Config{Size: 4}
+	e := newEngine(t, config)
+
+	// 白は置けるマスが無く、黒は (0, 3) に置ける
+	var state othello.State
+	state.Board[0][0] = othello.Black
+	state.Board[0][1] = othello.White
+	state.Board[0][2] = othello.White
+	state.Turn = othello.White
+
+	if got := e.Rule.LegalActionsFunc(state); !slices.Equal(got, []othello.Action{othello.PassAction}) {
+		t.Fatalf("合法手の不一致: got = %v, want = [PassAction]", got)
+	}
+
+	next, err := e.Rule.TransitionFunc(state, othello.PassAction)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if next.Turn != othello.Black || next.Board != state.Board {
+		t.Error("パスで手番だけが変わっていない")
+	}
+
+	isEnd, err := e.IsTerminal(next)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if isEnd {
+		t.Error("黒に合法手があるのに終局している")
+	}
+
+	// 黒が置くと白の石が無くなり、双方とも置けないので終局する
+	end, err := e.Rule.TransitionFunc(next, config.Square(0, 3))
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	ranks, err := e.RankByAgentFunc(end)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if ranks[othello.Black] != 1 || ranks[othello.White] != 2 {
+		t.Errorf("順位の不一致: got = %v", ranks)
+	}
+}
+
+// solveMargin は、手番から見た最善の石差を返す。
+func solveMargin(e engine, state othello.State, memo map[othello.State]int) int {
+	if v, ok := memo[state]; ok {
+		return v
+	}
+
+	legalActions := e.Rule.LegalActionsFunc(state)
+	if len(legalActions) == 0 {
+		points, _ := e.PointByAgentFunc(state)
+		margin := int(points[othello.Black] - points[othello.White])
+		if state.Turn == othello.White {
+			margin = -margin
+		}
+		return margin
+	}
+
+	best := -othello.MaxSize * othello.MaxSize
+	for _, a := range legalActions {
+		next, _ := e.Rule.TransitionFunc(state, a)
+		// パスの場合も手番は入れ替わる
+		best = max(best, -solveMargin(e, next, memo))
+	}
+	memo[state] = best
+	return best
+}
+
+func TestSolvedValues(t *testing.T) {
+	config := othello.Config{Size: 4}
+	e := newEngine(t, config)
+
+	s, err := solver.New(&e)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	scores, err := s.Solve(config.NewInitialState())
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if scores[othello.White] != 1.0 {
+		t.Errorf("理論値_4x4は後手必勝: 白の結果スコア got = %f, want = 1", scores[othello.White])
+	}
+
+	if got := solveMargin(e, config.NewInitialState(), map[othello.State]int{}); got != -8 {
+		t.Errorf("理論値_4x4は白が8石差で勝つ: 黒から見た石差 got = %d, want = -8", got)
+	}
+}
+
+func TestRandomPlayouts(t *testing.T) {
+	config := othello.NewDefaultConfig()
+	e := newEngine(t, config)
+
+	rngs, err := randx.NewPCGs(4)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	inits := make([]othello.State, 16)
+	for i := range inits {
+		inits[i] = config.NewInitialState()
+	}
+
+	accr := sequential.NewRandomActorCritic[othello.State, othello.Action, othello.Color]()
+	records, err := e.RecordPlayouts(inits, accr, rngs, 64)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	for i, r := range records {
+		// 置く手は最大60手で、パスは連続しない
+		if len(r.Steps) > 2*(config.Size*config.Size-4) {
+			t.Errorf("records[%d]: 手数が多すぎる: got = %d", i, len(r.Steps))
+		}
+
+		points, err := e.PointByAgentFunc(r.FinalState)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if points[othello.Black]+points[othello.White] > float32(config.Size*config.Size) {
+			t.Errorf("records[%d]: 石の数がマスの数を超えている: got = %v", i, points)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/sw965/crow/game"
 	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/omw/mathx/bitsx"
 )
 
 // Mark は、盤面のマスの状態、及びエージェント(手番)を表す。
@@ -166,3 +167,88 @@ func NewEngine() sequential.Engine[State, Action, Mark] {
 	e.SetStandardResultScoreByAgentFunc()
 	return e
 }
+
+// squareMapFunc は、マスの位置(行, 列)を対称変換で写す。
+type squareMapFunc func(r, c int) (int, int)
+
+// dihedralSquareMapFuncs は、3x3盤面の二面体群(回転4通り x 反転の有無)の8つの変換。
+var dihedralSquareMapFuncs = [8]squareMapFunc{
+	func(r, c int) (int, int) { return r, c },         // 恒等
+	func(r, c int) (int, int) { return c, 2 - r },     // 90度回転
+	func(r, c int) (int, int) { return 2 - r, 2 - c }, // 180度回転
+	func(r, c int) (int, int) { return 2 - c, r },     // 270度回転
+	func(r, c int) (int, int) { return r, 2 - c },     // 左右反転
+	func(r, c int) (int, int) { return 2 - r, c },     // 上下反転
+	func(r, c int) (int, int) { return c, r },         // 主対角線で反転
+	func(r, c int) (int, int) { return 2 - c, 2 - r }, // 副対角線で反転
+}
+
+// SymmetryFuncs は、三目並べの8つの対称変換を返す。先頭は恒等変換。
+func SymmetryFuncs() []game.SymmetryFunc[State, Action] {
+	fs := make([]game.SymmetryFunc[State, Action], len(dihedralSquareMapFuncs))
+	for i, f := range dihedralSquareMapFuncs {
+		fs[i] = func(s State) (State, game.ActionMapFunc[Action], error) {
+			next := State{Turn: s.Turn}
+			for r := range 3 {
+				for c := range 3 {
+					tr, tc := f(r, c)
+					next.Board[tr][tc] = s.Board[r][c]
+				}
+			}
+
+			actionMapFunc := func(a Action) Action {
+				row, col := f(a.Row, a.Col)
+				return Action{Row: row, Col: col}
+			}
+			return next, actionMapFunc, nil
+		}
+	}
+	return fs
+}
+
+// NewActionCodec は、9マスを行優先(Row*3+Col)でインデックス化したActionCodecを返す。
+func NewActionCodec() game.ActionCodec[Action] {
+	actions := make([]Action, 0, 9)
+	for r := range 3 {
+		for c := range 3 {
+			actions = append(actions, Action{Row: r, Col: c})
+		}
+	}
+	// 9マスは重複しない為、エラーにはならない
+	codec, _ := game.NewSliceActionCodec(actions)
+	return codec
+}
+
+// EncodedRows と EncodedCols は、EncodeState が返す行列の形状。
+const (
+	EncodedRows = 1
+	EncodedCols = 18
+)
+
+// EncodeState は、状態を手番から見た 1x18 のビット行列に変換する。
+// 先頭9ビットが手番のマーク、後半9ビットが相手のマークの位置(行優先)。
+func EncodeState(s State) (*bitsx.Matrix, error) {
+	x, err := bitsx.NewZerosMatrix(EncodedRows, EncodedCols)
+	if err != nil {
+		return nil, err
+	}
+
+	for r := range 3 {
+		for c := range 3 {
+			var offset int
+			switch s.Board[r][c] {
+			case s.Turn:
+				offset = 0
+			case opponent(s.Turn):
+				offset = 9
+			default:
+				continue
+			}
+
+			if err := x.Set(0, offset+r*3+c); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return x, nil
+}
@@ -141,3 +141,98 @@ func TestLegalActions(t *testing.T) {
 		}
 	})
 }
+
+func TestSymmetryFuncs(t *testing.T) {
+	engine := ttt.NewEngine()
+	state := ttt.State{
+		Board: ttt.Board{
+			{ttt.Cross, ttt.Cross, ttt.EmptyMark},
+			{ttt.Nought, ttt.EmptyMark, ttt.EmptyMark},
+			{ttt.EmptyMark, ttt.EmptyMark, ttt.EmptyMark},
+		},
+		Turn: ttt.Nought,
+	}
+
+	fs := ttt.SymmetryFuncs()
+	if len(fs) != 8 {
+		t.Fatalf("対称変換の数の不一致: got = %d, want = 8", len(fs))
+	}
+
+	seen := map[ttt.State]bool{}
+	for i, f := range fs {
+		symState, actionMapFunc, err := f(state)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		seen[symState] = true
+
+		if symState.Turn != state.Turn {
+			t.Errorf("fs[%d]: 手番が変わっている: got = %v, want = %v", i, symState.Turn, state.Turn)
+		}
+
+		// 合法手は、変換後の状態の合法手へ一対一に写されるはず
+		symLegalActions := map[ttt.Action]bool{}
+		for _, a := range engine.Rule.LegalActionsFunc(symState) {
+			symLegalActions[a] = true
+		}
+		for _, a := range engine.Rule.LegalActionsFunc(state) {
+			if !symLegalActions[actionMapFunc(a)] {
+				t.Errorf("fs[%d]: 合法手 %v の写像 %v が変換後の合法手ではない", i, a, actionMapFunc(a))
+			}
+		}
+
+		// 行動の写像と、状態の変換は一致するはず
+		next, err := engine.Rule.TransitionFunc(state, ttt.Action{Row: 0, Col: 2})
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		symNext, _, err := f(next)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		got, err := engine.Rule.TransitionFunc(symState, actionMapFunc(ttt.Action{Row: 0, Col: 2}))
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if got != symNext {
+			t.Errorf("fs[%d]: 変換してから遷移した状態と、遷移してから変換した状態が一致しない", i)
+		}
+	}
+
+	// 対称性の無い局面なので、8つの変換は全て異なる状態になるはず
+	if len(seen) != 8 {
+		t.Errorf("異なる状態の数の不一致: got = %d, want = 8", len(seen))
+	}
+}
+
+func TestEncodeState(t *testing.T) {
+	state := ttt.State{
+		Board: ttt.Board{
+			{ttt.Cross, ttt.EmptyMark, ttt.EmptyMark},
+			{ttt.EmptyMark, ttt.Nought, ttt.EmptyMark},
+			{ttt.EmptyMark, ttt.EmptyMark, ttt.EmptyMark},
+		},
+		Turn: ttt.Cross,
+	}
+
+	x, err := ttt.EncodeState(state)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if x.Rows() != ttt.EncodedRows || x.Cols() != ttt.EncodedCols {
+		t.Fatalf("形状の不一致: got = %dx%d, want = %dx%d", x.Rows(), x.Cols(), ttt.EncodedRows, ttt.EncodedCols)
+	}
+
+	// 手番(Cross)の(0,0)が先頭9ビット、相手(Nought)の(1,1)が後半9ビットに立つ
+	for c := range ttt.EncodedCols {
+		bit, err := x.Bit(0, c)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		want := c == 0 || c == 9+4
+		if (bit == 1) != want {
+			t.Errorf("ビット%dの不一致: got = %d, want = %t", c, bit, want)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+// Package league は、凍結したActorCriticのスナップショットを対戦相手のプールとして保持し、
+// 学習中のActorCriticの対戦相手を選ぶリーグ戦の仕組みを提供する。
+package league
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/omw/mathx/randx"
+)
+
+// Strategy は、プールから対戦相手を選ぶ方法。
+type Strategy int
+
+const (
+	// UniformStrategy は、全ての対戦相手から一様に選ぶ。
+	UniformStrategy Strategy = iota
+	// PFSPStrategy は、学習中のActorCriticのその相手への勝率を PFSPWeightFunc で重みに変換し、重みに比例して選ぶ。
+	PFSPStrategy
+	// LatestVsPastStrategy は、確率 LatestProbability で最新のスナップショットを選び、それ以外は過去のスナップショットから一様に選ぶ。
+	LatestVsPastStrategy
+)
+
+func (s Strategy) String() string {
+	switch s {
+	case UniformStrategy:
+		return "uniform"
+	case PFSPStrategy:
+		return "pfsp"
+	case LatestVsPastStrategy:
+		return "latest-vs-past"
+	default:
+		return fmt.Sprintf("Strategy(%d)", int(s))
+	}
+}
+
+// PFSPWeightFunc は、学習中のActorCriticの対戦相手への勝率(平均スコア)から、その相手を選ぶ重みを計算する。
+type PFSPWeightFunc func(float32) float32
+
+// PFSPHardWeightFunc は、勝てていない相手ほど重くする。重みは (1-p)^2。
+func PFSPHardWeightFunc(p float32) float32 {
+	return (1.0 - p) * (1.0 - p)
+}
+
+// PFSPVarianceWeightFunc は、勝率が五分に近い相手ほど重くする。重みは p(1-p)。
+func PFSPVarianceWeightFunc(p float32) float32 {
+	return p * (1.0 - p)
+}
+
+type Config struct {
+	Strategy Strategy
+	// PFSPWeightFunc は、PFSPStrategy で使う重み関数。nilの場合は PFSPHardWeightFunc を使う。
+	PFSPWeightFunc PFSPWeightFunc
+	// LatestProbability は、LatestVsPastStrategy で最新のスナップショットを選ぶ確率。
+	LatestProbability float32
+	// MaxSize は、プールに保持するスナップショットの数の上限。超えた場合は古いものから捨てる。0以下の場合は制限しない。
+	MaxSize int
+	// PriorWinRate は、まだ対戦していない相手への勝率とみなす値。
+	PriorWinRate float32
+}
+
+func NewDefaultConfig() Config {
+	return Config{
+		Strategy:          PFSPStrategy,
+		PFSPWeightFunc:    PFSPHardWeightFunc,
+		LatestProbability: 0.5,
+		PriorWinRate:      0.5,
+	}
+}
+
+func (c Config) Validate() error {
+	switch c.Strategy {
+	case UniformStrategy, PFSPStrategy, LatestVsPastStrategy:
+	default:
+		return fmt.Errorf("Strategyが不正: Strategy = %d", int(c.Strategy))
+	}
+
+	if c.LatestProbability < 0.0 || c.LatestProbability > 1.0 {
+		return fmt.Errorf("LatestProbabilityが不正: LatestProbability = %g: 0 <= LatestProbability <= 1 であるべき", c.LatestProbability)
+	}
+
+	if c.PriorWinRate < 0.0 || c.PriorWinRate > 1.0 {
+		return fmt.Errorf("PriorWinRateが不正: PriorWinRate = %g: 0 <= PriorWinRate <= 1 であるべき", c.PriorWinRate)
+	}
+	return nil
+}
+
+// Opponent は、プール内の対戦相手と、学習中のActorCriticのその相手に対する成績。
+type Opponent[S any, Ac, Ag comparable] struct {
+	ActorCritic sequential.ActorCritic[S, Ac, Ag]
+	// TotalScore は、学習中のActorCriticがこの相手との対局で得た結果スコアの合計。
+	TotalScore float32
+	NumGames   int
+}
+
+// WinRate は、学習中のActorCriticのこの相手への平均スコアを返す。まだ対戦していない場合は prior を返す。
+func (o Opponent[S, Ac, Ag]) WinRate(prior float32) float32 {
+	if o.NumGames <= 0 {
+		return prior
+	}
+	return o.TotalScore / float32(o.NumGames)
+}
+
+// Pool は、対戦相手のスナップショットを追加順に保持する。
+// 全てのメソッドは、複数のgoroutineから並行に呼び出せる。
+type Pool[S any, Ac, Ag comparable] struct {
+	config Config
+
+	mu        sync.Mutex
+	opponents []Opponent[S, Ac, Ag]
+}
+
+func NewPool[S any, Ac, Ag comparable](config Config) (*Pool[S, Ac, Ag], error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.PFSPWeightFunc == nil {
+		config.PFSPWeightFunc = PFSPHardWeightFunc
+	}
+	return &Pool[S, Ac, Ag]{config: config}, nil
+}
+
+func (p *Pool[S, Ac, Ag]) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.opponents)
+}
+
+// Opponents は、保持している対戦相手のコピーを追加順に返す。
+func (p *Pool[S, Ac, Ag]) Opponents() []Opponent[S, Ac, Ag] {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.opponents)
+}
+
+// Add は、スナップショットをプールに追加する。
+// accr は、以降の学習で内容が変わらないよう、モデルを複製した上で作ったものであるべき。
+func (p *Pool[S, Ac, Ag]) Add(accr sequential.ActorCritic[S, Ac, Ag]) error {
+	if err := accr.Validate(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, o := range p.opponents {
+		if o.ActorCritic.Name == accr.Name {
+			return fmt.Errorf("ActorCriticの名前が重複している: Name = %s", accr.Name)
+		}
+	}
+
+	p.opponents = append(p.opponents, Opponent[S, Ac, Ag]{ActorCritic: accr})
+	if p.config.MaxSize > 0 && len(p.opponents) > p.config.MaxSize {
+		p.opponents = slices.Delete(p.opponents, 0, len(p.opponents)-p.config.MaxSize)
+	}
+	return nil
+}
+
+// Weights は、各対戦相手(追加順)が Sample で選ばれる確率を返す。
+func (p *Pool[S, Ac, Ag]) Weights() ([]float32, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.weights()
+}
+
+func (p *Pool[S, Ac, Ag]) weights() ([]float32, error) {
+	n := len(p.opponents)
+	if n == 0 {
+		return nil, errors.New("プールが空です")
+	}
+
+	ws := make([]float32, n)
+	uniform := func() []float32 {
+		for i := range ws {
+			ws[i] = 1.0 / float32(n)
+		}
+		return ws
+	}
+
+	switch p.config.Strategy {
+	case UniformStrategy:
+		return uniform(), nil
+	case PFSPStrategy:
+		var sum float32
+		for i, o := range p.opponents {
+			w := p.config.PFSPWeightFunc(o.WinRate(p.config.PriorWinRate))
+			if w < 0 || math.IsNaN(float64(w)) {
+				return nil, fmt.Errorf("PFSPWeightFuncの戻り値が不正: weight = %g: weight >= 0 であるべき", w)
+			}
+			ws[i] = w
+			sum += w
+		}
+		// 全ての重みが0の場合(例えば、全ての相手に勝ち切っている場合)は、一様に選ぶ。
+		if sum <= 0 {
+			return uniform(), nil
+		}
+		for i := range ws {
+			ws[i] /= sum
+		}
+		return ws, nil
+	case LatestVsPastStrategy:
+		if n == 1 {
+			ws[0] = 1.0
+			return ws, nil
+		}
+		past := (1.0 - p.config.LatestProbability) / float32(n-1)
+		for i := range n - 1 {
+			ws[i] = past
+		}
+		ws[n-1] = p.config.LatestProbability
+		return ws, nil
+	default:
+		return nil, fmt.Errorf("Strategyが不正: Strategy = %d", int(p.config.Strategy))
+	}
+}
+
+// Sample は、Strategy に従って対戦相手を1つ選ぶ。
+func (p *Pool[S, Ac, Ag]) Sample(rng *rand.Rand) (sequential.ActorCritic[S, Ac, Ag], error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ws, err := p.weights()
+	if err != nil {
+		return sequential.ActorCritic[S, Ac, Ag]{}, err
+	}
+
+	idx, err := randx.IndexByWeights(ws, rng)
+	if err != nil {
+		return sequential.ActorCritic[S, Ac, Ag]{}, err
+	}
+	return p.opponents[idx].ActorCritic, nil
+}
+
+// Record は、学習中のActorCriticが name の相手との numGames 局で、結果スコアを合計 totalScore 得たことを記録する。
+// name の相手が既にプールから捨てられている場合は何もしない。
+func (p *Pool[S, Ac, Ag]) Record(name game.ActorCriticName, totalScore float32, numGames int) error {
+	if numGames < 0 {
+		return fmt.Errorf("numGamesが不正: numGames = %d: numGames >= 0 であるべき", numGames)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := range p.opponents {
+		if p.opponents[i].ActorCritic.Name == name {
+			p.opponents[i].TotalScore += totalScore
+			p.opponents[i].NumGames += numGames
+			return nil
+		}
+	}
+	return nil
+}
+
+// MatchResult は、Match で行った1組の対戦の結果。
+type MatchResult[S any, Ac, Ag comparable] struct {
+	OpponentName game.ActorCriticName
+	// Score は、学習中のActorCriticのこの対戦での平均スコア。
+	Score   float32
+	Records []sequential.Record[S, Ac, Ag]
+}
+
+// Match は、プールから対戦相手を選び、learner と総当たり(全ての手番の並び)で対戦させ、成績をプールに記録する。
+// 対戦の実行と、ActorCriticの名前ごとのスコアの集計は sequential.Engine.NewCrossPlayoutRecorder に任せる。
+// parallel は、対局を並列に実行する数。
+func (p *Pool[S, Ac, Ag]) Match(engine *sequential.Engine[S, Ac, Ag], learner sequential.ActorCritic[S, Ac, Ag], inits []S, parallel int, rng *rand.Rand) (MatchResult[S, Ac, Ag], error) {
+	if engine == nil {
+		return MatchResult[S, Ac, Ag]{}, errors.New("engineがnilです")
+	}
+
+	opponent, err := p.Sample(rng)
+	if err != nil {
+		return MatchResult[S, Ac, Ag]{}, err
+	}
+
+	if opponent.Name == learner.Name {
+		return MatchResult[S, Ac, Ag]{}, fmt.Errorf("learnerと対戦相手の名前が同じ: Name = %s: 成績を区別できない", learner.Name)
+	}
+
+	recorder, err := engine.NewCrossPlayoutRecorder(inits, []sequential.ActorCritic[S, Ac, Ag]{learner, opponent}, parallel)
+	if err != nil {
+		return MatchResult[S, Ac, Ag]{}, err
+	}
+
+	records, err := recorder.Collect()
+	if err != nil {
+		return MatchResult[S, Ac, Ag]{}, err
+	}
+
+	totalScore := recorder.TotalScoreByActorCriticName()[learner.Name]
+	numGames := recorder.NumGamesByActorCriticName()[learner.Name]
+	if err := p.Record(opponent.Name, totalScore, numGames); err != nil {
+		return MatchResult[S, Ac, Ag]{}, err
+	}
+
+	avg, err := recorder.AverageScoreByActorCriticName()
+	if err != nil {
+		return MatchResult[S, Ac, Ag]{}, err
+	}
+
+	return MatchResult[S, Ac, Ag]{
+		OpponentName: opponent.Name,
+		Score:        avg[learner.Name],
+		Records:      records,
+	}, nil
+}
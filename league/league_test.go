@@ -0,0 +1,246 @@
+package league_test
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/internal/ttt"
+	"github.com/sw965/crow/league"
+	"github.com/sw965/omw/mathx/randx"
+)
+
+type actorCritic = sequential.ActorCritic[ttt.State, ttt.Action, ttt.Mark]
+
+func newRandomActorCritic(name game.ActorCriticName) actorCritic {
+	accr := sequential.NewRandomActorCritic[ttt.State, ttt.Action, ttt.Mark]()
+	accr.Name = name
+	return accr
+}
+
+func newPool(t *testing.T, config league.Config, names ...game.ActorCriticName) *league.Pool[ttt.State, ttt.Action, ttt.Mark] {
+	t.Helper()
+	pool, err := league.NewPool[ttt.State, ttt.Action, ttt.Mark](config)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	for _, name := range names {
+		if err := pool.Add(newRandomActorCritic(name)); err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+	}
+	return pool
+}
+
+func equalWeights(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(float64(a[i]-b[i])) > 1e-5 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPoolWeights(t *testing.T) {
+	tests := []struct {
+		name   string
+		config league.Config
+		// scores は、各相手(追加順)に対する学習中のActorCriticの (合計スコア, 試合数)。
+		scores [][2]float32
+		want   []float32
+	}{
+		{
+			name:   "正常_一様",
+			config: league.Config{Strategy: league.UniformStrategy},
+			scores: [][2]float32{{4, 4}, {0, 4}, {0, 0}, {2, 4}},
+			want:   []float32{0.25, 0.25, 0.25, 0.25},
+		},
+		{
+			name:   "正常_PFSP_hard",
+			config: league.Config{Strategy: league.PFSPStrategy, PFSPWeightFunc: league.PFSPHardWeightFunc, PriorWinRate: 0.5},
+			// 勝率: 1.0, 0.0, 未対戦(0.5), 0.5 -> 重み: 0, 1, 0.25, 0.25
+			scores: [][2]float32{{4, 4}, {0, 4}, {0, 0}, {2, 4}},
+			want:   []float32{0.0, 1.0 / 1.5, 0.25 / 1.5, 0.25 / 1.5},
+		},
+		{
+			name:   "正常_PFSP_variance",
+			config: league.Config{Strategy: league.PFSPStrategy, PFSPWeightFunc: league.PFSPVarianceWeightFunc, PriorWinRate: 0.5},
+			// 重み: 0, 0, 0.25, 0.25
+			scores: [][2]float32{{4, 4}, {0, 4}, {0, 0}, {2, 4}},
+			want:   []float32{0.0, 0.0, 0.5, 0.5},
+		},
+		{
+			name:   "準正常_PFSP_全ての重みが0なら一様",
+			config: league.Config{Strategy: league.PFSPStrategy, PFSPWeightFunc: league.PFSPHardWeightFunc},
+			scores: [][2]float32{{4, 4}, {4, 4}},
+			want:   []float32{0.5, 0.5},
+		},
+		{
+			name:   "正常_最新と過去",
+			config: league.Config{Strategy: league.LatestVsPastStrategy, LatestProbability: 0.4},
+			scores: [][2]float32{{0, 0}, {0, 0}, {0, 0}, {0, 0}},
+			want:   []float32{0.2, 0.2, 0.2, 0.4},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			names := make([]game.ActorCriticName, len(tc.scores))
+			for i := range names {
+				names[i] = game.ActorCriticName(fmt.Sprintf("snapshot%d", i))
+			}
+			pool := newPool(t, tc.config, names...)
+
+			for i, s := range tc.scores {
+				if err := pool.Record(names[i], s[0], int(s[1])); err != nil {
+					t.Fatalf("予期せぬエラー: %v", err)
+				}
+			}
+
+			got, err := pool.Weights()
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if !equalWeights(got, tc.want) {
+				t.Errorf("重みの不一致: got = %v, want = %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPoolAdd(t *testing.T) {
+	pool := newPool(t, league.Config{Strategy: league.UniformStrategy, MaxSize: 2}, "a", "b", "c")
+
+	opponents := pool.Opponents()
+	if len(opponents) != 2 || opponents[0].ActorCritic.Name != "b" || opponents[1].ActorCritic.Name != "c" {
+		t.Errorf("古いスナップショットが捨てられていない: got = %d 件", len(opponents))
+	}
+
+	t.Run("異常_名前の重複", func(t *testing.T) {
+		if err := pool.Add(newRandomActorCritic("c")); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_PolicyValueFuncがnil", func(t *testing.T) {
+		if err := pool.Add(actorCritic{Name: "d", SelectFunc: game.MaxSelectFunc[ttt.Action, ttt.Mark]}); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_空のプールからのサンプリング", func(t *testing.T) {
+		empty := newPool(t, league.NewDefaultConfig())
+		if _, err := empty.Sample(randx.NewPCG()); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestPoolSample(t *testing.T) {
+	pool := newPool(t, league.Config{Strategy: league.LatestVsPastStrategy, LatestProbability: 0.7}, "old", "new")
+	rng := randx.NewPCG()
+
+	n := 10000
+	counts := map[game.ActorCriticName]int{}
+	for range n {
+		accr, err := pool.Sample(rng)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		counts[accr.Name]++
+	}
+
+	const eps = 0.03
+	ratio := float64(counts["new"]) / float64(n)
+	if math.Abs(ratio-0.7) > eps {
+		t.Errorf("最新のスナップショットの比率の不一致: got = %.3f, want = 0.700(±%.3f)", ratio, eps)
+	}
+}
+
+func TestPoolMatch(t *testing.T) {
+	engine := ttt.NewEngine()
+	pool := newPool(t, league.NewDefaultConfig(), "past1", "past2")
+	learner := newRandomActorCritic("learner")
+	rng := randx.NewPCG()
+
+	n := 5
+	inits := make([]ttt.State, n)
+	for i := range inits {
+		inits[i] = ttt.NewInitialState()
+	}
+
+	var totalGames int
+	for range 4 {
+		result, err := pool.Match(&engine, learner, inits, 2, rng)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		// 先手と後手を入れ替えて、n局ずつ対戦する
+		if len(result.Records) != 2*n {
+			t.Errorf("len(Records)の不一致: got = %d, want = %d", len(result.Records), 2*n)
+		}
+		if result.Score < 0.0 || result.Score > 1.0 {
+			t.Errorf("Scoreが範囲外: got = %f", result.Score)
+		}
+		for _, r := range result.Records {
+			if r.ActorCriticNameByAgent[ttt.Cross] != "learner" && r.ActorCriticNameByAgent[ttt.Nought] != "learner" {
+				t.Errorf("learnerが対局に参加していない: %v", r.ActorCriticNameByAgent)
+			}
+		}
+		totalGames += len(result.Records)
+	}
+
+	// 全ての対局の成績が、いずれかの相手に記録されている
+	var recordedGames int
+	for _, o := range pool.Opponents() {
+		recordedGames += o.NumGames
+		if o.NumGames > 0 {
+			if wr := o.WinRate(0.5); wr < 0.0 || wr > 1.0 {
+				t.Errorf("%s への勝率が範囲外: got = %f", o.ActorCritic.Name, wr)
+			}
+		}
+	}
+	if recordedGames != totalGames {
+		t.Errorf("記録された試合数の不一致: got = %d, want = %d", recordedGames, totalGames)
+	}
+
+	t.Run("異常_learnerと同名の相手", func(t *testing.T) {
+		same := newPool(t, league.NewDefaultConfig(), "learner")
+		if _, err := same.Match(&engine, learner, inits, 2, rng); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*league.Config)
+		wantErr bool
+	}{
+		{name: "正常", modify: func(c *league.Config) {}},
+		{name: "異常_LatestProbabilityが1超", modify: func(c *league.Config) { c.LatestProbability = 1.5 }, wantErr: true},
+		{name: "異常_PriorWinRateが負", modify: func(c *league.Config) { c.PriorWinRate = -0.1 }, wantErr: true},
+		{name: "異常_未知のStrategy", modify: func(c *league.Config) { c.Strategy = 99 }, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config := league.NewDefaultConfig()
+			tc.modify(&config)
+			err := config.Validate()
+			if tc.wantErr && err == nil {
+				t.Fatal("エラーを期待したが、nilが返された")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+		})
+	}
+}
@@ -7,13 +7,13 @@ import (
 	"fmt"
 	"maps"
 	"math/rand/v2"
-	"slices"
 	"sync"
 
 	"github.com/sw965/crow/game"
 	"github.com/sw965/crow/game/simultaneous"
+	"github.com/sw965/crow/mcts/internal/tree"
 	"github.com/sw965/crow/pucb"
-	"github.com/sw965/omw/parallel"
+	"github.com/sw965/crow/search"
 )
 
 var (
@@ -39,16 +39,16 @@ type LeafNodeEvalByAgentFunc[S any, Ag comparable] func(S, *rand.Rand) (LeafNode
 type PolicyFunc[S any, Ac, Ag comparable] func(S, simultaneous.LegalActionsByAgent[Ac, Ag]) (simultaneous.PolicyByAgent[Ac, Ag], error)
 
 type Node[S any, Ac, Ag comparable] struct {
-	State            S
-	virtualSelectors map[Ag]pucb.VirtualSelector[Ac]
-	nextNodes        Nodes[S, Ac, Ag]
-	mu               sync.Mutex
+	State        S
+	statsByAgent map[Ag]*tree.Stats[Ac]
+	nextNodes    Nodes[S, Ac, Ag]
+	mu           sync.Mutex
 }
 
 func (n *Node[S, Ac, Ag]) VirtualSelectors() map[Ag]pucb.VirtualSelector[Ac] {
-	cloned := make(map[Ag]pucb.VirtualSelector[Ac], len(n.virtualSelectors))
-	for agent, vs := range n.virtualSelectors {
-		cloned[agent] = maps.Clone(vs)
+	cloned := make(map[Ag]pucb.VirtualSelector[Ac], len(n.statsByAgent))
+	for agent, stats := range n.statsByAgent {
+		cloned[agent] = stats.VirtualSelector()
 	}
 	return cloned
 }
@@ -64,72 +64,16 @@ func (nodes Nodes[S, Ac, Ag]) FindByState(state S, eq simultaneous.EqualFunc[S])
 	return nil, false
 }
 
-type selectBuffer[S any, Ac, Ag comparable] struct {
-	node          *Node[S, Ac, Ag]
-	actionByAgent simultaneous.JointAction[Ac, Ag]
-}
-
-type selectBuffers[S any, Ac, Ag comparable] []selectBuffer[S, Ac, Ag]
-
-// backward は、リーフノードの評価値を、経路上の全ノードに反映する。
-// 途中でエラーが起きても、pending の解放は全ての経路・エージェントに対して必ず行い、
-// 発生したエラーはまとめて返す。
-func (ss selectBuffers[S, Ac, Ag]) backward(evals LeafNodeEvalByAgent[Ag]) error {
-	var errs []error
-	for _, s := range ss {
-		node := s.node
-		actionByAgent := s.actionByAgent
-
-		node.mu.Lock()
-		for agent, action := range actionByAgent {
-			c := node.virtualSelectors[agent][action]
-			// 未観測のカウントを消す
-			if err := c.DecrementPending(); err != nil {
-				errs = append(errs, err)
-			}
-
-			eval, ok := evals[agent]
-			if !ok {
-				errs = append(errs, fmt.Errorf(
-					"LeafNodeEvalByAgentに存在しないキー(Agent)でアクセスしようとした為、backwardを実行出来ませんでした。Agent = %v, LeafNodeEvalByAgent.Keys() = %v",
-					agent, slices.Collect(maps.Keys(evals)),
-				))
-				continue
-			}
-
-			if err := c.AddW(eval); err != nil {
-				errs = append(errs, err)
-				continue
-			}
-			c.IncrementVisits()
-		}
-		node.mu.Unlock()
-	}
-	return errors.Join(errs...)
-}
-
-// rollbackPending は、backward を実行しない場合に、経路上の pending を解放する。
-func (ss selectBuffers[S, Ac, Ag]) rollbackPending() error {
-	var errs []error
-	for _, s := range ss {
-		s.node.mu.Lock()
-		for agent, action := range s.actionByAgent {
-			if err := s.node.virtualSelectors[agent][action].DecrementPending(); err != nil {
-				errs = append(errs, err)
-			}
-		}
-		s.node.mu.Unlock()
-	}
-	return errors.Join(errs...)
-}
-
 type Engine[S any, Ac, Ag comparable] struct {
 	Game                    simultaneous.Engine[S, Ac, Ag]
 	PUCBFunc                pucb.Func
+	PUCBStatsFunc           pucb.StatsFunc
 	PolicyFunc              PolicyFunc[S, Ac, Ag]
 	LeafNodeEvalByAgentFunc LeafNodeEvalByAgentFunc[S, Ag]
 	NextNodesCap            int
 	VirtualValue            float32
+	FPU                     pucb.FPU
+	VirtualLoss             pucb.VirtualLoss
 	// MaxDepth は1回のシミュレーションで辿るノード数の上限。
 	// 状態が循環し得るゲームでは、展開もゲーム終了も起きずに探索が無限ループする恐れがある為、
 	// そのようなゲームでは必ず設定する事。上限に達した場合、その状態をリーフノードとして評価する。
@@ -142,10 +86,18 @@ func (e Engine[S, Ac, Ag]) Validate() error {
 		return err
 	}
 
-	if e.PUCBFunc == nil {
+	if e.PUCBFunc == nil && e.PUCBStatsFunc == nil {
 		return fmt.Errorf("%w: PUCBFunc", ErrNilEngineFunc)
 	}
 
+	if err := e.FPU.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	if err := e.VirtualLoss.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
 	if e.PolicyFunc == nil {
 		return fmt.Errorf("%w: PolicyFunc", ErrNilEngineFunc)
 	}
@@ -171,23 +123,34 @@ func (e *Engine[S, Ac, Ag]) SetUniformPolicyFunc() {
 // 乱数器は探索の呼び出し側からワーカー毎に渡される為、ここでは受け取らない。
 func (e *Engine[S, Ac, Ag]) SetPlayout(accr simultaneous.ActorCritic[S, Ac, Ag]) {
 	e.LeafNodeEvalByAgentFunc = func(state S, rng *rand.Rand) (LeafNodeEvalByAgent[Ag], error) {
-		finals, err := e.Game.Playouts([]S{state}, accr, []*rand.Rand{rng})
-		if err != nil {
-			return nil, err
-		}
-		final := finals[0]
-
-		scores, err := e.Game.EvaluateResultScoreByAgent(final)
+		// 途中の報酬(Game.RewardFunc)がある場合、プレイアウト中の報酬の合計も評価値に含める
+		returns, err := e.Game.PlayoutReturns([]S{state}, accr, []*rand.Rand{rng})
 		if err != nil {
 			return nil, err
 		}
 
 		evals := LeafNodeEvalByAgent[Ag]{}
-		maps.Copy(evals, scores)
+		maps.Copy(evals, returns[0])
 		return evals, nil
 	}
 }
 
+// SetSymmetryAveragedLeafNodeEval は、現在のリーフノードの評価関数を、
+// symmetryFuncsからランダムにk個(重複あり)選んだ対称変換を適用した状態の評価値の平均を返す評価関数に置き換える。
+// 対称変換はゲームの結果を変えない為、評価関数のばらつきを抑える効果がある。
+func (e *Engine[S, Ac, Ag]) SetSymmetryAveragedLeafNodeEval(symmetryFuncs []game.SymmetryFunc[S, Ac], k int) error {
+	if e.LeafNodeEvalByAgentFunc == nil {
+		return fmt.Errorf("%w: LeafNodeEvalByAgentFunc", ErrNilEngineFunc)
+	}
+
+	evalFunc, err := tree.NewSymmetryAveragedEvalFunc(e.LeafNodeEvalByAgentFunc, symmetryFuncs, k)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	e.LeafNodeEvalByAgentFunc = evalFunc
+	return nil
+}
+
 func (e Engine[S, Ac, Ag]) NewNode(state S) (*Node[S, Ac, Ag], error) {
 	legalActionsByAgent := e.Game.Rule.LegalActionsByAgentFunc(state)
 	if len(legalActionsByAgent) == 0 {
@@ -199,7 +162,14 @@ func (e Engine[S, Ac, Ag]) NewNode(state S) (*Node[S, Ac, Ag], error) {
 		return nil, err
 	}
 
-	selectors := make(map[Ag]pucb.VirtualSelector[Ac], len(e.Game.Agents))
+	statsByAgent := make(map[Ag]*tree.Stats[Ac], len(e.Game.Agents))
+	cfg := tree.Config{
+		Func:         e.PUCBFunc,
+		StatsFunc:    e.PUCBStatsFunc,
+		VirtualValue: e.VirtualValue,
+		FPU:          e.FPU,
+		VirtualLoss:  e.VirtualLoss,
+	}
 
 	for _, agent := range e.Game.Agents {
 		legalActions := legalActionsByAgent[agent]
@@ -212,24 +182,19 @@ func (e Engine[S, Ac, Ag]) NewNode(state S) (*Node[S, Ac, Ag], error) {
 			return nil, err
 		}
 
-		s := pucb.VirtualSelector[Ac]{}
-		for _, action := range legalActions {
-			p := policy[action]
-			s[action] = &pucb.Calculator{Func: e.PUCBFunc, P: p, VirtualValue: e.VirtualValue}
-		}
-		selectors[agent] = s
+		statsByAgent[agent] = tree.NewStats(legalActions, policy, cfg)
 	}
 
 	return &Node[S, Ac, Ag]{
-		State:            state,
-		virtualSelectors: selectors,
-		nextNodes:        make(Nodes[S, Ac, Ag], 0, e.NextNodesCap),
+		State:        state,
+		statsByAgent: statsByAgent,
+		nextNodes:    make(Nodes[S, Ac, Ag], 0, e.NextNodesCap),
 	}, nil
 }
 
 func (e Engine[S, Ac, Ag]) SelectExpansionBackward(node *Node[S, Ac, Ag], capacity int, rng *rand.Rand) (evals LeafNodeEvalByAgent[Ag], depth int, err error) {
 	state := node.State
-	buffers := make(selectBuffers[S, Ac, Ag], 0, capacity)
+	path := tree.NewPath[Ac, Ag](capacity)
 	var isEnd bool
 
 	// バッファ積み上げ中にエラーが起きた場合、pending を元に戻す。
@@ -237,43 +202,47 @@ func (e Engine[S, Ac, Ag]) SelectExpansionBackward(node *Node[S, Ac, Ag], capaci
 	backwardStarted := false
 	defer func() {
 		if err != nil && !backwardStarted {
-			if rbErr := buffers.rollbackPending(); rbErr != nil {
+			if rbErr := path.Rollback(); rbErr != nil {
 				err = errors.Join(err, rbErr)
 			}
 		}
 	}()
 
 	for {
-		node.mu.Lock()
+		// 各エージェントの行動を、そのエージェントの統計で独立に選ぶ。
+		// 他のワーカーが一部のエージェントだけ選んだ(観測した)統計を見ない様に、選択と観測はノードのロックを保持して行う。
+		// 途中で選択に失敗した場合、それまでに選んだ行動の pending は rollback で解放する。
+		path.PushLocked(&node.mu)
 		actionByAgent := make(simultaneous.JointAction[Ac, Ag], len(e.Game.Agents))
+		node.mu.Lock()
 		for _, agent := range e.Game.Agents {
-			vs := node.virtualSelectors[agent]
-			action, selectErr := vs.Select(rng)
-			if selectErr != nil {
-				// この時点までに actionByAgent に積んだ pending は、
-				// buffers に載っていない為、ノードのロック中にここで解放する
-				for a, ac := range actionByAgent {
-					if decrementErr := node.virtualSelectors[a][ac].DecrementPending(); decrementErr != nil {
-						selectErr = errors.Join(selectErr, decrementErr)
-					}
-				}
-				node.mu.Unlock()
-				err = selectErr
-				return nil, 0, err
+			var action Ac
+			action, err = path.Select(node.statsByAgent[agent], agent, rng)
+			if err != nil {
+				break
 			}
-			// 選択した行動の未観測カウントをインクリメント
-			vs[action].IncrementPending()
 			actionByAgent[agent] = action
 		}
 		node.mu.Unlock()
+		if err != nil {
+			return nil, 0, err
+		}
 
-		buffers = append(buffers, selectBuffer[S, Ac, Ag]{node: node, actionByAgent: actionByAgent})
-
+		prev := state
 		state, err = e.Game.Rule.TransitionFunc(state, actionByAgent)
 		if err != nil {
 			return nil, 0, err
 		}
 
+		if e.Game.RewardFunc != nil {
+			var rewards game.RewardByAgent[Ag]
+			rewards, err = e.Game.RewardFunc(prev, actionByAgent, state)
+			if err != nil {
+				return nil, 0, err
+			}
+			path.SetRewards(rewards)
+		}
+
 		isEnd, err = e.Game.IsTerminal(state)
 		if err != nil {
 			return nil, 0, err
@@ -284,7 +253,7 @@ func (e Engine[S, Ac, Ag]) SelectExpansionBackward(node *Node[S, Ac, Ag], capaci
 		}
 
 		// 深さが上限に達した場合、この状態をリーフノードとして評価する
-		if e.MaxDepth > 0 && len(buffers) >= e.MaxDepth {
+		if e.MaxDepth > 0 && path.Len() >= e.MaxDepth {
 			break
 		}
 
@@ -338,10 +307,11 @@ func (e Engine[S, Ac, Ag]) SelectExpansionBackward(node *Node[S, Ac, Ag], capaci
 	}
 
 	backwardStarted = true
-	if err = buffers.backward(evals); err != nil {
+	evals, err = path.Backward(evals, 1)
+	if err != nil {
 		return nil, 0, err
 	}
-	return evals, len(buffers), nil
+	return evals, path.Len(), nil
 }
 
 func (e Engine[S, Ac, Ag]) Search(rootNode *Node[S, Ac, Ag], n int, workerRngs []*rand.Rand) (RootNodeEvalByAgent[Ag], error) {
@@ -353,74 +323,59 @@ func (e Engine[S, Ac, Ag]) Search(rootNode *Node[S, Ac, Ag], n int, workerRngs [
 		return nil, errors.New("rootNode が nil です")
 	}
 
-	if n <= 0 {
-		return nil, fmt.Errorf("シミュレーション数が不正: n = %d: n > 0 であるべき", n)
-	}
-
-	p := len(workerRngs)
-	rootEvalsPerWorker := make([]RootNodeEvalByAgent[Ag], p)
-	for i := range p {
-		rootEvalsPerWorker[i] = RootNodeEvalByAgent[Ag]{}
+	rootEvals, err := tree.Run(n, workerRngs, func(capacity int, rng *rand.Rand) (map[Ag]float32, int, error) {
+		return e.SelectExpansionBackward(rootNode, capacity, rng)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return RootNodeEvalByAgent[Ag](rootEvals), nil
+}
 
-	workerBuffCaps := make([]int, p)
-	err := parallel.For(n, p, func(workerID, idx int) error {
-		rng := workerRngs[workerID]
-		leafEvals, depth, err := e.SelectExpansionBackward(rootNode, workerBuffCaps[workerID], rng)
-		if err != nil {
-			return err
-		}
-
-		for k, v := range leafEvals {
-			rootEvalsPerWorker[workerID][k] += v
-		}
+// searcher は、Engine を search.Searcher として扱う為の型。
+type searcher[S any, Ac, Ag comparable] struct {
+	engine Engine[S, Ac, Ag]
+}
 
-		workerBuffCaps[workerID] = depth + 1
-		return nil
-	})
+func (s searcher[S, Ac, Ag]) NewRoot(state S) (*Node[S, Ac, Ag], error) {
+	return s.engine.NewNode(state)
+}
 
+// Search は、rootNode から budget 回のシミュレーションを行い、各エージェントの訪問比率を方策とした結果を返す。
+func (s searcher[S, Ac, Ag]) Search(rootNode *Node[S, Ac, Ag], budget int, rngs []*rand.Rand) (search.Result[Ac, Ag], error) {
+	evals, err := s.engine.Search(rootNode, budget, rngs)
 	if err != nil {
-		return nil, err
+		return search.Result[Ac, Ag]{}, err
 	}
 
-	rootEvals := RootNodeEvalByAgent[Ag]{}
-	for i := range rootEvalsPerWorker {
-		for k, v := range rootEvalsPerWorker[i] {
-			rootEvals[k] += v
-		}
+	virtualSelectors := rootNode.VirtualSelectors()
+	result := search.Result[Ac, Ag]{
+		PolicyByAgent: make(map[Ag]game.Policy[Ac], len(virtualSelectors)),
+		ValueByAgent:  evals,
+		StatsByAgent:  make(map[Ag]*game.SearchStats[Ac, Ag], len(virtualSelectors)),
 	}
 
-	rootEvals.DivScalar(float32(n))
-	return rootEvals, nil
+	for agent, selector := range virtualSelectors {
+		result.PolicyByAgent[agent] = selector.VisitRatioByKey()
+		result.StatsByAgent[agent] = pucb.NewSearchStats(selector, budget, evals)
+	}
+	return result, nil
+}
+
+// Searcher は、Engine を search.Searcher として返す。予算はシミュレーション数。
+func (e Engine[S, Ac, Ag]) Searcher() search.Searcher[S, Ac, Ag, *Node[S, Ac, Ag]] {
+	return searcher[S, Ac, Ag]{engine: e}
 }
 
 func (e Engine[S, Ac, Ag]) NewPolicyNoValueFunc(simulations int, rngs []*rand.Rand) simultaneous.PolicyValueFunc[S, Ac, Ag] {
+	pvFunc := e.NewPolicyValueFunc(simulations, rngs)
 	return func(state S, legalActionsByAgent simultaneous.LegalActionsByAgent[Ac, Ag]) (simultaneous.PolicyByAgent[Ac, Ag], simultaneous.ValueByAgent[Ag], error) {
-		rootNode, err := e.NewNode(state)
+		policyByAgent, valueByAgent, err := pvFunc(state, legalActionsByAgent)
 		if err != nil {
 			return nil, nil, err
 		}
 
-		_, err = e.Search(rootNode, simulations, rngs)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		policyByAgent := make(simultaneous.PolicyByAgent[Ac, Ag], len(e.Game.Agents))
-		valueByAgent := make(simultaneous.ValueByAgent[Ag], len(e.Game.Agents))
-		virtualSelectors := rootNode.VirtualSelectors()
-
-		for _, agent := range e.Game.Agents {
-			visitRatios := virtualSelectors[agent].VisitRatioByKey()
-			policy := game.Policy[Ac]{}
-			for _, action := range legalActionsByAgent[agent] {
-				if p, ok := visitRatios[action]; !ok {
-					return nil, nil, fmt.Errorf("actionの訪問比率が存在しません: action = %v", action)
-				} else {
-					policy[action] = p
-				}
-			}
-			policyByAgent[agent] = policy
+		for agent := range valueByAgent {
 			valueByAgent[agent] = 0.0
 		}
 		return policyByAgent, valueByAgent, nil
@@ -428,39 +383,10 @@ func (e Engine[S, Ac, Ag]) NewPolicyNoValueFunc(simulations int, rngs []*rand.Ra
 }
 
 func (e Engine[S, Ac, Ag]) NewPolicyValueFunc(simulations int, rngs []*rand.Rand) simultaneous.PolicyValueFunc[S, Ac, Ag] {
-	return func(state S, legalActionsByAgent simultaneous.LegalActionsByAgent[Ac, Ag]) (simultaneous.PolicyByAgent[Ac, Ag], simultaneous.ValueByAgent[Ag], error) {
-		rootNode, err := e.NewNode(state)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		evals, err := e.Search(rootNode, simulations, rngs)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		policyByAgent := make(simultaneous.PolicyByAgent[Ac, Ag], len(e.Game.Agents))
-		valueByAgent := make(simultaneous.ValueByAgent[Ag], len(e.Game.Agents))
-		virtualSelectors := rootNode.VirtualSelectors()
-
-		for _, agent := range e.Game.Agents {
-			visitRatios := virtualSelectors[agent].VisitRatioByKey()
-			policy := game.Policy[Ac]{}
-			for _, action := range legalActionsByAgent[agent] {
-				if p, ok := visitRatios[action]; !ok {
-					return nil, nil, fmt.Errorf("actionの訪問比率が存在しません: action = %v", action)
-				} else {
-					policy[action] = p
-				}
-			}
-			policyByAgent[agent] = policy
+	return e.NewPolicyValueStatsFunc(simulations, rngs).PolicyValueFunc()
+}
 
-			eval, ok := evals[agent]
-			if !ok {
-				return nil, nil, fmt.Errorf("エージェントの評価値が存在しません: agent = %v", agent)
-			}
-			valueByAgent[agent] = eval
-		}
-		return policyByAgent, valueByAgent, nil
-	}
+// NewPolicyValueStatsFunc は、NewPolicyValueFunc と同じ方策と価値に加えて、ルートノードでの各エージェントの探索の統計を返す関数を返す。
+func (e Engine[S, Ac, Ag]) NewPolicyValueStatsFunc(simulations int, rngs []*rand.Rand) simultaneous.PolicyValueStatsFunc[S, Ac, Ag] {
+	return search.NewSimultaneousPolicyValueStatsFunc(e.Searcher(), simulations, rngs)
 }
@@ -1,12 +1,16 @@
 package dpuct_test
 
 import (
+	"errors"
 	"math"
+	"math/rand/v2"
 	"strings"
 	"testing"
 
 	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
 	"github.com/sw965/crow/game/simultaneous"
+	"github.com/sw965/crow/internal/ttt"
 	"github.com/sw965/crow/mcts/dpuct"
 	"github.com/sw965/crow/pucb"
 	"github.com/sw965/omw/mathx/randx"
@@ -278,3 +282,287 @@ func TestDPUCTSelectionErrorReleasesPending(t *testing.T) {
 		}
 	}
 }
+
+func TestDPUCTNewPolicyValueStatsFunc(t *testing.T) {
+	agent1 := 1
+	agent2 := 2
+	gameEngine := newRPSEngine(agent1, agent2)
+
+	mcts := dpuct.Engine[RockPaperScissors, Hand, int]{
+		Game:         gameEngine,
+		PUCBFunc:     pucb.NewAlphaGoFunc(float32(math.Sqrt(1000.0))),
+		NextNodesCap: 3,
+		VirtualValue: 0.5,
+	}
+	mcts.SetUniformPolicyFunc()
+	mcts.SetPlayout(simultaneous.NewRandomActorCritic[RockPaperScissors, Hand, int]())
+
+	rngs, err := randx.NewPCGs(2)
+	if err != nil {
+		panic(err)
+	}
+
+	simulations := 300
+	pvStatsFunc := mcts.NewPolicyValueStatsFunc(simulations, rngs)
+
+	rootState := RockPaperScissors{}
+	legalActionsByAgent := gameEngine.Rule.LegalActionsByAgentFunc(rootState)
+	policyByAgent, valueByAgent, statsByAgent, err := pvStatsFunc(rootState, legalActionsByAgent)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	for _, agent := range []int{agent1, agent2} {
+		stats, ok := statsByAgent[agent]
+		if !ok {
+			t.Fatalf("Agent %d の探索の統計が存在しない", agent)
+		}
+
+		var sumVisits int
+		for _, n := range stats.VisitsByAction {
+			sumVisits += n
+		}
+		if sumVisits != simulations {
+			t.Errorf("Agent %d の訪問回数の合計の不一致: got = %d, want = %d", agent, sumVisits, simulations)
+		}
+
+		visitPolicy, err := stats.VisitPolicy()
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		for hand, p := range policyByAgent[agent] {
+			if math.Abs(float64(visitPolicy[hand]-p)) > 1e-5 {
+				t.Errorf("Agent %d, hand %v: 訪問回数の分布と方策の不一致: got = %f, want = %f", agent, hand, visitPolicy[hand], p)
+			}
+		}
+
+		if stats.RootValueByAgent[agent] != valueByAgent[agent] {
+			t.Errorf("Agent %d のルートノードの価値の不一致: got = %f, want = %f", agent, stats.RootValueByAgent[agent], valueByAgent[agent])
+		}
+	}
+}
+
+// simultaneous.FromSequential で変換した三目並べでも、勝つ手が最も多く訪問される事を確かめる。
+func TestDPUCTFromSequential(t *testing.T) {
+	noop := ttt.Action{Row: -1, Col: -1}
+	seqEngine := ttt.NewEngine()
+	mcts := dpuct.Engine[ttt.State, ttt.Action, ttt.Mark]{
+		Game:         simultaneous.FromSequential(seqEngine, noop),
+		PUCBFunc:     pucb.NewAlphaGoFunc(1.25),
+		NextNodesCap: 9,
+		VirtualValue: 0.5,
+	}
+	mcts.SetUniformPolicyFunc()
+	mcts.SetPlayout(simultaneous.FromSequentialActorCritic(seqEngine, sequential.NewRandomActorCritic[ttt.State, ttt.Action, ttt.Mark](), noop))
+
+	// Crossは(0,2)に置けば勝ち
+	state := ttt.State{
+		Board: ttt.Board{
+			{ttt.Cross, ttt.Cross, ttt.EmptyMark},
+			{ttt.Nought, ttt.Nought, ttt.EmptyMark},
+			{ttt.EmptyMark, ttt.EmptyMark, ttt.EmptyMark},
+		},
+		Turn: ttt.Cross,
+	}
+
+	rootNode, err := mcts.NewNode(state)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	rngs, err := randx.NewPCGs(4)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if _, err := mcts.Search(rootNode, 5000, rngs); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	selectors := rootNode.VirtualSelectors()
+	if n := len(selectors[ttt.Nought]); n != 1 {
+		t.Errorf("手番でないエージェントの行動数の不一致: got = %d, want = 1", n)
+	}
+
+	var bestAction ttt.Action
+	bestVisits := -1
+	for action, calc := range selectors[ttt.Cross] {
+		if calc.Visits() > bestVisits {
+			bestVisits = calc.Visits()
+			bestAction = action
+		}
+	}
+
+	if want := (ttt.Action{Row: 0, Col: 2}); bestAction != want {
+		t.Errorf("最多訪問の行動の不一致: got = %v, want = %v", bestAction, want)
+	}
+}
+
+// rotateHand は、グー→パー→チョキ→グーの順に手を n 回ずらす。勝敗の関係を変えない、じゃんけんの対称変換。
+func rotateHand(h Hand, n int) Hand {
+	for i, hand := range HANDS {
+		if hand == h {
+			return HANDS[(i+n)%len(HANDS)]
+		}
+	}
+	return h
+}
+
+func rpsSymmetryFuncs() []game.SymmetryFunc[RockPaperScissors, Hand] {
+	fs := make([]game.SymmetryFunc[RockPaperScissors, Hand], len(HANDS))
+	for n := range HANDS {
+		fs[n] = func(rps RockPaperScissors) (RockPaperScissors, game.ActionMapFunc[Hand], error) {
+			rotated := RockPaperScissors{Finished: rps.Finished, Hand1: rotateHand(rps.Hand1, n), Hand2: rotateHand(rps.Hand2, n)}
+			return rotated, func(h Hand) Hand { return rotateHand(h, n) }, nil
+		}
+	}
+	return fs
+}
+
+func TestDPUCTSetSymmetryAveragedLeafNodeEval(t *testing.T) {
+	const k = 3
+	newMCTS := func() dpuct.Engine[RockPaperScissors, Hand, int] {
+		mcts := dpuct.Engine[RockPaperScissors, Hand, int]{
+			Game:         newRPSEngine(1, 2),
+			PUCBFunc:     pucb.NewAlphaGoFunc(1.0),
+			NextNodesCap: 3,
+			VirtualValue: 0.5,
+		}
+		mcts.SetUniformPolicyFunc()
+		// プレイヤー1の手がグーなら1、それ以外なら0と評価する(対称変換で評価値が変わる)評価関数
+		mcts.LeafNodeEvalByAgentFunc = func(rps RockPaperScissors, rng *rand.Rand) (dpuct.LeafNodeEvalByAgent[int], error) {
+			var v float32
+			if rps.Hand1 == ROCK {
+				v = 1.0
+			}
+			return dpuct.LeafNodeEvalByAgent[int]{1: v, 2: 1.0 - v}, nil
+		}
+		return mcts
+	}
+
+	mcts := newMCTS()
+	if err := mcts.SetSymmetryAveragedLeafNodeEval(rpsSymmetryFuncs(), k); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	// 3つの対称変換のうち、プレイヤー1の手がグーになるのは1つ
+	state := RockPaperScissors{Hand1: ROCK, Hand2: PAPER}
+	rng := randx.NewPCG()
+	n := 2000
+	var sum float64
+	for range n {
+		evals, err := mcts.LeafNodeEvalByAgentFunc(state, rng)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		// 評価値はk個の平均なので、1/k刻みになるはず
+		scaled := float64(evals[1]) * k
+		if math.Abs(scaled-math.Round(scaled)) > 0.0001 {
+			t.Fatalf("評価値がk個の平均になっていない: got = %f", evals[1])
+		}
+
+		if math.Abs(float64(evals[1]+evals[2])-1.0) > 0.0001 {
+			t.Fatalf("評価値の合計の不一致: got = %f, want = 1.0", evals[1]+evals[2])
+		}
+		sum += float64(evals[1])
+	}
+
+	// 平均すると、プレイヤー1の手がグーになる確率(1/3)に近付くはず
+	const eps = 0.03
+	avg := sum / float64(n)
+	if math.Abs(avg-1.0/3.0) > eps {
+		t.Errorf("評価値の平均の不一致: got = %.4f, want = 0.3333(±%.3f)", avg, eps)
+	}
+
+	t.Run("異常_kが0", func(t *testing.T) {
+		mcts := newMCTS()
+		if err := mcts.SetSymmetryAveragedLeafNodeEval(rpsSymmetryFuncs(), 0); !errors.Is(err, dpuct.ErrInvalidConfig) {
+			t.Errorf("エラーの不一致: got = %v, want = %v", err, dpuct.ErrInvalidConfig)
+		}
+	})
+
+	t.Run("異常_symmetryFuncsが空", func(t *testing.T) {
+		mcts := newMCTS()
+		if err := mcts.SetSymmetryAveragedLeafNodeEval(nil, k); !errors.Is(err, dpuct.ErrInvalidConfig) {
+			t.Errorf("エラーの不一致: got = %v, want = %v", err, dpuct.ErrInvalidConfig)
+		}
+	})
+
+	t.Run("異常_評価関数がnil", func(t *testing.T) {
+		mcts := newMCTS()
+		mcts.LeafNodeEvalByAgentFunc = nil
+		if err := mcts.SetSymmetryAveragedLeafNodeEval(rpsSymmetryFuncs(), k); !errors.Is(err, dpuct.ErrNilEngineFunc) {
+			t.Errorf("エラーの不一致: got = %v, want = %v", err, dpuct.ErrNilEngineFunc)
+		}
+	})
+}
+
+// FPU と VirtualLoss の各モードでも、じゃんけんの各手を偏りなく探索し、pending を全て解放する事を確かめる。
+func TestDPUCTFPUAndVirtualLoss(t *testing.T) {
+	tests := []struct {
+		name        string
+		fpu         pucb.FPU
+		virtualLoss pucb.VirtualLoss
+	}{
+		{name: "正常_ParentQとVirtualVisit", fpu: pucb.FPU{Mode: pucb.FPUParentQ, Value: 0.1}, virtualLoss: pucb.VirtualLoss{Mode: pucb.VirtualVisit}},
+		{name: "正常_LossとScaled", fpu: pucb.FPU{Mode: pucb.FPULoss}, virtualLoss: pucb.VirtualLoss{Mode: pucb.VirtualLossScaled, Scale: 3}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mcts := dpuct.Engine[RockPaperScissors, Hand, int]{
+				Game:         newRPSEngine(1, 2),
+				PUCBFunc:     pucb.NewAlphaGoFunc(float32(math.Sqrt(1000.0))),
+				NextNodesCap: 3,
+				VirtualValue: 0.0,
+				FPU:          tc.fpu,
+				VirtualLoss:  tc.virtualLoss,
+			}
+			mcts.SetUniformPolicyFunc()
+			mcts.SetPlayout(simultaneous.NewRandomActorCritic[RockPaperScissors, Hand, int]())
+
+			rngs, err := randx.NewPCGs(4)
+			if err != nil {
+				panic(err)
+			}
+
+			rootNode, err := mcts.NewNode(RockPaperScissors{})
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			const simulations = 10000
+			if _, err := mcts.Search(rootNode, simulations, rngs); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			const ratioEps = 0.1
+			for agent, selector := range rootNode.VirtualSelectors() {
+				for hand, calc := range selector {
+					ratio := float64(calc.Visits()) / float64(selector.SumVisits())
+					if math.Abs(ratio-1.0/3.0) > ratioEps {
+						t.Errorf("Agent %d, %s の訪問比率の不一致: got = %.4f, want = 0.333(±%.2f)", agent, hand, ratio, ratioEps)
+					}
+					if calc.Pending() != 0 {
+						t.Errorf("Agent %d, %s のpendingが解放されていない: got = %d, want = 0", agent, hand, calc.Pending())
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("異常_VirtualLossのScaleが0", func(t *testing.T) {
+		mcts := dpuct.Engine[RockPaperScissors, Hand, int]{
+			Game:         newRPSEngine(1, 2),
+			PUCBFunc:     pucb.NewAlphaGoFunc(1.0),
+			NextNodesCap: 3,
+			VirtualLoss:  pucb.VirtualLoss{Mode: pucb.VirtualLossScaled},
+		}
+		mcts.SetUniformPolicyFunc()
+		mcts.SetPlayout(simultaneous.NewRandomActorCritic[RockPaperScissors, Hand, int]())
+		if err := mcts.Validate(); !errors.Is(err, dpuct.ErrInvalidConfig) {
+			t.Errorf("エラーの不一致: got = %v, want = %v", err, dpuct.ErrInvalidConfig)
+		}
+	})
+}
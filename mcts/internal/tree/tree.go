@@ -0,0 +1,360 @@
+// Package tree は、puct・dpuct・muzero が共有する、探索木のノードの統計・backward・並列のシミュレーションを提供する。
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"sync"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/pucb"
+	"github.com/sw965/omw/parallel"
+)
+
+// Config は、Stats の各行動の統計(pucb.Calculator)の設定。
+type Config struct {
+	Func         pucb.Func
+	StatsFunc    pucb.StatsFunc
+	VirtualValue float32
+	FPU          pucb.FPU
+	VirtualLoss  pucb.VirtualLoss
+	// MinMax は、木全体で共有する観測値の最小値・最大値。nil でない場合、観測毎に更新し、Q の正規化に使う。
+	MinMax *pucb.MinMaxStats
+	// LockFree が true の場合、統計を pucb.AtomicVirtualSelector で持ち、選択と観測をロック無しで行う。
+	LockFree bool
+}
+
+// Stats は、1つのノードで1体のエージェントが選ぶ行動の統計。複数のワーカーから並行に呼び出しても安全。
+type Stats[Ac comparable] struct {
+	// virtualSelector と atomicSelector は、どちらか一方だけを持つ。Config.LockFree の場合は atomicSelector を持つ。
+	virtualSelector pucb.VirtualSelector[Ac]
+	atomicSelector  pucb.AtomicVirtualSelector[Ac]
+	minMax          *pucb.MinMaxStats
+	mu              sync.Mutex
+}
+
+// NewStats は、actions の各行動の事前確率を policy とした統計を返す。policy に無い行動の事前確率は0とする。
+func NewStats[Ac comparable](actions []Ac, policy game.Policy[Ac], cfg Config) *Stats[Ac] {
+	s := &Stats[Ac]{minMax: cfg.MinMax}
+	if cfg.LockFree {
+		s.atomicSelector = make(pucb.AtomicVirtualSelector[Ac], len(actions))
+		for _, action := range actions {
+			s.atomicSelector[action] = &pucb.AtomicCalculator{Func: cfg.Func, StatsFunc: cfg.StatsFunc, P: policy[action], VirtualValue: cfg.VirtualValue, FPU: cfg.FPU, VirtualLoss: cfg.VirtualLoss, MinMax: cfg.MinMax}
+		}
+		return s
+	}
+
+	s.virtualSelector = make(pucb.VirtualSelector[Ac], len(actions))
+	for _, action := range actions {
+		s.virtualSelector[action] = &pucb.Calculator{Func: cfg.Func, StatsFunc: cfg.StatsFunc, P: policy[action], VirtualValue: cfg.VirtualValue, FPU: cfg.FPU, VirtualLoss: cfg.VirtualLoss, MinMax: cfg.MinMax}
+	}
+	return s
+}
+
+// VirtualSelector は、各行動の統計の複製を返す。LockFree の統計では、呼び出した時点のスナップショットを返す。
+func (s *Stats[Ac]) VirtualSelector() pucb.VirtualSelector[Ac] {
+	if s.atomicSelector != nil {
+		return s.atomicSelector.Snapshot()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.virtualSelector)
+}
+
+// Select は、行動を選び、その行動の pending をインクリメントする。
+// LockFree の統計ではロックを取らず、選択と pending のインクリメントの間に他のワーカーが同じ行動を選ぶ事を許す。
+func (s *Stats[Ac]) Select(rng *rand.Rand) (Ac, error) {
+	if s.atomicSelector != nil {
+		action, err := s.atomicSelector.Select(rng)
+		if err != nil {
+			return action, err
+		}
+		s.atomicSelector[action].IncrementPending()
+		return action, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	action, err := s.virtualSelector.Select(rng)
+	if err != nil {
+		return action, err
+	}
+	// 選択した行動の未観測の数をインクリメントする
+	s.virtualSelector[action].IncrementPending()
+	return action, nil
+}
+
+// Observe は、action の pending を1つ解放し、v を観測する。v が不正な場合も、pending は必ず解放する。
+// 観測出来た場合、木の最小値・最大値も更新する。
+func (s *Stats[Ac]) Observe(action Ac, v float32) error {
+	if err := s.observe(action, v); err != nil {
+		return err
+	}
+
+	if s.minMax != nil {
+		return s.minMax.Update(v)
+	}
+	return nil
+}
+
+func (s *Stats[Ac]) observe(action Ac, v float32) error {
+	if s.atomicSelector != nil {
+		c := s.atomicSelector[action]
+		if err := c.Observe(v); err != nil {
+			return errors.Join(err, c.DecrementPending())
+		}
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.virtualSelector[action]
+	// 未観測のカウントを消す
+	pendingErr := c.DecrementPending()
+	if err := c.Observe(v); err != nil {
+		return errors.Join(pendingErr, err)
+	}
+	return pendingErr
+}
+
+// ReleasePending は、観測せずに action の pending を1つ解放する。
+func (s *Stats[Ac]) ReleasePending(action Ac) error {
+	if s.atomicSelector != nil {
+		return s.atomicSelector[action].DecrementPending()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.virtualSelector[action].DecrementPending()
+}
+
+type edge[Ac, Ag comparable] struct {
+	stats  *Stats[Ac]
+	agent  Ag
+	action Ac
+}
+
+type step[Ag comparable] struct {
+	// end は、このステップの最後の edge の次のインデックス。
+	end int
+	// rewards は、このステップの遷移で得た途中の報酬。無い場合は nil。
+	rewards game.RewardByAgent[Ag]
+	// mu は、PushLocked で渡したロック。nil でない場合、このステップの観測と pending の解放をまとめて行う間、保持する。
+	mu sync.Locker
+}
+
+// Path は、1回のシミュレーションで辿った経路。
+// 1つのステップ(状態遷移)は、そのノードで行動を選んだ全てのエージェントの行動を持つ。
+type Path[Ac, Ag comparable] struct {
+	edges []edge[Ac, Ag]
+	steps []step[Ag]
+}
+
+// NewPath は、capacity ステップ分の容量を持つ空の経路を返す。
+func NewPath[Ac, Ag comparable](capacity int) *Path[Ac, Ag] {
+	return &Path[Ac, Ag]{
+		edges: make([]edge[Ac, Ag], 0, capacity),
+		steps: make([]step[Ag], 0, capacity),
+	}
+}
+
+// Len は、経路のステップ数を返す。
+func (p *Path[Ac, Ag]) Len() int {
+	return len(p.steps)
+}
+
+// Push は、新しいステップを始める。
+func (p *Path[Ac, Ag]) Push() {
+	p.PushLocked(nil)
+}
+
+// PushLocked は、mu を保持して観測する新しいステップを始める。
+// 同時手番のノードで全てのエージェントの行動を mu を保持して選ぶ場合に使い、
+// 他のワーカーが、一部のエージェントだけ観測を反映した統計で行動を選ばない様にする。
+func (p *Path[Ac, Ag]) PushLocked(mu sync.Locker) {
+	p.steps = append(p.steps, step[Ag]{end: len(p.edges), mu: mu})
+}
+
+// stepEdges は、i 番目のステップの edge を返す。
+func (p *Path[Ac, Ag]) stepEdges(i int) []edge[Ac, Ag] {
+	start := 0
+	if i > 0 {
+		start = p.steps[i-1].end
+	}
+	return p.edges[start:p.steps[i].end]
+}
+
+// Select は、agent の行動を stats で選び、現在のステップに加える。
+// 選んだ行動の pending は、Backward か Rollback で解放する。
+func (p *Path[Ac, Ag]) Select(stats *Stats[Ac], agent Ag, rng *rand.Rand) (Ac, error) {
+	action, err := stats.Select(rng)
+	if err != nil {
+		return action, err
+	}
+	p.edges = append(p.edges, edge[Ac, Ag]{stats: stats, agent: agent, action: action})
+	p.steps[len(p.steps)-1].end = len(p.edges)
+	return action, nil
+}
+
+// SetRewards は、現在のステップの遷移で得た途中の報酬を設定する。
+func (p *Path[Ac, Ag]) SetRewards(rewards game.RewardByAgent[Ag]) {
+	p.steps[len(p.steps)-1].rewards = rewards
+}
+
+// Backward は、リーフノードの評価値を、経路上の全ての行動に反映し、ルートノードに反映した値を返す。
+// 各行動には、そのステップ以降に得た報酬を discount で割り引いた合計に、リーフノードの評価値を割り引いて加えた値を、
+// 行動したエージェントの分だけ反映する。割り引かない場合、discount は1とする。
+// 途中でエラーが起きても、pending の解放は全ての行動に対して必ず行い、発生したエラーはまとめて返す。
+func (p *Path[Ac, Ag]) Backward(evals map[Ag]float32, discount float32) (map[Ag]float32, error) {
+	var errs []error
+	returns := maps.Clone(evals)
+	if returns == nil {
+		returns = map[Ag]float32{}
+	}
+
+	for i := len(p.steps) - 1; i >= 0; i-- {
+		s := p.steps[i]
+		if discount != 1 {
+			for agent := range returns {
+				returns[agent] *= discount
+			}
+		}
+		for agent, r := range s.rewards {
+			returns[agent] += r
+		}
+
+		if s.mu != nil {
+			s.mu.Lock()
+		}
+		for _, e := range p.stepEdges(i) {
+			if _, ok := evals[e.agent]; !ok {
+				errs = append(errs, fmt.Errorf(
+					"LeafNodeEvalByAgentに存在しないキー(Agent)でアクセスしようとした為、backwardを実行出来ませんでした。Agent = %v, LeafNodeEvalByAgent.Keys() = %v",
+					e.agent, slices.Collect(maps.Keys(evals)),
+				))
+				if err := e.stats.ReleasePending(e.action); err != nil {
+					errs = append(errs, err)
+				}
+				continue
+			}
+
+			if err := e.stats.Observe(e.action, returns[e.agent]); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if s.mu != nil {
+			s.mu.Unlock()
+		}
+	}
+	return returns, errors.Join(errs...)
+}
+
+// Rollback は、Backward を実行しない場合に、経路上の全ての行動の pending を解放する。
+func (p *Path[Ac, Ag]) Rollback() error {
+	var errs []error
+	for i, s := range p.steps {
+		if s.mu != nil {
+			s.mu.Lock()
+		}
+		for _, e := range p.stepEdges(i) {
+			if err := e.stats.ReleasePending(e.action); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if s.mu != nil {
+			s.mu.Unlock()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SimulateFunc は、1回のシミュレーションを行い、ルートノードに反映した評価値と、辿ったステップ数を返す。
+// capacity は、経路の容量の目安で、同じワーカーの前回のステップ数 + 1。
+type SimulateFunc[Ag comparable] func(capacity int, rng *rand.Rand) (map[Ag]float32, int, error)
+
+// Run は、workerRngs の数のワーカーで、simulate を合計 n 回並行に呼び出し、ルートノードの評価値の平均を返す。
+func Run[Ag comparable](n int, workerRngs []*rand.Rand, simulate SimulateFunc[Ag]) (map[Ag]float32, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("シミュレーション数が不正: n = %d: n > 0 であるべき", n)
+	}
+
+	p := len(workerRngs)
+	rootEvalsPerWorker := make([]map[Ag]float32, p)
+	for i := range p {
+		rootEvalsPerWorker[i] = map[Ag]float32{}
+	}
+
+	workerBuffCaps := make([]int, p)
+	err := parallel.For(n, p, func(workerID, idx int) error {
+		rng := workerRngs[workerID]
+		evals, depth, err := simulate(workerBuffCaps[workerID], rng)
+		if err != nil {
+			return err
+		}
+
+		for k, v := range evals {
+			rootEvalsPerWorker[workerID][k] += v
+		}
+
+		workerBuffCaps[workerID] = depth + 1
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	rootEvals := map[Ag]float32{}
+	for i := range rootEvalsPerWorker {
+		for k, v := range rootEvalsPerWorker[i] {
+			rootEvals[k] += v
+		}
+	}
+
+	for k := range rootEvals {
+		rootEvals[k] /= float32(n)
+	}
+	return rootEvals, nil
+}
+
+// NewSymmetryAveragedEvalFunc は、symmetryFuncs からランダムに k 個(重複あり)選んだ対称変換を適用した状態の、
+// evalFunc の評価値の平均を返す評価関数を返す。
+// 対称変換はゲームの結果を変えない為、評価関数のばらつきを抑える効果がある。
+func NewSymmetryAveragedEvalFunc[S any, Ac, Ag comparable, E ~map[Ag]float32](evalFunc func(S, *rand.Rand) (E, error), symmetryFuncs []game.SymmetryFunc[S, Ac], k int) (func(S, *rand.Rand) (E, error), error) {
+	if len(symmetryFuncs) == 0 {
+		return nil, errors.New("symmetryFuncsが空です")
+	}
+
+	if k <= 0 {
+		return nil, fmt.Errorf("k=%d(0より大きい必要があります)", k)
+	}
+
+	return func(state S, rng *rand.Rand) (E, error) {
+		avgs := E{}
+		for range k {
+			f := symmetryFuncs[rng.IntN(len(symmetryFuncs))]
+			symState, _, err := f(state)
+			if err != nil {
+				return nil, err
+			}
+
+			evals, err := evalFunc(symState, rng)
+			if err != nil {
+				return nil, err
+			}
+
+			for agent, v := range evals {
+				avgs[agent] += v
+			}
+		}
+
+		for agent := range avgs {
+			avgs[agent] /= float32(k)
+		}
+		return avgs, nil
+	}, nil
+}
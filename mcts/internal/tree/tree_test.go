@@ -0,0 +1,233 @@
+package tree_test
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/mcts/internal/tree"
+	"github.com/sw965/crow/pucb"
+	"github.com/sw965/omw/mathx/randx"
+)
+
+func newStats(lockFree bool) *tree.Stats[string] {
+	policy := game.Policy[string]{"a": 0.5, "b": 0.5}
+	return tree.NewStats([]string{"a", "b"}, policy, tree.Config{
+		Func:         pucb.NewAlphaGoFunc(1.0),
+		VirtualValue: 0.5,
+		LockFree:     lockFree,
+	})
+}
+
+func sumPending(t *testing.T, stats *tree.Stats[string]) int {
+	t.Helper()
+	sum := 0
+	for _, c := range stats.VirtualSelector() {
+		sum += c.Pending()
+	}
+	return sum
+}
+
+// countingLocker は、Lock と Unlock を呼んだ回数を数える。
+type countingLocker struct {
+	locks, unlocks int
+}
+
+func (l *countingLocker) Lock()   { l.locks++ }
+func (l *countingLocker) Unlock() { l.unlocks++ }
+
+func TestPathBackward(t *testing.T) {
+	for _, lockFree := range []bool{false, true} {
+		name := "正常_ロック有り"
+		if lockFree {
+			name = "正常_LockFree"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			rng := randx.NewPCG()
+			root := newStats(lockFree)
+			p0 := newStats(lockFree)
+			p1 := newStats(lockFree)
+
+			path := tree.NewPath[string, int](0)
+			path.Push()
+			rootAction, err := path.Select(root, 0, rng)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			path.SetRewards(game.RewardByAgent[int]{0: 1.0})
+
+			// 同時手番のステップ
+			path.Push()
+			a0, err := path.Select(p0, 0, rng)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			a1, err := path.Select(p1, 1, rng)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			if path.Len() != 2 {
+				t.Errorf("ステップ数の不一致: got = %d, want = 2", path.Len())
+			}
+
+			returns, err := path.Backward(map[int]float32{0: 0.5, 1: 0.25}, 0.5)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			// ルートノード: 1.0 + 0.5 * (0.5 * 0.5)
+			if math.Abs(float64(returns[0])-1.125) > 0.0001 {
+				t.Errorf("ルートノードの評価値の不一致: got = %f, want = 1.125", returns[0])
+			}
+
+			checks := []struct {
+				stats  *tree.Stats[string]
+				action string
+				want   float32
+			}{
+				{stats: root, action: rootAction, want: 1.125},
+				{stats: p0, action: a0, want: 0.25},
+				{stats: p1, action: a1, want: 0.125},
+			}
+			for _, c := range checks {
+				calc := c.stats.VirtualSelector()[c.action]
+				if calc.Visits() != 1 {
+					t.Errorf("訪問回数の不一致: got = %d, want = 1", calc.Visits())
+				}
+				if math.Abs(float64(calc.Q()-c.want)) > 0.0001 {
+					t.Errorf("Qの不一致: got = %f, want = %f", calc.Q(), c.want)
+				}
+				if n := sumPending(t, c.stats); n != 0 {
+					t.Errorf("pendingが解放されていない: got = %d", n)
+				}
+			}
+		})
+	}
+
+	t.Run("正常_ロック付きのステップはまとめて観測する", func(t *testing.T) {
+		rng := randx.NewPCG()
+		p0 := newStats(false)
+		p1 := newStats(false)
+		mu := &countingLocker{}
+
+		path := tree.NewPath[string, int](1)
+		path.PushLocked(mu)
+		for agent, stats := range []*tree.Stats[string]{p0, p1} {
+			if _, err := path.Select(stats, agent, rng); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+		}
+
+		if _, err := path.Backward(map[int]float32{0: 1.0, 1: 0.0}, 1); err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if mu.locks != 1 || mu.unlocks != 1 {
+			t.Errorf("ロックの回数の不一致: got = (%d, %d), want = (1, 1)", mu.locks, mu.unlocks)
+		}
+		for _, stats := range []*tree.Stats[string]{p0, p1} {
+			if stats.VirtualSelector().SumVisits() != 1 {
+				t.Error("観測が反映されていない")
+			}
+		}
+	})
+
+	t.Run("異常_評価値に無いエージェント", func(t *testing.T) {
+		stats := newStats(false)
+		path := tree.NewPath[string, int](1)
+		path.Push()
+		if _, err := path.Select(stats, 1, randx.NewPCG()); err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		if _, err := path.Backward(map[int]float32{0: 1.0}, 1); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+		if n := sumPending(t, stats); n != 0 {
+			t.Errorf("pendingが解放されていない: got = %d", n)
+		}
+	})
+}
+
+func TestPathRollback(t *testing.T) {
+	rng := randx.NewPCG()
+	stats := newStats(false)
+	mu := &countingLocker{}
+	path := tree.NewPath[string, int](2)
+	// 2つ目のステップだけ、ロックを保持して解放する
+	path.Push()
+	if _, err := path.Select(stats, 0, rng); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	path.PushLocked(mu)
+	if _, err := path.Select(stats, 0, rng); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if n := sumPending(t, stats); n != 2 {
+		t.Fatalf("pendingの不一致: got = %d, want = 2", n)
+	}
+	if err := path.Rollback(); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if n := sumPending(t, stats); n != 0 {
+		t.Errorf("pendingが解放されていない: got = %d", n)
+	}
+	if stats.VirtualSelector().SumVisits() != 0 {
+		t.Error("Rollbackで訪問回数が増えた")
+	}
+	if mu.locks != 1 || mu.unlocks != 1 {
+		t.Errorf("ロックの回数の不一致: got = (%d, %d), want = (1, 1)", mu.locks, mu.unlocks)
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Run("正常_評価値の平均", func(t *testing.T) {
+		rngs, err := randx.NewPCGs(4)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		evals, err := tree.Run(100, rngs, func(capacity int, rng *rand.Rand) (map[int]float32, int, error) {
+			return map[int]float32{0: 1.0, 1: 0.5}, 3, nil
+		})
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if math.Abs(float64(evals[0])-1.0) > 0.0001 || math.Abs(float64(evals[1])-0.5) > 0.0001 {
+			t.Errorf("評価値の平均の不一致: got = %v", evals)
+		}
+	})
+
+	t.Run("異常_シミュレーション数が0", func(t *testing.T) {
+		rngs, err := randx.NewPCGs(1)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		_, err = tree.Run(0, rngs, func(int, *rand.Rand) (map[int]float32, int, error) {
+			return nil, 0, nil
+		})
+		if err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_シミュレーションのエラー", func(t *testing.T) {
+		rngs, err := randx.NewPCGs(2)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		want := errors.New("simulate")
+		_, err = tree.Run(10, rngs, func(int, *rand.Rand) (map[int]float32, int, error) {
+			return nil, 0, want
+		})
+		if !errors.Is(err, want) {
+			t.Errorf("エラーの不一致: got = %v, want = %v", err, want)
+		}
+	})
+}
@@ -0,0 +1,313 @@
+// Package muzero は、ゲームのルールの代わりに、学習したモデルで状態遷移を予測して探索する MuZero 型の MCTS を提供する。
+//
+// ルール(合法手)を使うのはルートノードだけで、ルート以降は Model の隠れ状態の上で探索する。
+// 状態遷移のシミュレーションが高価なゲームや、ルールを実装出来ないゲームでも探索出来る。
+// 各ノードの統計と backward は、puct・dpuct と共有する。
+package muzero
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/mcts/internal/tree"
+	"github.com/sw965/crow/pucb"
+	"github.com/sw965/crow/search"
+)
+
+var (
+	ErrNilEngineFunc = errors.New("muzero.Engineエラー: フィールドの関数がnilです")
+	ErrInvalidConfig = errors.New("muzero.Engineエラー: 設定値が不正です")
+)
+
+// Prediction は、隠れ状態に対する Model.Predict の出力。
+type Prediction[Ac, Ag comparable] struct {
+	// Agent は、その隠れ状態で行動を選ぶエージェント。
+	Agent Ag
+	// Policy は、行動の事前確率。Policy に無い行動の確率は0とする。
+	Policy game.Policy[Ac]
+	// ValueByAgent は、その隠れ状態以降に各エージェントが得る報酬と結果スコアの合計の予測値。
+	ValueByAgent map[Ag]float32
+}
+
+// Model は、MuZero の3つの関数(表現・ダイナミクス・予測)を持つ学習済みのモデル。
+// 探索は複数のワーカーから並行に呼び出す為、各メソッドは並行に呼び出しても安全である事。
+type Model[S, H any, Ac, Ag comparable] interface {
+	// Represent は、状態を隠れ状態に変換する。
+	Represent(S) (H, error)
+	// Dynamics は、隠れ状態で行動した後の隠れ状態と、その行動で各エージェントが得た報酬を返す。報酬が無い場合は nil でよい。
+	Dynamics(H, Ac) (H, game.RewardByAgent[Ag], error)
+	// Predict は、隠れ状態の手番のエージェント・方策・価値を返す。
+	Predict(H) (Prediction[Ac, Ag], error)
+}
+
+type RootNodeEvalByAgent[Ag comparable] map[Ag]float32
+
+func (es RootNodeEvalByAgent[Ag]) DivScalar(s float32) {
+	for k := range es {
+		es[k] /= s
+	}
+}
+
+type LeafNodeEvalByAgent[Ag comparable] map[Ag]float32
+
+type Node[H any, Ac, Ag comparable] struct {
+	Hidden H
+	Agent  Ag
+	// Reward は、親ノードからこのノードへの遷移で得た報酬。ルートノードと、報酬が無い場合は nil。
+	Reward game.RewardByAgent[Ag]
+	// ValueByAgent は、Model.Predict が返した、このノードの価値。
+	ValueByAgent map[Ag]float32
+	stats        *tree.Stats[Ac]
+	// Model.Dynamics は決定的な為、行動毎に子ノードは1つだけ持つ。
+	nextNodeByAction map[Ac]*Node[H, Ac, Ag]
+	// minMax は、木全体で共有する観測値の最小値・最大値。
+	minMax *pucb.MinMaxStats
+	mu     sync.Mutex
+}
+
+func (n *Node[H, Ac, Ag]) VirtualSelector() pucb.VirtualSelector[Ac] {
+	return n.stats.VirtualSelector()
+}
+
+// Engine は、Model の隠れ状態の上で探索する MCTS。
+// 評価値の範囲はモデル次第の為、MuZero と同じく、木全体で backward した値の最小値・最大値で Q を [0, 1] に正規化して行動を選ぶ。
+type Engine[S, H any, Ac, Ag comparable] struct {
+	Model Model[S, H, Ac, Ag]
+	// Actions は、ルートノード以外で選べる行動の集合。隠れ状態では合法手が分からない為、全ての行動を候補とする。
+	Actions []Ac
+	// LegalActionsFunc は、ルートノードの合法手を返す。ルールを使うのはルートノードだけ。
+	LegalActionsFunc sequential.LegalActionsFunc[S, Ac]
+	Agents           []Ag
+	PUCBFunc         pucb.Func
+	PUCBStatsFunc    pucb.StatsFunc
+	VirtualValue     float32
+	FPU              pucb.FPU
+	VirtualLoss      pucb.VirtualLoss
+	// Discount は、報酬と価値の割引率。0の場合は1(割引無し)とする。
+	Discount float32
+}
+
+func (e Engine[S, H, Ac, Ag]) Validate() error {
+	if e.Model == nil {
+		return fmt.Errorf("%w: Model", ErrNilEngineFunc)
+	}
+
+	if e.LegalActionsFunc == nil {
+		return fmt.Errorf("%w: LegalActionsFunc", ErrNilEngineFunc)
+	}
+
+	if e.PUCBFunc == nil && e.PUCBStatsFunc == nil {
+		return fmt.Errorf("%w: PUCBFunc", ErrNilEngineFunc)
+	}
+
+	if len(e.Actions) == 0 {
+		return fmt.Errorf("%w: Actionsが空です", ErrInvalidConfig)
+	}
+
+	if len(e.Agents) == 0 {
+		return fmt.Errorf("%w: Agentsが空です", ErrInvalidConfig)
+	}
+
+	if err := e.FPU.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	if err := e.VirtualLoss.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	if math.IsNaN(float64(e.Discount)) || e.Discount < 0 || e.Discount > 1 {
+		return fmt.Errorf("%w: Discount=%.6g(0以上1以下である必要があります)", ErrInvalidConfig, e.Discount)
+	}
+	return nil
+}
+
+func (e Engine[S, H, Ac, Ag]) discount() float32 {
+	if e.Discount == 0 {
+		return 1
+	}
+	return e.Discount
+}
+
+// NewNode は、state をルートとするノードを返す。ルートノードの行動は state の合法手で、方策は合法手でマスクして正規化する。
+func (e Engine[S, H, Ac, Ag]) NewNode(state S) (*Node[H, Ac, Ag], error) {
+	legalActions := e.LegalActionsFunc(state)
+	if len(legalActions) == 0 {
+		return nil, errors.New("ゲームが終了していないのに合法手がありません")
+	}
+
+	hidden, err := e.Model.Represent(state)
+	if err != nil {
+		return nil, err
+	}
+	return e.newNode(hidden, nil, pucb.NewMinMaxStats(), legalActions)
+}
+
+// newNode は、hidden のノードを返す。legalActions が nil の場合は、Actions の全ての行動を候補とする。
+func (e Engine[S, H, Ac, Ag]) newNode(hidden H, reward game.RewardByAgent[Ag], minMax *pucb.MinMaxStats, legalActions []Ac) (*Node[H, Ac, Ag], error) {
+	prediction, err := e.Model.Predict(hidden)
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(e.Agents, prediction.Agent) {
+		return nil, fmt.Errorf("Model.Predictが返したエージェントがAgentsに含まれていません: agent = %v", prediction.Agent)
+	}
+
+	actions := e.Actions
+	policy := prediction.Policy
+	if legalActions != nil {
+		actions = legalActions
+		policy, err = policy.MaskToLegalActions(legalActions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stats := tree.NewStats(actions, policy, tree.Config{
+		Func:         e.PUCBFunc,
+		StatsFunc:    e.PUCBStatsFunc,
+		VirtualValue: e.VirtualValue,
+		FPU:          e.FPU,
+		VirtualLoss:  e.VirtualLoss,
+		MinMax:       minMax,
+	})
+
+	return &Node[H, Ac, Ag]{
+		Hidden:           hidden,
+		Agent:            prediction.Agent,
+		Reward:           reward,
+		ValueByAgent:     prediction.ValueByAgent,
+		stats:            stats,
+		nextNodeByAction: make(map[Ac]*Node[H, Ac, Ag], len(actions)),
+		minMax:           minMax,
+	}, nil
+}
+
+// SelectExpansionBackward は、1回のシミュレーションを行う。
+// 未展開の行動を選ぶまで木を辿り、Model.Dynamics と Model.Predict で新しいノードを展開し、その価値を経路上に反映する。
+func (e Engine[S, H, Ac, Ag]) SelectExpansionBackward(node *Node[H, Ac, Ag], capacity int, rng *rand.Rand) (evals LeafNodeEvalByAgent[Ag], depth int, err error) {
+	path := tree.NewPath[Ac, Ag](capacity)
+
+	// バッファ積み上げ中にエラーが起きた場合、pending を元に戻す。
+	// backward 実行後は backward 側が pending を解放する為、ここでは戻さない。
+	backwardStarted := false
+	defer func() {
+		if err != nil && !backwardStarted {
+			if rbErr := path.Rollback(); rbErr != nil {
+				err = errors.Join(err, rbErr)
+			}
+		}
+	}()
+
+	for {
+		var action Ac
+		path.Push()
+		action, err = path.Select(node.stats, node.Agent, rng)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		node.mu.Lock()
+		nextNode, ok := node.nextNodeByAction[action]
+		node.mu.Unlock()
+
+		expand := false
+		if !ok {
+			var hidden H
+			var reward game.RewardByAgent[Ag]
+			hidden, reward, err = e.Model.Dynamics(node.Hidden, action)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			var newNode *Node[H, Ac, Ag]
+			newNode, err = e.newNode(hidden, reward, node.minMax, nil)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			// Unlockして newNode を作ってる間に、別のワーカーがノードを追加した可能性がある為、再度Lockして調べる
+			node.mu.Lock()
+			if nn, ok := node.nextNodeByAction[action]; ok {
+				nextNode = nn
+			} else {
+				node.nextNodeByAction[action] = newNode
+				nextNode = newNode
+				expand = true
+			}
+			node.mu.Unlock()
+		}
+
+		path.SetRewards(nextNode.Reward)
+		node = nextNode
+		if expand {
+			break
+		}
+	}
+
+	// 展開したノードの予測値を、リーフノードの評価値とする
+	evals = LeafNodeEvalByAgent[Ag]{}
+	maps.Copy(evals, node.ValueByAgent)
+
+	backwardStarted = true
+	evals, err = path.Backward(evals, e.discount())
+	if err != nil {
+		return nil, 0, err
+	}
+	return evals, path.Len(), nil
+}
+
+func (e Engine[S, H, Ac, Ag]) Search(rootNode *Node[H, Ac, Ag], n int, workerRngs []*rand.Rand) (RootNodeEvalByAgent[Ag], error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+
+	if rootNode == nil {
+		return nil, errors.New("rootNode が nil です")
+	}
+
+	rootEvals, err := tree.Run(n, workerRngs, func(capacity int, rng *rand.Rand) (map[Ag]float32, int, error) {
+		return e.SelectExpansionBackward(rootNode, capacity, rng)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return RootNodeEvalByAgent[Ag](rootEvals), nil
+}
+
+// searcher は、Engine を search.Searcher として扱う為の型。
+type searcher[S, H any, Ac, Ag comparable] struct {
+	engine Engine[S, H, Ac, Ag]
+}
+
+func (s searcher[S, H, Ac, Ag]) NewRoot(state S) (*Node[H, Ac, Ag], error) {
+	return s.engine.NewNode(state)
+}
+
+// Search は、rootNode から budget 回のシミュレーションを行い、訪問比率を手番のエージェントの方策とした結果を返す。
+func (s searcher[S, H, Ac, Ag]) Search(rootNode *Node[H, Ac, Ag], budget int, rngs []*rand.Rand) (search.Result[Ac, Ag], error) {
+	evals, err := s.engine.Search(rootNode, budget, rngs)
+	if err != nil {
+		return search.Result[Ac, Ag]{}, err
+	}
+
+	selector := rootNode.VirtualSelector()
+	return search.Result[Ac, Ag]{
+		PolicyByAgent: map[Ag]game.Policy[Ac]{rootNode.Agent: selector.VisitRatioByKey()},
+		ValueByAgent:  evals,
+		StatsByAgent:  map[Ag]*game.SearchStats[Ac, Ag]{rootNode.Agent: pucb.NewSearchStats(selector, budget, evals)},
+	}, nil
+}
+
+// Searcher は、Engine を search.Searcher として返す。予算はシミュレーション数。
+func (e Engine[S, H, Ac, Ag]) Searcher() search.Searcher[S, Ac, Ag, *Node[H, Ac, Ag]] {
+	return searcher[S, H, Ac, Ag]{engine: e}
+}
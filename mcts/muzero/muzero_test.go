@@ -0,0 +1,263 @@
+package muzero_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/internal/ttt"
+	"github.com/sw965/crow/mcts/muzero"
+	"github.com/sw965/crow/pucb"
+	"github.com/sw965/crow/search"
+	"github.com/sw965/omw/mathx/randx"
+)
+
+// tttHidden は、tttModel の隠れ状態。End はゲームが終了した後の吸収状態か。
+type tttHidden struct {
+	State ttt.State
+	End   bool
+}
+
+// tttModel は、ルールをそのまま使って遷移を予測する、三目並べの完全なモデル。
+// 非合法手は、行動したエージェントの負けとして吸収状態に遷移する。
+// ゲーム終了時の結果スコアを遷移の報酬とし、終了していない状態の価値は各エージェント0.5とする。
+type tttModel struct {
+	engine sequential.Engine[ttt.State, ttt.Action, ttt.Mark]
+}
+
+func (m tttModel) Represent(state ttt.State) (tttHidden, error) {
+	return tttHidden{State: state}, nil
+}
+
+func (m tttModel) Dynamics(h tttHidden, action ttt.Action) (tttHidden, game.RewardByAgent[ttt.Mark], error) {
+	if h.End {
+		return h, nil, nil
+	}
+
+	agent := h.State.Turn
+	if !slices.Contains(m.engine.Rule.LegalActionsFunc(h.State), action) {
+		reward := game.RewardByAgent[ttt.Mark]{}
+		for _, a := range m.engine.Agents {
+			if a != agent {
+				reward[a] = 1.0
+			}
+		}
+		return tttHidden{State: h.State, End: true}, reward, nil
+	}
+
+	next, err := m.engine.Rule.TransitionFunc(h.State, action)
+	if err != nil {
+		return tttHidden{}, nil, err
+	}
+
+	isEnd, err := m.engine.IsTerminal(next)
+	if err != nil {
+		return tttHidden{}, nil, err
+	}
+	if !isEnd {
+		return tttHidden{State: next}, nil, nil
+	}
+
+	scores, err := m.engine.EvaluateResultScoreByAgent(next)
+	if err != nil {
+		return tttHidden{}, nil, err
+	}
+	return tttHidden{State: next, End: true}, game.RewardByAgent[ttt.Mark](scores), nil
+}
+
+func (m tttModel) Predict(h tttHidden) (muzero.Prediction[ttt.Action, ttt.Mark], error) {
+	actions := tttActions()
+	policy := make(game.Policy[ttt.Action], len(actions))
+	for _, a := range actions {
+		policy[a] = 1.0 / float32(len(actions))
+	}
+
+	value := float32(0.5)
+	if h.End {
+		value = 0.0
+	}
+
+	return muzero.Prediction[ttt.Action, ttt.Mark]{
+		Agent:        h.State.Turn,
+		Policy:       policy,
+		ValueByAgent: map[ttt.Mark]float32{ttt.Cross: value, ttt.Nought: value},
+	}, nil
+}
+
+func tttActions() []ttt.Action {
+	actions := make([]ttt.Action, 0, 9)
+	for r := range 3 {
+		for c := range 3 {
+			actions = append(actions, ttt.Action{Row: r, Col: c})
+		}
+	}
+	return actions
+}
+
+func newTTTMuZero() muzero.Engine[ttt.State, tttHidden, ttt.Action, ttt.Mark] {
+	engine := ttt.NewEngine()
+	return muzero.Engine[ttt.State, tttHidden, ttt.Action, ttt.Mark]{
+		Model:            tttModel{engine: engine},
+		Actions:          tttActions(),
+		LegalActionsFunc: engine.Rule.LegalActionsFunc,
+		Agents:           engine.Agents,
+		PUCBFunc:         pucb.NewAlphaGoFunc(1.25),
+		VirtualValue:     0.5,
+	}
+}
+
+// winInOne は、Crossが(0,2)に置けば勝つ局面。
+var winInOne = ttt.State{
+	Board: ttt.Board{
+		{ttt.Cross, ttt.Cross, ttt.EmptyMark},
+		{ttt.Nought, ttt.Nought, ttt.EmptyMark},
+		{ttt.EmptyMark, ttt.EmptyMark, ttt.EmptyMark},
+	},
+	Turn: ttt.Cross,
+}
+
+func TestEngineValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*muzero.Engine[ttt.State, tttHidden, ttt.Action, ttt.Mark])
+		wantErr error
+	}{
+		{
+			name:   "正常",
+			modify: func(e *muzero.Engine[ttt.State, tttHidden, ttt.Action, ttt.Mark]) {},
+		},
+		{
+			name:    "異常_Modelがnil",
+			modify:  func(e *muzero.Engine[ttt.State, tttHidden, ttt.Action, ttt.Mark]) { e.Model = nil },
+			wantErr: muzero.ErrNilEngineFunc,
+		},
+		{
+			name:    "異常_LegalActionsFuncがnil",
+			modify:  func(e *muzero.Engine[ttt.State, tttHidden, ttt.Action, ttt.Mark]) { e.LegalActionsFunc = nil },
+			wantErr: muzero.ErrNilEngineFunc,
+		},
+		{
+			name:    "異常_PUCBFuncがnil",
+			modify:  func(e *muzero.Engine[ttt.State, tttHidden, ttt.Action, ttt.Mark]) { e.PUCBFunc = nil },
+			wantErr: muzero.ErrNilEngineFunc,
+		},
+		{
+			name:    "異常_Actionsが空",
+			modify:  func(e *muzero.Engine[ttt.State, tttHidden, ttt.Action, ttt.Mark]) { e.Actions = nil },
+			wantErr: muzero.ErrInvalidConfig,
+		},
+		{
+			name:    "異常_Agentsが空",
+			modify:  func(e *muzero.Engine[ttt.State, tttHidden, ttt.Action, ttt.Mark]) { e.Agents = nil },
+			wantErr: muzero.ErrInvalidConfig,
+		},
+		{
+			name:    "異常_Discountが1より大きい",
+			modify:  func(e *muzero.Engine[ttt.State, tttHidden, ttt.Action, ttt.Mark]) { e.Discount = 1.5 },
+			wantErr: muzero.ErrInvalidConfig,
+		},
+		{
+			name: "異常_不正なFPU",
+			modify: func(e *muzero.Engine[ttt.State, tttHidden, ttt.Action, ttt.Mark]) {
+				e.FPU = pucb.FPU{Mode: pucb.FPUMode(-1)}
+			},
+			wantErr: muzero.ErrInvalidConfig,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newTTTMuZero()
+			tc.modify(&e)
+			err := e.Validate()
+			if tc.wantErr == nil {
+				if err != nil {
+					t.Fatalf("予期せぬエラー: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("エラーの不一致: got = %v, want = %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	winningAction := ttt.Action{Row: 0, Col: 2}
+
+	tests := []struct {
+		name     string
+		discount float32
+		workers  int
+	}{
+		{name: "正常_割引無し", discount: 0, workers: 1},
+		{name: "正常_割引有り", discount: 0.9, workers: 1},
+		{name: "正常_複数ワーカー", discount: 0, workers: 4},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newTTTMuZero()
+			e.Discount = tc.discount
+			rngs, err := randx.NewPCGs(tc.workers)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			result, err := search.Run(e.Searcher(), winInOne, 800, rngs)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			policy := result.PolicyByAgent[ttt.Cross]
+			// ルートノードの行動は合法手だけ
+			legalActions := ttt.NewEngine().Rule.LegalActionsFunc(winInOne)
+			if err := policy.ValidateForLegalActions(legalActions, true); err != nil {
+				t.Errorf("予期せぬエラー: %v", err)
+			}
+
+			best, err := game.MaxSelectFunc[ttt.Action, ttt.Mark](policy, ttt.Cross, 0, rngs[0])
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if best != winningAction {
+				t.Errorf("選んだ行動の不一致: got = %v, want = %v, policy = %v", best, winningAction, policy)
+			}
+
+			if v := result.ValueByAgent[ttt.Cross]; v < 0.8 {
+				t.Errorf("勝ちの局面の価値が低い: got = %f", v)
+			}
+
+			stats := result.StatsByAgent[ttt.Cross]
+			if stats == nil || stats.Simulations != 800 {
+				t.Errorf("探索の統計の不一致: got = %+v", stats)
+			}
+		})
+	}
+
+	t.Run("異常_合法手が無い", func(t *testing.T) {
+		e := newTTTMuZero()
+		e.LegalActionsFunc = func(ttt.State) []ttt.Action { return nil }
+		if _, err := e.NewNode(winInOne); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_シミュレーション数が0", func(t *testing.T) {
+		e := newTTTMuZero()
+		root, err := e.NewNode(winInOne)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		rngs, err := randx.NewPCGs(1)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if _, err := e.Search(root, 0, rngs); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
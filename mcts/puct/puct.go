@@ -11,8 +11,9 @@ import (
 
 	"github.com/sw965/crow/game"
 	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/mcts/internal/tree"
 	"github.com/sw965/crow/pucb"
-	"github.com/sw965/omw/parallel"
+	"github.com/sw965/crow/search"
 )
 
 var (
@@ -38,13 +39,16 @@ type LeafNodeEvalByAgentFunc[S any, Ag comparable] func(S, *rand.Rand) (LeafNode
 type Node[S any, Ac, Ag comparable] struct {
 	State             S
 	Agent             Ag
-	virtualSelector   pucb.VirtualSelector[Ac]
+	stats             *tree.Stats[Ac]
 	nextNodesByAction map[Ac]Nodes[S, Ac, Ag]
-	mu                sync.Mutex
+	// minMax は、Engine.NormalizeQ の場合に、木全体で共有する観測値の最小値・最大値。
+	minMax *pucb.MinMaxStats
+	mu     sync.Mutex
 }
 
+// VirtualSelector は、各行動の統計を返す。LockFree の Engine で作ったノードでは、呼び出した時点のスナップショットを返す。
 func (n *Node[S, Ac, Ag]) VirtualSelector() pucb.VirtualSelector[Ac] {
-	return maps.Clone(n.virtualSelector)
+	return n.stats.VirtualSelector()
 }
 
 type Nodes[S any, Ac, Ag comparable] []*Node[S, Ac, Ag]
@@ -58,75 +62,30 @@ func (nodes Nodes[S, Ac, Ag]) FindByState(state S, eq sequential.EqualFunc[S]) (
 	return nil, false
 }
 
-type selectBuffer[S any, Ac, Ag comparable] struct {
-	node   *Node[S, Ac, Ag]
-	action Ac
-}
-
-type selectBuffers[S any, Ac, Ag comparable] []selectBuffer[S, Ac, Ag]
-
-// backward は、リーフノードの評価値を、経路上の全ノードに反映する。
-// 途中でエラーが起きても、pending の解放は全ての経路に対して必ず行い、
-// 発生したエラーはまとめて返す。
-func (ss selectBuffers[S, Ac, Ag]) backward(evals LeafNodeEvalByAgent[Ag]) error {
-	var errs []error
-	for _, s := range ss {
-		node := s.node
-		action := s.action
-
-		node.mu.Lock()
-		c := node.virtualSelector[action]
-		// 未観測のカウントを消す
-		if err := c.DecrementPending(); err != nil {
-			errs = append(errs, err)
-		}
-
-		eval, ok := evals[node.Agent]
-		if !ok {
-			errs = append(errs, fmt.Errorf(
-				"LeafNodeEvalByAgentに存在しないキー(Agent)でアクセスしようとした為、backwardを実行出来ませんでした。node.Agent = %v, LeafNodeEvalByAgent.Keys() = %v",
-				node.Agent, slices.Collect(maps.Keys(evals)),
-			))
-			node.mu.Unlock()
-			continue
-		}
-
-		if err := c.AddW(eval); err != nil {
-			errs = append(errs, err)
-			node.mu.Unlock()
-			continue
-		}
-		c.IncrementVisits()
-		node.mu.Unlock()
-	}
-	return errors.Join(errs...)
-}
-
-// rollbackPending は、backward を実行しない場合に、経路上の pending を解放する。
-func (ss selectBuffers[S, Ac, Ag]) rollbackPending() error {
-	var errs []error
-	for _, s := range ss {
-		s.node.mu.Lock()
-		if err := s.node.virtualSelector[s.action].DecrementPending(); err != nil {
-			errs = append(errs, err)
-		}
-		s.node.mu.Unlock()
-	}
-	return errors.Join(errs...)
-}
-
 type Engine[S any, Ac, Ag comparable] struct {
 	Game                    sequential.Engine[S, Ac, Ag]
 	PUCBFunc                pucb.Func
+	PUCBStatsFunc           pucb.StatsFunc
 	PolicyFunc              sequential.PolicyFunc[S, Ac]
 	LeafNodeEvalByAgentFunc LeafNodeEvalByAgentFunc[S, Ag]
 	NextNodesCap            int
 	VirtualValue            float32
+	FPU                     pucb.FPU
+	VirtualLoss             pucb.VirtualLoss
 	// MaxDepth は1回のシミュレーションで辿るノード数の上限。
 	// 状態が循環し得るゲームでは、展開もゲーム終了も起きずに探索が無限ループする恐れがある為、
 	// そのようなゲームでは必ず設定する事。上限に達した場合、その状態をリーフノードとして評価する。
 	// 0の場合は無制限。
 	MaxDepth int
+	// LockFree が true の場合、各ノードの統計を pucb.AtomicVirtualSelector で持ち、
+	// 行動の選択と backward をノードのロック無しで行う。ロックを取るのは子ノードの検索と追加だけになる。
+	// ワーカー数が多い場合にロックの競合を減らせるが、選択は他のワーカーが更新中の統計を読む事がある。
+	// 観測値の分散・最小値・最大値は記録しない為、PUCBStatsFunc、及び FPU の pucb.FPULoss とは併用出来ない。
+	LockFree bool
+	// NormalizeQ が true の場合、MuZero と同じく、木全体で backward した値の最小値・最大値で Q を [0, 1] に正規化して行動を選ぶ。
+	// 報酬の合計や得点のように、評価値の範囲が [0, 1] に収まらないゲームで、Q と探索項の尺度を揃える。
+	// 正規化するのは選択だけで、VirtualSelector が返す Q や探索の統計は正規化しない。
+	NormalizeQ bool
 }
 
 func (e Engine[S, Ac, Ag]) Validate() error {
@@ -134,10 +93,26 @@ func (e Engine[S, Ac, Ag]) Validate() error {
 		return err
 	}
 
-	if e.PUCBFunc == nil {
+	if e.PUCBFunc == nil && e.PUCBStatsFunc == nil {
 		return fmt.Errorf("%w: PUCBFunc", ErrNilEngineFunc)
 	}
 
+	if e.LockFree && e.PUCBStatsFunc != nil {
+		return fmt.Errorf("%w: LockFreeとPUCBStatsFuncは併用出来ません(分散・最小値・最大値を記録しない為)", ErrInvalidConfig)
+	}
+
+	if e.LockFree && e.FPU.Mode == pucb.FPULoss {
+		return fmt.Errorf("%w: LockFreeとFPU.Mode=%v は併用出来ません(観測値の最小値を記録しない為)", ErrInvalidConfig, e.FPU.Mode)
+	}
+
+	if err := e.FPU.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	if err := e.VirtualLoss.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
 	if e.PolicyFunc == nil {
 		return fmt.Errorf("%w: PolicyFunc", ErrNilEngineFunc)
 	}
@@ -160,24 +135,71 @@ func (e *Engine[S, Ac, Ag]) SetUniformPolicyFunc() {
 // 乱数器は探索の呼び出し側からワーカー毎に渡される為、ここでは受け取らない。
 func (e *Engine[S, Ac, Ag]) SetPlayout(accr sequential.ActorCritic[S, Ac, Ag]) {
 	e.LeafNodeEvalByAgentFunc = func(state S, rng *rand.Rand) (LeafNodeEvalByAgent[Ag], error) {
-		finals, err := e.Game.Playouts([]S{state}, accr, []*rand.Rand{rng})
-		if err != nil {
-			return nil, err
-		}
-		final := finals[0]
-
-		scores, err := e.Game.EvaluateResultScoreByAgent(final)
+		// 途中の報酬(Game.RewardFunc)がある場合、プレイアウト中の報酬の合計も評価値に含める
+		returns, err := e.Game.PlayoutReturns([]S{state}, accr, []*rand.Rand{rng})
 		if err != nil {
 			return nil, err
 		}
 
 		evals := LeafNodeEvalByAgent[Ag]{}
-		maps.Copy(evals, scores)
+		maps.Copy(evals, returns[0])
 		return evals, nil
 	}
 }
 
+// SingleAgentValueFunc は、一人用のゲームで、状態の価値(以降に得られる報酬と結果スコアの合計の推定値)を返す。
+type SingleAgentValueFunc[S any] func(S, *rand.Rand) (float32, error)
+
+// SetSingleAgent は、Game.Agents が1体だけのゲーム(パズル等)を探索する設定にする。
+// 評価値の範囲が分からない為、NormalizeQ を有効にし、VirtualLoss を pucb.VirtualVisit にする(VirtualValue は使わない)。
+// valueFunc が nil でない場合、リーフノードの評価関数を valueFunc に置き換える。nil の場合は、設定済みの評価関数(SetPlayout等)をそのまま使う。
+func (e *Engine[S, Ac, Ag]) SetSingleAgent(valueFunc SingleAgentValueFunc[S]) error {
+	if len(e.Game.Agents) != 1 {
+		return fmt.Errorf("%w: len(Game.Agents)=%d(一人用のゲームは1である必要があります)", ErrInvalidConfig, len(e.Game.Agents))
+	}
+
+	e.NormalizeQ = true
+	e.VirtualLoss = pucb.VirtualLoss{Mode: pucb.VirtualVisit}
+	if valueFunc != nil {
+		agent := e.Game.Agents[0]
+		e.LeafNodeEvalByAgentFunc = func(state S, rng *rand.Rand) (LeafNodeEvalByAgent[Ag], error) {
+			v, err := valueFunc(state, rng)
+			if err != nil {
+				return nil, err
+			}
+			return LeafNodeEvalByAgent[Ag]{agent: v}, nil
+		}
+	}
+	return nil
+}
+
+// SetSymmetryAveragedLeafNodeEval は、現在のリーフノードの評価関数を、
+// symmetryFuncsからランダムにk個(重複あり)選んだ対称変換を適用した状態の評価値の平均を返す評価関数に置き換える。
+// 対称変換はゲームの結果を変えない為、評価関数のばらつきを抑える効果がある。
+func (e *Engine[S, Ac, Ag]) SetSymmetryAveragedLeafNodeEval(symmetryFuncs []game.SymmetryFunc[S, Ac], k int) error {
+	if e.LeafNodeEvalByAgentFunc == nil {
+		return fmt.Errorf("%w: LeafNodeEvalByAgentFunc", ErrNilEngineFunc)
+	}
+
+	evalFunc, err := tree.NewSymmetryAveragedEvalFunc(e.LeafNodeEvalByAgentFunc, symmetryFuncs, k)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	e.LeafNodeEvalByAgentFunc = evalFunc
+	return nil
+}
+
+// NewNode は、state をルートとするノードを返す。NormalizeQ の場合、このノードを根とする木で新しい最小値・最大値を持つ。
 func (e Engine[S, Ac, Ag]) NewNode(state S) (*Node[S, Ac, Ag], error) {
+	var minMax *pucb.MinMaxStats
+	if e.NormalizeQ {
+		minMax = pucb.NewMinMaxStats()
+	}
+	return e.newNode(state, minMax)
+}
+
+// newNode は、木の最小値・最大値として minMax を共有するノードを返す。
+func (e Engine[S, Ac, Ag]) newNode(state S, minMax *pucb.MinMaxStats) (*Node[S, Ac, Ag], error) {
 	legalActions := e.Game.Rule.LegalActionsFunc(state)
 
 	// policy.ValidateForLegalActionsでもlegalActionsの空チェックはするが、PolicyFuncを安全に呼ぶ為に、ここでもチェックする
@@ -195,11 +217,15 @@ func (e Engine[S, Ac, Ag]) NewNode(state S) (*Node[S, Ac, Ag], error) {
 		return nil, err
 	}
 
-	s := pucb.VirtualSelector[Ac]{}
-	for _, action := range legalActions {
-		p := policy[action]
-		s[action] = &pucb.Calculator{Func: e.PUCBFunc, P: p, VirtualValue: e.VirtualValue}
-	}
+	stats := tree.NewStats(legalActions, policy, tree.Config{
+		Func:         e.PUCBFunc,
+		StatsFunc:    e.PUCBStatsFunc,
+		VirtualValue: e.VirtualValue,
+		FPU:          e.FPU,
+		VirtualLoss:  e.VirtualLoss,
+		MinMax:       minMax,
+		LockFree:     e.LockFree,
+	})
 
 	agent := e.Game.Rule.CurrentAgentFunc(state)
 
@@ -212,14 +238,15 @@ func (e Engine[S, Ac, Ag]) NewNode(state S) (*Node[S, Ac, Ag], error) {
 	return &Node[S, Ac, Ag]{
 		State:             state,
 		Agent:             agent,
-		virtualSelector:   s,
+		stats:             stats,
 		nextNodesByAction: make(map[Ac]Nodes[S, Ac, Ag], e.NextNodesCap),
+		minMax:            minMax,
 	}, nil
 }
 
 func (e Engine[S, Ac, Ag]) SelectExpansionBackward(node *Node[S, Ac, Ag], capacity int, rng *rand.Rand) (evals LeafNodeEvalByAgent[Ag], depth int, err error) {
 	state := node.State
-	buffers := make(selectBuffers[S, Ac, Ag], 0, capacity)
+	path := tree.NewPath[Ac, Ag](capacity)
 	var isEnd bool
 
 	// バッファ積み上げ中にエラーが起きた場合、pending を元に戻す。
@@ -227,32 +254,35 @@ func (e Engine[S, Ac, Ag]) SelectExpansionBackward(node *Node[S, Ac, Ag], capaci
 	backwardStarted := false
 	defer func() {
 		if err != nil && !backwardStarted {
-			if rbErr := buffers.rollbackPending(); rbErr != nil {
+			if rbErr := path.Rollback(); rbErr != nil {
 				err = errors.Join(err, rbErr)
 			}
 		}
 	}()
 
 	for {
-		node.mu.Lock()
-
 		var action Ac
-		action, err = node.virtualSelector.Select(rng)
+		path.Push()
+		action, err = path.Select(node.stats, node.Agent, rng)
 		if err != nil {
-			node.mu.Unlock()
 			return nil, 0, err
 		}
-		// 選択した行動のノードの未観測の数をインクリメントする
-		node.virtualSelector[action].IncrementPending()
-
-		node.mu.Unlock()
-		buffers = append(buffers, selectBuffer[S, Ac, Ag]{node: node, action: action})
 
+		prev := state
 		state, err = e.Game.Rule.TransitionFunc(state, action)
 		if err != nil {
 			return nil, 0, err
 		}
 
+		if e.Game.RewardFunc != nil {
+			var rewards game.RewardByAgent[Ag]
+			rewards, err = e.Game.RewardFunc(prev, action, state)
+			if err != nil {
+				return nil, 0, err
+			}
+			path.SetRewards(rewards)
+		}
+
 		isEnd, err = e.Game.IsTerminal(state)
 		if err != nil {
 			return nil, 0, err
@@ -263,7 +293,7 @@ func (e Engine[S, Ac, Ag]) SelectExpansionBackward(node *Node[S, Ac, Ag], capaci
 		}
 
 		// 深さが上限に達した場合、この状態をリーフノードとして評価する
-		if e.MaxDepth > 0 && len(buffers) >= e.MaxDepth {
+		if e.MaxDepth > 0 && path.Len() >= e.MaxDepth {
 			break
 		}
 
@@ -280,7 +310,7 @@ func (e Engine[S, Ac, Ag]) SelectExpansionBackward(node *Node[S, Ac, Ag], capaci
 			expand = false
 		} else {
 			var newNode *Node[S, Ac, Ag]
-			newNode, err = e.NewNode(state)
+			newNode, err = e.newNode(state, node.minMax)
 			if err != nil {
 				return nil, 0, err
 			}
@@ -323,10 +353,11 @@ func (e Engine[S, Ac, Ag]) SelectExpansionBackward(node *Node[S, Ac, Ag], capaci
 	}
 
 	backwardStarted = true
-	if err = buffers.backward(evals); err != nil {
+	evals, err = path.Backward(evals, 1)
+	if err != nil {
 		return nil, 0, err
 	}
-	return evals, len(buffers), nil
+	return evals, path.Len(), nil
 }
 
 func (e Engine[S, Ac, Ag]) Search(rootNode *Node[S, Ac, Ag], n int, workerRngs []*rand.Rand) (RootNodeEvalByAgent[Ag], error) {
@@ -338,98 +369,57 @@ func (e Engine[S, Ac, Ag]) Search(rootNode *Node[S, Ac, Ag], n int, workerRngs [
 		return nil, errors.New("rootNode が nil です")
 	}
 
-	if n <= 0 {
-		return nil, fmt.Errorf("シミュレーション数が不正: n = %d: n > 0 であるべき", n)
-	}
-
-	p := len(workerRngs)
-	rootEvalsPerWorker := make([]RootNodeEvalByAgent[Ag], p)
-	for i := range p {
-		rootEvalsPerWorker[i] = RootNodeEvalByAgent[Ag]{}
+	rootEvals, err := tree.Run(n, workerRngs, func(capacity int, rng *rand.Rand) (map[Ag]float32, int, error) {
+		return e.SelectExpansionBackward(rootNode, capacity, rng)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return RootNodeEvalByAgent[Ag](rootEvals), nil
+}
 
-	workerBuffCaps := make([]int, p)
-	err := parallel.For(n, p, func(workerID, idx int) error {
-		rng := workerRngs[workerID]
-		leafEvals, depth, err := e.SelectExpansionBackward(rootNode, workerBuffCaps[workerID], rng)
-		if err != nil {
-			return err
-		}
-
-		for k, v := range leafEvals {
-			rootEvalsPerWorker[workerID][k] += v
-		}
+// searcher は、Engine を search.Searcher として扱う為の型。
+type searcher[S any, Ac, Ag comparable] struct {
+	engine Engine[S, Ac, Ag]
+}
 
-		workerBuffCaps[workerID] = depth + 1
-		return nil
-	})
+func (s searcher[S, Ac, Ag]) NewRoot(state S) (*Node[S, Ac, Ag], error) {
+	return s.engine.NewNode(state)
+}
 
+// Search は、rootNode から budget 回のシミュレーションを行い、訪問比率を手番のエージェントの方策とした結果を返す。
+func (s searcher[S, Ac, Ag]) Search(rootNode *Node[S, Ac, Ag], budget int, rngs []*rand.Rand) (search.Result[Ac, Ag], error) {
+	evals, err := s.engine.Search(rootNode, budget, rngs)
 	if err != nil {
-		return nil, err
+		return search.Result[Ac, Ag]{}, err
 	}
 
-	rootEvals := RootNodeEvalByAgent[Ag]{}
-	for i := range rootEvalsPerWorker {
-		for k, v := range rootEvalsPerWorker[i] {
-			rootEvals[k] += v
-		}
-	}
+	selector := rootNode.VirtualSelector()
+	return search.Result[Ac, Ag]{
+		PolicyByAgent: map[Ag]game.Policy[Ac]{rootNode.Agent: selector.VisitRatioByKey()},
+		ValueByAgent:  evals,
+		StatsByAgent:  map[Ag]*game.SearchStats[Ac, Ag]{rootNode.Agent: pucb.NewSearchStats(selector, budget, evals)},
+	}, nil
+}
 
-	rootEvals.DivScalar(float32(n))
-	return rootEvals, nil
+// Searcher は、Engine を search.Searcher として返す。予算はシミュレーション数。
+func (e Engine[S, Ac, Ag]) Searcher() search.Searcher[S, Ac, Ag, *Node[S, Ac, Ag]] {
+	return searcher[S, Ac, Ag]{engine: e}
 }
 
 func (e Engine[S, Ac, Ag]) NewPolicyNoValueFunc(simulations int, rngs []*rand.Rand) sequential.PolicyValueFunc[S, Ac] {
+	pvFunc := e.NewPolicyValueFunc(simulations, rngs)
 	return func(state S, legalActions []Ac) (game.Policy[Ac], float32, error) {
-		rootNode, err := e.NewNode(state)
-		if err != nil {
-			return nil, 0.0, err
-		}
-
-		_, err = e.Search(rootNode, simulations, rngs)
-		if err != nil {
-			return nil, 0.0, err
-		}
-
-		visitRatios := rootNode.VirtualSelector().VisitRatioByKey()
-		policy := game.Policy[Ac]{}
-		for _, action := range legalActions {
-			if p, ok := visitRatios[action]; !ok {
-				return nil, 0.0, fmt.Errorf("actionの訪問比率が存在しません: action = %v", action)
-			} else {
-				policy[action] = p
-			}
-		}
-		return policy, 0.0, nil
+		policy, _, err := pvFunc(state, legalActions)
+		return policy, 0.0, err
 	}
 }
 
 func (e Engine[S, Ac, Ag]) NewPolicyValueFunc(simulations int, rngs []*rand.Rand) sequential.PolicyValueFunc[S, Ac] {
-	return func(state S, legalActions []Ac) (game.Policy[Ac], float32, error) {
-		rootNode, err := e.NewNode(state)
-		if err != nil {
-			return nil, 0.0, err
-		}
-
-		evals, err := e.Search(rootNode, simulations, rngs)
-		if err != nil {
-			return nil, 0.0, err
-		}
-
-		visitRatios := rootNode.VirtualSelector().VisitRatioByKey()
-		policy := game.Policy[Ac]{}
-		for _, action := range legalActions {
-			if p, ok := visitRatios[action]; !ok {
-				return nil, 0.0, fmt.Errorf("actionの訪問比率が存在しません: action = %v", action)
-			} else {
-				policy[action] = p
-			}
-		}
+	return e.NewPolicyValueStatsFunc(simulations, rngs).PolicyValueFunc()
+}
 
-		eval, ok := evals[rootNode.Agent]
-		if !ok {
-			return nil, 0.0, fmt.Errorf("ルートノードのエージェントの評価値が存在しません: agent = %v", rootNode.Agent)
-		}
-		return policy, eval, nil
-	}
+// NewPolicyValueStatsFunc は、NewPolicyValueFunc と同じ方策と価値に加えて、ルートノードの探索の統計を返す関数を返す。
+func (e Engine[S, Ac, Ag]) NewPolicyValueStatsFunc(simulations int, rngs []*rand.Rand) sequential.PolicyValueStatsFunc[S, Ac, Ag] {
+	return search.NewSequentialPolicyValueStatsFunc(e.Searcher(), simulations, rngs, e.Game.Rule.CurrentAgentFunc)
 }
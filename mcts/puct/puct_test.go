@@ -1,6 +1,8 @@
 package puct_test
 
 import (
+	"errors"
+	"fmt"
 	"math"
 	"testing"
 
@@ -84,6 +86,187 @@ func TestSearchFindsWinningMove(t *testing.T) {
 	}
 }
 
+// FPU と VirtualLoss の各モードでも、勝つ手を見つける事を確かめる。
+func TestSearchFPUAndVirtualLoss(t *testing.T) {
+	state := ttt.State{
+		Board: ttt.Board{
+			{ttt.Cross, ttt.Cross, ttt.EmptyMark},
+			{ttt.Nought, ttt.Nought, ttt.EmptyMark},
+			{ttt.EmptyMark, ttt.EmptyMark, ttt.EmptyMark},
+		},
+		Turn: ttt.Cross,
+	}
+	want := ttt.Action{Row: 0, Col: 2}
+
+	tests := []struct {
+		name        string
+		fpu         pucb.FPU
+		virtualLoss pucb.VirtualLoss
+		lockFree    bool
+	}{
+		{name: "正常_ParentQとVirtualVisit", fpu: pucb.FPU{Mode: pucb.FPUParentQ, Value: 0.2}, virtualLoss: pucb.VirtualLoss{Mode: pucb.VirtualVisit}},
+		{name: "正常_LossとScaled", fpu: pucb.FPU{Mode: pucb.FPULoss}, virtualLoss: pucb.VirtualLoss{Mode: pucb.VirtualLossScaled, Scale: 4}},
+		{name: "正常_LockFreeでParentQとScaled", fpu: pucb.FPU{Mode: pucb.FPUParentQ}, virtualLoss: pucb.VirtualLoss{Mode: pucb.VirtualLossScaled, Scale: 2}, lockFree: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mcts := newTTTMCTS()
+			mcts.FPU = tc.fpu
+			mcts.VirtualLoss = tc.virtualLoss
+			mcts.LockFree = tc.lockFree
+
+			rootNode, err := mcts.NewNode(state)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			rngs, err := randx.NewPCGs(4)
+			if err != nil {
+				panic(err)
+			}
+
+			if _, err := mcts.Search(rootNode, 3000, rngs); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			selector := rootNode.VirtualSelector()
+			if got := selector.SumVisits(); got != 3000 {
+				t.Errorf("訪問回数の合計の不一致: got = %d, want = 3000", got)
+			}
+			for action, calc := range selector {
+				if action != want && calc.Visits() >= selector[want].Visits() {
+					t.Errorf("勝つ手より多く訪問された行動がある: action = %v, visits = %d, want visits = %d", action, calc.Visits(), selector[want].Visits())
+				}
+			}
+		})
+	}
+}
+
+// PUCBStatsFunc に分散を使う式を指定しても、勝つ手を見つける事を確かめる。
+func TestSearchPUCBStatsFunc(t *testing.T) {
+	mcts := newTTTMCTS()
+	mcts.PUCBFunc = nil
+	mcts.PUCBStatsFunc = pucb.NewUCB1TunedFunc()
+
+	state := ttt.State{
+		Board: ttt.Board{
+			{ttt.Cross, ttt.Cross, ttt.EmptyMark},
+			{ttt.Nought, ttt.Nought, ttt.EmptyMark},
+			{ttt.EmptyMark, ttt.EmptyMark, ttt.EmptyMark},
+		},
+		Turn: ttt.Cross,
+	}
+
+	rootNode, err := mcts.NewNode(state)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	rngs, err := randx.NewPCGs(4)
+	if err != nil {
+		panic(err)
+	}
+
+	if _, err := mcts.Search(rootNode, 3000, rngs); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	want := ttt.Action{Row: 0, Col: 2}
+	selector := rootNode.VirtualSelector()
+	for action, calc := range selector {
+		if action != want && calc.Visits() >= selector[want].Visits() {
+			t.Errorf("勝つ手より多く訪問された行動がある: action = %v, visits = %d, want visits = %d", action, calc.Visits(), selector[want].Visits())
+		}
+	}
+
+	// 勝つ手の観測値は全て勝ち(1.0)なので、分散は0
+	if got := selector[want].Variance(); got > 1e-6 {
+		t.Errorf("勝つ手の分散の不一致: got = %f, want = 0.0", got)
+	}
+}
+
+// LockFree の場合も、同じく勝つ手を見つけ、探索後に pending が全て解放される事を確かめる。
+func TestSearchLockFree(t *testing.T) {
+	mcts := newTTTMCTS()
+	mcts.LockFree = true
+
+	state := ttt.State{
+		Board: ttt.Board{
+			{ttt.Cross, ttt.Cross, ttt.EmptyMark},
+			{ttt.Nought, ttt.Nought, ttt.EmptyMark},
+			{ttt.EmptyMark, ttt.EmptyMark, ttt.EmptyMark},
+		},
+		Turn: ttt.Cross,
+	}
+
+	rootNode, err := mcts.NewNode(state)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	rngs, err := randx.NewPCGs(8)
+	if err != nil {
+		panic(err)
+	}
+
+	const n = 5000
+	if _, err := mcts.Search(rootNode, n, rngs); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	selector := rootNode.VirtualSelector()
+	if got := selector.SumVisits(); got != n {
+		t.Errorf("訪問回数の合計の不一致: got = %d, want = %d", got, n)
+	}
+
+	var bestAction ttt.Action
+	bestVisits := -1
+	for action, calc := range selector {
+		if calc.Visits() > bestVisits {
+			bestVisits = calc.Visits()
+			bestAction = action
+		}
+
+		if calc.Pending() != 0 {
+			t.Errorf("action %v のpendingが解放されていない: got = %d, want = 0", action, calc.Pending())
+		}
+	}
+
+	want := ttt.Action{Row: 0, Col: 2}
+	if bestAction != want {
+		t.Errorf("最多訪問の行動の不一致: got = %v, want = %v", bestAction, want)
+	}
+}
+
+// BenchmarkSearch は、ワーカー数(workerRngs の数)毎に、ロック有りと LockFree の探索のスループットを比べる。
+func BenchmarkSearch(b *testing.B) {
+	const simulations = 2000
+	for _, lockFree := range []bool{false, true} {
+		for _, p := range []int{1, 2, 4, 8, 16} {
+			b.Run(fmt.Sprintf("LockFree=%t/workers=%d", lockFree, p), func(b *testing.B) {
+				mcts := newTTTMCTS()
+				mcts.LockFree = lockFree
+				rngs, err := randx.NewPCGs(p)
+				if err != nil {
+					b.Fatalf("予期せぬエラー: %v", err)
+				}
+
+				for b.Loop() {
+					rootNode, err := mcts.NewNode(ttt.NewInitialState())
+					if err != nil {
+						b.Fatalf("予期せぬエラー: %v", err)
+					}
+					if _, err := mcts.Search(rootNode, simulations, rngs); err != nil {
+						b.Fatalf("予期せぬエラー: %v", err)
+					}
+				}
+				b.ReportMetric(float64(b.N*simulations)/b.Elapsed().Seconds(), "sims/s")
+			})
+		}
+	}
+}
+
 func TestNewPolicyValueFunc(t *testing.T) {
 	mcts := newTTTMCTS()
 	rngs, err := randx.NewPCGs(2)
@@ -142,6 +325,40 @@ func TestEngineValidate(t *testing.T) {
 			t.Fatal("エラーを期待したが、nilが返された")
 		}
 	})
+
+	t.Run("異常_FPUのModeが不正", func(t *testing.T) {
+		mcts := newTTTMCTS()
+		mcts.FPU = pucb.FPU{Mode: pucb.FPUMode(-1)}
+		if err := mcts.Validate(); !errors.Is(err, puct.ErrInvalidConfig) {
+			t.Errorf("エラーの不一致: got = %v, want = %v", err, puct.ErrInvalidConfig)
+		}
+	})
+
+	t.Run("異常_VirtualLossのScaleが0", func(t *testing.T) {
+		mcts := newTTTMCTS()
+		mcts.VirtualLoss = pucb.VirtualLoss{Mode: pucb.VirtualLossScaled}
+		if err := mcts.Validate(); !errors.Is(err, puct.ErrInvalidConfig) {
+			t.Errorf("エラーの不一致: got = %v, want = %v", err, puct.ErrInvalidConfig)
+		}
+	})
+
+	t.Run("異常_LockFreeとFPULoss", func(t *testing.T) {
+		mcts := newTTTMCTS()
+		mcts.LockFree = true
+		mcts.FPU = pucb.FPU{Mode: pucb.FPULoss}
+		if err := mcts.Validate(); !errors.Is(err, puct.ErrInvalidConfig) {
+			t.Errorf("エラーの不一致: got = %v, want = %v", err, puct.ErrInvalidConfig)
+		}
+	})
+
+	t.Run("異常_LockFreeとPUCBStatsFunc", func(t *testing.T) {
+		mcts := newTTTMCTS()
+		mcts.LockFree = true
+		mcts.PUCBStatsFunc = pucb.NewUCB1TunedFunc()
+		if err := mcts.Validate(); !errors.Is(err, puct.ErrInvalidConfig) {
+			t.Errorf("エラーの不一致: got = %v, want = %v", err, puct.ErrInvalidConfig)
+		}
+	})
 }
 
 // 終了しないゲームでも、MaxDepthを設定すれば探索が打ち切られる事を確認する。
@@ -217,3 +434,333 @@ func TestSearchMaxDepth(t *testing.T) {
 		t.Fatalf("予期せぬエラー: %v", err)
 	}
 }
+
+func TestSetSymmetryAveragedLeafNodeEval(t *testing.T) {
+	const k = 4
+	mcts := newTTTMCTS()
+	// 左上にCrossがあれば1、なければ0と評価する(対称変換で評価値が変わる)評価関数
+	mcts.LeafNodeEvalByAgentFunc = func(s ttt.State, rng *rand.Rand) (puct.LeafNodeEvalByAgent[ttt.Mark], error) {
+		var v float32
+		if s.Board[0][0] == ttt.Cross {
+			v = 1.0
+		}
+		return puct.LeafNodeEvalByAgent[ttt.Mark]{ttt.Cross: v, ttt.Nought: 1.0 - v}, nil
+	}
+
+	if err := mcts.SetSymmetryAveragedLeafNodeEval(ttt.SymmetryFuncs(), k); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	// 角にCrossが1つある局面。8つの対称変換のうち、左上にCrossが来るのは2つ
+	state := ttt.State{
+		Board: ttt.Board{
+			{ttt.Cross, ttt.EmptyMark, ttt.EmptyMark},
+			{ttt.EmptyMark, ttt.EmptyMark, ttt.EmptyMark},
+			{ttt.EmptyMark, ttt.EmptyMark, ttt.EmptyMark},
+		},
+		Turn: ttt.Nought,
+	}
+
+	rng := randx.NewPCG()
+	n := 2000
+	var sum float64
+	for range n {
+		evals, err := mcts.LeafNodeEvalByAgentFunc(state, rng)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		// 評価値はk個の平均なので、1/k刻みになるはず
+		scaled := float64(evals[ttt.Cross]) * k
+		if math.Abs(scaled-math.Round(scaled)) > 0.0001 {
+			t.Fatalf("評価値がk個の平均になっていない: got = %f", evals[ttt.Cross])
+		}
+
+		if math.Abs(float64(evals[ttt.Cross]+evals[ttt.Nought])-1.0) > 0.0001 {
+			t.Fatalf("評価値の合計の不一致: got = %f, want = 1.0", evals[ttt.Cross]+evals[ttt.Nought])
+		}
+		sum += float64(evals[ttt.Cross])
+	}
+
+	// 平均すると、左上にCrossが来る確率(2/8)に近付くはず
+	const eps = 0.03
+	avg := sum / float64(n)
+	if math.Abs(avg-0.25) > eps {
+		t.Errorf("評価値の平均の不一致: got = %.4f, want = 0.25(±%.3f)", avg, eps)
+	}
+
+	t.Run("異常_kが0", func(t *testing.T) {
+		mcts := newTTTMCTS()
+		if err := mcts.SetSymmetryAveragedLeafNodeEval(ttt.SymmetryFuncs(), 0); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_symmetryFuncsが空", func(t *testing.T) {
+		mcts := newTTTMCTS()
+		if err := mcts.SetSymmetryAveragedLeafNodeEval(nil, k); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+// 途中の報酬がある一人用ゲーム。2手で終了し、行動1を選ぶと報酬1を得る。
+type rewardState struct {
+	Depth int
+}
+
+func newRewardMCTS() puct.Engine[rewardState, int, string] {
+	gameEngine := sequential.Engine[rewardState, int, string]{
+		Rule: sequential.Rule[rewardState, int, string]{
+			LegalActionsFunc: func(rewardState) []int { return []int{0, 1} },
+			TransitionFunc: func(s rewardState, a int) (rewardState, error) {
+				return rewardState{Depth: s.Depth + 1}, nil
+			},
+			EqualFunc:        func(a, b rewardState) bool { return a == b },
+			CurrentAgentFunc: func(rewardState) string { return "A" },
+		},
+		RankByAgentFunc: func(s rewardState) (game.RankByAgent[string], error) {
+			if s.Depth < 2 {
+				return game.RankByAgent[string]{}, nil
+			}
+			return game.RankByAgent[string]{"A": 1}, nil
+		},
+		RewardFunc: func(s rewardState, a int, next rewardState) (game.RewardByAgent[string], error) {
+			return game.RewardByAgent[string]{"A": float32(a)}, nil
+		},
+		Agents: []string{"A"},
+	}
+	gameEngine.SetStandardResultScoreByAgentFunc()
+
+	mcts := puct.Engine[rewardState, int, string]{
+		Game:         gameEngine,
+		PUCBFunc:     pucb.NewAlphaGoFunc(1.25),
+		NextNodesCap: 1,
+	}
+	mcts.SetUniformPolicyFunc()
+	mcts.SetPlayout(sequential.NewRandomActorCritic[rewardState, int, string]())
+	return mcts
+}
+
+func TestSearchRewards(t *testing.T) {
+	mcts := newRewardMCTS()
+	rootNode, err := mcts.NewNode(rewardState{})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	rng := randx.NewPCG()
+	// ルートから見たリターンは、経路上の報酬の合計 + 結果スコア(1.0)
+	for range 100 {
+		evals, _, err := mcts.SelectExpansionBackward(rootNode, 0, rng)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if evals["A"] < 1.0 || evals["A"] > 3.0 {
+			t.Fatalf("リターンが範囲外: got = %f, want = [1.0, 3.0]", evals["A"])
+		}
+	}
+
+	selector := rootNode.VirtualSelector()
+	// 行動1は報酬1を得る分、行動0よりQ値が大きいはず
+	if selector[1].Q() <= selector[0].Q() {
+		t.Errorf("報酬のある行動のQ値が大きくない: Q(1) = %f, Q(0) = %f", selector[1].Q(), selector[0].Q())
+	}
+
+	// 行動1を選んだ後のQ値は、少なくとも報酬1 + 結果スコア1を含む
+	if selector[1].Q() < 2.0 {
+		t.Errorf("行動1のQ値に報酬が含まれていない: got = %f, want >= 2.0", selector[1].Q())
+	}
+}
+
+func TestNewPolicyValueStatsFunc(t *testing.T) {
+	mcts := newTTTMCTS()
+	rngs, err := randx.NewPCGs(2)
+	if err != nil {
+		panic(err)
+	}
+
+	simulations := 500
+	pvStatsFunc := mcts.NewPolicyValueStatsFunc(simulations, rngs)
+
+	state := ttt.NewInitialState()
+	legalActions := mcts.Game.Rule.LegalActionsFunc(state)
+
+	policy, value, stats, err := pvStatsFunc(state, legalActions)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if stats == nil {
+		t.Fatal("statsがnilです")
+	}
+
+	if stats.Simulations != simulations {
+		t.Errorf("Simulationsの不一致: got = %d, want = %d", stats.Simulations, simulations)
+	}
+
+	// 訪問回数の合計はシミュレーション回数と一致し、正規化すると方策と一致する
+	var sumVisits int
+	for _, n := range stats.VisitsByAction {
+		sumVisits += n
+	}
+	if sumVisits != simulations {
+		t.Errorf("訪問回数の合計の不一致: got = %d, want = %d", sumVisits, simulations)
+	}
+
+	visitPolicy, err := stats.VisitPolicy()
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	for _, a := range legalActions {
+		if math.Abs(float64(visitPolicy[a]-policy[a])) > 1e-5 {
+			t.Errorf("action %v: 訪問回数の分布と方策の不一致: got = %f, want = %f", a, visitPolicy[a], policy[a])
+		}
+		// 一様な方策関数なので、事前確率は全て 1/9
+		if math.Abs(float64(stats.PriorByAction[a])-1.0/9.0) > 1e-5 {
+			t.Errorf("action %v: 事前確率の不一致: got = %f, want = %f", a, stats.PriorByAction[a], 1.0/9.0)
+		}
+		if q := stats.QByAction[a]; q < 0.0 || q > 1.0 {
+			t.Errorf("action %v: Qが範囲外: got = %f", a, q)
+		}
+	}
+
+	if stats.RootValueByAgent[ttt.Cross] != value {
+		t.Errorf("ルートノードの価値の不一致: got = %f, want = %f", stats.RootValueByAgent[ttt.Cross], value)
+	}
+
+	// 探索の統計を記録しながら対局できる
+	accr := sequential.ActorCritic[ttt.State, ttt.Action, ttt.Mark]{
+		PolicyValueFunc:      pvStatsFunc.PolicyValueFunc(),
+		PolicyValueStatsFunc: mcts.NewPolicyValueStatsFunc(16, rngs),
+		SelectFunc:           game.WeightedRandomSelectFunc[ttt.Action, ttt.Mark],
+	}
+	engine := ttt.NewEngine()
+	records, err := engine.RecordPlayouts([]ttt.State{state}, accr, []*rand.Rand{randx.NewPCG()}, 9)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	for i, step := range records[0].Steps {
+		if step.SearchStats == nil || step.SearchStats.Simulations != 16 {
+			t.Errorf("Steps[%d]: 探索の統計が記録されていない", i)
+		}
+	}
+}
+
+// 報酬の桁が大きい一人用のゲーム。2手で終了する。
+// 1手目に行動0を選ぶと報酬60を得るが、2手目は何を選んでも報酬0。
+// 1手目に行動1を選ぶと報酬0だが、2手目に行動1を選ぶと報酬100を得る(最善は1→1の100)。
+// 1手目の行動1の後をランダムに進めた場合の報酬の期待値は50で、行動0の60より小さい為、
+// 1手目だけを見る探索は行動0を選び続けてしまう。
+type trapState struct {
+	Depth int
+	First int
+}
+
+func newTrapMCTS() puct.Engine[trapState, int, string] {
+	gameEngine := sequential.Engine[trapState, int, string]{
+		Rule: sequential.Rule[trapState, int, string]{
+			LegalActionsFunc: func(trapState) []int { return []int{0, 1} },
+			TransitionFunc: func(s trapState, a int) (trapState, error) {
+				if s.Depth == 0 {
+					return trapState{Depth: 1, First: a}, nil
+				}
+				return trapState{Depth: 2, First: s.First}, nil
+			},
+			EqualFunc:        func(a, b trapState) bool { return a == b },
+			CurrentAgentFunc: func(trapState) string { return "A" },
+		},
+		RankByAgentFunc: func(s trapState) (game.RankByAgent[string], error) {
+			if s.Depth < 2 {
+				return game.RankByAgent[string]{}, nil
+			}
+			return game.RankByAgent[string]{"A": 1}, nil
+		},
+		RewardFunc: func(s trapState, a int, next trapState) (game.RewardByAgent[string], error) {
+			var r float32
+			switch {
+			case s.Depth == 0 && a == 0:
+				r = 60
+			case s.Depth == 1 && s.First == 1 && a == 1:
+				r = 100
+			}
+			return game.RewardByAgent[string]{"A": r}, nil
+		},
+		Agents: []string{"A"},
+	}
+	gameEngine.SetStandardResultScoreByAgentFunc()
+
+	mcts := puct.Engine[trapState, int, string]{
+		Game:         gameEngine,
+		PUCBFunc:     pucb.NewAlphaGoFunc(1.25),
+		NextNodesCap: 1,
+	}
+	mcts.SetUniformPolicyFunc()
+	mcts.SetPlayout(sequential.NewRandomActorCritic[trapState, int, string]())
+	return mcts
+}
+
+func TestSearchSingleAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		valueFunc puct.SingleAgentValueFunc[trapState]
+		lockFree  bool
+	}{
+		{name: "正常_プレイアウト"},
+		{name: "正常_プレイアウト_LockFree", lockFree: true},
+		{
+			name: "正常_価値関数",
+			// 以降に得られる報酬の最大値 + 結果スコア(1.0)を返す価値関数
+			valueFunc: func(s trapState, _ *rand.Rand) (float32, error) {
+				if s.Depth == 1 && s.First == 1 {
+					return 101, nil
+				}
+				return 1, nil
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mcts := newTrapMCTS()
+			mcts.LockFree = tc.lockFree
+			if err := mcts.SetSingleAgent(tc.valueFunc); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			rootNode, err := mcts.NewNode(trapState{})
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			rngs, err := randx.NewPCGs(4)
+			if err != nil {
+				panic(err)
+			}
+
+			evals, err := mcts.Search(rootNode, 2000, rngs)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			selector := rootNode.VirtualSelector()
+			if selector[1].Visits() <= selector[0].Visits() {
+				t.Errorf("最善の行動が最も多く訪問されていない: visits(1) = %d, visits(0) = %d", selector[1].Visits(), selector[0].Visits())
+			}
+
+			// Q とルートの評価値は、正規化していない報酬の尺度のまま
+			if q := selector[1].Q(); q < 80 {
+				t.Errorf("行動1のQ値が低い: got = %f, want >= 80", q)
+			}
+			if evals["A"] < 60 {
+				t.Errorf("ルートの評価値が低い: got = %f, want >= 60", evals["A"])
+			}
+		})
+	}
+
+	t.Run("異常_エージェントが2体", func(t *testing.T) {
+		mcts := newTTTMCTS()
+		if err := mcts.SetSingleAgent(nil); !errors.Is(err, puct.ErrInvalidConfig) {
+			t.Errorf("エラーの不一致: got = %v, want = %v", err, puct.ErrInvalidConfig)
+		}
+	})
+}
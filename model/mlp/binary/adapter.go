@@ -0,0 +1,195 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/mcts/puct"
+	"github.com/sw965/omw/mathx/bitsx"
+)
+
+// StateEncoder は、ゲームの状態をモデルの入力(XRows x XCols のビット行列)に変換する。
+type StateEncoder[S any] interface {
+	Encode(S) (*bitsx.Matrix, error)
+}
+
+// StateEncoderFunc は、関数をStateEncoderとして扱う為のアダプタ。
+type StateEncoderFunc[S any] func(S) (*bitsx.Matrix, error)
+
+func (f StateEncoderFunc[S]) Encode(s S) (*bitsx.Matrix, error) {
+	return f(s)
+}
+
+// NewHiddenEncoder は、encoderの出力をTwoHeadModelの共有Backboneに通したものを返すStateEncoderを返す。
+// TwoHeadModelの各ヘッド(Model)を、NewPolicyFunc や NewLeafNodeEvalByAgentFunc に渡す為に使う。
+func NewHiddenEncoder[S any](model *TwoHeadModel, encoder StateEncoder[S]) StateEncoder[S] {
+	return StateEncoderFunc[S](func(state S) (*bitsx.Matrix, error) {
+		x, err := encoder.Encode(state)
+		if err != nil {
+			return nil, err
+		}
+		return model.Backbone.Predict(x)
+	})
+}
+
+// NewPolicyFunc は、分類モデル(出力クラス = codecのインデックス)を、合法手でマスクした方策を返す sequential.PolicyFunc に変換する。
+// モデルのクラス数は codec.Size() と一致するべき。
+func NewPolicyFunc[S any, Ac comparable](policyModel *Model, encoder StateEncoder[S], codec game.ActionCodec[Ac]) (sequential.PolicyFunc[S, Ac], error) {
+	if err := validatePolicyModel(policyModel, encoder, codec); err != nil {
+		return nil, err
+	}
+
+	return func(state S, legalActions []Ac) (game.Policy[Ac], error) {
+		x, err := encoder.Encode(state)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := policyModel.PredictSoftmax(x)
+		if err != nil {
+			return nil, err
+		}
+		return game.DecodePolicy(y, legalActions, codec)
+	}, nil
+}
+
+// validatePolicyModel は、分類モデルを方策に変換する為の引数を検証する。
+func validatePolicyModel[S any, Ac comparable](policyModel *Model, encoder StateEncoder[S], codec game.ActionCodec[Ac]) error {
+	if policyModel == nil {
+		return errors.New("policyModelがnilです")
+	}
+
+	if encoder == nil {
+		return errors.New("encoderがnilです")
+	}
+
+	if codec == nil {
+		return errors.New("codecがnilです")
+	}
+
+	if len(policyModel.Prototypes) != codec.Size() {
+		return fmt.Errorf("クラス数とcodec.Size()が不一致: len(Prototypes) = %d, codec.Size() = %d", len(policyModel.Prototypes), codec.Size())
+	}
+	return nil
+}
+
+// NewPolicyValueFunc は、分類モデルと回帰モデルを組み合わせて sequential.PolicyValueFunc に変換する。
+// 価値は、その状態で手番のエージェントから見た値(PredictValue)とする。状態のエンコードは1回だけ行い、両方のモデルで使う。
+func NewPolicyValueFunc[S any, Ac comparable](policyModel, valueModel *Model, encoder StateEncoder[S], codec game.ActionCodec[Ac]) (sequential.PolicyValueFunc[S, Ac], error) {
+	if err := validatePolicyModel(policyModel, encoder, codec); err != nil {
+		return nil, err
+	}
+
+	if valueModel == nil {
+		return nil, errors.New("valueModelがnilです")
+	}
+
+	return func(state S, legalActions []Ac) (game.Policy[Ac], float32, error) {
+		x, err := encoder.Encode(state)
+		if err != nil {
+			return nil, 0.0, err
+		}
+
+		y, err := policyModel.PredictSoftmax(x)
+		if err != nil {
+			return nil, 0.0, err
+		}
+
+		policy, err := game.DecodePolicy(y, legalActions, codec)
+		if err != nil {
+			return nil, 0.0, err
+		}
+
+		value, err := valueModel.PredictValue(x)
+		if err != nil {
+			return nil, 0.0, err
+		}
+		return policy, value, nil
+	}, nil
+}
+
+// NewLeafNodeEvalByAgentFunc は、回帰モデルを、エージェント毎のリーフノードの評価関数に変換する。
+// モデルは、その状態で手番のエージェント(currentAgentFunc)から見た結果スコアの期待値 v を予測する事を前提とする。
+// 他のエージェントには、結果スコアの合計が1になる様に (1 - v) / (len(agents) - 1) を割り当てる。
+// 二人ゲームで game.StandardResultScoreByAgentFunc を使う場合と同じ前提である。
+func NewLeafNodeEvalByAgentFunc[S any, Ag comparable](valueModel *Model, encoder StateEncoder[S], currentAgentFunc func(S) Ag, agents []Ag) (puct.LeafNodeEvalByAgentFunc[S, Ag], error) {
+	if valueModel == nil {
+		return nil, errors.New("valueModelがnilです")
+	}
+
+	if encoder == nil {
+		return nil, errors.New("encoderがnilです")
+	}
+
+	if currentAgentFunc == nil {
+		return nil, errors.New("currentAgentFuncがnilです")
+	}
+
+	if len(agents) == 0 {
+		return nil, errors.New("agentsが空です: len(agents) > 0 であるべき")
+	}
+
+	return func(state S, _ *rand.Rand) (puct.LeafNodeEvalByAgent[Ag], error) {
+		x, err := encoder.Encode(state)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := valueModel.PredictValue(x)
+		if err != nil {
+			return nil, err
+		}
+
+		current := currentAgentFunc(state)
+		evals := make(puct.LeafNodeEvalByAgent[Ag], len(agents))
+		for _, agent := range agents {
+			if agent == current {
+				evals[agent] = v
+			} else {
+				evals[agent] = (1.0 - v) / float32(len(agents)-1)
+			}
+		}
+		return evals, nil
+	}, nil
+}
+
+// NewTwoHeadPolicyValueFunc は、TwoHeadModelを sequential.PolicyValueFunc に変換する。
+// 方策と価値を、Backboneの1回の推論から求める。
+func NewTwoHeadPolicyValueFunc[S any, Ac comparable](model *TwoHeadModel, encoder StateEncoder[S], codec game.ActionCodec[Ac]) (sequential.PolicyValueFunc[S, Ac], error) {
+	if model == nil {
+		return nil, errors.New("modelがnilです")
+	}
+
+	if encoder == nil {
+		return nil, errors.New("encoderがnilです")
+	}
+
+	if codec == nil {
+		return nil, errors.New("codecがnilです")
+	}
+
+	if len(model.PolicyHead.Prototypes) != codec.Size() {
+		return nil, fmt.Errorf("クラス数とcodec.Size()が不一致: len(PolicyHead.Prototypes) = %d, codec.Size() = %d", len(model.PolicyHead.Prototypes), codec.Size())
+	}
+
+	return func(state S, legalActions []Ac) (game.Policy[Ac], float32, error) {
+		x, err := encoder.Encode(state)
+		if err != nil {
+			return nil, 0.0, err
+		}
+
+		y, value, err := model.Predict(x)
+		if err != nil {
+			return nil, 0.0, err
+		}
+
+		policy, err := game.DecodePolicy(y, legalActions, codec)
+		if err != nil {
+			return nil, 0.0, err
+		}
+		return policy, value, nil
+	}, nil
+}
@@ -9,7 +9,11 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/sw965/crow/internal/ttt"
+	"github.com/sw965/crow/mcts/muzero"
+	"github.com/sw965/crow/mcts/puct"
 	"github.com/sw965/crow/model/mlp/binary"
+	"github.com/sw965/crow/pucb"
 	"github.com/sw965/omw/mathx/bitsx"
 )
 
@@ -520,3 +524,441 @@ func TestModelEvaluation_InvalidSize(t *testing.T) {
 		})
 	}
 }
+
+// newTTTModels は、三目並べ用の方策モデル(9クラス)と価値モデル(回帰)を返す。
+func newTTTModels(t *testing.T) (binary.Model, binary.Model) {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	policyModel := binary.Model{XRows: ttt.EncodedRows, XCols: ttt.EncodedCols}
+	if err := policyModel.AppendDenseLayer(32, rng); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if err := policyModel.SetClassPrototypes(9, rng); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	valueModel := binary.Model{XRows: ttt.EncodedRows, XCols: ttt.EncodedCols}
+	if err := valueModel.AppendDenseLayer(32, rng); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if err := valueModel.SetRegressionPrototypes(8); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if err := valueModel.SetSigmoidValues(); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	return policyModel, valueModel
+}
+
+func TestAdapters(t *testing.T) {
+	policyModel, valueModel := newTTTModels(t)
+	encoder := binary.StateEncoderFunc[ttt.State](ttt.EncodeState)
+	codec := ttt.NewActionCodec()
+	engine := ttt.NewEngine()
+
+	state, err := engine.Rule.TransitionFunc(ttt.NewInitialState(), ttt.Action{Row: 1, Col: 1})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	legalActions := engine.Rule.LegalActionsFunc(state)
+
+	t.Run("正常_PolicyValueFunc", func(t *testing.T) {
+		pvFunc, err := binary.NewPolicyValueFunc(&policyModel, &valueModel, encoder, codec)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		policy, value, err := pvFunc(state, legalActions)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		// 合法手のみの確率分布になる
+		if err := policy.ValidateForLegalActions(legalActions, true); err != nil {
+			t.Errorf("予期せぬエラー: %v", err)
+		}
+		if math.Abs(float64(policy.Sum()-1.0)) > 0.0001 {
+			t.Errorf("policyの合計の不一致: got = %f, want = 1.0", policy.Sum())
+		}
+
+		if value < 0.0 || value > 1.0 {
+			t.Errorf("価値が範囲外: got = %f, want = [0.0, 1.0]", value)
+		}
+	})
+
+	t.Run("正常_PolicyValueFuncのエンコードは1回", func(t *testing.T) {
+		calls := 0
+		countingEncoder := binary.StateEncoderFunc[ttt.State](func(s ttt.State) (*bitsx.Matrix, error) {
+			calls++
+			return ttt.EncodeState(s)
+		})
+
+		pvFunc, err := binary.NewPolicyValueFunc(&policyModel, &valueModel, countingEncoder, codec)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		if _, _, err := pvFunc(state, legalActions); err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("エンコードの回数の不一致: got = %d, want = 1", calls)
+		}
+	})
+
+	t.Run("正常_LeafNodeEvalByAgentFuncの合計は1", func(t *testing.T) {
+		evalFunc, err := binary.NewLeafNodeEvalByAgentFunc(&valueModel, encoder, engine.Rule.CurrentAgentFunc, engine.Agents)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		evals, err := evalFunc(state, nil)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if len(evals) != 2 {
+			t.Fatalf("len(evals)の不一致: got = %d, want = 2", len(evals))
+		}
+		if sum := evals[ttt.Cross] + evals[ttt.Nought]; math.Abs(float64(sum-1.0)) > 0.0001 {
+			t.Errorf("評価値の合計の不一致: got = %f, want = 1.0", sum)
+		}
+	})
+
+	t.Run("正常_探索で使える", func(t *testing.T) {
+		policyFunc, err := binary.NewPolicyFunc(&policyModel, encoder, codec)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		evalFunc, err := binary.NewLeafNodeEvalByAgentFunc(&valueModel, encoder, engine.Rule.CurrentAgentFunc, engine.Agents)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		mcts := puct.Engine[ttt.State, ttt.Action, ttt.Mark]{
+			Game:                    engine,
+			PUCBFunc:                pucb.NewAlphaGoFunc(1.25),
+			NextNodesCap:            9,
+			VirtualValue:            0.5,
+			PolicyFunc:              policyFunc,
+			LeafNodeEvalByAgentFunc: evalFunc,
+		}
+
+		rngs := []*rand.Rand{rand.New(rand.NewPCG(3, 4))}
+		policy, _, err := mcts.NewPolicyValueFunc(100, rngs)(state, legalActions)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if err := policy.ValidateForLegalActions(legalActions, true); err != nil {
+			t.Errorf("予期せぬエラー: %v", err)
+		}
+	})
+
+	t.Run("異常_クラス数とcodecの不一致", func(t *testing.T) {
+		if _, err := binary.NewPolicyFunc(&valueModel, encoder, codec); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_nilのモデル", func(t *testing.T) {
+		if _, err := binary.NewLeafNodeEvalByAgentFunc(nil, encoder, engine.Rule.CurrentAgentFunc, engine.Agents); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+// newTestTwoHeadModel は、テスト用の小さな二頭モデル(入力1x64, 共有層32, 各ヘッドの層32, 方策4クラス, 価値8段階)を返す。
+func newTestTwoHeadModel(t *testing.T) (binary.TwoHeadModel, *rand.Rand) {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	model := binary.TwoHeadModel{XRows: 1, XCols: 64}
+	if err := model.AppendDenseLayer(32, rng); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if err := model.SetPolicyHead(32, 4, rng); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if err := model.SetValueHead(32, 8, 0.0, 1.0, rng); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	return model, rng
+}
+
+func TestTwoHeadModelPredict(t *testing.T) {
+	model, rng := newTestTwoHeadModel(t)
+	x := newTestInput(t, rng)
+
+	policy, value, err := model.Predict(x)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if len(policy) != 4 {
+		t.Fatalf("len(policy)の不一致: got = %d, want = 4", len(policy))
+	}
+
+	if value < 0.0 || value > 1.0 {
+		t.Errorf("値が範囲外: got = %f, want = [0.0, 1.0]", value)
+	}
+
+	t.Run("正常_保存と読み込みで出力が一致", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "twohead.gob")
+		if err := model.Save(path); err != nil {
+			t.Fatalf("保存失敗: %v", err)
+		}
+
+		loaded, err := binary.LoadTwoHeadModel(path)
+		if err != nil {
+			t.Fatalf("読み込み失敗: %v", err)
+		}
+
+		gotPolicy, gotValue, err := loaded.Predict(x)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if !slices.Equal(gotPolicy, policy) || gotValue != value {
+			t.Errorf("出力の不一致: got = (%v, %f), want = (%v, %f)", gotPolicy, gotValue, policy, value)
+		}
+	})
+}
+
+func TestTwoHeadTrainer(t *testing.T) {
+	t.Run("異常_ハイパーパラメータが未設定", func(t *testing.T) {
+		model, _ := newTestTwoHeadModel(t)
+		trainer, err := binary.NewTwoHeadTrainer(model, 1)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		err = trainer.Validate()
+		if err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+		if !strings.Contains(err.Error(), "sharedHyperparameters") {
+			t.Errorf("エラーメッセージの不一致: got = %v", err)
+		}
+	})
+
+	t.Run("異常_ラベルの長さの不一致", func(t *testing.T) {
+		model, rng := newTestTwoHeadModel(t)
+		ctx := binary.NewSharedHyperparameters()
+		if err := model.SetSharedHyperparameters(&ctx); err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		trainer, err := binary.NewTwoHeadTrainer(model, 1)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		xs := bitsx.Matrices{newTestInput(t, rng)}
+		if err := trainer.Train(xs, []int{0}, []int{}); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("性質_両ヘッドのターゲットに近付く", func(t *testing.T) {
+		model, rng := newTestTwoHeadModel(t)
+		ctx := binary.NewSharedHyperparameters()
+		if err := model.SetSharedHyperparameters(&ctx); err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		n := 8
+		xs := make(bitsx.Matrices, n)
+		policyLabels := make([]int, n)
+		valueLabels := make([]int, n)
+		for i := range n {
+			xs[i] = newTestInput(t, rng)
+			policyLabels[i] = i % 4
+			valueLabels[i] = (i * 3) % 8
+		}
+
+		trainer, err := binary.NewTwoHeadTrainer(model, 2)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		trainer.MiniBatchSize = n
+
+		lossBefore, err := model.ValueHead.Loss(hiddens(t, model, xs), valueLabels, 1)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		for range 200 {
+			if err := trainer.Train(xs, policyLabels, valueLabels); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+		}
+
+		hs := hiddens(t, model, xs)
+		acc, err := model.PolicyHead.Accuracy(hs, policyLabels, 1)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		lossAfter, err := model.ValueHead.Loss(hs, valueLabels, 1)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		t.Logf("方策の精度 = %.3f, 価値の損失 = %.4f -> %.4f", acc, lossBefore, lossAfter)
+
+		// 8サンプル4クラスの記憶なので、チャンスレート(0.25)より十分高くなるはず
+		if acc < 0.75 {
+			t.Errorf("方策の精度が低い: got = %.3f, want >= 0.75", acc)
+		}
+		if lossAfter >= lossBefore {
+			t.Errorf("価値の損失が減っていない: before = %.4f, after = %.4f", lossBefore, lossAfter)
+		}
+	})
+}
+
+// hiddens は、各入力に対する共有Backboneの出力を返す。
+func hiddens(t *testing.T, model binary.TwoHeadModel, xs bitsx.Matrices) bitsx.Matrices {
+	t.Helper()
+	hs := make(bitsx.Matrices, len(xs))
+	for i, x := range xs {
+		h, err := model.Backbone.Predict(x)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		hs[i] = h
+	}
+	return hs
+}
+
+// newTTTLatentModel は、三目並べ用の LatentModel(隠れ状態1x32, 方策9クラス, 価値・報酬8段階)を返す。
+func newTTTLatentModel(t *testing.T) *binary.LatentModel[ttt.State, ttt.Action, ttt.Mark] {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(1, 2))
+	codec := ttt.NewActionCodec()
+	engine := ttt.NewEngine()
+
+	representation := binary.Model{XRows: ttt.EncodedRows, XCols: ttt.EncodedCols}
+	if err := representation.AppendDenseLayer(32, rng); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	transition := binary.Model{XRows: 1, XCols: 32 + codec.Size()}
+	if err := transition.AppendDenseLayer(32, rng); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	reward := binary.Model{XRows: 1, XCols: 32}
+	if err := reward.SetRegressionPrototypes(8); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if err := reward.SetSigmoidValues(); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	prediction := binary.TwoHeadModel{XRows: 1, XCols: 32}
+	if err := prediction.SetPolicyHead(32, codec.Size(), rng); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if err := prediction.SetValueHead(32, 8, 0.0, 1.0, rng); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	return &binary.LatentModel[ttt.State, ttt.Action, ttt.Mark]{
+		Encoder:          binary.StateEncoderFunc[ttt.State](ttt.EncodeState),
+		Codec:            codec,
+		Representation:   representation.Backbone,
+		Transition:       transition.Backbone,
+		Reward:           &reward,
+		Prediction:       &prediction,
+		CurrentAgentFunc: engine.Rule.CurrentAgentFunc,
+		NextAgentFunc: func(m ttt.Mark) ttt.Mark {
+			if m == ttt.Cross {
+				return ttt.Nought
+			}
+			return ttt.Cross
+		},
+		Agents: engine.Agents,
+	}
+}
+
+func TestLatentModel(t *testing.T) {
+	model := newTTTLatentModel(t)
+	if err := model.Validate(); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	state := ttt.NewInitialState()
+
+	t.Run("正常_隠れ状態の遷移", func(t *testing.T) {
+		h, err := model.Represent(state)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if h.Agent != ttt.Cross {
+			t.Errorf("手番の不一致: got = %v, want = %v", h.Agent, ttt.Cross)
+		}
+
+		next, reward, err := model.Dynamics(h, ttt.Action{Row: 1, Col: 1})
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if next.X.Rows() != h.X.Rows() || next.X.Cols() != h.X.Cols() {
+			t.Errorf("隠れ状態の形状の不一致: got = %dx%d, want = %dx%d", next.X.Rows(), next.X.Cols(), h.X.Rows(), h.X.Cols())
+		}
+		if next.Agent != ttt.Nought {
+			t.Errorf("手番の不一致: got = %v, want = %v", next.Agent, ttt.Nought)
+		}
+		// 報酬は行動したエージェントだけに与える
+		if _, ok := reward[ttt.Cross]; !ok || len(reward) != 1 {
+			t.Errorf("報酬の不一致: got = %v", reward)
+		}
+
+		prediction, err := model.Predict(next)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if len(prediction.Policy) != 9 {
+			t.Errorf("len(Policy)の不一致: got = %d, want = 9", len(prediction.Policy))
+		}
+		if sum := prediction.ValueByAgent[ttt.Cross] + prediction.ValueByAgent[ttt.Nought]; math.Abs(float64(sum-1.0)) > 0.0001 {
+			t.Errorf("価値の合計の不一致: got = %f, want = 1.0", sum)
+		}
+	})
+
+	t.Run("正常_探索で使える", func(t *testing.T) {
+		engine := ttt.NewEngine()
+		mcts := muzero.Engine[ttt.State, binary.LatentState[ttt.Mark], ttt.Action, ttt.Mark]{
+			Model:            model,
+			Actions:          engine.Rule.LegalActionsFunc(state),
+			LegalActionsFunc: engine.Rule.LegalActionsFunc,
+			Agents:           engine.Agents,
+			PUCBFunc:         pucb.NewAlphaGoFunc(1.25),
+			VirtualValue:     0.5,
+		}
+
+		rngs := []*rand.Rand{rand.New(rand.NewPCG(3, 4))}
+		root, err := mcts.NewNode(state)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if _, err := mcts.Search(root, 100, rngs); err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if sum := root.VirtualSelector().SumVisits(); sum != 100 {
+			t.Errorf("訪問回数の合計の不一致: got = %d, want = 100", sum)
+		}
+	})
+
+	t.Run("異常_Transitionの出力形状が不一致", func(t *testing.T) {
+		broken := *model
+		broken.Transition = nil
+		h, err := broken.Represent(state)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if _, _, err := broken.Dynamics(h, ttt.Action{Row: 0, Col: 0}); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_Codecがnil", func(t *testing.T) {
+		broken := *model
+		broken.Codec = nil
+		if err := broken.Validate(); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
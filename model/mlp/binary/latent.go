@@ -0,0 +1,182 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/mcts/muzero"
+	"github.com/sw965/omw/mathx/bitsx"
+)
+
+// LatentState は、LatentModel の隠れ状態。
+type LatentState[Ag comparable] struct {
+	X *bitsx.Matrix
+	// Agent は、この隠れ状態で行動を選ぶエージェント。
+	Agent Ag
+}
+
+// LatentModel は、ビット演算の層で muzero.Model を実装したモデル。
+// 隠れ状態で手番は予測せず、Represent で CurrentAgentFunc から求め、Dynamics 毎に NextAgentFunc で進める。
+type LatentModel[S any, Ac, Ag comparable] struct {
+	Encoder StateEncoder[S]
+	Codec   game.ActionCodec[Ac]
+	// Representation は、Encoder の出力を隠れ状態(HRows x HCols)に変換する。
+	Representation Sequence
+	// Transition は、隠れ状態の各行の後ろに行動の one-hot(Codec.Size() 列)を連結した行列を、次の隠れ状態に変換する。
+	// 出力の形状は、隠れ状態と同じであるべき。
+	Transition Sequence
+	// Reward は、次の隠れ状態から、行動したエージェントが得た報酬を予測する。nil の場合、報酬は無いものとする。
+	Reward *Model
+	// Prediction は、隠れ状態から方策(クラス = Codec のインデックス)と価値を予測する。
+	Prediction       *TwoHeadModel
+	CurrentAgentFunc func(S) Ag
+	NextAgentFunc    func(Ag) Ag
+	Agents           []Ag
+}
+
+func (m *LatentModel[S, Ac, Ag]) Validate() error {
+	if m.Encoder == nil {
+		return errors.New("Encoderがnilです")
+	}
+
+	if m.Codec == nil {
+		return errors.New("Codecがnilです")
+	}
+
+	if m.Prediction == nil {
+		return errors.New("Predictionがnilです")
+	}
+
+	if len(m.Prediction.PolicyHead.Prototypes) != m.Codec.Size() {
+		return fmt.Errorf("クラス数とCodec.Size()が不一致: len(Prediction.PolicyHead.Prototypes) = %d, Codec.Size() = %d", len(m.Prediction.PolicyHead.Prototypes), m.Codec.Size())
+	}
+
+	if m.CurrentAgentFunc == nil {
+		return errors.New("CurrentAgentFuncがnilです")
+	}
+
+	if m.NextAgentFunc == nil {
+		return errors.New("NextAgentFuncがnilです")
+	}
+
+	if len(m.Agents) == 0 {
+		return errors.New("Agentsが空です: len(Agents) > 0 であるべき")
+	}
+	return nil
+}
+
+func (m *LatentModel[S, Ac, Ag]) Represent(state S) (LatentState[Ag], error) {
+	x, err := m.Encoder.Encode(state)
+	if err != nil {
+		return LatentState[Ag]{}, err
+	}
+
+	h, err := m.Representation.Predict(x)
+	if err != nil {
+		return LatentState[Ag]{}, err
+	}
+	return LatentState[Ag]{X: h, Agent: m.CurrentAgentFunc(state)}, nil
+}
+
+func (m *LatentModel[S, Ac, Ag]) Dynamics(h LatentState[Ag], action Ac) (LatentState[Ag], game.RewardByAgent[Ag], error) {
+	idx, err := m.Codec.Index(action)
+	if err != nil {
+		return LatentState[Ag]{}, nil, err
+	}
+
+	x, err := appendOneHotCols(h.X, idx, m.Codec.Size())
+	if err != nil {
+		return LatentState[Ag]{}, nil, err
+	}
+
+	next, err := m.Transition.Predict(x)
+	if err != nil {
+		return LatentState[Ag]{}, nil, err
+	}
+
+	if next.Rows() != h.X.Rows() || next.Cols() != h.X.Cols() {
+		return LatentState[Ag]{}, nil, fmt.Errorf("Transitionの出力形状が隠れ状態と不一致: got = %dx%d, want = %dx%d", next.Rows(), next.Cols(), h.X.Rows(), h.X.Cols())
+	}
+
+	var reward game.RewardByAgent[Ag]
+	if m.Reward != nil {
+		r, err := m.Reward.PredictValue(next)
+		if err != nil {
+			return LatentState[Ag]{}, nil, err
+		}
+		reward = game.RewardByAgent[Ag]{h.Agent: r}
+	}
+	return LatentState[Ag]{X: next, Agent: m.NextAgentFunc(h.Agent)}, reward, nil
+}
+
+// Predict は、隠れ状態の方策と価値を返す。
+// 価値は、手番のエージェントから見た値 v とし、他のエージェントには (1 - v) / (len(Agents) - 1) を割り当てる。
+// NewLeafNodeEvalByAgentFunc と同じ前提である。
+func (m *LatentModel[S, Ac, Ag]) Predict(h LatentState[Ag]) (muzero.Prediction[Ac, Ag], error) {
+	y, v, err := m.Prediction.Predict(h.X)
+	if err != nil {
+		return muzero.Prediction[Ac, Ag]{}, err
+	}
+
+	if len(y) != m.Codec.Size() {
+		return muzero.Prediction[Ac, Ag]{}, fmt.Errorf("出力ベクトルの長さが不一致: len(y) = %d, Codec.Size() = %d", len(y), m.Codec.Size())
+	}
+
+	policy := make(game.Policy[Ac], len(y))
+	for i, p := range y {
+		action, err := m.Codec.Decode(i)
+		if err != nil {
+			return muzero.Prediction[Ac, Ag]{}, err
+		}
+		policy[action] = p
+	}
+
+	valueByAgent := make(map[Ag]float32, len(m.Agents))
+	for _, agent := range m.Agents {
+		if agent == h.Agent {
+			valueByAgent[agent] = v
+		} else {
+			valueByAgent[agent] = (1.0 - v) / float32(len(m.Agents)-1)
+		}
+	}
+
+	return muzero.Prediction[Ac, Ag]{
+		Agent:        h.Agent,
+		Policy:       policy,
+		ValueByAgent: valueByAgent,
+	}, nil
+}
+
+// appendOneHotCols は、x の各行の後ろに、idx 列目だけが1の size 列を連結した行列を返す。
+func appendOneHotCols(x *bitsx.Matrix, idx, size int) (*bitsx.Matrix, error) {
+	if idx < 0 || idx >= size {
+		return nil, fmt.Errorf("idxが不正: idx = %d: 0 <= idx < %d であるべき", idx, size)
+	}
+
+	rows, cols := x.Rows(), x.Cols()
+	y, err := bitsx.NewZerosMatrix(rows, cols+size)
+	if err != nil {
+		return nil, err
+	}
+
+	for r := range rows {
+		for c := range cols {
+			bit, err := x.Bit(r, c)
+			if err != nil {
+				return nil, err
+			}
+
+			if bit == 1 {
+				if err := y.Set(r, c); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if err := y.Set(r, cols+idx); err != nil {
+			return nil, err
+		}
+	}
+	return y, nil
+}
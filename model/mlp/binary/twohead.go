@@ -0,0 +1,421 @@
+package binary
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+
+	"github.com/sw965/omw/encoding/gobx"
+	"github.com/sw965/omw/mathx/bitsx"
+	"github.com/sw965/omw/mathx/randx"
+	"github.com/sw965/omw/parallel"
+	"github.com/sw965/omw/slicesx"
+)
+
+// TwoHeadModel は、共有のBackboneの出力を、方策ヘッド(分類)と価値ヘッド(回帰)の2つのModelへ入力するモデル。
+// 各ヘッドのXRows, XColsはBackboneの出力形状で、ヘッド固有の層(ヘッドのBackbone)は空でもよい。
+// MCTSの様に、同じ状態に対して方策と価値の両方を求める場合、Backboneの推論が1回で済む。
+type TwoHeadModel struct {
+	Backbone   Sequence
+	PolicyHead Model
+	ValueHead  Model
+	XRows      int
+	XCols      int
+}
+
+func LoadTwoHeadModel(path string) (TwoHeadModel, error) {
+	return gobx.Load[TwoHeadModel](path)
+}
+
+func (m *TwoHeadModel) Save(path string) error {
+	return gobx.Save(m, path)
+}
+
+// Clone はモデルの深いコピーを返す。
+// gob経由でコピーするため、各層の sharedHyperparameters は引き継がれない。
+func (m *TwoHeadModel) Clone() (TwoHeadModel, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m); err != nil {
+		return TwoHeadModel{}, err
+	}
+	var c TwoHeadModel
+	if err := gob.NewDecoder(&buf).Decode(&c); err != nil {
+		return TwoHeadModel{}, err
+	}
+	return c, nil
+}
+
+// AppendDenseLayer は、共有のBackboneに層を追加する。ヘッドを設定する前に呼ぶ事。
+func (m *TwoHeadModel) AppendDenseLayer(wRows int, rng *rand.Rand) error {
+	backbone := Model{Backbone: m.Backbone, XRows: m.XRows, XCols: m.XCols}
+	if err := backbone.AppendDenseLayer(wRows, rng); err != nil {
+		return err
+	}
+	m.Backbone = backbone.Backbone
+	return nil
+}
+
+// newHead は、入力がBackboneの出力形状で、wRows > 0 の場合にヘッド固有の層を1つ持つModelを返す。
+func (m *TwoHeadModel) newHead(wRows int, rng *rand.Rand) (Model, error) {
+	hRows, hCols, err := m.Backbone.OutputShape(m.XRows, m.XCols)
+	if err != nil {
+		return Model{}, err
+	}
+
+	head := Model{XRows: hRows, XCols: hCols}
+	if wRows > 0 {
+		if err := head.AppendDenseLayer(wRows, rng); err != nil {
+			return Model{}, err
+		}
+	}
+	return head, nil
+}
+
+// SetPolicyHead は、ETFプロトタイプで numClasses クラスに分類する方策ヘッドを設定する。
+// wRows > 0 の場合は、ヘッド固有の層(出力の列数 wRows)を1つ挟む。
+func (m *TwoHeadModel) SetPolicyHead(wRows, numClasses int, rng *rand.Rand) error {
+	head, err := m.newHead(wRows, rng)
+	if err != nil {
+		return err
+	}
+
+	if err := head.SetClassPrototypes(numClasses, rng); err != nil {
+		return err
+	}
+	m.PolicyHead = head
+	return nil
+}
+
+// SetValueHead は、温度計プロトタイプで [minVal, maxVal] を numValues 段階で表す価値ヘッドを設定する。
+// wRows > 0 の場合は、ヘッド固有の層(出力の列数 wRows)を1つ挟む。
+func (m *TwoHeadModel) SetValueHead(wRows, numValues int, minVal, maxVal float32, rng *rand.Rand) error {
+	head, err := m.newHead(wRows, rng)
+	if err != nil {
+		return err
+	}
+
+	if err := head.SetRegressionPrototypes(numValues); err != nil {
+		return err
+	}
+
+	if err := head.SetValues(minVal, maxVal); err != nil {
+		return err
+	}
+	m.ValueHead = head
+	return nil
+}
+
+// SetSharedHyperparameters は、Backboneと両ヘッドの全ての層にハイパーパラメータを設定する。
+// gobでロードした後は、学習前に呼ぶ必要がある。
+func (m *TwoHeadModel) SetSharedHyperparameters(ctx *SharedHyperparameters) error {
+	for _, seq := range []Sequence{m.Backbone, m.PolicyHead.Backbone, m.ValueHead.Backbone} {
+		if err := seq.SetSharedHyperparameters(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Predict は、方策ヘッドのsoftmax出力と、価値ヘッドの予測値を返す。Backboneの推論は1回のみ。
+func (m *TwoHeadModel) Predict(x *bitsx.Matrix) ([]float32, float32, error) {
+	h, err := m.Backbone.Predict(x)
+	if err != nil {
+		return nil, 0.0, err
+	}
+
+	policy, err := m.PolicyHead.PredictSoftmax(h)
+	if err != nil {
+		return nil, 0.0, err
+	}
+
+	value, err := m.ValueHead.PredictValue(h)
+	if err != nil {
+		return nil, 0.0, err
+	}
+	return policy, value, nil
+}
+
+// twoHeadDelta は、Backboneと両ヘッドの層の更新量。
+type twoHeadDelta struct {
+	backbone SeqDelta
+	policy   SeqDelta
+	value    SeqDelta
+}
+
+func newZerosSeqDelta(seq Sequence) SeqDelta {
+	sd := make(SeqDelta, len(seq))
+	for l, layer := range seq {
+		sd[l] = layer.NewZerosDeltas()
+	}
+	return sd
+}
+
+func newZerosTwoHeadDelta(m TwoHeadModel) twoHeadDelta {
+	return twoHeadDelta{
+		backbone: newZerosSeqDelta(m.Backbone),
+		policy:   newZerosSeqDelta(m.PolicyHead.Backbone),
+		value:    newZerosSeqDelta(m.ValueHead.Backbone),
+	}
+}
+
+func (d twoHeadDelta) clear() {
+	d.backbone.Clear()
+	d.policy.Clear()
+	d.value.Clear()
+}
+
+func (d twoHeadDelta) add(other twoHeadDelta) error {
+	if err := d.backbone.Add(other.backbone); err != nil {
+		return err
+	}
+	if err := d.policy.Add(other.policy); err != nil {
+		return err
+	}
+	return d.value.Add(other.value)
+}
+
+func (d twoHeadDelta) sign() {
+	d.backbone.Sign()
+	d.policy.Sign()
+	d.value.Sign()
+}
+
+// TwoHeadTrainer は、TwoHeadModelを、方策と価値の両方のターゲットでBEPにより同時に学習する。
+// Backboneの更新量は、両ヘッドから逆伝播したターゲットによる更新量の合計の符号になる。
+type TwoHeadTrainer struct {
+	MiniBatchSize int
+	LR            float32
+	// Margin は Trainer.Margin と同じ(両ヘッド共通)。
+	Margin float32
+
+	model           TwoHeadModel
+	workerRNGs      []*rand.Rand
+	shuffleRNG      *rand.Rand
+	workerDeltas    []twoHeadDelta
+	aggregatedDelta twoHeadDelta
+}
+
+func NewTwoHeadTrainer(model TwoHeadModel, p int) (*TwoHeadTrainer, error) {
+	workerCount := max(p, 0)
+	workerDeltas := make([]twoHeadDelta, workerCount)
+	for i := range workerCount {
+		workerDeltas[i] = newZerosTwoHeadDelta(model)
+	}
+
+	workerRNGs, err := randx.NewPCGs(workerCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TwoHeadTrainer{
+		MiniBatchSize:   128,
+		LR:              defaultLR,
+		Margin:          defaultMargin,
+		model:           model,
+		workerRNGs:      workerRNGs,
+		shuffleRNG:      randx.NewPCG(),
+		workerDeltas:    workerDeltas,
+		aggregatedDelta: newZerosTwoHeadDelta(model),
+	}, nil
+}
+
+func validateSharedHyperparameters(seq Sequence) error {
+	for i, layer := range seq {
+		if d, ok := layer.(*Dense); ok && d.sharedHyperparameters == nil {
+			return fmt.Errorf("layer %d: sharedHyperparameters が未設定です。学習前に SetSharedHyperparameters を呼んでください", i)
+		}
+	}
+	return nil
+}
+
+func (t *TwoHeadTrainer) Validate() error {
+	if len(t.model.Backbone) == 0 {
+		return errors.New("model validation: Backboneが空です: 学習前に1層以上追加するべき")
+	}
+
+	if len(t.model.PolicyHead.Prototypes) == 0 {
+		return errors.New("方策ヘッドのprototypesが未設定です: 学習前にSetPolicyHeadで設定するべき")
+	}
+
+	if len(t.model.ValueHead.Prototypes) == 0 {
+		return errors.New("価値ヘッドのprototypesが未設定です: 学習前にSetValueHeadで設定するべき")
+	}
+
+	if t.LR <= 0.0 {
+		return fmt.Errorf("LRが不正(LR <= 0): LR = %g: LR > 0 であるべき", t.LR)
+	}
+
+	if len(t.workerRNGs) == 0 {
+		return errors.New("workerRNGsが空です: NewTwoHeadTrainerのpは1以上であるべき")
+	}
+
+	if err := t.model.ValueHead.validateAscendingValues(); err != nil {
+		return err
+	}
+
+	if err := validateSharedHyperparameters(t.model.Backbone); err != nil {
+		return fmt.Errorf("Backbone: %w", err)
+	}
+
+	if err := validateSharedHyperparameters(t.model.PolicyHead.Backbone); err != nil {
+		return fmt.Errorf("PolicyHead: %w", err)
+	}
+
+	if err := validateSharedHyperparameters(t.model.ValueHead.Backbone); err != nil {
+		return fmt.Errorf("ValueHead: %w", err)
+	}
+	return nil
+}
+
+// Train は、xs[i] に対する方策のラベル(行動のインデックス) policyLabels[i] と、
+// 価値のラベル(ValueHead.ValueToLabel で求めたインデックス) valueLabels[i] で1エポック学習する。
+func (t *TwoHeadTrainer) Train(xs bitsx.Matrices, policyLabels, valueLabels []int) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	batchSize := t.MiniBatchSize
+	if batchSize <= 0 {
+		return fmt.Errorf("MiniBatchSizeが不正(MiniBatchSize <= 0): MiniBatchSize = %d: 1以上であるべき", batchSize)
+	}
+
+	n := len(xs)
+	if n != len(policyLabels) || n != len(valueLabels) {
+		return fmt.Errorf("長さが不一致: len(xs) = %d, len(policyLabels) = %d, len(valueLabels) = %d", n, len(policyLabels), len(valueLabels))
+	}
+
+	if n < batchSize {
+		batchSize = n
+	}
+
+	shuffledIdxs := t.shuffleRNG.Perm(n)
+	for i := 0; i < n; i += batchSize {
+		end := min(i+batchSize, n)
+		batchIdxs := shuffledIdxs[i:end]
+
+		batchXs, err := slicesx.ElementsByIndices(xs, batchIdxs...)
+		if err != nil {
+			return err
+		}
+
+		batchPolicyLabels, err := slicesx.ElementsByIndices(policyLabels, batchIdxs...)
+		if err != nil {
+			return err
+		}
+
+		batchValueLabels, err := slicesx.ElementsByIndices(valueLabels, batchIdxs...)
+		if err != nil {
+			return err
+		}
+
+		delta, err := t.computeSignDelta(batchXs, batchPolicyLabels, batchValueLabels)
+		if err != nil {
+			return err
+		}
+
+		if err := t.model.Backbone.Update(delta.backbone, t.LR, t.workerRNGs); err != nil {
+			return err
+		}
+
+		// ヘッド固有の層が無い場合は、プロトタイプのみのヘッドなので更新しない
+		if len(t.model.PolicyHead.Backbone) > 0 {
+			if err := t.model.PolicyHead.Backbone.Update(delta.policy, t.LR, t.workerRNGs); err != nil {
+				return err
+			}
+		}
+
+		if len(t.model.ValueHead.Backbone) > 0 {
+			if err := t.model.ValueHead.Backbone.Update(delta.value, t.LR, t.workerRNGs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// propagateHead は、ヘッドの出力が更新基準を満たす場合に、ヘッドの層の更新量を加算し、Backboneの出力に対するターゲットを返す。
+// 更新対象でない場合は nil を返す。
+func propagateHead(y *bitsx.Matrix, backwards Backwards, label int, head Model, margin float32, seqDelta SeqDelta) (*bitsx.Matrix, error) {
+	shouldUpdate, err := SatisfiesUpdateCriterion(y, label, head.Prototypes, margin)
+	if err != nil {
+		return nil, err
+	}
+
+	if !shouldUpdate {
+		return nil, nil
+	}
+	return backwards.Propagate(head.Prototypes[label], seqDelta)
+}
+
+func (t *TwoHeadTrainer) computeSignDelta(xs bitsx.Matrices, policyLabels, valueLabels []int) (twoHeadDelta, error) {
+	// Backboneには、1サンプルにつき最大で2つのヘッドの更新量が加算される
+	n := len(xs)
+	if n > math.MaxInt16/2 {
+		return twoHeadDelta{}, fmt.Errorf("サンプル数が多すぎます: n = %d: Deltaの要素はint16の為、%d 以下であるべき", n, math.MaxInt16/2)
+	}
+
+	for _, d := range t.workerDeltas {
+		d.clear()
+	}
+
+	p := len(t.workerRNGs)
+	model := t.model
+
+	err := parallel.For(n, p, func(workerID, idx int) error {
+		rng := t.workerRNGs[workerID]
+		delta := t.workerDeltas[workerID]
+
+		h, backboneBackwards, err := model.Backbone.Forward(xs[idx], rng)
+		if err != nil {
+			return err
+		}
+
+		yp, policyBackwards, err := model.PolicyHead.Backbone.Forward(h, rng)
+		if err != nil {
+			return err
+		}
+
+		yv, valueBackwards, err := model.ValueHead.Backbone.Forward(h, rng)
+		if err != nil {
+			return err
+		}
+
+		policyT, err := propagateHead(yp, policyBackwards, policyLabels[idx], model.PolicyHead, t.Margin, delta.policy)
+		if err != nil {
+			return err
+		}
+
+		valueT, err := propagateHead(yv, valueBackwards, valueLabels[idx], model.ValueHead, t.Margin, delta.value)
+		if err != nil {
+			return err
+		}
+
+		// 両ヘッドからのターゲットによる更新量を、Backboneの更新量に加算する
+		for _, target := range []*bitsx.Matrix{policyT, valueT} {
+			if target == nil {
+				continue
+			}
+			if _, err := backboneBackwards.Propagate(target, delta.backbone); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return twoHeadDelta{}, err
+	}
+
+	t.aggregatedDelta.clear()
+	for _, d := range t.workerDeltas {
+		if err := t.aggregatedDelta.add(d); err != nil {
+			return twoHeadDelta{}, err
+		}
+	}
+
+	t.aggregatedDelta.sign()
+	return t.aggregatedDelta, nil
+}
@@ -0,0 +1,308 @@
+// Package opening は、対局の初期状態として使う序盤の局面集(オープニングブック)を作り、保存・読み込みする。
+// 同じ初期状態から貪欲に指すActorCritic同士の対局は、ほぼ決定的になる為、
+// 評価用の対局では、互角に近い様々な局面から指させる。
+package opening
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/omw/encoding/gobx"
+	"github.com/sw965/omw/mathx/randx"
+)
+
+// Opening は、序盤の局面と、初期状態からその局面までに指した手。
+type Opening[S any, Ac comparable] struct {
+	State   S
+	Actions []Ac
+	// Eval は、Book.Filter で付けた評価値。評価していない場合は0。
+	Eval float32
+}
+
+// Book は、序盤の局面集。States を NewCrossPlayoutRecorder などの inits にそのまま渡せる。
+type Book[S any, Ac comparable] struct {
+	Openings []Opening[S, Ac]
+}
+
+func (b Book[S, Ac]) Len() int {
+	return len(b.Openings)
+}
+
+// States は、各序盤の局面を返す。
+func (b Book[S, Ac]) States() []S {
+	states := make([]S, len(b.Openings))
+	for i, o := range b.Openings {
+		states[i] = o.State
+	}
+	return states
+}
+
+// HashFunc は、局面を64ビットのキーに写す。同じ局面は、同じキーに写さなければならない。
+// キーは重複判定の絞り込みにだけ使い、同じキーの局面は Rule.EqualFunc で比べるので、衝突しても良い。
+type HashFunc[S any] func(S) uint64
+
+// EvalFunc は、局面の評価値を [0, 1] で返す。0.5 が互角を表す。
+// 互角からの差だけを見るので、どのエージェントから見た評価値でもよい。
+type EvalFunc[S any] func(S) (float32, error)
+
+// NewEvalFunc は、PolicyValueFunc の価値(手番のエージェントから見た価値)を評価値とする EvalFunc を返す。
+// 探索付きの PolicyValueFunc を渡せば、探索による評価で互角の局面を選べる。
+func NewEvalFunc[S any, Ac, Ag comparable](engine *sequential.Engine[S, Ac, Ag], pvFunc sequential.PolicyValueFunc[S, Ac]) EvalFunc[S] {
+	return func(state S) (float32, error) {
+		_, value, err := pvFunc(state, engine.Rule.LegalActionsFunc(state))
+		return value, err
+	}
+}
+
+// Filter は、評価値と互角(0.5)との差が margin 以下の序盤だけを、評価値を付けて返す。
+func (b Book[S, Ac]) Filter(evalFunc EvalFunc[S], margin float32) (Book[S, Ac], error) {
+	if evalFunc == nil {
+		return Book[S, Ac]{}, errors.New("evalFuncがnilです")
+	}
+
+	if margin < 0 || math.IsNaN(float64(margin)) {
+		return Book[S, Ac]{}, fmt.Errorf("marginが不正: margin = %g: margin >= 0 であるべき", margin)
+	}
+
+	filtered := make([]Opening[S, Ac], 0, len(b.Openings))
+	for _, o := range b.Openings {
+		v, err := evalFunc(o.State)
+		if err != nil {
+			return Book[S, Ac]{}, err
+		}
+
+		if isBalanced(v, margin) {
+			o.Eval = v
+			filtered = append(filtered, o)
+		}
+	}
+	return Book[S, Ac]{Openings: filtered}, nil
+}
+
+func isBalanced(v, margin float32) bool {
+	return float32(math.Abs(float64(v-0.5))) <= margin
+}
+
+// Save は、bookをpathに保存する。
+func (b Book[S, Ac]) Save(path string) error {
+	return gobx.Save(b, path)
+}
+
+// LoadBook は、Saveで保存したbookを読み込む。
+func LoadBook[S any, Ac comparable](path string) (Book[S, Ac], error) {
+	return gobx.Load[Book[S, Ac]](path)
+}
+
+// RandomConfig は、Random で序盤を作る設定。
+type RandomConfig[S any] struct {
+	// Plies は、初期状態から一様ランダムに指す手数。
+	Plies int
+	// Count は、作る序盤の数。
+	Count int
+	// MaxAttempts は、序盤を作る試行回数の上限。条件を満たす序盤が Count 個集まらない場合はエラーを返す。
+	MaxAttempts int
+	// EvalFunc が nil でない場合、評価値と互角(0.5)との差が Margin 以下の序盤だけを使う。
+	EvalFunc EvalFunc[S]
+	Margin   float32
+	// Unique が true の場合、同じ局面(Rule.EqualFunc)の序盤を重複させない。
+	// EvalFunc で捨てた局面も覚えておき、同じ局面を EvalFunc で評価するのは1回だけにする。
+	Unique bool
+	// HashFunc は、Unique の重複判定を速くする。nil の場合、作った全ての序盤と比べる為、
+	// 1序盤あたり O(Count) の比較になる。
+	HashFunc HashFunc[S]
+}
+
+func (c RandomConfig[S]) Validate() error {
+	if c.Plies < 0 {
+		return fmt.Errorf("Pliesが不正: Plies = %d: Plies >= 0 であるべき", c.Plies)
+	}
+
+	if c.Count <= 0 {
+		return fmt.Errorf("Countが不正: Count = %d: Count > 0 であるべき", c.Count)
+	}
+
+	if c.MaxAttempts < c.Count {
+		return fmt.Errorf("MaxAttemptsが不正: MaxAttempts = %d: MaxAttempts >= Count(%d) であるべき", c.MaxAttempts, c.Count)
+	}
+
+	if c.Margin < 0 || math.IsNaN(float64(c.Margin)) {
+		return fmt.Errorf("Marginが不正: Margin = %g: Margin >= 0 であるべき", c.Margin)
+	}
+	return nil
+}
+
+// Random は、init から Plies 手を一様ランダムに指した序盤を Count 個作る。
+// 途中で終局した序盤と、EvalFunc で互角でないと評価された序盤は捨てる。
+func Random[S any, Ac, Ag comparable](engine *sequential.Engine[S, Ac, Ag], init S, config RandomConfig[S], rng *rand.Rand) (Book[S, Ac], error) {
+	if engine == nil {
+		return Book[S, Ac]{}, errors.New("engineがnilです")
+	}
+
+	if err := engine.Validate(); err != nil {
+		return Book[S, Ac]{}, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return Book[S, Ac]{}, err
+	}
+
+	openings := make([]Opening[S, Ac], 0, config.Count)
+	seen := newStateSet(engine.Rule.EqualFunc, config.HashFunc)
+	for attempt := 0; attempt < config.MaxAttempts && len(openings) < config.Count; attempt++ {
+		o, ok, err := randomOpening(engine, init, config.Plies, rng)
+		if err != nil {
+			return Book[S, Ac]{}, err
+		}
+		if !ok {
+			continue
+		}
+
+		if config.Unique {
+			// 互角でない局面も seen に加え、同じ局面を何度も評価しない
+			if seen.contains(o.State) {
+				continue
+			}
+			seen.add(o.State)
+		}
+
+		if config.EvalFunc != nil {
+			v, err := config.EvalFunc(o.State)
+			if err != nil {
+				return Book[S, Ac]{}, err
+			}
+			if !isBalanced(v, config.Margin) {
+				continue
+			}
+			o.Eval = v
+		}
+		openings = append(openings, o)
+	}
+
+	if len(openings) < config.Count {
+		return Book[S, Ac]{}, fmt.Errorf("条件を満たす序盤が不足しています: got = %d, want = %d: MaxAttempts(%d) を増やすか、条件を緩めるべき", len(openings), config.Count, config.MaxAttempts)
+	}
+	return Book[S, Ac]{Openings: openings}, nil
+}
+
+// randomOpening は、initからplies手を一様ランダムに指す。途中または最後に終局した場合、第2戻り値はfalse。
+func randomOpening[S any, Ac, Ag comparable](engine *sequential.Engine[S, Ac, Ag], init S, plies int, rng *rand.Rand) (Opening[S, Ac], bool, error) {
+	state := init
+	actions := make([]Ac, 0, plies)
+	for range plies {
+		isEnd, err := engine.IsTerminal(state)
+		if err != nil {
+			return Opening[S, Ac]{}, false, err
+		}
+		if isEnd {
+			return Opening[S, Ac]{}, false, nil
+		}
+
+		action, err := randx.Choice(engine.Rule.LegalActionsFunc(state), rng)
+		if err != nil {
+			return Opening[S, Ac]{}, false, fmt.Errorf("ゲームが終了していないのに合法手がありません: %w", err)
+		}
+
+		state, err = engine.Rule.TransitionFunc(state, action)
+		if err != nil {
+			return Opening[S, Ac]{}, false, err
+		}
+		actions = append(actions, action)
+	}
+
+	isEnd, err := engine.IsTerminal(state)
+	if err != nil || isEnd {
+		return Opening[S, Ac]{}, false, err
+	}
+	return Opening[S, Ac]{State: state, Actions: actions}, true, nil
+}
+
+// stateSet は、局面の集合。hashFunc が nil の場合、全ての局面と eq で比べる。
+type stateSet[S any] struct {
+	eq       sequential.EqualFunc[S]
+	hashFunc HashFunc[S]
+	buckets  map[uint64][]S
+}
+
+func newStateSet[S any](eq sequential.EqualFunc[S], hashFunc HashFunc[S]) stateSet[S] {
+	return stateSet[S]{eq: eq, hashFunc: hashFunc, buckets: map[uint64][]S{}}
+}
+
+func (s stateSet[S]) key(state S) uint64 {
+	if s.hashFunc == nil {
+		return 0
+	}
+	return s.hashFunc(state)
+}
+
+func (s stateSet[S]) contains(state S) bool {
+	for _, other := range s.buckets[s.key(state)] {
+		if s.eq(other, state) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s stateSet[S]) add(state S) {
+	k := s.key(state)
+	s.buckets[k] = append(s.buckets[k], state)
+}
+
+// Enumerate は、init から depth 手で到達できる、終局していない全ての局面を返す。
+// 手順が違っても同じ局面(Rule.EqualFunc)は1つにまとめ、最初に見つけた手順を Actions にする。
+// hashFunc は、重複判定を速くする。nil の場合、同じ深さで見つけた全ての局面と比べる為、
+// 比較の回数は局面の数の2乗に比例する。
+// 局面の数は depth に対して指数的に増える為、小さい depth で使う事。
+func Enumerate[S any, Ac, Ag comparable](engine *sequential.Engine[S, Ac, Ag], init S, depth int, hashFunc HashFunc[S]) (Book[S, Ac], error) {
+	if engine == nil {
+		return Book[S, Ac]{}, errors.New("engineがnilです")
+	}
+
+	if err := engine.Validate(); err != nil {
+		return Book[S, Ac]{}, err
+	}
+
+	if depth < 0 {
+		return Book[S, Ac]{}, fmt.Errorf("depthが不正: depth = %d: depth >= 0 であるべき", depth)
+	}
+
+	isEnd, err := engine.IsTerminal(init)
+	if err != nil {
+		return Book[S, Ac]{}, err
+	}
+	if isEnd {
+		return Book[S, Ac]{}, nil
+	}
+
+	frontier := []Opening[S, Ac]{{State: init, Actions: []Ac{}}}
+	for range depth {
+		next := make([]Opening[S, Ac], 0, len(frontier))
+		seen := newStateSet(engine.Rule.EqualFunc, hashFunc)
+		for _, o := range frontier {
+			for _, action := range engine.Rule.LegalActionsFunc(o.State) {
+				state, err := engine.Rule.TransitionFunc(o.State, action)
+				if err != nil {
+					return Book[S, Ac]{}, err
+				}
+
+				isEnd, err := engine.IsTerminal(state)
+				if err != nil {
+					return Book[S, Ac]{}, err
+				}
+				if isEnd || seen.contains(state) {
+					continue
+				}
+				seen.add(state)
+
+				actions := make([]Ac, len(o.Actions), len(o.Actions)+1)
+				copy(actions, o.Actions)
+				next = append(next, Opening[S, Ac]{State: state, Actions: append(actions, action)})
+			}
+		}
+		frontier = next
+	}
+	return Book[S, Ac]{Openings: frontier}, nil
+}
@@ -0,0 +1,270 @@
+package opening_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/internal/ttt"
+	"github.com/sw965/crow/opening"
+	"github.com/sw965/omw/mathx/randx"
+)
+
+type book = opening.Book[ttt.State, ttt.Action]
+
+// assertReplay は、各序盤の手順を初期状態から辿ると、序盤の局面に到達する事を確かめる。
+func assertReplay(t *testing.T, engine sequential.Engine[ttt.State, ttt.Action, ttt.Mark], b book) {
+	t.Helper()
+	for i, o := range b.Openings {
+		state := ttt.NewInitialState()
+		for _, a := range o.Actions {
+			var err error
+			state, err = engine.Rule.TransitionFunc(state, a)
+			if err != nil {
+				t.Fatalf("Openings[%d]: 予期せぬエラー: %v", i, err)
+			}
+		}
+		if state != o.State {
+			t.Errorf("Openings[%d]: 手順を辿った局面がStateと一致しない", i)
+		}
+	}
+}
+
+// centerEvalFunc は、中央が空いていれば互角(0.5)、埋まっていれば1を返す。
+func centerEvalFunc(s ttt.State) (float32, error) {
+	if s.Board[1][1] == ttt.EmptyMark {
+		return 0.5, nil
+	}
+	return 1.0, nil
+}
+
+// tttHash は、盤面を3進数で表し、手番を最下位ビットに加える。
+func tttHash(s ttt.State) uint64 {
+	var h uint64
+	for r := range 3 {
+		for c := range 3 {
+			h = h*3 + uint64(s.Board[r][c])
+		}
+	}
+	return h<<1 | uint64(s.Turn&1)
+}
+
+// collidingHash は、全ての局面を同じキーに写す。
+func collidingHash(ttt.State) uint64 {
+	return 0
+}
+
+func TestEnumerate(t *testing.T) {
+	engine := ttt.NewEngine()
+
+	tests := []struct {
+		name  string
+		depth int
+		want  int
+	}{
+		{name: "正常_深さ0", depth: 0, want: 1},
+		{name: "正常_深さ1", depth: 1, want: 9},
+		{name: "正常_深さ2", depth: 2, want: 9 * 8},
+		// 先手の2手の順番を入れ替えた局面は同じなので、9C2 * 7 通り
+		{name: "正常_深さ3_同一局面をまとめる", depth: 3, want: 36 * 7},
+	}
+
+	hashFuncs := []struct {
+		name     string
+		hashFunc opening.HashFunc[ttt.State]
+	}{
+		{name: "HashFuncなし", hashFunc: nil},
+		{name: "HashFuncあり", hashFunc: tttHash},
+		{name: "HashFuncが衝突", hashFunc: collidingHash},
+	}
+
+	for _, h := range hashFuncs {
+		for _, tc := range tests {
+			t.Run(tc.name+"_"+h.name, func(t *testing.T) {
+				b, err := opening.Enumerate(&engine, ttt.NewInitialState(), tc.depth, h.hashFunc)
+				if err != nil {
+					t.Fatalf("予期せぬエラー: %v", err)
+				}
+				if b.Len() != tc.want {
+					t.Errorf("局面数の不一致: got = %d, want = %d", b.Len(), tc.want)
+				}
+				for i, o := range b.Openings {
+					if len(o.Actions) != tc.depth {
+						t.Errorf("Openings[%d]の手数の不一致: got = %d, want = %d", i, len(o.Actions), tc.depth)
+					}
+				}
+				assertReplay(t, engine, b)
+			})
+		}
+	}
+
+	t.Run("異常_負の深さ", func(t *testing.T) {
+		if _, err := opening.Enumerate(&engine, ttt.NewInitialState(), -1, nil); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestRandom(t *testing.T) {
+	engine := ttt.NewEngine()
+	rng := randx.NewPCG()
+
+	for _, hashFunc := range []opening.HashFunc[ttt.State]{nil, tttHash} {
+		name := "正常_重複なし"
+		if hashFunc != nil {
+			name = "正常_重複なし_HashFuncあり"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			config := opening.RandomConfig[ttt.State]{Plies: 2, Count: 20, MaxAttempts: 1000, Unique: true, HashFunc: hashFunc}
+			b, err := opening.Random(&engine, ttt.NewInitialState(), config, rng)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if b.Len() != config.Count {
+				t.Fatalf("序盤の数の不一致: got = %d, want = %d", b.Len(), config.Count)
+			}
+
+			seen := map[ttt.State]bool{}
+			for i, o := range b.Openings {
+				if seen[o.State] {
+					t.Errorf("Openings[%d]: 局面が重複している", i)
+				}
+				seen[o.State] = true
+			}
+			assertReplay(t, engine, b)
+		})
+	}
+
+	t.Run("正常_互角な局面だけ", func(t *testing.T) {
+		config := opening.RandomConfig[ttt.State]{Plies: 2, Count: 10, MaxAttempts: 1000, EvalFunc: centerEvalFunc, Margin: 0.1}
+		b, err := opening.Random(&engine, ttt.NewInitialState(), config, rng)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		for i, o := range b.Openings {
+			if o.State.Board[1][1] != ttt.EmptyMark || o.Eval != 0.5 {
+				t.Errorf("Openings[%d]: 互角でない局面が含まれている: Eval = %f", i, o.Eval)
+			}
+		}
+	})
+
+	t.Run("正常_同じ局面は1回だけ評価する", func(t *testing.T) {
+		calls := 0
+		rejectFunc := func(ttt.State) (float32, error) {
+			calls++
+			return 1.0, nil
+		}
+
+		config := opening.RandomConfig[ttt.State]{Plies: 2, Count: 1, MaxAttempts: 1000, EvalFunc: rejectFunc, Margin: 0.1, Unique: true, HashFunc: tttHash}
+		if _, err := opening.Random(&engine, ttt.NewInitialState(), config, rng); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+		// 2手の局面は72通りしかない
+		if calls > 72 {
+			t.Errorf("評価の回数の不一致: got = %d, want <= 72", calls)
+		}
+	})
+
+	t.Run("異常_条件を満たす序盤が不足", func(t *testing.T) {
+		// 2手の局面は72通りしかない
+		config := opening.RandomConfig[ttt.State]{Plies: 2, Count: 100, MaxAttempts: 10000, Unique: true}
+		if _, err := opening.Random(&engine, ttt.NewInitialState(), config, rng); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_MaxAttemptsがCount未満", func(t *testing.T) {
+		config := opening.RandomConfig[ttt.State]{Plies: 2, Count: 10, MaxAttempts: 5}
+		if _, err := opening.Random(&engine, ttt.NewInitialState(), config, rng); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestBookFilter(t *testing.T) {
+	engine := ttt.NewEngine()
+	b, err := opening.Enumerate(&engine, ttt.NewInitialState(), 1, nil)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	filtered, err := b.Filter(centerEvalFunc, 0.0)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if filtered.Len() != 8 {
+		t.Errorf("局面数の不一致: got = %d, want = 8", filtered.Len())
+	}
+
+	// PolicyValueFuncの価値でも絞り込める。一様な方策関数の価値は0なので、全て捨てられる
+	evalFunc := opening.NewEvalFunc(&engine, sequential.UniformPolicyNoValueFunc[ttt.State, ttt.Action])
+	filtered, err = b.Filter(evalFunc, 0.1)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if filtered.Len() != 0 {
+		t.Errorf("局面数の不一致: got = %d, want = 0", filtered.Len())
+	}
+}
+
+func TestBookSaveLoad(t *testing.T) {
+	engine := ttt.NewEngine()
+	b, err := opening.Enumerate(&engine, ttt.NewInitialState(), 2, nil)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "book.gob")
+	if err := b.Save(path); err != nil {
+		t.Fatalf("保存失敗: %v", err)
+	}
+
+	loaded, err := opening.LoadBook[ttt.State, ttt.Action](path)
+	if err != nil {
+		t.Fatalf("読み込み失敗: %v", err)
+	}
+
+	if loaded.Len() != b.Len() {
+		t.Fatalf("局面数の不一致: got = %d, want = %d", loaded.Len(), b.Len())
+	}
+	for i := range b.Openings {
+		if loaded.Openings[i].State != b.Openings[i].State {
+			t.Errorf("Openings[%d]: 保存前後で局面が一致しない", i)
+		}
+	}
+}
+
+func TestBookCrossPlayout(t *testing.T) {
+	engine := ttt.NewEngine()
+	b, err := opening.Enumerate(&engine, ttt.NewInitialState(), 2, nil)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	accr1 := sequential.NewRandomActorCritic[ttt.State, ttt.Action, ttt.Mark]()
+	accr1.Name = "rand1"
+	accr2 := sequential.NewRandomActorCritic[ttt.State, ttt.Action, ttt.Mark]()
+	accr2.Name = "rand2"
+
+	recorder, err := engine.NewCrossPlayoutRecorder(b.States(), []sequential.ActorCritic[ttt.State, ttt.Action, ttt.Mark]{accr1, accr2}, 2)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	records, err := recorder.Collect()
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if len(records) != 2*b.Len() {
+		t.Fatalf("len(records)の不一致: got = %d, want = %d", len(records), 2*b.Len())
+	}
+
+	// 各対局は序盤の局面から始まる
+	for i, r := range records {
+		if r.Steps[0].State != b.Openings[i%b.Len()].State {
+			t.Errorf("records[%d]: 序盤の局面から始まっていない", i)
+		}
+	}
+}
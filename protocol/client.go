@@ -0,0 +1,206 @@
+package protocol
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+)
+
+// Client は、プロトコルを話す相手(サーバー)にコマンドを送り、応答を受け取る。
+// 相手は1局分の状態を持つ為、コマンドの送受信は直列に行う。全てのメソッドは複数のgoroutineから呼び出せる。
+type Client struct {
+	mu     sync.Mutex
+	r      *bufio.Reader
+	w      io.Writer
+	closer io.Closer
+	cmd    *exec.Cmd
+}
+
+// NewClient は、r から応答を読み、w にコマンドを書くClientを返す。
+func NewClient(r io.Reader, w io.Writer) *Client {
+	return &Client{r: bufio.NewReader(r), w: w}
+}
+
+// StartProcess は、外部のエンジンのプロセスを起動し、その標準入出力と話すClientを返す。
+func StartProcess(name string, args ...string) (*Client, error) {
+	cmd := exec.Command(name, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	c := NewClient(stdout, stdin)
+	c.closer = stdin
+	c.cmd = cmd
+	return c, nil
+}
+
+// Close は、quit コマンドを送り、StartProcess で起動したプロセスの終了を待つ。
+func (c *Client) Close() error {
+	_, err := c.Send("quit")
+	if c.closer != nil {
+		if cerr := c.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if c.cmd != nil {
+		if werr := c.cmd.Wait(); err == nil {
+			err = werr
+		}
+	}
+	return err
+}
+
+// Send は、1行のコマンドを送り、応答の本文を行ごとに返す。応答が "? " で始まる場合はエラーを返す。
+func (c *Client) Send(line string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.send(line)
+}
+
+// SendBatch は、複数のコマンドを、他のgoroutineのコマンドを挟まずに順に送り、各応答を返す。
+// エラーが起きた場合、残りのコマンドは送らない。
+func (c *Client) SendBatch(lines ...string) ([][]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	resps := make([][]string, 0, len(lines))
+	for _, line := range lines {
+		resp, err := c.send(line)
+		if err != nil {
+			return nil, err
+		}
+		resps = append(resps, resp)
+	}
+	return resps, nil
+}
+
+func (c *Client) send(line string) ([]string, error) {
+	if strings.ContainsAny(line, "\r\n") {
+		return nil, errors.New("コマンドに改行が含まれています")
+	}
+
+	if _, err := io.WriteString(c.w, line+"\n"); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for {
+		text, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("応答の読み込みに失敗: command = %q: %w", line, err)
+		}
+
+		text = strings.TrimRight(text, "\r\n")
+		if text == "" {
+			if len(lines) == 0 {
+				// 応答の前の空行は読み飛ばす
+				continue
+			}
+			break
+		}
+		lines = append(lines, text)
+	}
+
+	head := lines[0]
+	switch {
+	case strings.HasPrefix(head, "= ") || head == "=":
+		lines[0] = strings.TrimPrefix(strings.TrimPrefix(head, "="), " ")
+		return lines, nil
+	case strings.HasPrefix(head, "? ") || head == "?":
+		return nil, fmt.Errorf("サーバーがエラーを返しました: command = %q: %s", line, strings.TrimPrefix(strings.TrimPrefix(head, "?"), " "))
+	default:
+		return nil, fmt.Errorf("応答の形式が不正: command = %q: %q", line, head)
+	}
+}
+
+// SetBudget は、相手の探索量を変える。
+func (c *Client) SetBudget(budget int) error {
+	_, err := c.Send("budget " + strconv.Itoa(budget))
+	return err
+}
+
+// NewPolicyValueFunc は、状態を newgame で相手に送り、policy コマンドの応答を方策と価値として返す PolicyValueFunc を返す。
+// 相手の方策のうち、legalActions に無い行動はエラーとする。
+func NewPolicyValueFunc[S any, Ac comparable](c *Client, stateCodec TextCodec[S], actionCodec TextCodec[Ac]) sequential.PolicyValueFunc[S, Ac] {
+	return func(state S, legalActions []Ac) (game.Policy[Ac], float32, error) {
+		text, err := stateCodec.Encode(state)
+		if err != nil {
+			return nil, 0.0, err
+		}
+
+		// newgame と policy の間に、他のgoroutineのコマンドが挟まらない様にする
+		resps, err := c.SendBatch("newgame "+text, "policy")
+		if err != nil {
+			return nil, 0.0, err
+		}
+		return parsePolicy(resps[1], legalActions, actionCodec)
+	}
+}
+
+func parsePolicy[Ac comparable](lines []string, legalActions []Ac, actionCodec TextCodec[Ac]) (game.Policy[Ac], float32, error) {
+	if len(lines) == 0 {
+		return nil, 0.0, errors.New("policyの応答が空です")
+	}
+
+	valueText, ok := strings.CutPrefix(lines[0], "value ")
+	if !ok {
+		return nil, 0.0, fmt.Errorf("policyの応答の1行目が不正: %q: \"value 価値\" であるべき", lines[0])
+	}
+
+	value, err := strconv.ParseFloat(valueText, 32)
+	if err != nil {
+		return nil, 0.0, err
+	}
+
+	policy := make(game.Policy[Ac], len(lines)-1)
+	for _, line := range lines[1:] {
+		actionText, pText, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, 0.0, fmt.Errorf("policyの応答の行が不正: %q: \"行動 確率\" であるべき", line)
+		}
+
+		action, err := actionCodec.Decode(actionText)
+		if err != nil {
+			return nil, 0.0, err
+		}
+
+		p, err := strconv.ParseFloat(pText, 32)
+		if err != nil {
+			return nil, 0.0, err
+		}
+		policy[action] = float32(p)
+	}
+
+	if err := policy.ValidateForLegalActions(legalActions, false); err != nil {
+		return nil, 0.0, err
+	}
+	return policy, float32(value), nil
+}
+
+// NewActorCritic は、相手のエンジンを、方策と価値を相手に計算させるActorCriticとして返す。
+// 行動の選択は手元の selectFunc で行う。
+func NewActorCritic[S any, Ac, Ag comparable](name game.ActorCriticName, c *Client, stateCodec TextCodec[S], actionCodec TextCodec[Ac], selectFunc game.SelectFunc[Ac, Ag]) sequential.ActorCritic[S, Ac, Ag] {
+	return sequential.ActorCritic[S, Ac, Ag]{
+		Name:            name,
+		PolicyValueFunc: NewPolicyValueFunc(c, stateCodec, actionCodec),
+		SelectFunc:      selectFunc,
+	}
+}
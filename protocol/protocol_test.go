@@ -0,0 +1,258 @@
+package protocol_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/internal/ttt"
+	"github.com/sw965/crow/protocol"
+)
+
+var markChars = map[ttt.Mark]byte{ttt.EmptyMark: '.', ttt.Nought: 'o', ttt.Cross: 'x'}
+
+// stateCodec は、三目並べの状態を "手番 盤面9文字" のテキストにする。
+type stateCodec struct{}
+
+func (stateCodec) Encode(s ttt.State) (string, error) {
+	var b strings.Builder
+	b.WriteByte(markChars[s.Turn])
+	b.WriteByte(' ')
+	for _, row := range s.Board {
+		for _, m := range row {
+			b.WriteByte(markChars[m])
+		}
+	}
+	return b.String(), nil
+}
+
+func (stateCodec) Decode(text string) (ttt.State, error) {
+	turn, board, ok := strings.Cut(text, " ")
+	if !ok || len(turn) != 1 || len(board) != 9 {
+		return ttt.State{}, fmt.Errorf("状態のテキストが不正: %q", text)
+	}
+
+	markOf := func(c byte) (ttt.Mark, error) {
+		for m, mc := range markChars {
+			if mc == c {
+				return m, nil
+			}
+		}
+		return 0, fmt.Errorf("マークが不正: %q", c)
+	}
+
+	var s ttt.State
+	var err error
+	if s.Turn, err = markOf(turn[0]); err != nil {
+		return ttt.State{}, err
+	}
+	for i := range 9 {
+		if s.Board[i/3][i%3], err = markOf(board[i]); err != nil {
+			return ttt.State{}, err
+		}
+	}
+	return s, nil
+}
+
+// actionCodec は、三目並べの行動を "行,列" のテキストにする。
+type actionCodec struct{}
+
+func (actionCodec) Encode(a ttt.Action) (string, error) {
+	return fmt.Sprintf("%d,%d", a.Row, a.Col), nil
+}
+
+func (actionCodec) Decode(text string) (ttt.Action, error) {
+	var a ttt.Action
+	if _, err := fmt.Sscanf(text, "%d,%d", &a.Row, &a.Col); err != nil {
+		return ttt.Action{}, fmt.Errorf("行動のテキストが不正: %q: %w", text, err)
+	}
+	return a, nil
+}
+
+// newServer は、一様な方策で、budget を価値として返すActorCriticのサーバーを返す。
+func newServer(t *testing.T) *protocol.Server[ttt.State, ttt.Action, ttt.Mark] {
+	t.Helper()
+	engine := ttt.NewEngine()
+	newActorCriticFunc := func(budget int) (sequential.ActorCritic[ttt.State, ttt.Action, ttt.Mark], error) {
+		return sequential.ActorCritic[ttt.State, ttt.Action, ttt.Mark]{
+			Name: game.ActorCriticName(fmt.Sprintf("uniform-%d", budget)),
+			PolicyValueFunc: func(state ttt.State, legalActions []ttt.Action) (game.Policy[ttt.Action], float32, error) {
+				policy, err := sequential.UniformPolicyFunc(state, legalActions)
+				return policy, float32(budget) / 100.0, err
+			},
+			SelectFunc: game.MaxSelectFunc[ttt.Action, ttt.Mark],
+		}, nil
+	}
+
+	server, err := protocol.NewServer(&engine, stateCodec{}, actionCodec{}, ttt.NewInitialState, newActorCriticFunc, 10, rand.New(rand.NewPCG(1, 2)))
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	return server
+}
+
+func TestServerServe(t *testing.T) {
+	server := newServer(t)
+
+	input := strings.Join([]string{
+		"# コメントと空行は無視する",
+		"",
+		"name",
+		"budget 50",
+		"name",
+		"play 1,1",
+		"state",
+		"play 1,1",
+		"legal",
+		"newgame o x........",
+		"policy",
+		"terminal",
+		"unknown",
+		"quit",
+		"name",
+	}, "\n")
+
+	var out bytes.Buffer
+	if err := server.Serve(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	// 応答は空行で終わる。policyの応答だけ複数行になる
+	responses := []string{
+		"= uniform-10",
+		"= ",
+		"= uniform-50",
+		"= ",
+		"= o ....x....",
+		"? 合法手ではありません: action = {1 1}",
+		"= 0,0 0,1 0,2 1,0 1,2 2,0 2,1 2,2",
+		"= ",
+		"= value 0.5\n0,1 0.125\n0,2 0.125\n1,0 0.125\n1,1 0.125\n1,2 0.125\n2,0 0.125\n2,1 0.125\n2,2 0.125",
+		"= false",
+		"? 未知のコマンド: unknown",
+		"= ",
+	}
+	want := strings.Join(responses, "\n\n") + "\n\n"
+
+	if out.String() != want {
+		t.Errorf("応答の不一致:\ngot:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestServerGenMove(t *testing.T) {
+	server := newServer(t)
+	engine := ttt.NewEngine()
+
+	// 一様な方策で最大の確率の手を選ぶので、終局まで指せる
+	for range 9 {
+		isEnd, err := engine.IsTerminal(server.State())
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if isEnd {
+			break
+		}
+		if _, err := server.Execute("genmove"); err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+	}
+
+	resp, err := server.Execute("terminal")
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if resp != "true" {
+		t.Errorf("終局していない: got = %s", resp)
+	}
+
+	if _, err := server.Execute("genmove"); err == nil {
+		t.Fatal("終局後のgenmoveで、エラーを期待したが、nilが返された")
+	}
+}
+
+// startServer は、パイプの先でサーバーを動かし、それと話すClientを返す。
+func startServer(t *testing.T) *protocol.Client {
+	t.Helper()
+	server := newServer(t)
+
+	cmdR, cmdW := io.Pipe()
+	respR, respW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := server.Serve(cmdR, respW)
+		respW.Close()
+		done <- err
+	}()
+
+	client := protocol.NewClient(respR, cmdW)
+	t.Cleanup(func() {
+		if err := client.Close(); err != nil {
+			t.Errorf("予期せぬエラー: %v", err)
+		}
+		if err := <-done; err != nil {
+			t.Errorf("予期せぬエラー: %v", err)
+		}
+	})
+	return client
+}
+
+func TestClient(t *testing.T) {
+	client := startServer(t)
+
+	lines, err := client.Send("name")
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if len(lines) != 1 || lines[0] != "uniform-10" {
+		t.Errorf("応答の不一致: got = %v", lines)
+	}
+
+	t.Run("異常_サーバーのエラー", func(t *testing.T) {
+		if _, err := client.Send("play 9,9"); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_改行を含むコマンド", func(t *testing.T) {
+		if _, err := client.Send("name\nname"); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("正常_ActorCriticとして対局する", func(t *testing.T) {
+		if err := client.SetBudget(30); err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		remote := protocol.NewActorCritic[ttt.State, ttt.Action, ttt.Mark]("remote", client, stateCodec{}, actionCodec{}, game.WeightedRandomSelectFunc[ttt.Action, ttt.Mark])
+		engine := ttt.NewEngine()
+
+		inits := []ttt.State{ttt.NewInitialState(), ttt.NewInitialState(), ttt.NewInitialState()}
+		rngs := []*rand.Rand{rand.New(rand.NewPCG(3, 4)), rand.New(rand.NewPCG(5, 6))}
+		records, err := engine.RecordPlayouts(inits, remote, rngs, 9)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		for i, record := range records {
+			isEnd, err := engine.IsTerminal(record.FinalState)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if !isEnd {
+				t.Errorf("records[%d]: 終局していない", i)
+			}
+			for j, step := range record.Steps {
+				// サーバー側の価値は budget / 100
+				if step.Value != 0.3 {
+					t.Errorf("records[%d].Steps[%d].Valueの不一致: got = %f, want = 0.3", i, j, step.Value)
+				}
+			}
+		}
+	})
+}
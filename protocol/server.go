@@ -0,0 +1,327 @@
+// Package protocol は、外部のGUIやスクリプトから sequential.Engine のActorCriticを操作する為の、
+// 行単位のテキストプロトコル(GTP/UCIに似た、ゲームに依存しないもの)のサーバーとクライアントを提供する。
+//
+// 1行が1コマンドで、"コマンド 引数" の形をとる。空行と "#" で始まる行は無視する。
+// 応答は、成功なら "= " 、失敗なら "? " で始まり、空行で終わる。応答は複数行になる事がある。
+//
+//	name              ActorCriticの名前
+//	newgame [状態]    対局を初期状態(指定した場合はその状態)から始める
+//	state             現在の状態
+//	legal             合法手(空白区切り)
+//	play 行動         行動を指す
+//	genmove           ActorCriticで行動を選んで指し、その行動を返す
+//	policy            1行目に "value 価値"、以降の各行に "行動 確率" を確率の降順で返す(指さない)
+//	budget 回数       探索量を変え、ActorCriticを作り直す
+//	terminal          終局していれば true、そうでなければ false
+//	quit              終了する
+//
+// 状態のテキストは改行を含まず、行動のテキストは空白も含まない事。
+package protocol
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sw965/crow/game/sequential"
+)
+
+// TextCodec は、値とプロトコル上のテキストを相互に変換する。
+type TextCodec[T any] interface {
+	Encode(T) (string, error)
+	Decode(string) (T, error)
+}
+
+// NewActorCriticFunc は、探索量 budget(シミュレーション回数など)に応じたActorCriticを作る。
+type NewActorCriticFunc[S any, Ac, Ag comparable] func(budget int) (sequential.ActorCritic[S, Ac, Ag], error)
+
+// Server は、1局分の状態を持ち、コマンドに従ってActorCriticを動かす。
+type Server[S any, Ac, Ag comparable] struct {
+	Engine             *sequential.Engine[S, Ac, Ag]
+	StateCodec         TextCodec[S]
+	ActionCodec        TextCodec[Ac]
+	InitStateFunc      func() S
+	NewActorCriticFunc NewActorCriticFunc[S, Ac, Ag]
+
+	accr     sequential.ActorCritic[S, Ac, Ag]
+	budget   int
+	state    S
+	numSteps int
+	rng      *rand.Rand
+}
+
+func NewServer[S any, Ac, Ag comparable](
+	engine *sequential.Engine[S, Ac, Ag],
+	stateCodec TextCodec[S],
+	actionCodec TextCodec[Ac],
+	initStateFunc func() S,
+	newActorCriticFunc NewActorCriticFunc[S, Ac, Ag],
+	budget int,
+	rng *rand.Rand,
+) (*Server[S, Ac, Ag], error) {
+	if engine == nil {
+		return nil, errors.New("engineがnilです")
+	}
+
+	if err := engine.Validate(); err != nil {
+		return nil, err
+	}
+
+	if stateCodec == nil || actionCodec == nil {
+		return nil, errors.New("codecがnilです")
+	}
+
+	if initStateFunc == nil {
+		return nil, errors.New("initStateFuncがnilです")
+	}
+
+	if newActorCriticFunc == nil {
+		return nil, errors.New("newActorCriticFuncがnilです")
+	}
+
+	if rng == nil {
+		return nil, errors.New("rngがnilです")
+	}
+
+	s := &Server[S, Ac, Ag]{
+		Engine:             engine,
+		StateCodec:         stateCodec,
+		ActionCodec:        actionCodec,
+		InitStateFunc:      initStateFunc,
+		NewActorCriticFunc: newActorCriticFunc,
+		state:              initStateFunc(),
+		rng:                rng,
+	}
+
+	if err := s.setBudget(budget); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Server[S, Ac, Ag]) setBudget(budget int) error {
+	if budget <= 0 {
+		return fmt.Errorf("budgetが不正: budget = %d: budget > 0 であるべき", budget)
+	}
+
+	accr, err := s.NewActorCriticFunc(budget)
+	if err != nil {
+		return err
+	}
+
+	if err := accr.Validate(); err != nil {
+		return err
+	}
+
+	s.accr = accr
+	s.budget = budget
+	return nil
+}
+
+// State は、現在の状態を返す。
+func (s *Server[S, Ac, Ag]) State() S {
+	return s.state
+}
+
+// errQuit は、quit コマンドを受け取った事を Serve に伝える。
+var errQuit = errors.New("quit")
+
+// Serve は、r からコマンドを1行ずつ読み、応答を w に書く。quit コマンドか r の終端で nil を返す。
+func (s *Server[S, Ac, Ag]) Serve(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	bw := bufio.NewWriter(w)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		resp, err := s.Execute(line)
+		quit := errors.Is(err, errQuit)
+		if err != nil && !quit {
+			fmt.Fprintf(bw, "? %s\n\n", strings.ReplaceAll(err.Error(), "\n", " "))
+		} else {
+			fmt.Fprintf(bw, "= %s\n\n", resp)
+		}
+
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+
+		if quit {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// Execute は、1行のコマンドを実行し、応答の本文を返す。
+func (s *Server[S, Ac, Ag]) Execute(line string) (string, error) {
+	cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	arg = strings.TrimSpace(arg)
+
+	switch cmd {
+	case "name":
+		return string(s.accr.Name), nil
+	case "newgame":
+		return "", s.newGame(arg)
+	case "state":
+		return s.StateCodec.Encode(s.state)
+	case "legal":
+		return s.legal()
+	case "play":
+		action, err := s.ActionCodec.Decode(arg)
+		if err != nil {
+			return "", err
+		}
+		return "", s.play(action)
+	case "genmove":
+		return s.genMove()
+	case "policy":
+		return s.policy()
+	case "budget":
+		budget, err := strconv.Atoi(arg)
+		if err != nil {
+			return "", fmt.Errorf("budgetが整数ではありません: %w", err)
+		}
+		return "", s.setBudget(budget)
+	case "terminal":
+		isEnd, err := s.Engine.IsTerminal(s.state)
+		return strconv.FormatBool(isEnd), err
+	case "quit":
+		return "", errQuit
+	default:
+		return "", fmt.Errorf("未知のコマンド: %s", cmd)
+	}
+}
+
+func (s *Server[S, Ac, Ag]) newGame(arg string) error {
+	state := s.InitStateFunc()
+	if arg != "" {
+		var err error
+		state, err = s.StateCodec.Decode(arg)
+		if err != nil {
+			return err
+		}
+	}
+	s.state = state
+	s.numSteps = 0
+	return nil
+}
+
+func (s *Server[S, Ac, Ag]) legalActions() ([]Ac, error) {
+	isEnd, err := s.Engine.IsTerminal(s.state)
+	if err != nil {
+		return nil, err
+	}
+	if isEnd {
+		return nil, errors.New("ゲームは既に終了しています")
+	}
+	return s.Engine.Rule.LegalActionsFunc(s.state), nil
+}
+
+func (s *Server[S, Ac, Ag]) legal() (string, error) {
+	legalActions, err := s.legalActions()
+	if err != nil {
+		return "", err
+	}
+
+	texts := make([]string, len(legalActions))
+	for i, a := range legalActions {
+		text, err := s.ActionCodec.Encode(a)
+		if err != nil {
+			return "", err
+		}
+		texts[i] = text
+	}
+	return strings.Join(texts, " "), nil
+}
+
+func (s *Server[S, Ac, Ag]) play(action Ac) error {
+	legalActions, err := s.legalActions()
+	if err != nil {
+		return err
+	}
+
+	if !slices.Contains(legalActions, action) {
+		return fmt.Errorf("合法手ではありません: action = %v", action)
+	}
+
+	next, err := s.Engine.Rule.TransitionFunc(s.state, action)
+	if err != nil {
+		return err
+	}
+	s.state = next
+	s.numSteps++
+	return nil
+}
+
+func (s *Server[S, Ac, Ag]) genMove() (string, error) {
+	legalActions, err := s.legalActions()
+	if err != nil {
+		return "", err
+	}
+
+	policy, _, err := s.accr.PolicyValueFunc(s.state, legalActions)
+	if err != nil {
+		return "", err
+	}
+
+	agent := s.Engine.Rule.CurrentAgentFunc(s.state)
+	action, err := s.accr.SelectFunc(policy, agent, s.numSteps, s.rng)
+	if err != nil {
+		return "", err
+	}
+
+	text, err := s.ActionCodec.Encode(action)
+	if err != nil {
+		return "", err
+	}
+	return text, s.play(action)
+}
+
+func (s *Server[S, Ac, Ag]) policy() (string, error) {
+	legalActions, err := s.legalActions()
+	if err != nil {
+		return "", err
+	}
+
+	policy, value, err := s.accr.PolicyValueFunc(s.state, legalActions)
+	if err != nil {
+		return "", err
+	}
+
+	type entry struct {
+		text string
+		p    float32
+	}
+	entries := make([]entry, 0, len(policy))
+	for a, p := range policy {
+		text, err := s.ActionCodec.Encode(a)
+		if err != nil {
+			return "", err
+		}
+		entries = append(entries, entry{text: text, p: p})
+	}
+
+	// 確率の降順、同じ確率ならテキストの昇順に並べ、応答を決定的にする
+	slices.SortFunc(entries, func(a, b entry) int {
+		if c := cmp.Compare(b.p, a.p); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.text, b.text)
+	})
+
+	lines := make([]string, 0, len(entries)+1)
+	lines = append(lines, "value "+strconv.FormatFloat(float64(value), 'g', -1, 32))
+	for _, e := range entries {
+		lines = append(lines, e.text+" "+strconv.FormatFloat(float64(e.p), 'g', -1, 32))
+	}
+	return strings.Join(lines, "\n"), nil
+}
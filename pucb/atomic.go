@@ -0,0 +1,182 @@
+package pucb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync/atomic"
+
+	"github.com/sw965/omw/mathx/randx"
+)
+
+// pendingMask は、AtomicCalculator.counts の下位32ビット(pending)を取り出すマスク。
+const pendingMask = 1<<32 - 1
+
+// AtomicCalculator は、統計(W・訪問回数・pending)を atomic に更新する Calculator。
+// ロックを取らずに、複数のワーカーから同時に読み書きできる。
+//
+// 訪問回数と pending は1つの64ビット値に詰めて持つ為、Visits は常に一貫した値を返し、
+// Observe は「pending を1減らして訪問回数を1増やす」を1回の操作で行う。
+// W は別の64ビット値に持つ為、更新の途中で読み出した Q は、最後の観測を含まない値になり得る。
+// 観測値の分散・最小値・最大値は記録しない為、StatsFunc に渡す Stats の Observations・Mean・Variance・Min・Max は常に0になり、
+// FPU の FPULoss は兄弟の最小値が無いものとして Value を使う。
+// Func、StatsFunc、P、VirtualValue、FPU、VirtualLoss、MinMax は、共有する前に設定し、その後は変更しない事。
+type AtomicCalculator struct {
+	Func         Func
+	StatsFunc    StatsFunc
+	P            float32
+	VirtualValue float32
+	FPU          FPU
+	VirtualLoss  VirtualLoss
+	MinMax       *MinMaxStats
+	// counts は、上位32ビットに訪問回数、下位32ビットに pending を持つ。
+	counts atomic.Uint64
+	// w は、W を float64 のビット列で持つ。
+	w atomic.Uint64
+}
+
+func (c *AtomicCalculator) load() (visits, pending int) {
+	v := c.counts.Load()
+	return int(v >> 32), int(v & pendingMask)
+}
+
+func (c *AtomicCalculator) AddW(v float32) error {
+	if isNaN32(v) || isInf32(v) {
+		return fmt.Errorf("vが不正(NaN/Inf): v=%.6g", v)
+	}
+
+	for {
+		old := c.w.Load()
+		w := math.Float64frombits(old) + float64(v)
+		if c.w.CompareAndSwap(old, math.Float64bits(w)) {
+			return nil
+		}
+	}
+}
+
+func (c *AtomicCalculator) IncrementVisits() {
+	c.counts.Add(1 << 32)
+}
+
+func (c *AtomicCalculator) Pending() int {
+	_, pending := c.load()
+	return pending
+}
+
+func (c *AtomicCalculator) IncrementPending() {
+	c.counts.Add(1)
+}
+
+func (c *AtomicCalculator) DecrementPending() error {
+	for {
+		old := c.counts.Load()
+		if old&pendingMask == 0 {
+			return errors.New("pendingが不正(underflow): pending = 0")
+		}
+
+		if c.counts.CompareAndSwap(old, old-1) {
+			return nil
+		}
+	}
+}
+
+// Observe は、pending を1つ観測済みの訪問に変え、v を W に加える。
+// DecrementPending、AddW、IncrementVisits をまとめたもの。v が不正な場合は、何も変更せずにエラーを返す。
+func (c *AtomicCalculator) Observe(v float32) error {
+	if isNaN32(v) || isInf32(v) {
+		return fmt.Errorf("vが不正(NaN/Inf): v=%.6g", v)
+	}
+
+	for {
+		old := c.counts.Load()
+		if old&pendingMask == 0 {
+			return errors.New("pendingが不正(underflow): pending = 0")
+		}
+
+		if c.counts.CompareAndSwap(old, old-1+1<<32) {
+			break
+		}
+	}
+	return c.AddW(v)
+}
+
+func (c *AtomicCalculator) Visits() int {
+	return c.Snapshot().Visits()
+}
+
+func (c *AtomicCalculator) W() float32 {
+	return c.Snapshot().W()
+}
+
+func (c *AtomicCalculator) Q() float32 {
+	return c.Snapshot().Q()
+}
+
+// Snapshot は、現在の統計を持つ Calculator を返す。返した Calculator は、以降の更新の影響を受けない。
+func (c *AtomicCalculator) Snapshot() *Calculator {
+	visits, pending := c.load()
+	return &Calculator{
+		Func:         c.Func,
+		StatsFunc:    c.StatsFunc,
+		P:            c.P,
+		w:            float32(math.Float64frombits(c.w.Load())),
+		visits:       visits,
+		pending:      pending,
+		VirtualValue: c.VirtualValue,
+		FPU:          c.FPU,
+		VirtualLoss:  c.VirtualLoss,
+		MinMax:       c.MinMax,
+	}
+}
+
+// AtomicVirtualSelector は、AtomicCalculator を持つ VirtualSelector。
+// 行動の集合(マップ自体)は共有する前に作り、その後は変更しない事。統計の読み書きにロックは要らない。
+type AtomicVirtualSelector[K comparable] map[K]*AtomicCalculator
+
+// Snapshot は、各行動の現在の統計を持つ VirtualSelector を返す。
+func (s AtomicVirtualSelector[K]) Snapshot() VirtualSelector[K] {
+	snapshot := make(VirtualSelector[K], len(s))
+	for k, c := range s {
+		snapshot[k] = c.Snapshot()
+	}
+	return snapshot
+}
+
+func (s AtomicVirtualSelector[K]) SumVisits() int {
+	sum := 0
+	for _, c := range s {
+		sum += c.Visits()
+	}
+	return sum
+}
+
+func (s AtomicVirtualSelector[K]) VisitRatioByKey() map[K]float32 {
+	return s.Snapshot().VisitRatioByKey()
+}
+
+// MaxKeys は、各行動の統計を1度ずつ読み出し、読み出した値の中で U が最大の行動を返す。
+// 読み出しの途中で他のワーカーが統計を更新しても、訪問回数の合計は読み出した値から計算する為、矛盾しない。
+func (s AtomicVirtualSelector[K]) MaxKeys() ([]K, error) {
+	return s.MaxKeysRand(nil)
+}
+
+// MaxKeysRand は、rng を各行動の StatsFunc に渡して、MaxKeys と同じく U が最大の行動を返す。
+func (s AtomicVirtualSelector[K]) MaxKeysRand(rng *rand.Rand) ([]K, error) {
+	ks := make([]K, 0, len(s))
+	calcs := make([]*Calculator, 0, len(s))
+	for k, c := range s {
+		ks = append(ks, k)
+		calcs = append(calcs, c.Snapshot())
+	}
+	return maxKeysOf(ks, calcs, rng)
+}
+
+func (s AtomicVirtualSelector[K]) Select(rng *rand.Rand) (K, error) {
+	ks, err := s.MaxKeysRand(rng)
+	if err != nil {
+		var zero K
+		return zero, err
+	}
+	return randx.Choice(ks, rng)
+}
@@ -0,0 +1,151 @@
+package pucb
+
+import (
+	"fmt"
+)
+
+type FPUMode int
+
+const (
+	// FPUConstant は、未訪問の行動の Q を FPU.Value とする。ゼロ値の FPU は、Q = 0 の FPUConstant。
+	FPUConstant FPUMode = iota
+	// FPUParentQ は、未訪問の行動の Q を、親ノードの Q から FPU.Value を引いた値とする。
+	// 親ノードの Q は、兄弟の行動の観測値の平均。観測が無い場合は0とする。
+	FPUParentQ
+	// FPULoss は、未訪問の行動の Q を、兄弟の行動の観測値の最小値とし、未訪問の行動を負けと同等に扱う。
+	// 値の範囲を知らなくても使える。観測が無い場合は FPU.Value とする。
+	FPULoss
+)
+
+func (m FPUMode) String() string {
+	switch m {
+	case FPUConstant:
+		return "Constant"
+	case FPUParentQ:
+		return "ParentQ"
+	case FPULoss:
+		return "Loss"
+	default:
+		return fmt.Sprintf("FPUMode(%d)", int(m))
+	}
+}
+
+// FPU (First Play Urgency) は、まだ訪問していない行動の Q の決め方。ゼロ値は、Q = 0 とする FPUConstant。
+type FPU struct {
+	Mode  FPUMode
+	Value float32
+}
+
+func (f FPU) Validate() error {
+	if f.Mode < FPUConstant || f.Mode > FPULoss {
+		return fmt.Errorf("FPU.Modeが不正: Mode = %v", f.Mode)
+	}
+
+	if isNaN32(f.Value) || isInf32(f.Value) {
+		return fmt.Errorf("FPU.Valueが不正(NaN/Inf): Value=%.6g", f.Value)
+	}
+	return nil
+}
+
+// parentStats は、FPU の計算に使う、兄弟の行動の観測値の統計。
+type parentStats struct {
+	// ok は、兄弟の行動に1つでも観測があるか。
+	ok  bool
+	q   float32
+	min float32
+}
+
+// newParentStats は、calcs の観測値の統計を返す。pending は含めない。
+func newParentStats(calcs []*Calculator) parentStats {
+	var ps parentStats
+	var w float32
+	visits := 0
+	for _, c := range calcs {
+		if c.visits == 0 {
+			continue
+		}
+		w += c.w
+		visits += c.visits
+
+		// Observe を使わずに訪問回数を増やした場合は、観測値の最小値を持たない
+		if c.observations == 0 {
+			continue
+		}
+		if !ps.ok || c.min < ps.min {
+			ps.min = c.min
+		}
+		ps.ok = true
+	}
+
+	if visits != 0 {
+		ps.q = w / float32(visits)
+	}
+	return ps
+}
+
+// q は、parent を兄弟の行動の統計として、未訪問の行動の Q を返す。
+func (f FPU) q(parent parentStats) float32 {
+	switch f.Mode {
+	case FPUParentQ:
+		return parent.q - f.Value
+	case FPULoss:
+		if parent.ok {
+			return parent.min
+		}
+		return f.Value
+	default:
+		return f.Value
+	}
+}
+
+type VirtualLossMode int
+
+const (
+	// VirtualLossConstant は、pending 1つを、VirtualValue を観測した1回の訪問として扱う。ゼロ値の VirtualLoss。
+	VirtualLossConstant VirtualLossMode = iota
+	// VirtualVisit は、pending 1つを、Q を変えない1回の訪問として扱う。訪問回数だけが増え、探索項が小さくなる。
+	VirtualVisit
+	// VirtualLossScaled は、pending 1つを、VirtualValue を観測した VirtualLoss.Scale 回の訪問として扱う。
+	// 同じ行動に集中する選択を、VirtualLossConstant より強く抑える。
+	VirtualLossScaled
+)
+
+func (m VirtualLossMode) String() string {
+	switch m {
+	case VirtualLossConstant:
+		return "Constant"
+	case VirtualVisit:
+		return "VirtualVisit"
+	case VirtualLossScaled:
+		return "Scaled"
+	default:
+		return fmt.Sprintf("VirtualLossMode(%d)", int(m))
+	}
+}
+
+// VirtualLoss は、選択済みで未観測(pending)の行動の統計の扱い方。
+// ゼロ値は、pending を VirtualValue を観測した訪問として扱う VirtualLossConstant。
+type VirtualLoss struct {
+	Mode VirtualLossMode
+	// Scale は、VirtualLossScaled で pending 1つを何回の訪問として扱うか。他のモードでは使わない。
+	Scale int
+}
+
+func (v VirtualLoss) Validate() error {
+	if v.Mode < VirtualLossConstant || v.Mode > VirtualLossScaled {
+		return fmt.Errorf("VirtualLoss.Modeが不正: Mode = %v", v.Mode)
+	}
+
+	if v.Mode == VirtualLossScaled && v.Scale <= 0 {
+		return fmt.Errorf("VirtualLoss.Scaleが不正: Scale = %d: Scale > 0 であるべき", v.Scale)
+	}
+	return nil
+}
+
+// weight は、pending 1つを何回の訪問として扱うかを返す。
+func (v VirtualLoss) weight() int {
+	if v.Mode == VirtualLossScaled {
+		return v.Scale
+	}
+	return 1
+}
@@ -0,0 +1,74 @@
+package pucb
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+// MinMaxStats は、探索木全体で観測した値の最小値と最大値を持ち、Q を [0, 1] に正規化する(MuZero)。
+// 報酬の範囲が分からないゲーム(一人用のパズルや得点制のゲーム)でも、Q を探索項と同じ尺度で扱える。
+// 最小値と最大値は1つの64ビット値に詰めて atomic に更新する為、複数のワーカーから同時に使える。
+// ゼロ値は、まだ値を観測していない MinMaxStats として使える。
+//
+// https://arxiv.org/abs/1911.08265
+type MinMaxStats struct {
+	// bounds は、上位32ビットに最小値、下位32ビットに最大値を、float32 のビット列で持つ。
+	// ゼロ値が観測無し(最小値 +Inf、最大値 -Inf)になる様に、emptyBounds との排他的論理和で持つ。
+	bounds atomic.Uint64
+}
+
+var emptyBounds = uint64(math.Float32bits(float32(math.Inf(1))))<<32 | uint64(math.Float32bits(float32(math.Inf(-1))))
+
+func packBounds(lo, hi float32) uint64 {
+	return (uint64(math.Float32bits(lo))<<32 | uint64(math.Float32bits(hi))) ^ emptyBounds
+}
+
+func unpackBounds(v uint64) (float32, float32) {
+	v ^= emptyBounds
+	return math.Float32frombits(uint32(v >> 32)), math.Float32frombits(uint32(v))
+}
+
+// NewMinMaxStats は、まだ値を観測していない MinMaxStats を返す。
+func NewMinMaxStats() *MinMaxStats {
+	return &MinMaxStats{}
+}
+
+// Update は、v を観測した値として、最小値と最大値を更新する。
+func (s *MinMaxStats) Update(v float32) error {
+	if isNaN32(v) || isInf32(v) {
+		return fmt.Errorf("vが不正(NaN/Inf): v=%.6g", v)
+	}
+
+	for {
+		old := s.bounds.Load()
+		lo, hi := unpackBounds(old)
+		if v >= lo && v <= hi {
+			return nil
+		}
+
+		if s.bounds.CompareAndSwap(old, packBounds(min(lo, v), max(hi, v))) {
+			return nil
+		}
+	}
+}
+
+// Bounds は、観測した値の最小値と最大値を返す。観測が無い場合、ok は false。
+func (s *MinMaxStats) Bounds() (lo, hi float32, ok bool) {
+	lo, hi = unpackBounds(s.bounds.Load())
+	return lo, hi, lo <= hi
+}
+
+// Normalize は、q を観測した値の範囲で [0, 1] に正規化する。
+// s が nil の場合や、最大値が最小値より大きくない(観測が2種類未満の)場合は、q をそのまま返す。
+func (s *MinMaxStats) Normalize(q float32) float32 {
+	if s == nil {
+		return q
+	}
+
+	lo, hi, ok := s.Bounds()
+	if !ok || hi <= lo {
+		return q
+	}
+	return (q - lo) / (hi - lo)
+}
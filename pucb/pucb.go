@@ -12,9 +12,11 @@ package pucb
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"math"
 	"math/rand/v2"
 
+	"github.com/sw965/crow/game"
 	"github.com/sw965/omw/mathx/randx"
 )
 
@@ -61,15 +63,240 @@ func NewAlphaZeroFunc(cInit, cBase float32) (Func, error) {
 	}, nil
 }
 
+// Stats は、StatsFunc に渡す、1つの行動の統計。
+type Stats struct {
+	// Q、P、SumVisits、Visits は、Func に渡す値と同じ。Visits と Q は pending を含む。
+	Q         float32
+	P         float32
+	SumVisits int
+	Visits    int
+	// Observations は、観測した回数。pending を含まない。
+	Observations int
+	// Mean、Variance、Min、Max は、観測した値の平均・分散(標本数で割る)・最小値・最大値。
+	// 観測が無い場合は全て0。
+	Mean     float32
+	Variance float32
+	Min      float32
+	Max      float32
+}
+
+// StatsFunc は、Func より多くの統計を使って、行動の U を計算する。
+// Calculator.StatsFunc(及び各 MCTS の Engine.PUCBStatsFunc)に設定すると、Func の代わりに使う。
+// 分散等を使う式(NewUCB1TunedFunc 等)は、StatsFunc としてだけ提供する。
+// rng は、Thompson sampling のように乱数を使う関数の為に渡す。nil の場合もある為、乱数を使う関数は nil を扱う事。
+type StatsFunc func(s Stats, rng *rand.Rand) float32
+
+// StatsFunc は、f を StatsFunc に変換する。
+func (f Func) StatsFunc() StatsFunc {
+	return func(s Stats, _ *rand.Rand) float32 {
+		return f(s.Q, s.P, s.SumVisits, s.Visits)
+	}
+}
+
+// unvisitedU は、UCB系の式で、まだ訪問していない行動に与える U。どの訪問済みの行動よりも先に選ばれる。
+const unvisitedU float32 = math.MaxFloat32
+
+// NewUCB1TunedFunc は、UCB1-Tuned の StatsFunc を返す。観測値は [0, 1] の範囲にあるものとする。
+// U = Q + sqrt(ln(N)/n * min(1/4, V + sqrt(2ln(N)/n)))。P は使わない。
+//
+// https://doi.org/10.1023/A:1013689704352
+func NewUCB1TunedFunc() StatsFunc {
+	return func(s Stats, _ *rand.Rand) float32 {
+		if s.Visits == 0 {
+			return unvisitedU
+		}
+		n := float64(s.Visits)
+		logN := math.Log(float64(s.SumVisits))
+		v := float64(s.Variance) + math.Sqrt(2.0*logN/n)
+		return s.Q + float32(math.Sqrt(logN/n*min(0.25, v)))
+	}
+}
+
+// NewUCBVFunc は、UCB-V の StatsFunc を返す。b は観測値の範囲の幅、zeta と c は探索の強さ。
+// U = Q + sqrt(2V·zeta·ln(N)/n) + 3c·b·zeta·ln(N)/n。P は使わない。
+//
+// https://doi.org/10.1016/j.tcs.2009.01.016
+func NewUCBVFunc(b, zeta, c float32) (StatsFunc, error) {
+	if b <= 0 || isNaN32(b) || isInf32(b) {
+		return nil, fmt.Errorf("bが不正(<=0/NaN/Inf): b=%.6g", b)
+	}
+
+	if zeta <= 0 || isNaN32(zeta) || isInf32(zeta) {
+		return nil, fmt.Errorf("zetaが不正(<=0/NaN/Inf): zeta=%.6g", zeta)
+	}
+
+	if c <= 0 || isNaN32(c) || isInf32(c) {
+		return nil, fmt.Errorf("cが不正(<=0/NaN/Inf): c=%.6g", c)
+	}
+
+	return func(s Stats, _ *rand.Rand) float32 {
+		if s.Visits == 0 {
+			return unvisitedU
+		}
+		n := float64(s.Visits)
+		e := float64(zeta) * math.Log(float64(s.SumVisits))
+		exploration := math.Sqrt(2.0*float64(s.Variance)*e/n) + 3.0*float64(c*b)*e/n
+		return s.Q + float32(exploration)
+	}, nil
+}
+
+// klUCBIterations は、KL-UCB の上限を二分探索する回数。
+const klUCBIterations = 32
+
+// bernoulliKL は、ベルヌーイ分布 p と q の KL ダイバージェンス。
+func bernoulliKL(p, q float64) float64 {
+	const e = 1e-12
+	p = min(max(p, e), 1-e)
+	q = min(max(q, e), 1-e)
+	return p*math.Log(p/q) + (1-p)*math.Log((1-p)/(1-q))
+}
+
+// NewKLUCBFunc は、ベルヌーイ分布の KL ダイバージェンスを使う KL-UCB の StatsFunc を返す。
+// 観測値は [lo, hi] の範囲にあるものとし、Q を [0, 1] に変換して
+// n·KL(Q, q) <= ln(N) + c·ln(ln(N)) を満たす最大の q を、[lo, hi] に戻して返す。P は使わない。
+//
+// https://arxiv.org/abs/1102.2490
+func NewKLUCBFunc(lo, hi, c float32) (StatsFunc, error) {
+	if isNaN32(lo) || isInf32(lo) || isNaN32(hi) || isInf32(hi) || lo >= hi {
+		return nil, fmt.Errorf("lo・hiが不正: lo=%.6g, hi=%.6g: lo < hi であるべき", lo, hi)
+	}
+
+	if c < 0 || isNaN32(c) || isInf32(c) {
+		return nil, fmt.Errorf("cが不正(<0/NaN/Inf): c=%.6g", c)
+	}
+
+	width := float64(hi - lo)
+	return func(s Stats, _ *rand.Rand) float32 {
+		if s.Visits == 0 {
+			return unvisitedU
+		}
+
+		q := min(max((float64(s.Q)-float64(lo))/width, 0.0), 1.0)
+		logN := math.Log(float64(s.SumVisits))
+		bound := logN
+		if logN > 1.0 {
+			bound += float64(c) * math.Log(logN)
+		}
+		bound /= float64(s.Visits)
+
+		low, high := q, 1.0
+		for range klUCBIterations {
+			mid := (low + high) / 2.0
+			if bernoulliKL(q, mid) <= bound {
+				low = mid
+			} else {
+				high = mid
+			}
+		}
+		return lo + float32(low*width)
+	}, nil
+}
+
+// NewThompsonFunc は、平均 Q・分散 (Variance + priorVariance) / (n + 1) の正規分布から U を標本する、
+// Thompson sampling の StatsFunc を返す。priorVariance は、観測が少ない間の探索の強さ。P は使わない。
+// rng が nil の場合は、標本せずに Q を返す。
+func NewThompsonFunc(priorVariance float32) (StatsFunc, error) {
+	if priorVariance <= 0 || isNaN32(priorVariance) || isInf32(priorVariance) {
+		return nil, fmt.Errorf("priorVarianceが不正(<=0/NaN/Inf): priorVariance=%.6g", priorVariance)
+	}
+
+	return func(s Stats, rng *rand.Rand) float32 {
+		if rng == nil {
+			return s.Q
+		}
+		std := math.Sqrt(float64(s.Variance+priorVariance) / float64(s.Visits+1))
+		return s.Q + float32(rng.NormFloat64()*std)
+	}, nil
+}
+
 type Calculator struct {
-	Func   Func
-	P      float32
-	w      float32
-	visits int
+	Func Func
+	// StatsFunc が nil でない場合、Func の代わりに使う。
+	StatsFunc StatsFunc
+	P         float32
+	w         float32
+	visits    int
 	// pending は「選択済みだが、まだ結果を観測していない」回数。
 	// 並列探索で複数のワーカーが同じ行動に集中しないようにする、virtual lossの仕組みに使う。
 	pending      int
 	VirtualValue float32
+	// FPU は、未訪問の行動の Q の決め方。親ノードの統計を使うモードは、VirtualSelector を通して選択する場合だけ親の統計を使う。
+	FPU FPU
+	// VirtualLoss は、pending の行動の統計の扱い方。
+	VirtualLoss VirtualLoss
+	// MinMax が nil でない場合、U の計算に使う Q を MinMax で正規化する。FPU の FPUConstant の値は正規化しない。
+	MinMax *MinMaxStats
+	// observations・mean・m2・min・max は、Observe で記録した値の統計(Welford法)。
+	observations int
+	mean         float64
+	m2           float64
+	min          float32
+	max          float32
+}
+
+// Observe は、v を1回の観測として記録する。AddW と IncrementVisits に加え、観測値の平均・分散・最小値・最大値を更新する。
+// AddW と IncrementVisits を直接呼んだ場合、これらの統計は更新されない。
+func (c *Calculator) Observe(v float32) error {
+	if err := c.AddW(v); err != nil {
+		return err
+	}
+	c.IncrementVisits()
+
+	if c.observations == 0 || v < c.min {
+		c.min = v
+	}
+	if c.observations == 0 || v > c.max {
+		c.max = v
+	}
+
+	c.observations += 1
+	delta := float64(v) - c.mean
+	c.mean += delta / float64(c.observations)
+	c.m2 += delta * (float64(v) - c.mean)
+	return nil
+}
+
+// Observations は、Observe で記録した回数を返す。
+func (c *Calculator) Observations() int {
+	return c.observations
+}
+
+// Mean は、観測値の平均を返す。Q と異なり、pending を含まない。
+func (c *Calculator) Mean() float32 {
+	return float32(c.mean)
+}
+
+// Variance は、観測値の分散(標本数で割る)を返す。観測が2回未満の場合は0。
+func (c *Calculator) Variance() float32 {
+	if c.observations < 2 {
+		return 0.0
+	}
+	return float32(c.m2 / float64(c.observations))
+}
+
+// Min は、観測値の最小値を返す。観測が無い場合は0。
+func (c *Calculator) Min() float32 {
+	return c.min
+}
+
+// Max は、観測値の最大値を返す。観測が無い場合は0。
+func (c *Calculator) Max() float32 {
+	return c.max
+}
+
+// Stats は、sumVisits を総訪問回数とした、StatsFunc に渡す統計を返す。
+func (c *Calculator) Stats(sumVisits int) Stats {
+	return Stats{
+		Q:            c.Q(),
+		P:            c.P,
+		SumVisits:    sumVisits,
+		Visits:       c.Visits(),
+		Observations: c.observations,
+		Mean:         c.Mean(),
+		Variance:     c.Variance(),
+		Min:          c.min,
+		Max:          c.max,
+	}
 }
 
 func (c *Calculator) AddW(v float32) error {
@@ -101,20 +328,46 @@ func (c *Calculator) DecrementPending() error {
 }
 
 func (c *Calculator) Visits() int {
-	return c.visits + c.pending
+	return c.visits + c.pending*c.VirtualLoss.weight()
 }
 
 func (c *Calculator) W() float32 {
-	return c.w + (c.VirtualValue * float32(c.pending))
+	if c.VirtualLoss.Mode == VirtualVisit {
+		if c.visits == 0 {
+			return 0.0
+		}
+		// pending の訪問にも、観測した値の平均を割り当てる
+		return c.w + c.w/float32(c.visits)*float32(c.pending)
+	}
+	return c.w + (c.VirtualValue * float32(c.pending*c.VirtualLoss.weight()))
 }
 
+// Q は、親ノードの統計が無いものとして FPU を計算する。
 func (c *Calculator) Q() float32 {
-	visits := c.Visits()
-	if visits == 0 {
-		return 0.0
+	return c.q(c.FPU.q(parentStats{}))
+}
+
+// unvisited は、Q を FPU で決めるかを返す。
+func (c *Calculator) unvisited() bool {
+	return c.visits == 0 && (c.pending == 0 || c.VirtualLoss.Mode == VirtualVisit)
+}
+
+// q は、未訪問の行動の Q を fpuQ として、Q を返す。
+func (c *Calculator) q(fpuQ float32) float32 {
+	if c.unvisited() {
+		return fpuQ
+	}
+	return c.W() / float32(c.Visits())
+}
+
+// selectionQ は、U の計算に使う Q を返す。MinMax がある場合、Q と親ノードの統計を正規化する。
+func (c *Calculator) selectionQ(parent parentStats) float32 {
+	if c.unvisited() {
+		parent.q = c.MinMax.Normalize(parent.q)
+		parent.min = c.MinMax.Normalize(parent.min)
+		return c.FPU.q(parent)
 	}
-	w := c.W()
-	return w / float32(visits)
+	return c.MinMax.Normalize(c.W() / float32(c.Visits()))
 }
 
 func (c *Calculator) ValidateForSumVisits(sumVisits int) error {
@@ -131,20 +384,41 @@ func (c *Calculator) ValidateForSumVisits(sumVisits int) error {
 		return fmt.Errorf("Pが不正(負/NaN/Inf): P=%.6g", c.P)
 	}
 
-	if c.Func == nil {
-		return errors.New("Funcが未初期化(nil)")
+	if c.Func == nil && c.StatsFunc == nil {
+		return errors.New("FuncとStatsFuncが未初期化(nil)")
 	}
-	return nil
+
+	if err := c.FPU.Validate(); err != nil {
+		return err
+	}
+	return c.VirtualLoss.Validate()
 }
 
 func (c *Calculator) U(sumVisits int) (float32, error) {
+	return c.URand(sumVisits, nil)
+}
+
+// URand は、rng を StatsFunc に渡して U を計算する。Func を使う場合は U と同じ。
+func (c *Calculator) URand(sumVisits int, rng *rand.Rand) (float32, error) {
+	return c.u(sumVisits, parentStats{}, rng)
+}
+
+// u は、parent を兄弟の行動の統計として FPU を計算し、U を返す。
+func (c *Calculator) u(sumVisits int, parent parentStats, rng *rand.Rand) (float32, error) {
 	if err := c.ValidateForSumVisits(sumVisits); err != nil {
 		return 0.0, err
 	}
 
 	visits := c.Visits()
-	q := c.Q()
-	u := c.Func(q, c.P, sumVisits, visits)
+	q := c.selectionQ(parent)
+	var u float32
+	if c.StatsFunc != nil {
+		stats := c.Stats(sumVisits)
+		stats.Q = q
+		u = c.StatsFunc(stats, rng)
+	} else {
+		u = c.Func(q, c.P, sumVisits, visits)
+	}
 
 	if isNaN32(u) || isInf32(u) {
 		return 0.0, fmt.Errorf(
@@ -188,45 +462,91 @@ func (s VirtualSelector[K]) VisitRatioByKey() map[K]float32 {
 	return m
 }
 
+// NewSearchStats は、探索後のルートノードのセレクタから、探索の統計を作る。
+// rootValueByAgent は複製して持つ。
+func NewSearchStats[Ac, Ag comparable](s VirtualSelector[Ac], simulations int, rootValueByAgent map[Ag]float32) *game.SearchStats[Ac, Ag] {
+	stats := &game.SearchStats[Ac, Ag]{
+		Simulations:      simulations,
+		VisitsByAction:   make(map[Ac]int, len(s)),
+		QByAction:        make(map[Ac]float32, len(s)),
+		PriorByAction:    make(map[Ac]float32, len(s)),
+		RootValueByAgent: maps.Clone(rootValueByAgent),
+	}
+	for action, c := range s {
+		stats.VisitsByAction[action] = c.Visits()
+		stats.QByAction[action] = c.Q()
+		stats.PriorByAction[action] = c.P
+	}
+	return stats
+}
+
 const eps float32 = 0.0001
 
 func (s VirtualSelector[K]) MaxKeys() ([]K, error) {
-	sum := s.SumVisits()
-	ks := make([]K, 0, len(s))
-	var max float32
-	first := true
+	return s.MaxKeysRand(nil)
+}
 
+// MaxKeysRand は、rng を各行動の StatsFunc に渡して、U が最大の行動を返す。
+// 未訪問の行動の Q は、各行動の FPU に、全ての行動の観測値の統計を親ノードの統計として渡して決める。
+func (s VirtualSelector[K]) MaxKeysRand(rng *rand.Rand) ([]K, error) {
+	ks := make([]K, 0, len(s))
+	calcs := make([]*Calculator, 0, len(s))
 	for k, c := range s {
-		u, err := c.U(sum)
+		ks = append(ks, k)
+		calcs = append(calcs, c)
+	}
+	return maxKeysOf(ks, calcs, rng)
+}
+
+// maxKeysOf は、calcs[i] の U が最大の ks[i] を返す。
+func maxKeysOf[K comparable](ks []K, calcs []*Calculator, rng *rand.Rand) ([]K, error) {
+	sum := 0
+	for _, c := range calcs {
+		sum += c.Visits()
+	}
+
+	parent := newParentStats(calcs)
+	us := make([]float32, len(calcs))
+	for i, c := range calcs {
+		u, err := c.u(sum, parent, rng)
 		if err != nil {
 			return nil, err
 		}
+		us[i] = u
+	}
+	return maxKeys(ks, us), nil
+}
 
-		if first {
+// maxKeys は、us[i] が最大の ks[i] を、誤差 eps 以内の同率も含めて返す。ks を上書きして使う。
+func maxKeys[K comparable](ks []K, us []float32) []K {
+	maxKs := ks[:0]
+	var max float32
+	for i, k := range ks {
+		u := us[i]
+		if i == 0 {
 			max = u
-			ks = append(ks, k)
-			first = false
+			maxKs = append(maxKs, k)
 			continue
 		}
 
 		// 「明確に」最大更新（eps以上 上なら max 更新して候補を入れ替え）
 		if u > max+eps {
 			max = u
-			ks = ks[:0]
-			ks = append(ks, k)
+			maxKs = maxKs[:0]
+			maxKs = append(maxKs, k)
 			continue
 		}
 
 		// 誤差 eps 以内なら同率扱い
 		if float32(math.Abs(float64(u-max))) <= eps {
-			ks = append(ks, k)
+			maxKs = append(maxKs, k)
 		}
 	}
-	return ks, nil
+	return maxKs
 }
 
 func (s VirtualSelector[K]) Select(rng *rand.Rand) (K, error) {
-	ks, err := s.MaxKeys()
+	ks, err := s.MaxKeysRand(rng)
 	if err != nil {
 		var zero K
 		return zero, err
@@ -2,6 +2,7 @@ package pucb_test
 
 import (
 	"math"
+	"sync"
 	"testing"
 
 	"github.com/sw965/crow/pucb"
@@ -200,6 +201,40 @@ func TestVirtualSelectorVisitRatioByKey(t *testing.T) {
 	})
 }
 
+func TestNewSearchStats(t *testing.T) {
+	s := pucb.VirtualSelector[string]{
+		"a": &pucb.Calculator{P: 0.7},
+		"b": &pucb.Calculator{P: 0.3},
+	}
+	for _, v := range []float32{1.0, 0.5} {
+		s["a"].IncrementVisits()
+		if err := s["a"].AddW(v); err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+	}
+
+	rootValueByAgent := map[int]float32{0: 0.75}
+	stats := pucb.NewSearchStats(s, 2, rootValueByAgent)
+	if stats.Simulations != 2 {
+		t.Errorf("シミュレーション数の不一致: got = %d, want = 2", stats.Simulations)
+	}
+	if stats.VisitsByAction["a"] != 2 || stats.VisitsByAction["b"] != 0 {
+		t.Errorf("訪問回数の不一致: got = %v", stats.VisitsByAction)
+	}
+	if math.Abs(float64(stats.QByAction["a"])-0.75) > 0.0001 {
+		t.Errorf("Qの不一致: got = %f, want = 0.75", stats.QByAction["a"])
+	}
+	if stats.PriorByAction["a"] != 0.7 || stats.PriorByAction["b"] != 0.3 {
+		t.Errorf("事前確率の不一致: got = %v", stats.PriorByAction)
+	}
+
+	// ルートノードの価値は複製して持つ
+	rootValueByAgent[0] = 0.0
+	if stats.RootValueByAgent[0] != 0.75 {
+		t.Errorf("ルートノードの価値の不一致: got = %f, want = 0.75", stats.RootValueByAgent[0])
+	}
+}
+
 func TestVirtualSelectorMaxKeysAndSelect(t *testing.T) {
 	alphaGo := pucb.NewAlphaGoFunc(1.0)
 
@@ -258,3 +293,617 @@ func TestVirtualSelectorMaxKeysAndSelect(t *testing.T) {
 		}
 	})
 }
+
+func TestAtomicCalculator(t *testing.T) {
+	t.Run("正常_Calculatorと同じ統計", func(t *testing.T) {
+		c := &pucb.Calculator{Func: pucb.NewAlphaGoFunc(1.0), P: 0.3, VirtualValue: 0.5}
+		ac := &pucb.AtomicCalculator{Func: pucb.NewAlphaGoFunc(1.0), P: 0.3, VirtualValue: 0.5}
+		for _, v := range []float32{1.0, 0.0, 0.25} {
+			c.IncrementPending()
+			ac.IncrementPending()
+			if err := c.DecrementPending(); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if err := c.AddW(v); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			c.IncrementVisits()
+			if err := ac.Observe(v); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+		}
+		c.IncrementPending()
+		ac.IncrementPending()
+
+		if c.Visits() != ac.Visits() || c.Pending() != ac.Pending() {
+			t.Errorf("訪問回数の不一致: got = (%d, %d), want = (%d, %d)", ac.Visits(), ac.Pending(), c.Visits(), c.Pending())
+		}
+		if math.Abs(float64(c.W()-ac.W())) > 1e-6 || math.Abs(float64(c.Q()-ac.Q())) > 1e-6 {
+			t.Errorf("W・Qの不一致: got = (%f, %f), want = (%f, %f)", ac.W(), ac.Q(), c.W(), c.Q())
+		}
+
+		u, err := c.U(10)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		au, err := ac.Snapshot().U(10)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if u != au {
+			t.Errorf("Uの不一致: got = %f, want = %f", au, u)
+		}
+	})
+
+	t.Run("性質_並行に更新しても失われない", func(t *testing.T) {
+		ac := &pucb.AtomicCalculator{}
+		const workers, n = 8, 1000
+		var wg sync.WaitGroup
+		for range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range n {
+					ac.IncrementPending()
+					if err := ac.Observe(0.5); err != nil {
+						t.Errorf("予期せぬエラー: %v", err)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		if got := ac.Visits(); got != workers*n {
+			t.Errorf("Visitsの不一致: got = %d, want = %d", got, workers*n)
+		}
+		if got := ac.Pending(); got != 0 {
+			t.Errorf("Pendingの不一致: got = %d, want = 0", got)
+		}
+		if got := ac.W(); math.Abs(float64(got)-workers*n*0.5) > 0.0001 {
+			t.Errorf("Wの不一致: got = %f, want = %f", got, workers*n*0.5)
+		}
+	})
+
+	t.Run("異常_pendingのunderflow", func(t *testing.T) {
+		ac := &pucb.AtomicCalculator{}
+		if err := ac.DecrementPending(); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+		if err := ac.Observe(1.0); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_ObserveにNaN", func(t *testing.T) {
+		ac := &pucb.AtomicCalculator{}
+		ac.IncrementPending()
+		if err := ac.Observe(float32(math.NaN())); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+		// 不正な値では何も変更しない
+		if ac.Pending() != 1 || ac.Visits() != 1 {
+			t.Errorf("統計が変更された: pending = %d, visits = %d", ac.Pending(), ac.Visits())
+		}
+	})
+}
+
+func TestAtomicVirtualSelector(t *testing.T) {
+	alphaGo := pucb.NewAlphaGoFunc(1.0)
+
+	t.Run("正常_VirtualSelectorと同じ行動を選ぶ", func(t *testing.T) {
+		s := pucb.VirtualSelector[string]{
+			"high": &pucb.Calculator{Func: alphaGo, P: 0.9},
+			"low":  &pucb.Calculator{Func: alphaGo, P: 0.1},
+		}
+		as := pucb.AtomicVirtualSelector[string]{
+			"high": &pucb.AtomicCalculator{Func: alphaGo, P: 0.9},
+			"low":  &pucb.AtomicCalculator{Func: alphaGo, P: 0.1},
+		}
+		for _, k := range []string{"high", "low"} {
+			s[k].IncrementVisits()
+			as[k].IncrementVisits()
+		}
+
+		want, err := s.MaxKeys()
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		got, err := as.MaxKeys()
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if len(got) != 1 || got[0] != want[0] {
+			t.Errorf("MaxKeysの不一致: got = %v, want = %v", got, want)
+		}
+
+		if as.SumVisits() != s.SumVisits() {
+			t.Errorf("SumVisitsの不一致: got = %d, want = %d", as.SumVisits(), s.SumVisits())
+		}
+
+		snapshot := as.Snapshot()
+		as["high"].IncrementVisits()
+		if got := snapshot["high"].Visits(); got != 1 {
+			t.Errorf("スナップショットが更新の影響を受けた: got = %d, want = 1", got)
+		}
+	})
+
+	t.Run("異常_Funcがnilの場合はSelectがエラー", func(t *testing.T) {
+		as := pucb.AtomicVirtualSelector[string]{
+			"a": &pucb.AtomicCalculator{},
+		}
+		if _, err := as.Select(randx.NewPCG()); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestCalculatorObserve(t *testing.T) {
+	t.Run("正常_平均・分散・最小値・最大値", func(t *testing.T) {
+		c := &pucb.Calculator{VirtualValue: 0.5}
+		for _, v := range []float32{2, 4, 4, 4, 5, 5, 7, 9} {
+			if err := c.Observe(v); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+		}
+		// pending は観測値の統計に含まれない
+		c.IncrementPending()
+
+		if got := c.Observations(); got != 8 {
+			t.Errorf("Observationsの不一致: got = %d, want = 8", got)
+		}
+		if got := c.Visits(); got != 9 {
+			t.Errorf("Visitsの不一致: got = %d, want = 9", got)
+		}
+		if got := c.Mean(); math.Abs(float64(got)-5.0) > 1e-5 {
+			t.Errorf("Meanの不一致: got = %f, want = 5.0", got)
+		}
+		if got := c.Variance(); math.Abs(float64(got)-4.0) > 1e-5 {
+			t.Errorf("Varianceの不一致: got = %f, want = 4.0", got)
+		}
+		if c.Min() != 2 || c.Max() != 9 {
+			t.Errorf("Min・Maxの不一致: got = (%f, %f), want = (2, 9)", c.Min(), c.Max())
+		}
+
+		s := c.Stats(20)
+		if s.SumVisits != 20 || s.Visits != 9 || s.Q != c.Q() || s.Variance != c.Variance() {
+			t.Errorf("Statsの不一致: got = %+v", s)
+		}
+	})
+
+	t.Run("異常_NaNは記録しない", func(t *testing.T) {
+		c := &pucb.Calculator{}
+		if err := c.Observe(float32(math.NaN())); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+		if c.Observations() != 0 || c.Visits() != 0 {
+			t.Errorf("統計が変更された: observations = %d, visits = %d", c.Observations(), c.Visits())
+		}
+	})
+}
+
+func TestStatsFunc(t *testing.T) {
+	ucbV, err := pucb.NewUCBVFunc(1.0, 1.0, 1.0)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	klUCB, err := pucb.NewKLUCBFunc(0.0, 1.0, 0.0)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	thompson, err := pucb.NewThompsonFunc(0.25)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	funcs := []struct {
+		name string
+		f    pucb.StatsFunc
+	}{
+		{name: "UCB1-Tuned", f: pucb.NewUCB1TunedFunc()},
+		{name: "UCB-V", f: ucbV},
+		{name: "KL-UCB", f: klUCB},
+	}
+
+	for _, tc := range funcs {
+		t.Run("性質_"+tc.name+"_未訪問の行動が先に選ばれる", func(t *testing.T) {
+			s := pucb.VirtualSelector[string]{
+				"visited":   &pucb.Calculator{StatsFunc: tc.f},
+				"unvisited": &pucb.Calculator{StatsFunc: tc.f},
+			}
+			if err := s["visited"].Observe(1.0); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			ks, err := s.MaxKeys()
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if len(ks) != 1 || ks[0] != "unvisited" {
+				t.Errorf("MaxKeysの不一致: got = %v, want = [unvisited]", ks)
+			}
+		})
+
+		t.Run("性質_"+tc.name+"_Qに探索項を加えた値", func(t *testing.T) {
+			stats := pucb.Stats{Q: 0.5, SumVisits: 100, Visits: 10, Observations: 10, Mean: 0.5, Variance: 0.25}
+			u := tc.f(stats, nil)
+			if u <= stats.Q {
+				t.Errorf("UがQ以下: got = %f, Q = %f", u, stats.Q)
+			}
+
+			// 訪問回数が増えると探索項は小さくなる
+			more := stats
+			more.Visits = 50
+			more.Observations = 50
+			if got := tc.f(more, nil); got >= u {
+				t.Errorf("訪問回数が増えても探索項が小さくならない: got = %f, before = %f", got, u)
+			}
+		})
+	}
+
+	t.Run("理論値_UCB1-Tuned", func(t *testing.T) {
+		stats := pucb.Stats{Q: 0.5, SumVisits: 100, Visits: 10, Variance: 0.01}
+		logN := math.Log(100)
+		want := 0.5 + math.Sqrt(logN/10*math.Min(0.25, 0.01+math.Sqrt(2*logN/10)))
+		if got := pucb.NewUCB1TunedFunc()(stats, nil); math.Abs(float64(got)-want) > 1e-5 {
+			t.Errorf("Uの不一致: got = %f, want = %f", got, want)
+		}
+	})
+
+	t.Run("理論値_KL-UCBの上限はKLの制約を満たす", func(t *testing.T) {
+		stats := pucb.Stats{Q: 0.3, SumVisits: 100, Visits: 20}
+		q := float64(klUCB(stats, nil))
+		kl := 0.3*math.Log(0.3/q) + 0.7*math.Log(0.7/(1-q))
+		if want := math.Log(100) / 20; math.Abs(kl-want) > 1e-4 {
+			t.Errorf("KLの不一致: got = %f, want = %f", kl, want)
+		}
+	})
+
+	t.Run("統計_Thompson samplingの標本の平均はQ", func(t *testing.T) {
+		stats := pucb.Stats{Q: 0.3, Visits: 3, Variance: 0.75}
+		rng := randx.NewPCG()
+		const n = 20000
+		var sum, sumSq float64
+		for range n {
+			u := float64(thompson(stats, rng))
+			sum += u
+			sumSq += u * u
+		}
+		mean := sum / n
+		variance := sumSq/n - mean*mean
+		if math.Abs(mean-0.3) > 0.02 {
+			t.Errorf("平均の不一致: got = %.4f, want = 0.3(±0.02)", mean)
+		}
+		// 分散は (0.75 + 0.25) / (3 + 1)
+		if math.Abs(variance-0.25) > 0.02 {
+			t.Errorf("分散の不一致: got = %.4f, want = 0.25(±0.02)", variance)
+		}
+
+		if got := thompson(stats, nil); got != 0.3 {
+			t.Errorf("rngがnilの場合のUの不一致: got = %f, want = 0.3", got)
+		}
+	})
+
+	t.Run("正常_FuncのStatsFuncはFuncと同じ値", func(t *testing.T) {
+		f := pucb.NewAlphaGoFunc(1.25)
+		stats := pucb.Stats{Q: 0.4, P: 0.2, SumVisits: 30, Visits: 5}
+		if got, want := f.StatsFunc()(stats, nil), f(0.4, 0.2, 30, 5); got != want {
+			t.Errorf("Uの不一致: got = %f, want = %f", got, want)
+		}
+	})
+
+	t.Run("異常_引数が不正", func(t *testing.T) {
+		if _, err := pucb.NewUCBVFunc(0.0, 1.0, 1.0); err == nil {
+			t.Error("エラーを期待したが、nilが返された")
+		}
+		if _, err := pucb.NewKLUCBFunc(1.0, 1.0, 0.0); err == nil {
+			t.Error("エラーを期待したが、nilが返された")
+		}
+		if _, err := pucb.NewThompsonFunc(float32(math.NaN())); err == nil {
+			t.Error("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestFPU(t *testing.T) {
+	alphaGo := pucb.NewAlphaGoFunc(1.0)
+
+	// visited は観測値 0.8 と 0.4 を持ち、unvisited は未訪問。兄弟の平均は 0.6、最小値は 0.4。
+	newSelector := func(fpu pucb.FPU) pucb.VirtualSelector[string] {
+		s := pucb.VirtualSelector[string]{
+			"visited":   &pucb.Calculator{Func: alphaGo, P: 0.5, FPU: fpu},
+			"unvisited": &pucb.Calculator{Func: alphaGo, P: 0.5, FPU: fpu},
+		}
+		for _, v := range []float32{0.8, 0.4} {
+			if err := s["visited"].Observe(v); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+		}
+		return s
+	}
+
+	tests := []struct {
+		name string
+		fpu  pucb.FPU
+		// want は、unvisited の Q
+		want float32
+	}{
+		{name: "正常_ゼロ値は0", fpu: pucb.FPU{}, want: 0.0},
+		{name: "正常_Constant", fpu: pucb.FPU{Mode: pucb.FPUConstant, Value: 0.3}, want: 0.3},
+		{name: "正常_ParentQ", fpu: pucb.FPU{Mode: pucb.FPUParentQ, Value: 0.1}, want: 0.5},
+		{name: "正常_Loss", fpu: pucb.FPU{Mode: pucb.FPULoss, Value: -1.0}, want: 0.4},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newSelector(tc.fpu)
+			// sumVisits = 2 で、visited の U = 0.6 + 0.5*sqrt(2)/3、unvisited の U = want + 0.5*sqrt(2)
+			visitedU := 0.6 + 0.5*math.Sqrt(2)/3
+			unvisitedU := float64(tc.want) + 0.5*math.Sqrt(2)
+			wantKey := "visited"
+			if unvisitedU > visitedU {
+				wantKey = "unvisited"
+			}
+
+			ks, err := s.MaxKeys()
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if len(ks) != 1 || ks[0] != wantKey {
+				t.Errorf("MaxKeysの不一致: got = %v, want = [%s]", ks, wantKey)
+			}
+		})
+	}
+
+	t.Run("性質_Lossは未訪問の行動を最小の観測値として扱う", func(t *testing.T) {
+		// P が同じなら、未訪問の探索項は大きいが、Q が最小値になる為、sumVisits が大きいと visited が選ばれる
+		s := newSelector(pucb.FPU{Mode: pucb.FPULoss})
+		for range 100 {
+			if err := s["visited"].Observe(0.6); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+		}
+		s["visited"].P = 0.99
+		s["unvisited"].P = 0.01
+
+		ks, err := s.MaxKeys()
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if len(ks) != 1 || ks[0] != "visited" {
+			t.Errorf("MaxKeysの不一致: got = %v, want = [visited]", ks)
+		}
+	})
+
+	t.Run("準正常_親に観測が無い", func(t *testing.T) {
+		c := &pucb.Calculator{Func: alphaGo, FPU: pucb.FPU{Mode: pucb.FPULoss, Value: -1.0}}
+		if got := c.Q(); got != -1.0 {
+			t.Errorf("Qの不一致: got = %f, want = -1.0", got)
+		}
+
+		c.FPU = pucb.FPU{Mode: pucb.FPUParentQ, Value: 0.2}
+		if got := c.Q(); math.Abs(float64(got)+0.2) > 1e-6 {
+			t.Errorf("Qの不一致: got = %f, want = -0.2", got)
+		}
+	})
+
+	t.Run("異常_不正な設定", func(t *testing.T) {
+		invalids := []pucb.FPU{
+			{Mode: pucb.FPUMode(-1)},
+			{Mode: pucb.FPULoss + 1},
+			{Mode: pucb.FPUConstant, Value: float32(math.NaN())},
+		}
+		for _, fpu := range invalids {
+			c := &pucb.Calculator{Func: alphaGo, FPU: fpu}
+			if _, err := c.U(0); err == nil {
+				t.Errorf("エラーを期待したが、nilが返された: fpu = %+v", fpu)
+			}
+		}
+	})
+}
+
+func TestVirtualLoss(t *testing.T) {
+	// 観測値 0.8 を2回観測し、pending が1つある行動
+	newCalculator := func(vl pucb.VirtualLoss) *pucb.Calculator {
+		c := &pucb.Calculator{Func: pucb.NewAlphaGoFunc(1.0), VirtualValue: 0.2, VirtualLoss: vl}
+		for range 2 {
+			if err := c.Observe(0.8); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+		}
+		c.IncrementPending()
+		return c
+	}
+
+	tests := []struct {
+		name       string
+		vl         pucb.VirtualLoss
+		wantVisits int
+		wantQ      float32
+	}{
+		{name: "正常_ゼロ値はConstant", vl: pucb.VirtualLoss{}, wantVisits: 3, wantQ: (0.8*2 + 0.2) / 3},
+		{name: "正常_VirtualVisit", vl: pucb.VirtualLoss{Mode: pucb.VirtualVisit}, wantVisits: 3, wantQ: 0.8},
+		{name: "正常_Scaled", vl: pucb.VirtualLoss{Mode: pucb.VirtualLossScaled, Scale: 3}, wantVisits: 5, wantQ: (0.8*2 + 0.2*3) / 5},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newCalculator(tc.vl)
+			if got := c.Visits(); got != tc.wantVisits {
+				t.Errorf("Visitsの不一致: got = %d, want = %d", got, tc.wantVisits)
+			}
+			if got := c.Q(); math.Abs(float64(got-tc.wantQ)) > 1e-5 {
+				t.Errorf("Qの不一致: got = %f, want = %f", got, tc.wantQ)
+			}
+
+			// pending を解放すると、観測値だけの統計に戻る
+			if err := c.DecrementPending(); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if c.Visits() != 2 || math.Abs(float64(c.Q())-0.8) > 1e-5 {
+				t.Errorf("解放後の統計の不一致: visits = %d, Q = %f", c.Visits(), c.Q())
+			}
+		})
+	}
+
+	t.Run("正常_VirtualVisitで未観測ならFPU", func(t *testing.T) {
+		c := &pucb.Calculator{
+			Func:        pucb.NewAlphaGoFunc(1.0),
+			FPU:         pucb.FPU{Value: 0.5},
+			VirtualLoss: pucb.VirtualLoss{Mode: pucb.VirtualVisit},
+		}
+		c.IncrementPending()
+		if got := c.Q(); got != 0.5 {
+			t.Errorf("Qの不一致: got = %f, want = 0.5", got)
+		}
+	})
+
+	t.Run("正常_AtomicCalculatorも同じ統計", func(t *testing.T) {
+		vl := pucb.VirtualLoss{Mode: pucb.VirtualLossScaled, Scale: 3}
+		c := newCalculator(vl)
+		ac := &pucb.AtomicCalculator{Func: pucb.NewAlphaGoFunc(1.0), VirtualValue: 0.2, VirtualLoss: vl}
+		for range 2 {
+			ac.IncrementPending()
+			if err := ac.Observe(0.8); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+		}
+		ac.IncrementPending()
+		if c.Visits() != ac.Visits() || math.Abs(float64(c.Q()-ac.Q())) > 1e-5 {
+			t.Errorf("統計の不一致: got = (%d, %f), want = (%d, %f)", ac.Visits(), ac.Q(), c.Visits(), c.Q())
+		}
+	})
+
+	t.Run("異常_不正な設定", func(t *testing.T) {
+		invalids := []pucb.VirtualLoss{
+			{Mode: pucb.VirtualLossMode(-1)},
+			{Mode: pucb.VirtualLossScaled + 1},
+			{Mode: pucb.VirtualLossScaled, Scale: 0},
+		}
+		for _, vl := range invalids {
+			if err := vl.Validate(); err == nil {
+				t.Errorf("エラーを期待したが、nilが返された: vl = %+v", vl)
+			}
+		}
+	})
+}
+
+func TestMinMaxStats(t *testing.T) {
+	t.Run("正常_観測した範囲で正規化する", func(t *testing.T) {
+		s := pucb.NewMinMaxStats()
+		if _, _, ok := s.Bounds(); ok {
+			t.Error("観測が無いのに ok = true")
+		}
+		// 観測が無い場合はそのまま返す
+		if got := s.Normalize(30.0); got != 30.0 {
+			t.Errorf("Normalizeの不一致: got = %f, want = 30.0", got)
+		}
+
+		for _, v := range []float32{20.0, -10.0, 50.0, 0.0} {
+			if err := s.Update(v); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+		}
+
+		lo, hi, ok := s.Bounds()
+		if !ok || lo != -10.0 || hi != 50.0 {
+			t.Errorf("Boundsの不一致: got = (%f, %f, %t), want = (-10, 50, true)", lo, hi, ok)
+		}
+		if got := s.Normalize(20.0); math.Abs(float64(got)-0.5) > 1e-6 {
+			t.Errorf("Normalizeの不一致: got = %f, want = 0.5", got)
+		}
+	})
+
+	t.Run("正常_ゼロ値は観測無し", func(t *testing.T) {
+		var s pucb.MinMaxStats
+		if _, _, ok := s.Bounds(); ok {
+			t.Error("観測が無いのに ok = true")
+		}
+
+		// 全て負の値でも、0 を範囲に含めない
+		for _, v := range []float32{-30.0, -10.0} {
+			if err := s.Update(v); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+		}
+		lo, hi, ok := s.Bounds()
+		if !ok || lo != -30.0 || hi != -10.0 {
+			t.Errorf("Boundsの不一致: got = (%f, %f, %t), want = (-30, -10, true)", lo, hi, ok)
+		}
+		if got := s.Normalize(-20.0); math.Abs(float64(got)-0.5) > 1e-6 {
+			t.Errorf("Normalizeの不一致: got = %f, want = 0.5", got)
+		}
+	})
+
+	t.Run("準正常_nilと範囲の幅が0", func(t *testing.T) {
+		var nilStats *pucb.MinMaxStats
+		if got := nilStats.Normalize(3.0); got != 3.0 {
+			t.Errorf("Normalizeの不一致: got = %f, want = 3.0", got)
+		}
+
+		s := pucb.NewMinMaxStats()
+		if err := s.Update(5.0); err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if got := s.Normalize(3.0); got != 3.0 {
+			t.Errorf("Normalizeの不一致: got = %f, want = 3.0", got)
+		}
+	})
+
+	t.Run("性質_並行に更新しても最小値と最大値を失わない", func(t *testing.T) {
+		s := pucb.NewMinMaxStats()
+		const workers, n = 8, 1000
+		var wg sync.WaitGroup
+		for w := range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range n {
+					if err := s.Update(float32(w*n + i)); err != nil {
+						t.Errorf("予期せぬエラー: %v", err)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		lo, hi, _ := s.Bounds()
+		if lo != 0 || hi != workers*n-1 {
+			t.Errorf("Boundsの不一致: got = (%f, %f), want = (0, %d)", lo, hi, workers*n-1)
+		}
+	})
+
+	t.Run("正常_CalculatorのUは正規化したQを使う", func(t *testing.T) {
+		s := pucb.NewMinMaxStats()
+		for _, v := range []float32{0.0, 100.0} {
+			if err := s.Update(v); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+		}
+
+		c := &pucb.Calculator{Func: pucb.NewAlphaGoFunc(1.0), P: 0.5, MinMax: s}
+		if err := c.Observe(80.0); err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		u, err := c.U(4)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		// Q = 80 は 0.8 に正規化され、探索項は 1.0*0.5*sqrt(4)/2 = 0.5
+		if math.Abs(float64(u)-1.3) > 1e-5 {
+			t.Errorf("Uの不一致: got = %f, want = 1.3", u)
+		}
+		// Q 自体は正規化しない
+		if got := c.Q(); got != 80.0 {
+			t.Errorf("Qの不一致: got = %f, want = 80.0", got)
+		}
+	})
+
+	t.Run("異常_NaN", func(t *testing.T) {
+		if err := pucb.NewMinMaxStats().Update(float32(math.NaN())); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
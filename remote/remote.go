@@ -0,0 +1,379 @@
+// Package remote は、PolicyValueFunc の評価と対局の記録の収集を net/rpc 越しに行い、
+// 複数のプロセスで自己対局を分散できる様にする。
+//
+// 評価器のプロセスは Evaluator(と任意で Collector)を NewServer で公開し、
+// 対局のプロセスは Client の PolicyValueFunc で評価を依頼して、できた記録を Submit で送り返す。
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/omw/parallel"
+)
+
+const (
+	EvaluatorServiceName = "Evaluator"
+	CollectorServiceName = "Collector"
+)
+
+// EvaluateRequest は、複数の局面の評価の依頼。States と LegalActions は同じ長さであるべき。
+type EvaluateRequest[S any, Ac comparable] struct {
+	States       []S
+	LegalActions [][]Ac
+}
+
+// EvaluateResponse は、EvaluateRequest の各局面の方策と価値。
+type EvaluateResponse[Ac comparable] struct {
+	Policies []game.Policy[Ac]
+	Values   []float32
+}
+
+// Evaluator は、PolicyValueFunc を RPC で公開する。
+type Evaluator[S any, Ac comparable] struct {
+	pvFunc sequential.PolicyValueFunc[S, Ac]
+	// p は、1つの依頼の中の局面を並列に評価する数。
+	p int
+	// numRequests は、受け取った依頼の数。
+	numRequests atomic.Int64
+}
+
+// NewEvaluator は、pvFunc で評価する Evaluator を返す。
+// pvFunc が並行に呼び出せない場合(例えば、探索のrngsを共有する場合)は、p = 1 にする事。
+func NewEvaluator[S any, Ac comparable](pvFunc sequential.PolicyValueFunc[S, Ac], p int) (*Evaluator[S, Ac], error) {
+	if pvFunc == nil {
+		return nil, errors.New("pvFuncがnilです")
+	}
+
+	if p <= 0 {
+		return nil, fmt.Errorf("pが不正: p = %d: p > 0 であるべき", p)
+	}
+	return &Evaluator[S, Ac]{pvFunc: pvFunc, p: p}, nil
+}
+
+// NumRequests は、それまでに受け取った依頼の数を返す。Batcher がどれだけ依頼をまとめたかの確認に使う。
+func (e *Evaluator[S, Ac]) NumRequests() int {
+	return int(e.numRequests.Load())
+}
+
+func (e *Evaluator[S, Ac]) evaluate(states []S, legalActions [][]Ac) ([]game.Policy[Ac], []float32, error) {
+	e.numRequests.Add(1)
+	n := len(states)
+	if len(legalActions) != n {
+		return nil, nil, fmt.Errorf("依頼の長さが不一致: len(States) = %d, len(LegalActions) = %d", n, len(legalActions))
+	}
+
+	policies := make([]game.Policy[Ac], n)
+	values := make([]float32, n)
+	err := parallel.For(n, e.p, func(_, idx int) error {
+		policy, value, err := e.pvFunc(states[idx], legalActions[idx])
+		if err != nil {
+			return err
+		}
+		policies[idx] = policy
+		values[idx] = value
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return policies, values, nil
+}
+
+// evaluatorService は、Evaluator のうち、RPCのメソッドだけを公開する。
+// net/rpc は、登録した型のRPCに使えないメソッドについてログを出す為、Evaluator を直接登録しない。
+type evaluatorService[S any, Ac comparable] struct {
+	evaluator *Evaluator[S, Ac]
+}
+
+// Evaluate は、RPCのメソッド。依頼の各局面を評価する。
+func (s *evaluatorService[S, Ac]) Evaluate(req *EvaluateRequest[S, Ac], resp *EvaluateResponse[Ac]) error {
+	policies, values, err := s.evaluator.evaluate(req.States, req.LegalActions)
+	if err != nil {
+		return err
+	}
+	resp.Policies = policies
+	resp.Values = values
+	return nil
+}
+
+// SubmitRequest は、対局のプロセスから送る記録。
+type SubmitRequest[S any, Ac, Ag comparable] struct {
+	Records []sequential.Record[S, Ac, Ag]
+}
+
+// SubmitResponse は、Collector がそれまでに受け取った記録の総数。
+type SubmitResponse struct {
+	Total int
+}
+
+// Collector は、複数の対局のプロセスから送られた記録を集める。
+type Collector[S any, Ac, Ag comparable] struct {
+	mu      sync.Mutex
+	records []sequential.Record[S, Ac, Ag]
+	total   int
+	// onSubmit が nil でない場合、記録を受け取る度に呼ぶ。エラーを返すと、送った側にエラーが返る。
+	onSubmit func([]sequential.Record[S, Ac, Ag]) error
+}
+
+// NewCollector は、Collector を返す。onSubmit は nil でもよい。
+func NewCollector[S any, Ac, Ag comparable](onSubmit func([]sequential.Record[S, Ac, Ag]) error) *Collector[S, Ac, Ag] {
+	return &Collector[S, Ac, Ag]{onSubmit: onSubmit}
+}
+
+func (c *Collector[S, Ac, Ag]) submit(records []sequential.Record[S, Ac, Ag]) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.onSubmit != nil {
+		if err := c.onSubmit(records); err != nil {
+			return 0, err
+		}
+	}
+
+	c.records = append(c.records, records...)
+	c.total += len(records)
+	return c.total, nil
+}
+
+// collectorService は、Collector のうち、RPCのメソッドだけを公開する。
+type collectorService[S any, Ac, Ag comparable] struct {
+	collector *Collector[S, Ac, Ag]
+}
+
+// Submit は、RPCのメソッド。記録を受け取る。
+func (s *collectorService[S, Ac, Ag]) Submit(req *SubmitRequest[S, Ac, Ag], resp *SubmitResponse) error {
+	total, err := s.collector.submit(req.Records)
+	if err != nil {
+		return err
+	}
+	resp.Total = total
+	return nil
+}
+
+// Drain は、受け取った記録を返し、保持している記録を空にする。
+func (c *Collector[S, Ac, Ag]) Drain() []sequential.Record[S, Ac, Ag] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	records := c.records
+	c.records = nil
+	return records
+}
+
+// Total は、それまでに受け取った記録の総数を返す。Drain しても減らない。
+func (c *Collector[S, Ac, Ag]) Total() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total
+}
+
+// NewServer は、evaluator と collector を登録した rpc.Server を返す。どちらかは nil でもよい。
+// 返り値の Accept(listener) や ServeConn(conn) で接続を受け付ける。
+func NewServer[S any, Ac, Ag comparable](evaluator *Evaluator[S, Ac], collector *Collector[S, Ac, Ag]) (*rpc.Server, error) {
+	if evaluator == nil && collector == nil {
+		return nil, errors.New("evaluatorとcollectorが両方nilです")
+	}
+
+	server := rpc.NewServer()
+	if evaluator != nil {
+		if err := server.RegisterName(EvaluatorServiceName, &evaluatorService[S, Ac]{evaluator: evaluator}); err != nil {
+			return nil, err
+		}
+	}
+
+	if collector != nil {
+		if err := server.RegisterName(CollectorServiceName, &collectorService[S, Ac, Ag]{collector: collector}); err != nil {
+			return nil, err
+		}
+	}
+	return server, nil
+}
+
+// Client は、Evaluator と Collector を公開したサーバーと話す。全てのメソッドは複数のgoroutineから呼び出せる。
+type Client[S any, Ac, Ag comparable] struct {
+	rpcClient *rpc.Client
+}
+
+// NewClient は、接続済みの conn でサーバーと話す Client を返す。
+func NewClient[S any, Ac, Ag comparable](conn net.Conn) *Client[S, Ac, Ag] {
+	return &Client[S, Ac, Ag]{rpcClient: rpc.NewClient(conn)}
+}
+
+// Dial は、address のサーバーに接続した Client を返す。
+func Dial[S any, Ac, Ag comparable](network, address string) (*Client[S, Ac, Ag], error) {
+	rpcClient, err := rpc.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &Client[S, Ac, Ag]{rpcClient: rpcClient}, nil
+}
+
+func (c *Client[S, Ac, Ag]) Close() error {
+	return c.rpcClient.Close()
+}
+
+// Evaluate は、複数の局面の評価をまとめて依頼する。
+// 各局面の方策は、その局面の合法手と一致する事を確かめてから返す。
+func (c *Client[S, Ac, Ag]) Evaluate(states []S, legalActions [][]Ac) ([]game.Policy[Ac], []float32, error) {
+	req := &EvaluateRequest[S, Ac]{States: states, LegalActions: legalActions}
+	var resp EvaluateResponse[Ac]
+	if err := c.rpcClient.Call(EvaluatorServiceName+".Evaluate", req, &resp); err != nil {
+		return nil, nil, err
+	}
+
+	if len(resp.Policies) != len(states) || len(resp.Values) != len(states) {
+		return nil, nil, fmt.Errorf("応答の長さが不一致: len(Policies) = %d, len(Values) = %d: %d であるべき", len(resp.Policies), len(resp.Values), len(states))
+	}
+
+	for i, policy := range resp.Policies {
+		if err := policy.ValidateForLegalActions(legalActions[i], false); err != nil {
+			return nil, nil, fmt.Errorf("Policies[%d]が不正: %w", i, err)
+		}
+	}
+	return resp.Policies, resp.Values, nil
+}
+
+// PolicyValueFunc は、1局面ずつ評価を依頼する PolicyValueFunc を返す。
+// 並行に呼び出した評価を1回の依頼にまとめたい場合は、Batcher を使う。
+func (c *Client[S, Ac, Ag]) PolicyValueFunc() sequential.PolicyValueFunc[S, Ac] {
+	return func(state S, legalActions []Ac) (game.Policy[Ac], float32, error) {
+		policies, values, err := c.Evaluate([]S{state}, [][]Ac{legalActions})
+		if err != nil {
+			return nil, 0.0, err
+		}
+		return policies[0], values[0], nil
+	}
+}
+
+// Submit は、記録を Collector に送り、Collector が受け取った記録の総数を返す。
+func (c *Client[S, Ac, Ag]) Submit(records []sequential.Record[S, Ac, Ag]) (int, error) {
+	req := &SubmitRequest[S, Ac, Ag]{Records: records}
+	var resp SubmitResponse
+	if err := c.rpcClient.Call(CollectorServiceName+".Submit", req, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Total, nil
+}
+
+type batchItem[S any, Ac comparable] struct {
+	state        S
+	legalActions []Ac
+	done         chan batchResult[Ac]
+}
+
+type batchResult[Ac comparable] struct {
+	policy game.Policy[Ac]
+	value  float32
+	err    error
+}
+
+// Batcher は、並行に呼び出された評価を、最大 batchSize 局面ずつ1回の依頼にまとめる。
+// 最初の評価から maxWait 経っても batchSize に達しない場合は、その時点の局面だけで依頼する。
+// parallel.For で並列に対局する場合、通信の回数を減らせる。
+type Batcher[S any, Ac, Ag comparable] struct {
+	client    *Client[S, Ac, Ag]
+	batchSize int
+	maxWait   time.Duration
+	items     chan batchItem[S, Ac]
+	closeOnce sync.Once
+	closed    chan struct{}
+	wg        sync.WaitGroup
+}
+
+func NewBatcher[S any, Ac, Ag comparable](client *Client[S, Ac, Ag], batchSize int, maxWait time.Duration) (*Batcher[S, Ac, Ag], error) {
+	if client == nil {
+		return nil, errors.New("clientがnilです")
+	}
+
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("batchSizeが不正: batchSize = %d: batchSize > 0 であるべき", batchSize)
+	}
+
+	if maxWait <= 0 {
+		return nil, fmt.Errorf("maxWaitが不正: maxWait = %v: maxWait > 0 であるべき", maxWait)
+	}
+
+	b := &Batcher[S, Ac, Ag]{
+		client:    client,
+		batchSize: batchSize,
+		maxWait:   maxWait,
+		items:     make(chan batchItem[S, Ac]),
+		closed:    make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go b.loop()
+	return b, nil
+}
+
+func (b *Batcher[S, Ac, Ag]) loop() {
+	defer b.wg.Done()
+	for {
+		var first batchItem[S, Ac]
+		select {
+		case first = <-b.items:
+		case <-b.closed:
+			return
+		}
+
+		batch := []batchItem[S, Ac]{first}
+		timer := time.NewTimer(b.maxWait)
+	collect:
+		for len(batch) < b.batchSize {
+			select {
+			case item := <-b.items:
+				batch = append(batch, item)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+		b.flush(batch)
+	}
+}
+
+func (b *Batcher[S, Ac, Ag]) flush(batch []batchItem[S, Ac]) {
+	states := make([]S, len(batch))
+	legalActions := make([][]Ac, len(batch))
+	for i, item := range batch {
+		states[i] = item.state
+		legalActions[i] = item.legalActions
+	}
+
+	policies, values, err := b.client.Evaluate(states, legalActions)
+	for i, item := range batch {
+		if err != nil {
+			item.done <- batchResult[Ac]{err: err}
+			continue
+		}
+		item.done <- batchResult[Ac]{policy: policies[i], value: values[i]}
+	}
+}
+
+// PolicyValueFunc は、評価を Batcher に任せる PolicyValueFunc を返す。Close の後に呼ぶとエラーを返す。
+func (b *Batcher[S, Ac, Ag]) PolicyValueFunc() sequential.PolicyValueFunc[S, Ac] {
+	return func(state S, legalActions []Ac) (game.Policy[Ac], float32, error) {
+		item := batchItem[S, Ac]{state: state, legalActions: legalActions, done: make(chan batchResult[Ac], 1)}
+		select {
+		case b.items <- item:
+		case <-b.closed:
+			return nil, 0.0, errors.New("Batcherは既に閉じられています")
+		}
+
+		result := <-item.done
+		return result.policy, result.value, result.err
+	}
+}
+
+// Close は、まとめる処理を止める。Client は閉じない。
+func (b *Batcher[S, Ac, Ag]) Close() {
+	b.closeOnce.Do(func() { close(b.closed) })
+	b.wg.Wait()
+}
@@ -0,0 +1,313 @@
+package remote_test
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/internal/ttt"
+	"github.com/sw965/crow/remote"
+	"github.com/sw965/omw/mathx/randx"
+)
+
+type (
+	client    = remote.Client[ttt.State, ttt.Action, ttt.Mark]
+	collector = remote.Collector[ttt.State, ttt.Action, ttt.Mark]
+	record    = sequential.Record[ttt.State, ttt.Action, ttt.Mark]
+)
+
+// halfValueFunc は、一様な方策と価値0.5を返す。
+func halfValueFunc(state ttt.State, legalActions []ttt.Action) (game.Policy[ttt.Action], float32, error) {
+	policy, err := sequential.UniformPolicyFunc(state, legalActions)
+	return policy, 0.5, err
+}
+
+// startServer は、パイプの先で evaluator と collector を公開し、それと話す Client を返す。
+func startServer(t *testing.T, evaluator *remote.Evaluator[ttt.State, ttt.Action], c *collector) *client {
+	t.Helper()
+	server, err := remote.NewServer(evaluator, c)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+
+	cl := remote.NewClient[ttt.State, ttt.Action, ttt.Mark](clientConn)
+	t.Cleanup(func() { cl.Close() })
+	return cl
+}
+
+func newEvaluator(t *testing.T) *remote.Evaluator[ttt.State, ttt.Action] {
+	t.Helper()
+	evaluator, err := remote.NewEvaluator(halfValueFunc, 2)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	return evaluator
+}
+
+func TestNew(t *testing.T) {
+	t.Run("異常_pvFuncがnil", func(t *testing.T) {
+		if _, err := remote.NewEvaluator[ttt.State, ttt.Action](nil, 1); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_pが0", func(t *testing.T) {
+		if _, err := remote.NewEvaluator(halfValueFunc, 0); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_evaluatorとcollectorが両方nil", func(t *testing.T) {
+		if _, err := remote.NewServer[ttt.State, ttt.Action, ttt.Mark](nil, nil); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_batchSizeが0", func(t *testing.T) {
+		cl := startServer(t, newEvaluator(t), nil)
+		if _, err := remote.NewBatcher(cl, 0, time.Millisecond); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestClientEvaluate(t *testing.T) {
+	evaluator := newEvaluator(t)
+	cl := startServer(t, evaluator, nil)
+	engine := ttt.NewEngine()
+
+	init := ttt.NewInitialState()
+	next, err := engine.Rule.TransitionFunc(init, ttt.Action{Row: 1, Col: 1})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	states := []ttt.State{init, next}
+	legals := [][]ttt.Action{engine.Rule.LegalActionsFunc(init), engine.Rule.LegalActionsFunc(next)}
+	policies, values, err := cl.Evaluate(states, legals)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	for i := range states {
+		if len(policies[i]) != len(legals[i]) {
+			t.Errorf("policies[%d]の長さの不一致: got = %d, want = %d", i, len(policies[i]), len(legals[i]))
+		}
+		if values[i] != 0.5 {
+			t.Errorf("values[%d]の不一致: got = %f, want = 0.5", i, values[i])
+		}
+	}
+
+	if got := evaluator.NumRequests(); got != 1 {
+		t.Errorf("依頼の数の不一致: got = %d, want = 1", got)
+	}
+
+	t.Run("異常_長さの不一致", func(t *testing.T) {
+		if _, _, err := cl.Evaluate(states, legals[:1]); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_方策が合法手と一致しない", func(t *testing.T) {
+		// 局面に関係なく初期局面の方策を返す、局面とずれた評価器
+		stale, err := remote.NewEvaluator(func(ttt.State, []ttt.Action) (game.Policy[ttt.Action], float32, error) {
+			return halfValueFunc(init, legals[0])
+		}, 1)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		staleClient := startServer(t, stale, nil)
+		if _, _, err := staleClient.Evaluate(states, legals); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+		if _, _, err := staleClient.PolicyValueFunc()(next, legals[1]); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_Collectorが登録されていない", func(t *testing.T) {
+		if _, err := cl.Submit(nil); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestDistributedSelfPlay(t *testing.T) {
+	evaluator := newEvaluator(t)
+	c := remote.NewCollector[ttt.State, ttt.Action, ttt.Mark](nil)
+	cl := startServer(t, evaluator, c)
+	engine := ttt.NewEngine()
+
+	tests := []struct {
+		name   string
+		pvFunc func(t *testing.T) sequential.PolicyValueFunc[ttt.State, ttt.Action]
+	}{
+		{
+			name:   "正常_1局面ずつ依頼",
+			pvFunc: func(*testing.T) sequential.PolicyValueFunc[ttt.State, ttt.Action] { return cl.PolicyValueFunc() },
+		},
+		{
+			name: "正常_Batcherで依頼をまとめる",
+			pvFunc: func(t *testing.T) sequential.PolicyValueFunc[ttt.State, ttt.Action] {
+				batcher, err := remote.NewBatcher(cl, 4, 5*time.Millisecond)
+				if err != nil {
+					t.Fatalf("予期せぬエラー: %v", err)
+				}
+				t.Cleanup(batcher.Close)
+				return batcher.PolicyValueFunc()
+			},
+		},
+	}
+
+	const numGames = 8
+	submitted := 0
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			accr := sequential.ActorCritic[ttt.State, ttt.Action, ttt.Mark]{
+				Name:            "remote",
+				PolicyValueFunc: tc.pvFunc(t),
+				SelectFunc:      game.WeightedRandomSelectFunc[ttt.Action, ttt.Mark],
+			}
+
+			inits := make([]ttt.State, numGames)
+			for i := range inits {
+				inits[i] = ttt.NewInitialState()
+			}
+
+			rngs, err := randx.NewPCGs(4)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			before := evaluator.NumRequests()
+			records, err := engine.RecordPlayouts(inits, accr, rngs, 9)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			numSteps := 0
+			for i, r := range records {
+				for j, step := range r.Steps {
+					if step.Value != 0.5 {
+						t.Errorf("records[%d].Steps[%d].Valueの不一致: got = %f, want = 0.5", i, j, step.Value)
+					}
+				}
+				numSteps += len(r.Steps)
+			}
+
+			if got := evaluator.NumRequests() - before; got > numSteps {
+				t.Errorf("依頼の数が手数を超えている: got = %d, 手数 = %d", got, numSteps)
+			}
+
+			total, err := cl.Submit(records)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			submitted += len(records)
+			if total != submitted {
+				t.Errorf("Totalの不一致: got = %d, want = %d", total, submitted)
+			}
+		})
+	}
+
+	drained := c.Drain()
+	if len(drained) != submitted {
+		t.Fatalf("Drainした記録の数の不一致: got = %d, want = %d", len(drained), submitted)
+	}
+	for i, r := range drained {
+		isEnd, err := engine.IsTerminal(r.FinalState)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if !isEnd {
+			t.Errorf("drained[%d]: 終局していない", i)
+		}
+	}
+
+	if len(c.Drain()) != 0 {
+		t.Error("Drainの後に記録が残っている")
+	}
+	if c.Total() != submitted {
+		t.Errorf("Drainの後のTotalの不一致: got = %d, want = %d", c.Total(), submitted)
+	}
+}
+
+func TestBatcher(t *testing.T) {
+	evaluator := newEvaluator(t)
+	cl := startServer(t, evaluator, nil)
+	engine := ttt.NewEngine()
+
+	batcher, err := remote.NewBatcher(cl, 8, time.Second)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	pvFunc := batcher.PolicyValueFunc()
+
+	// batchSize 個を同時に依頼すると、maxWait を待たずに1回の依頼にまとまる
+	init := ttt.NewInitialState()
+	legals := engine.Rule.LegalActionsFunc(init)
+	errs := make(chan error, 8)
+	start := time.Now()
+	for range 8 {
+		go func() {
+			_, _, err := pvFunc(init, legals)
+			errs <- err
+		}()
+	}
+	for range 8 {
+		if err := <-errs; err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("maxWaitを待っている: elapsed = %v", elapsed)
+	}
+	if got := evaluator.NumRequests(); got != 1 {
+		t.Errorf("依頼の数の不一致: got = %d, want = 1", got)
+	}
+
+	batcher.Close()
+	if _, _, err := pvFunc(init, legals); err == nil {
+		t.Fatal("Closeの後で、エラーを期待したが、nilが返された")
+	}
+}
+
+func TestCollectorOnSubmit(t *testing.T) {
+	errFull := errors.New("満杯")
+	c := remote.NewCollector(func(records []record) error {
+		if len(records) > 1 {
+			return errFull
+		}
+		return nil
+	})
+	cl := startServer(t, nil, c)
+
+	engine := ttt.NewEngine()
+	accr := sequential.NewRandomActorCritic[ttt.State, ttt.Action, ttt.Mark]()
+	rngs := []*rand.Rand{rand.New(rand.NewPCG(1, 2))}
+	records, err := engine.RecordPlayouts([]ttt.State{ttt.NewInitialState(), ttt.NewInitialState()}, accr, rngs, 9)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if _, err := cl.Submit(records[:1]); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	// onSubmit のエラーは送った側に返り、記録は保持されない
+	if _, err := cl.Submit(records); err == nil {
+		t.Fatal("エラーを期待したが、nilが返された")
+	}
+	if c.Total() != 1 {
+		t.Errorf("Totalの不一致: got = %d, want = 1", c.Total())
+	}
+}
@@ -0,0 +1,488 @@
+// Package replay は、自己対局の記録のステップを学習用に保持するリプレイバッファを提供する。
+package replay
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"sync"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/game/simultaneous"
+	"github.com/sw965/omw/atomicfile"
+	"github.com/sw965/omw/encoding/gobx"
+	"github.com/sw965/omw/mathx/bitsx"
+	"github.com/sw965/omw/mathx/randx"
+)
+
+// Sample は、リプレイバッファに保持する、1エージェント分の1局面の学習データ。
+// 同時手番ゲームでは、1ステップから各エージェントのSampleを作る。
+type Sample[S any, Ac, Ag comparable] struct {
+	// ID は、バッファへの追加順に割り当てる通し番号。UpdatePriorities で使う。
+	ID uint64
+	// GameID は、このSampleを(最後に)追加した対局の通し番号。ウィンドウの判定に使う。
+	GameID uint64
+	State  S
+	Agent  Ag
+	Policy game.Policy[Ac]
+	Value  float32
+	// FastSearch は、Policy が安価な探索によるもので、方策の学習に使うべきでない場合に true になる(sequential.Step.FastSearch)。
+	// 価値の学習には使ってよい。方策の学習には、PolicyTrainingSamples で除いたSampleを使う事。
+	FastSearch bool
+	// Priority は、優先度付きサンプリングでの重み(の元)。追加時は、その時点の最大の優先度になる。
+	Priority float32
+	// Count は、重複排除で統合された局面の数。Value は、この数の平均になる。
+	Count int
+	// PolicyCount は、Policy の平均に使った局面の数。完全な探索の方策が安価な探索の方策を置き換えた場合、
+	// 安価な探索の局面は数えない為、Count より小さくなる。
+	PolicyCount int
+}
+
+type Config[S any, Ag comparable] struct {
+	// WindowGames は、直近何局分のSampleを保持するか。0以下の場合は制限しない。
+	WindowGames int
+	// MaxSamples は、保持するSampleの数の上限。超えた場合は古いSampleから捨てる。0以下の場合は制限しない。
+	MaxSamples int
+	// PriorityExponent は、優先度付きサンプリングで、確率を Priority^PriorityExponent に比例させる指数。
+	PriorityExponent float32
+	// KeyFunc が nil でない場合、同じキーの局面を重複とみなし、1つのSampleに統合する。
+	// 統合したSampleのPolicyとValueは、重複した局面の平均になり、最新の対局のSampleとして扱う。
+	// ただし、FastSearch のSampleと完全な探索のSampleを統合する場合、Policyは完全な探索のものを使う。
+	KeyFunc func(S, Ag) string
+}
+
+// ReplayBuffer は、直近の対局のSampleを保持し、一様または優先度付きでミニバッチをサンプリングする。
+// 全てのメソッドは、複数のgoroutineから並行に呼び出せる。
+type ReplayBuffer[S any, Ac, Ag comparable] struct {
+	config Config[S, Ag]
+
+	mu sync.Mutex
+	// entries は追加順(GameIDの昇順)に並び、重複排除で取り除いたSampleはnilになる。
+	entries     []*Sample[S, Ac, Ag]
+	size        int
+	indexByKey  map[string]int
+	nextID      uint64
+	nextGameID  uint64
+	maxPriority float32
+}
+
+func NewReplayBuffer[S any, Ac, Ag comparable](config Config[S, Ag]) (*ReplayBuffer[S, Ac, Ag], error) {
+	if config.PriorityExponent < 0 || math.IsNaN(float64(config.PriorityExponent)) {
+		return nil, fmt.Errorf("PriorityExponentが不正: PriorityExponent = %g: PriorityExponent >= 0 であるべき", config.PriorityExponent)
+	}
+
+	return &ReplayBuffer[S, Ac, Ag]{
+		config:      config,
+		indexByKey:  map[string]int{},
+		maxPriority: 1.0,
+	}, nil
+}
+
+// Len は、保持しているSampleの数を返す。
+func (rb *ReplayBuffer[S, Ac, Ag]) Len() int {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.size
+}
+
+// NumGames は、これまでに追加した対局の数を返す。
+func (rb *ReplayBuffer[S, Ac, Ag]) NumGames() int {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return int(rb.nextGameID)
+}
+
+// Samples は、保持している全てのSampleのコピーを、追加順に返す。
+func (rb *ReplayBuffer[S, Ac, Ag]) Samples() []Sample[S, Ac, Ag] {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	samples := make([]Sample[S, Ac, Ag], 0, rb.size)
+	for _, e := range rb.entries {
+		if e != nil {
+			samples = append(samples, *e)
+		}
+	}
+	return samples
+}
+
+// AddSequentialSteps は、1局分のステップを追加する。ElmoSteps等で加工したステップを渡してもよい。
+func (rb *ReplayBuffer[S, Ac, Ag]) AddSequentialSteps(steps []sequential.Step[S, Ac, Ag]) {
+	samples := make([]Sample[S, Ac, Ag], len(steps))
+	for i, step := range steps {
+		samples[i] = Sample[S, Ac, Ag]{State: step.State, Agent: step.Agent, Policy: step.Policy, Value: step.Value, FastSearch: step.FastSearch}
+	}
+	rb.addGame(samples)
+}
+
+func (rb *ReplayBuffer[S, Ac, Ag]) AddSequentialRecord(record sequential.Record[S, Ac, Ag]) {
+	rb.AddSequentialSteps(record.Steps)
+}
+
+// AddSimultaneousSteps は、1局分のステップを追加する。各ステップから、方策と価値を持つエージェント毎にSampleを作る。
+// 価値を持たないエージェント(simultaneous.FromSequentialActorCritic の手番でないエージェント等)は、行動しなかったものとして除く。
+func (rb *ReplayBuffer[S, Ac, Ag]) AddSimultaneousSteps(steps []simultaneous.Step[S, Ac, Ag]) {
+	samples := make([]Sample[S, Ac, Ag], 0, len(steps)*2)
+	for _, step := range steps {
+		for agent, policy := range step.PolicyByAgent {
+			value, ok := step.ValueByAgent[agent]
+			if !ok {
+				continue
+			}
+			samples = append(samples, Sample[S, Ac, Ag]{State: step.State, Agent: agent, Policy: policy, Value: value})
+		}
+	}
+	rb.addGame(samples)
+}
+
+func (rb *ReplayBuffer[S, Ac, Ag]) AddSimultaneousRecord(record simultaneous.Record[S, Ac, Ag]) {
+	rb.AddSimultaneousSteps(record.Steps)
+}
+
+func (rb *ReplayBuffer[S, Ac, Ag]) addGame(samples []Sample[S, Ac, Ag]) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	gameID := rb.nextGameID
+	rb.nextGameID++
+
+	for _, sample := range samples {
+		sample.ID = rb.nextID
+		rb.nextID++
+		sample.GameID = gameID
+		sample.Priority = rb.maxPriority
+		sample.Count = 1
+		sample.PolicyCount = 1
+
+		if rb.config.KeyFunc != nil {
+			key := rb.config.KeyFunc(sample.State, sample.Agent)
+			if idx, ok := rb.indexByKey[key]; ok {
+				old := rb.entries[idx]
+				switch {
+				case old.FastSearch == sample.FastSearch:
+					sample.Policy = mergePolicies(old.Policy, old.PolicyCount, sample.Policy)
+					sample.PolicyCount = old.PolicyCount + 1
+				case sample.FastSearch:
+					// 安価な探索の方策は、完全な探索の方策に混ぜない
+					sample.Policy = old.Policy
+					sample.PolicyCount = old.PolicyCount
+					sample.FastSearch = false
+				}
+				sample.Value = (old.Value*float32(old.Count) + sample.Value) / float32(old.Count+1)
+				sample.Count = old.Count + 1
+				sample.Priority = max(sample.Priority, old.Priority)
+				rb.entries[idx] = nil
+				rb.size--
+			}
+			rb.indexByKey[key] = len(rb.entries)
+		}
+
+		rb.entries = append(rb.entries, &sample)
+		rb.size++
+	}
+	rb.evict()
+}
+
+// mergePolicies は、count個の平均であるoldに、newを1つ加えた平均を返す。
+func mergePolicies[Ac comparable](old game.Policy[Ac], count int, new game.Policy[Ac]) game.Policy[Ac] {
+	merged := make(game.Policy[Ac], max(len(old), len(new)))
+	for a, p := range old {
+		merged[a] += p * float32(count)
+	}
+	for a, p := range new {
+		merged[a] += p
+	}
+	for a := range merged {
+		merged[a] /= float32(count + 1)
+	}
+	return merged
+}
+
+// evict は、ウィンドウ外、及び上限を超えた古いSampleを捨て、必要に応じてentriesを詰める。
+func (rb *ReplayBuffer[S, Ac, Ag]) evict() {
+	start := 0
+	for start < len(rb.entries) {
+		e := rb.entries[start]
+		if e == nil {
+			start++
+			continue
+		}
+
+		outOfWindow := rb.config.WindowGames > 0 && e.GameID+uint64(rb.config.WindowGames) < rb.nextGameID
+		overflow := rb.config.MaxSamples > 0 && rb.size > rb.config.MaxSamples
+		if !outOfWindow && !overflow {
+			break
+		}
+
+		rb.removeKey(e)
+		rb.entries[start] = nil
+		rb.size--
+		start++
+	}
+
+	// 取り除いたSampleが半分を超えたら詰める
+	if len(rb.entries)-rb.size > len(rb.entries)/2 {
+		rb.compact()
+	}
+}
+
+func (rb *ReplayBuffer[S, Ac, Ag]) removeKey(e *Sample[S, Ac, Ag]) {
+	if rb.config.KeyFunc != nil {
+		delete(rb.indexByKey, rb.config.KeyFunc(e.State, e.Agent))
+	}
+}
+
+func (rb *ReplayBuffer[S, Ac, Ag]) compact() {
+	entries := make([]*Sample[S, Ac, Ag], 0, rb.size)
+	for _, e := range rb.entries {
+		if e == nil {
+			continue
+		}
+		if rb.config.KeyFunc != nil {
+			rb.indexByKey[rb.config.KeyFunc(e.State, e.Agent)] = len(entries)
+		}
+		entries = append(entries, e)
+	}
+	rb.entries = entries
+}
+
+// SampleBatch は、n個のSampleをサンプリングする。
+// prioritized が false の場合は一様に非復元抽出し(nが保持数より多い場合は全て返す)、
+// true の場合は Priority^PriorityExponent に比例して復元抽出する。
+func (rb *ReplayBuffer[S, Ac, Ag]) SampleBatch(n int, prioritized bool, rng *rand.Rand) ([]Sample[S, Ac, Ag], error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("nが不正: n = %d: n > 0 であるべき", n)
+	}
+
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if rb.size == 0 {
+		return nil, errors.New("リプレイバッファが空です")
+	}
+
+	if len(rb.entries) != rb.size {
+		rb.compact()
+	}
+
+	if !prioritized {
+		idxs := rng.Perm(rb.size)[:min(n, rb.size)]
+		batch := make([]Sample[S, Ac, Ag], len(idxs))
+		for i, idx := range idxs {
+			batch[i] = *rb.entries[idx]
+		}
+		return batch, nil
+	}
+
+	cum := make([]float64, rb.size)
+	var total float64
+	for i, e := range rb.entries {
+		total += math.Pow(float64(e.Priority), float64(rb.config.PriorityExponent))
+		cum[i] = total
+	}
+
+	if total <= 0 || math.IsInf(total, 0) || math.IsNaN(total) {
+		return nil, fmt.Errorf("優先度の合計が不正: total = %g: 正の有限値であるべき", total)
+	}
+
+	batch := make([]Sample[S, Ac, Ag], n)
+	for i := range n {
+		// 累積和が r を超える最初の要素を選ぶ(重みが0の要素は選ばれない)
+		r := rng.Float64() * total
+		idx := sort.Search(len(cum), func(j int) bool { return cum[j] > r })
+		batch[i] = *rb.entries[min(idx, len(cum)-1)]
+	}
+	return batch, nil
+}
+
+// UpdatePriorities は、IDで指定したSampleの優先度を更新する。既に捨てられたSampleは無視する。
+func (rb *ReplayBuffer[S, Ac, Ag]) UpdatePriorities(ids []uint64, priorities []float32) error {
+	if len(ids) != len(priorities) {
+		return fmt.Errorf("長さが不一致: len(ids) = %d, len(priorities) = %d", len(ids), len(priorities))
+	}
+
+	for i, p := range priorities {
+		if p < 0 || math.IsNaN(float64(p)) || math.IsInf(float64(p), 0) {
+			return fmt.Errorf("優先度が不正(負/NaN/Inf): ids[%d] = %d, priority = %g", i, ids[i], p)
+		}
+	}
+
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	priorityByID := make(map[uint64]float32, len(ids))
+	for i, id := range ids {
+		priorityByID[id] = priorities[i]
+	}
+
+	for _, e := range rb.entries {
+		if e == nil {
+			continue
+		}
+		if p, ok := priorityByID[e.ID]; ok {
+			e.Priority = p
+			rb.maxPriority = max(rb.maxPriority, p)
+		}
+	}
+	return nil
+}
+
+// Snapshot は、保存用のバッファの状態。Configの関数は保存出来ない為、含めない。
+type Snapshot[S any, Ac, Ag comparable] struct {
+	Samples     []Sample[S, Ac, Ag]
+	NextID      uint64
+	NextGameID  uint64
+	MaxPriority float32
+}
+
+// Save は、バッファの内容をgobでpathに保存する。書き込みは原子的に行う。
+func (rb *ReplayBuffer[S, Ac, Ag]) Save(path string) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(rb.Snapshot()); err != nil {
+		return err
+	}
+	return atomicfile.WriteFrom(path, &buf, 0644)
+}
+
+// Snapshot は、バッファの現在の内容を返す。他の状態(チェックポイント等)と一緒に保存する為に使う。
+func (rb *ReplayBuffer[S, Ac, Ag]) Snapshot() Snapshot[S, Ac, Ag] {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	samples := make([]Sample[S, Ac, Ag], 0, rb.size)
+	for _, e := range rb.entries {
+		if e != nil {
+			samples = append(samples, *e)
+		}
+	}
+	return Snapshot[S, Ac, Ag]{
+		Samples:     samples,
+		NextID:      rb.nextID,
+		NextGameID:  rb.nextGameID,
+		MaxPriority: rb.maxPriority,
+	}
+}
+
+// Load は、Saveで保存した内容で、バッファの内容を置き換える。Configは現在のものを使う。
+func (rb *ReplayBuffer[S, Ac, Ag]) Load(path string) error {
+	snap, err := gobx.Load[Snapshot[S, Ac, Ag]](path)
+	if err != nil {
+		return err
+	}
+	rb.Restore(snap)
+	return nil
+}
+
+// Restore は、snap の内容で、バッファの内容を置き換える。Configは現在のものを使う。
+func (rb *ReplayBuffer[S, Ac, Ag]) Restore(snap Snapshot[S, Ac, Ag]) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.entries = make([]*Sample[S, Ac, Ag], len(snap.Samples))
+	for i := range snap.Samples {
+		sample := snap.Samples[i]
+		// PolicyCount を持たない以前のSnapshotでは、全ての局面を方策の平均に使っている
+		if sample.PolicyCount == 0 {
+			sample.PolicyCount = sample.Count
+		}
+		rb.entries[i] = &sample
+	}
+	rb.size = len(rb.entries)
+	rb.nextID = snap.NextID
+	rb.nextGameID = snap.NextGameID
+	rb.maxPriority = snap.MaxPriority
+
+	rb.indexByKey = map[string]int{}
+	rb.compact()
+	rb.evict()
+}
+
+// EncodeFunc は、Sampleをモデルの入力に変換する。
+type EncodeFunc[S any, Ac, Ag comparable] func(Sample[S, Ac, Ag]) (*bitsx.Matrix, error)
+
+// LabelFunc は、Sampleをモデルのラベル(クラスのインデックス)に変換する。
+type LabelFunc[S any, Ac, Ag comparable] func(Sample[S, Ac, Ag]) (int, error)
+
+// NewStateEncodeFunc は、状態のみを使うEncodeFuncを返す。
+func NewStateEncodeFunc[S any, Ac, Ag comparable](encodeFunc func(S) (*bitsx.Matrix, error)) EncodeFunc[S, Ac, Ag] {
+	return func(sample Sample[S, Ac, Ag]) (*bitsx.Matrix, error) {
+		return encodeFunc(sample.State)
+	}
+}
+
+// PolicyTrainingSamples は、方策の学習に使えるSample(FastSearch が false のもの)だけを返す。
+func PolicyTrainingSamples[S any, Ac, Ag comparable](samples []Sample[S, Ac, Ag]) []Sample[S, Ac, Ag] {
+	policySamples := make([]Sample[S, Ac, Ag], 0, len(samples))
+	for _, sample := range samples {
+		if !sample.FastSearch {
+			policySamples = append(policySamples, sample)
+		}
+	}
+	return policySamples
+}
+
+// NewPolicyLabelFunc は、Policyに従って行動をサンプリングし、codecのインデックスをラベルとするLabelFuncを返す。
+// FastSearch のSampleにはエラーを返す為、PolicyTrainingSamples で除いてから使う事。
+// rngを使う為、返り値を複数のgoroutineから並行に呼び出してはならない。
+func NewPolicyLabelFunc[S any, Ac, Ag comparable](codec game.ActionCodec[Ac], rng *rand.Rand) LabelFunc[S, Ac, Ag] {
+	return func(sample Sample[S, Ac, Ag]) (int, error) {
+		if sample.FastSearch {
+			return 0, fmt.Errorf("安価な探索のSampleは方策の学習に使えません: ID = %d", sample.ID)
+		}
+
+		target, err := game.EncodePolicy(sample.Policy, codec)
+		if err != nil {
+			return 0, err
+		}
+		return randx.IndexByWeights(target, rng)
+	}
+}
+
+// NewValueLabelFunc は、valueToLabelFunc(binary.Model.ValueToLabel 等)でValueをラベルに変換するLabelFuncを返す。
+func NewValueLabelFunc[S any, Ac, Ag comparable](valueToLabelFunc func(float32) int) LabelFunc[S, Ac, Ag] {
+	return func(sample Sample[S, Ac, Ag]) (int, error) {
+		return valueToLabelFunc(sample.Value), nil
+	}
+}
+
+// TrainingData は、samplesを、binary.Trainer.Train にそのまま渡せる入力とラベルに変換する。
+// labelFuncsを複数渡した場合、ラベルもその数だけ返す(二頭モデルの方策と価値等)。
+func TrainingData[S any, Ac, Ag comparable](samples []Sample[S, Ac, Ag], encodeFunc EncodeFunc[S, Ac, Ag], labelFuncs ...LabelFunc[S, Ac, Ag]) (bitsx.Matrices, [][]int, error) {
+	if encodeFunc == nil {
+		return nil, nil, errors.New("encodeFuncがnilです")
+	}
+
+	for j, f := range labelFuncs {
+		if f == nil {
+			return nil, nil, fmt.Errorf("labelFuncs[%d]がnilです", j)
+		}
+	}
+
+	xs := make(bitsx.Matrices, len(samples))
+	labels := make([][]int, len(labelFuncs))
+	for j := range labels {
+		labels[j] = make([]int, len(samples))
+	}
+
+	for i, sample := range samples {
+		x, err := encodeFunc(sample)
+		if err != nil {
+			return nil, nil, err
+		}
+		xs[i] = x
+
+		for j, f := range labelFuncs {
+			label, err := f(sample)
+			if err != nil {
+				return nil, nil, err
+			}
+			labels[j][i] = label
+		}
+	}
+	return xs, labels, nil
+}
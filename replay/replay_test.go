@@ -0,0 +1,399 @@
+package replay_test
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/game/simultaneous"
+	"github.com/sw965/crow/internal/ttt"
+	"github.com/sw965/crow/replay"
+	"github.com/sw965/omw/mathx/randx"
+)
+
+type step = sequential.Step[int, string, string]
+
+// newGame は、状態が start, start+1, ... となるn手分のステップを返す。
+func newGame(start, n int) []step {
+	steps := make([]step, n)
+	for i := range n {
+		steps[i] = step{State: start + i, Agent: "先手", Policy: game.Policy[string]{"a": 1.0}, Value: float32(start + i)}
+	}
+	return steps
+}
+
+func newBuffer(t *testing.T, config replay.Config[int, string]) *replay.ReplayBuffer[int, string, string] {
+	t.Helper()
+	rb, err := replay.NewReplayBuffer[int, string, string](config)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	return rb
+}
+
+func states(rb *replay.ReplayBuffer[int, string, string]) []int {
+	samples := rb.Samples()
+	ss := make([]int, len(samples))
+	for i, s := range samples {
+		ss[i] = s.State
+	}
+	return ss
+}
+
+func TestReplayBufferWindow(t *testing.T) {
+	tests := []struct {
+		name   string
+		config replay.Config[int, string]
+		want   []int
+	}{
+		{
+			name:   "正常_制限なし",
+			config: replay.Config[int, string]{},
+			want:   []int{0, 1, 10, 11, 20, 21},
+		},
+		{
+			name:   "正常_直近2局",
+			config: replay.Config[int, string]{WindowGames: 2},
+			want:   []int{10, 11, 20, 21},
+		},
+		{
+			name:   "正常_上限3",
+			config: replay.Config[int, string]{MaxSamples: 3},
+			want:   []int{11, 20, 21},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rb := newBuffer(t, tc.config)
+			for g := range 3 {
+				rb.AddSequentialSteps(newGame(g*10, 2))
+			}
+
+			got := states(rb)
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("保持している状態の不一致: got = %v, want = %v", got, tc.want)
+			}
+			if rb.Len() != len(tc.want) {
+				t.Errorf("Lenの不一致: got = %d, want = %d", rb.Len(), len(tc.want))
+			}
+			if rb.NumGames() != 3 {
+				t.Errorf("NumGamesの不一致: got = %d, want = 3", rb.NumGames())
+			}
+		})
+	}
+}
+
+func TestReplayBufferDedup(t *testing.T) {
+	rb := newBuffer(t, replay.Config[int, string]{
+		WindowGames: 2,
+		KeyFunc:     func(s int, _ string) string { return fmt.Sprint(s) },
+	})
+
+	rb.AddSequentialSteps([]step{{State: 1, Agent: "先手", Policy: game.Policy[string]{"a": 1.0}, Value: 1.0}})
+	rb.AddSequentialSteps([]step{{State: 1, Agent: "先手", Policy: game.Policy[string]{"b": 1.0}, Value: 0.0}})
+
+	samples := rb.Samples()
+	if len(samples) != 1 {
+		t.Fatalf("重複が統合されていない: len = %d, want = 1", len(samples))
+	}
+
+	got := samples[0]
+	if got.Count != 2 || got.Value != 0.5 || got.Policy["a"] != 0.5 || got.Policy["b"] != 0.5 {
+		t.Errorf("統合結果の不一致: got = %+v", got)
+	}
+
+	// 統合したSampleは最新の対局の扱いなので、次の1局ではウィンドウから外れない
+	rb.AddSequentialSteps(newGame(100, 1))
+	if rb.Len() != 2 {
+		t.Errorf("Lenの不一致: got = %d, want = 2", rb.Len())
+	}
+
+	// さらに1局追加すると、統合したSampleはウィンドウから外れる
+	rb.AddSequentialSteps(newGame(200, 1))
+	if got := states(rb); fmt.Sprint(got) != "[100 200]" {
+		t.Errorf("保持している状態の不一致: got = %v, want = [100 200]", got)
+	}
+}
+
+func TestReplayBufferSampleBatch(t *testing.T) {
+	rng := randx.NewPCG()
+	rb := newBuffer(t, replay.Config[int, string]{PriorityExponent: 1.0})
+	rb.AddSequentialSteps(newGame(0, 4))
+
+	t.Run("正常_一様は非復元抽出", func(t *testing.T) {
+		batch, err := rb.SampleBatch(10, false, rng)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if len(batch) != 4 {
+			t.Fatalf("len(batch)の不一致: got = %d, want = 4", len(batch))
+		}
+		seen := map[int]bool{}
+		for _, s := range batch {
+			seen[s.State] = true
+		}
+		if len(seen) != 4 {
+			t.Errorf("重複して抽出された: %v", batch)
+		}
+	})
+
+	t.Run("統計_優先度に比例", func(t *testing.T) {
+		samples := rb.Samples()
+		ids := []uint64{samples[0].ID, samples[1].ID, samples[2].ID, samples[3].ID}
+		if err := rb.UpdatePriorities(ids, []float32{0.0, 1.0, 1.0, 2.0}); err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		n := 10000
+		batch, err := rb.SampleBatch(n, true, rng)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		counts := map[int]int{}
+		for _, s := range batch {
+			counts[s.State]++
+		}
+
+		const eps = 0.03
+		for state, want := range map[int]float64{0: 0.0, 1: 0.25, 2: 0.25, 3: 0.5} {
+			ratio := float64(counts[state]) / float64(n)
+			if math.Abs(ratio-want) > eps {
+				t.Errorf("状態%dの抽出比率の不一致: got = %.3f, want = %.3f(±%.3f)", state, ratio, want, eps)
+			}
+		}
+	})
+
+	t.Run("異常_空のバッファ", func(t *testing.T) {
+		empty := newBuffer(t, replay.Config[int, string]{})
+		if _, err := empty.SampleBatch(1, false, rng); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_負の優先度", func(t *testing.T) {
+		if err := rb.UpdatePriorities([]uint64{0}, []float32{-1.0}); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestReplayBufferSaveLoad(t *testing.T) {
+	config := replay.Config[int, string]{WindowGames: 3}
+	rb := newBuffer(t, config)
+	rb.AddSequentialSteps(newGame(0, 2))
+	rb.AddSequentialSteps(newGame(10, 2))
+
+	path := filepath.Join(t.TempDir(), "buffer.gob")
+	if err := rb.Save(path); err != nil {
+		t.Fatalf("保存失敗: %v", err)
+	}
+
+	loaded := newBuffer(t, config)
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("読み込み失敗: %v", err)
+	}
+
+	if fmt.Sprint(states(loaded)) != fmt.Sprint(states(rb)) {
+		t.Errorf("保存前後の不一致: got = %v, want = %v", states(loaded), states(rb))
+	}
+
+	// 対局の通し番号も復元され、ウィンドウが続きから動く
+	loaded.AddSequentialSteps(newGame(20, 1))
+	loaded.AddSequentialSteps(newGame(30, 1))
+	if got := states(loaded); fmt.Sprint(got) != "[10 11 20 30]" {
+		t.Errorf("保持している状態の不一致: got = %v, want = [10 11 20 30]", got)
+	}
+}
+
+func TestReplayBufferConcurrentAdd(t *testing.T) {
+	rb := newBuffer(t, replay.Config[int, string]{MaxSamples: 50})
+
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(uint64(w), 0))
+			for g := range 20 {
+				rb.AddSequentialSteps(newGame(w*1000+g*10, 3))
+				if _, err := rb.SampleBatch(4, true, rng); err != nil {
+					t.Errorf("予期せぬエラー: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if rb.Len() != 50 {
+		t.Errorf("Lenの不一致: got = %d, want = 50", rb.Len())
+	}
+	if rb.NumGames() != 160 {
+		t.Errorf("NumGamesの不一致: got = %d, want = 160", rb.NumGames())
+	}
+}
+
+func TestTrainingData(t *testing.T) {
+	rb, err := replay.NewReplayBuffer[ttt.State, ttt.Action, ttt.Mark](replay.Config[ttt.State, ttt.Mark]{})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	engine := ttt.NewEngine()
+	records, err := engine.RecordPlayouts([]ttt.State{ttt.NewInitialState()}, sequential.NewRandomActorCritic[ttt.State, ttt.Action, ttt.Mark](), []*rand.Rand{randx.NewPCG()}, 9)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	rb.AddSequentialRecord(records[0])
+
+	codec := ttt.NewActionCodec()
+	samples := rb.Samples()
+	xs, labels, err := replay.TrainingData(
+		samples,
+		replay.NewStateEncodeFunc[ttt.State, ttt.Action, ttt.Mark](ttt.EncodeState),
+		replay.NewPolicyLabelFunc[ttt.State, ttt.Action, ttt.Mark](codec, randx.NewPCG()),
+		replay.NewValueLabelFunc[ttt.State, ttt.Action, ttt.Mark](func(v float32) int { return int(v * 10) }),
+	)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if len(xs) != len(samples) || len(labels) != 2 || len(labels[0]) != len(samples) || len(labels[1]) != len(samples) {
+		t.Fatalf("形状の不一致: len(xs) = %d, len(labels) = %d", len(xs), len(labels))
+	}
+
+	// 方策のラベルは、その局面の合法手のインデックスになる
+	for i, s := range samples {
+		a, err := codec.Decode(labels[0][i])
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if s.State.Board[a.Row][a.Col] != ttt.EmptyMark {
+			t.Errorf("samples[%d]: ラベルの行動 %v が合法手ではない", i, a)
+		}
+	}
+}
+
+// 安価な探索のステップは、Sampleに FastSearch として引き継がれ、方策の学習から除かれる事を確かめる。
+func TestFastSearchSamples(t *testing.T) {
+	fast := step{State: 1, Agent: "先手", Policy: game.Policy[string]{"b": 1.0}, Value: 0.0, FastSearch: true}
+	full := step{State: 2, Agent: "先手", Policy: game.Policy[string]{"a": 1.0}, Value: 1.0}
+
+	rb := newBuffer(t, replay.Config[int, string]{})
+	rb.AddSequentialSteps([]step{fast, full})
+
+	samples := rb.Samples()
+	if !samples[0].FastSearch || samples[1].FastSearch {
+		t.Fatalf("FastSearchの不一致: got = (%t, %t), want = (true, false)", samples[0].FastSearch, samples[1].FastSearch)
+	}
+
+	policySamples := replay.PolicyTrainingSamples(samples)
+	if len(policySamples) != 1 || policySamples[0].State != 2 {
+		t.Errorf("PolicyTrainingSamplesの不一致: got = %+v", policySamples)
+	}
+
+	codec, err := game.NewSliceActionCodec([]string{"a", "b"})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	labelFunc := replay.NewPolicyLabelFunc[int, string, string](codec, randx.NewPCG())
+
+	t.Run("異常_安価な探索のSampleの方策のラベル", func(t *testing.T) {
+		if _, err := labelFunc(samples[0]); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("正常_重複排除では完全な探索の方策を使う", func(t *testing.T) {
+		rb := newBuffer(t, replay.Config[int, string]{KeyFunc: func(s int, _ string) string { return fmt.Sprint(s) }})
+		rb.AddSequentialSteps([]step{{State: 1, Agent: "先手", Policy: game.Policy[string]{"a": 1.0}, Value: 1.0}})
+		rb.AddSequentialSteps([]step{fast})
+
+		got := rb.Samples()[0]
+		if got.FastSearch || got.Policy["a"] != 1.0 || got.Policy["b"] != 0.0 || got.Value != 0.5 {
+			t.Errorf("統合結果の不一致: got = %+v", got)
+		}
+
+		if _, err := labelFunc(got); err != nil {
+			t.Errorf("予期せぬエラー: %v", err)
+		}
+	})
+	t.Run("正常_安価な探索の後の完全な探索の方策は均等に平均する", func(t *testing.T) {
+		rb := newBuffer(t, replay.Config[int, string]{KeyFunc: func(s int, _ string) string { return fmt.Sprint(s) }})
+		for range 3 {
+			rb.AddSequentialSteps([]step{fast})
+		}
+		rb.AddSequentialSteps([]step{{State: 1, Agent: "先手", Policy: game.Policy[string]{"a": 1.0}, Value: 1.0}})
+		rb.AddSequentialSteps([]step{{State: 1, Agent: "先手", Policy: game.Policy[string]{"b": 1.0}, Value: 1.0}})
+
+		got := rb.Samples()[0]
+		if got.FastSearch || got.Count != 5 || got.PolicyCount != 2 {
+			t.Fatalf("統合結果の不一致: got = %+v", got)
+		}
+		if math.Abs(float64(got.Policy["a"]-0.5)) > 0.0001 || math.Abs(float64(got.Policy["b"]-0.5)) > 0.0001 {
+			t.Errorf("Policyの不一致: got = %v, want = map[a:0.5 b:0.5]", got.Policy)
+		}
+		if math.Abs(float64(got.Value-0.4)) > 0.0001 {
+			t.Errorf("Valueの不一致: got = %f, want = 0.4", got.Value)
+		}
+	})
+}
+
+func TestAddSimultaneousRecord(t *testing.T) {
+	newSimultaneousBuffer := func(t *testing.T) *replay.ReplayBuffer[int, string, int] {
+		t.Helper()
+		rb, err := replay.NewReplayBuffer[int, string, int](replay.Config[int, int]{})
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		return rb
+	}
+
+	t.Run("正常_全エージェント", func(t *testing.T) {
+		rb := newSimultaneousBuffer(t)
+		rb.AddSimultaneousRecord(simultaneous.Record[int, string, int]{
+			Steps: []simultaneous.Step[int, string, int]{{
+				State:         0,
+				PolicyByAgent: simultaneous.PolicyByAgent[string, int]{1: {"グー": 1.0}, 2: {"パー": 1.0}},
+				ValueByAgent:  simultaneous.ValueByAgent[int]{1: 0.2, 2: 0.8},
+			}},
+		})
+
+		samples := rb.Samples()
+		if len(samples) != 2 {
+			t.Fatalf("len(samples)の不一致: got = %d, want = 2", len(samples))
+		}
+		for _, s := range samples {
+			want := map[int]float32{1: 0.2, 2: 0.8}[s.Agent]
+			if s.Value != want {
+				t.Errorf("agent = %d: Valueの不一致: got = %f, want = %f", s.Agent, s.Value, want)
+			}
+		}
+	})
+
+	t.Run("正常_価値の無いエージェントを除く", func(t *testing.T) {
+		rb := newSimultaneousBuffer(t)
+		// FromSequentialActorCritic の記録の様に、手番でないエージェント2は noop の方策だけを持ち、価値を持たない
+		rb.AddSimultaneousRecord(simultaneous.Record[int, string, int]{
+			Steps: []simultaneous.Step[int, string, int]{{
+				State:         0,
+				PolicyByAgent: simultaneous.PolicyByAgent[string, int]{1: {"グー": 1.0}, 2: {"noop": 1.0}},
+				ValueByAgent:  simultaneous.ValueByAgent[int]{1: 0.2},
+			}},
+		})
+
+		samples := rb.Samples()
+		if len(samples) != 1 {
+			t.Fatalf("len(samples)の不一致: got = %d, want = 1", len(samples))
+		}
+		if samples[0].Agent != 1 || samples[0].Value != 0.2 {
+			t.Errorf("Sampleの不一致: got = %+v", samples[0])
+		}
+	})
+}
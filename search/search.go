@@ -0,0 +1,137 @@
+// Package search は、探索アルゴリズムに共通する Searcher インターフェースと、
+// 任意の Searcher を逐次手番・同時手番の PolicyValueFunc や ActorCritic に変換する関数を提供する。
+//
+// 探索アルゴリズムは、ルートの作成(NewRoot)と、予算を指定した探索(Search)だけを実装すれば、
+// 自己対戦や評価の道具をそのまま使える。puct.Engine と dpuct.Engine は、それぞれの Searcher メソッドで Searcher を返す。
+package search
+
+import (
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/game/simultaneous"
+)
+
+// Result は、1回の探索の結果。
+type Result[Ac, Ag comparable] struct {
+	// PolicyByAgent は、ルートで行動を選ぶ各エージェントの、探索が推奨する方策。
+	// 逐次手番のゲームでは、手番のエージェントの分だけを持てばよい。
+	PolicyByAgent map[Ag]game.Policy[Ac]
+	// ValueByAgent は、探索で得た、ルートでの各エージェントの価値。
+	ValueByAgent map[Ag]float32
+	// StatsByAgent は、PolicyByAgent の各エージェントの探索の統計。統計が無い場合は nil。
+	StatsByAgent map[Ag]*game.SearchStats[Ac, Ag]
+}
+
+// Searcher は、状態 S から行動 Ac を探索するアルゴリズム。R はルート(探索木など)の型。
+type Searcher[S any, Ac, Ag comparable, R any] interface {
+	// NewRoot は、state をルートとする、まだ探索していないルートを返す。
+	NewRoot(state S) (R, error)
+	// Search は、root から budget の予算(シミュレーション数など)だけ探索し、結果を返す。
+	// 同じ root で繰り返し呼び出した場合、前回までの探索を引き継いでよい。
+	Search(root R, budget int, rngs []*rand.Rand) (Result[Ac, Ag], error)
+}
+
+// Run は、state から新しいルートを作り、budget だけ探索した結果を返す。
+func Run[S any, Ac, Ag comparable, R any](searcher Searcher[S, Ac, Ag, R], state S, budget int, rngs []*rand.Rand) (Result[Ac, Ag], error) {
+	root, err := searcher.NewRoot(state)
+	if err != nil {
+		return Result[Ac, Ag]{}, err
+	}
+	return searcher.Search(root, budget, rngs)
+}
+
+// legalPolicy は、探索の方策を legalActions の各行動の確率に並べ直す。方策に無い合法手がある場合はエラーを返す。
+func legalPolicy[Ac comparable](policy game.Policy[Ac], legalActions []Ac) (game.Policy[Ac], error) {
+	legal := make(game.Policy[Ac], len(legalActions))
+	for _, action := range legalActions {
+		p, ok := policy[action]
+		if !ok {
+			return nil, fmt.Errorf("actionの訪問比率が存在しません: action = %v", action)
+		}
+		legal[action] = p
+	}
+	return legal, nil
+}
+
+// NewSequentialPolicyValueStatsFunc は、各局面で budget だけ探索し、手番のエージェントの方策・価値・探索の統計を返す関数を返す。
+// 手番は currentAgentFunc で求める。
+func NewSequentialPolicyValueStatsFunc[S any, Ac, Ag comparable, R any](searcher Searcher[S, Ac, Ag, R], budget int, rngs []*rand.Rand, currentAgentFunc sequential.CurrentAgentFunc[S, Ag]) sequential.PolicyValueStatsFunc[S, Ac, Ag] {
+	return func(state S, legalActions []Ac) (game.Policy[Ac], float32, *game.SearchStats[Ac, Ag], error) {
+		result, err := Run(searcher, state, budget, rngs)
+		if err != nil {
+			return nil, 0.0, nil, err
+		}
+
+		agent := currentAgentFunc(state)
+		policy, err := legalPolicy(result.PolicyByAgent[agent], legalActions)
+		if err != nil {
+			return nil, 0.0, nil, err
+		}
+
+		value, ok := result.ValueByAgent[agent]
+		if !ok {
+			return nil, 0.0, nil, fmt.Errorf("ルートノードのエージェントの評価値が存在しません: agent = %v", agent)
+		}
+		return policy, value, result.StatsByAgent[agent], nil
+	}
+}
+
+// NewSequentialActorCritic は、searcher で探索して行動を選ぶ逐次手番の ActorCritic を返す。
+func NewSequentialActorCritic[S any, Ac, Ag comparable, R any](name game.ActorCriticName, searcher Searcher[S, Ac, Ag, R], budget int, rngs []*rand.Rand, currentAgentFunc sequential.CurrentAgentFunc[S, Ag], selectFunc game.SelectFunc[Ac, Ag]) sequential.ActorCritic[S, Ac, Ag] {
+	pvStatsFunc := NewSequentialPolicyValueStatsFunc(searcher, budget, rngs, currentAgentFunc)
+	return sequential.ActorCritic[S, Ac, Ag]{
+		Name:                 name,
+		PolicyValueFunc:      pvStatsFunc.PolicyValueFunc(),
+		SelectFunc:           selectFunc,
+		PolicyValueStatsFunc: pvStatsFunc,
+	}
+}
+
+// NewSimultaneousPolicyValueStatsFunc は、各局面で budget だけ探索し、legalActionsByAgent の全エージェントの方策・価値・探索の統計を返す関数を返す。
+func NewSimultaneousPolicyValueStatsFunc[S any, Ac, Ag comparable, R any](searcher Searcher[S, Ac, Ag, R], budget int, rngs []*rand.Rand) simultaneous.PolicyValueStatsFunc[S, Ac, Ag] {
+	return func(state S, legalActionsByAgent simultaneous.LegalActionsByAgent[Ac, Ag]) (simultaneous.PolicyByAgent[Ac, Ag], simultaneous.ValueByAgent[Ag], simultaneous.SearchStatsByAgent[Ac, Ag], error) {
+		result, err := Run(searcher, state, budget, rngs)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		policyByAgent := make(simultaneous.PolicyByAgent[Ac, Ag], len(legalActionsByAgent))
+		valueByAgent := make(simultaneous.ValueByAgent[Ag], len(legalActionsByAgent))
+		var statsByAgent simultaneous.SearchStatsByAgent[Ac, Ag]
+		for agent, legalActions := range legalActionsByAgent {
+			policy, err := legalPolicy(result.PolicyByAgent[agent], legalActions)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			policyByAgent[agent] = policy
+
+			value, ok := result.ValueByAgent[agent]
+			if !ok {
+				return nil, nil, nil, fmt.Errorf("エージェントの評価値が存在しません: agent = %v", agent)
+			}
+			valueByAgent[agent] = value
+
+			if stats, ok := result.StatsByAgent[agent]; ok {
+				if statsByAgent == nil {
+					statsByAgent = simultaneous.SearchStatsByAgent[Ac, Ag]{}
+				}
+				statsByAgent[agent] = stats
+			}
+		}
+		return policyByAgent, valueByAgent, statsByAgent, nil
+	}
+}
+
+// NewSimultaneousActorCritic は、searcher で探索して各エージェントの行動を選ぶ同時手番の ActorCritic を返す。
+func NewSimultaneousActorCritic[S any, Ac, Ag comparable, R any](name game.ActorCriticName, searcher Searcher[S, Ac, Ag, R], budget int, rngs []*rand.Rand, selectFunc game.SelectFunc[Ac, Ag]) simultaneous.ActorCritic[S, Ac, Ag] {
+	pvStatsFunc := NewSimultaneousPolicyValueStatsFunc(searcher, budget, rngs)
+	return simultaneous.ActorCritic[S, Ac, Ag]{
+		Name:                 name,
+		PolicyValueFunc:      pvStatsFunc.PolicyValueFunc(),
+		SelectFunc:           selectFunc,
+		PolicyValueStatsFunc: pvStatsFunc,
+	}
+}
@@ -0,0 +1,226 @@
+package search_test
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/game/simultaneous"
+	"github.com/sw965/crow/internal/ttt"
+	"github.com/sw965/crow/mcts/dpuct"
+	"github.com/sw965/crow/mcts/puct"
+	"github.com/sw965/crow/pucb"
+	"github.com/sw965/crow/search"
+	"github.com/sw965/omw/mathx/randx"
+)
+
+// winningSearcher は、次の一手で勝てる手があればそれに確率1を、無ければ一様な確率を割り当てる、1手読みの Searcher。
+// ルートは探索した回数を数える。
+type winningSearcher struct {
+	engine sequential.Engine[ttt.State, ttt.Action, ttt.Mark]
+}
+
+type winningRoot struct {
+	state    ttt.State
+	searched int
+}
+
+func (s winningSearcher) NewRoot(state ttt.State) (*winningRoot, error) {
+	return &winningRoot{state: state}, nil
+}
+
+func (s winningSearcher) Search(root *winningRoot, budget int, rngs []*rand.Rand) (search.Result[ttt.Action, ttt.Mark], error) {
+	root.searched += budget
+	legalActions := s.engine.Rule.LegalActionsFunc(root.state)
+	agent := root.state.Turn
+
+	policy := game.Policy[ttt.Action]{}
+	for _, a := range legalActions {
+		next, err := s.engine.Rule.TransitionFunc(root.state, a)
+		if err != nil {
+			return search.Result[ttt.Action, ttt.Mark]{}, err
+		}
+
+		ranks, err := s.engine.RankByAgentFunc(next)
+		if err != nil {
+			return search.Result[ttt.Action, ttt.Mark]{}, err
+		}
+
+		policy[a] = 0.0
+		if ranks[agent] == 1 && ranks[next.Turn] == 2 {
+			policy[a] = 1.0
+		}
+	}
+
+	value := float32(1.0)
+	normalized, err := policy.Normalize()
+	if err != nil {
+		// 勝てる手が無い場合
+		value = 0.5
+		normalized = game.Policy[ttt.Action]{}
+		for a := range policy {
+			normalized[a] = 1.0 / float32(len(policy))
+		}
+	}
+
+	return search.Result[ttt.Action, ttt.Mark]{
+		PolicyByAgent: map[ttt.Mark]game.Policy[ttt.Action]{agent: normalized},
+		ValueByAgent:  map[ttt.Mark]float32{agent: value},
+	}, nil
+}
+
+// winInOne は、Crossが(0,2)に置けば勝つ局面。
+var winInOne = ttt.State{
+	Board: ttt.Board{
+		{ttt.Cross, ttt.Cross, ttt.EmptyMark},
+		{ttt.Nought, ttt.Nought, ttt.EmptyMark},
+		{ttt.EmptyMark, ttt.EmptyMark, ttt.EmptyMark},
+	},
+	Turn: ttt.Cross,
+}
+
+var winningAction = ttt.Action{Row: 0, Col: 2}
+
+func TestNewSequentialActorCritic(t *testing.T) {
+	engine := ttt.NewEngine()
+	rngs, err := randx.NewPCGs(2)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	mcts := puct.Engine[ttt.State, ttt.Action, ttt.Mark]{
+		Game:         engine,
+		PUCBFunc:     pucb.NewAlphaGoFunc(1.25),
+		NextNodesCap: 9,
+		VirtualValue: 0.5,
+	}
+	mcts.SetUniformPolicyFunc()
+	mcts.SetPlayout(sequential.NewRandomActorCritic[ttt.State, ttt.Action, ttt.Mark]())
+
+	tests := []struct {
+		name string
+		accr sequential.ActorCritic[ttt.State, ttt.Action, ttt.Mark]
+	}{
+		{
+			name: "正常_独自のSearcher",
+			accr: search.NewSequentialActorCritic("winning", search.Searcher[ttt.State, ttt.Action, ttt.Mark, *winningRoot](winningSearcher{engine: engine}), 1, rngs, engine.Rule.CurrentAgentFunc, game.MaxSelectFunc[ttt.Action, ttt.Mark]),
+		},
+		{
+			name: "正常_puct",
+			accr: search.NewSequentialActorCritic("puct", mcts.Searcher(), 3000, rngs, engine.Rule.CurrentAgentFunc, game.MaxSelectFunc[ttt.Action, ttt.Mark]),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.accr.Validate(); err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			legalActions := engine.Rule.LegalActionsFunc(winInOne)
+			policy, value, stats, err := tc.accr.PolicyValueStatsFunc(winInOne, legalActions)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			if len(policy) != len(legalActions) {
+				t.Errorf("方策の要素数の不一致: got = %d, want = %d", len(policy), len(legalActions))
+			}
+
+			action, err := tc.accr.SelectFunc(policy, ttt.Cross, 0, rngs[0])
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if action != winningAction {
+				t.Errorf("選んだ行動の不一致: got = %v, want = %v", action, winningAction)
+			}
+
+			if value < 0.9 {
+				t.Errorf("勝ちの局面の価値が低い: got = %f", value)
+			}
+
+			if tc.name == "正常_puct" && (stats == nil || stats.Simulations != 3000) {
+				t.Errorf("探索の統計の不一致: got = %+v", stats)
+			}
+		})
+	}
+
+	t.Run("異常_方策に無い合法手", func(t *testing.T) {
+		pvFunc := search.NewSequentialPolicyValueStatsFunc(search.Searcher[ttt.State, ttt.Action, ttt.Mark, *winningRoot](winningSearcher{engine: engine}), 1, rngs, engine.Rule.CurrentAgentFunc)
+		if _, _, _, err := pvFunc(winInOne, []ttt.Action{{Row: 0, Col: 0}}); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestRun(t *testing.T) {
+	engine := ttt.NewEngine()
+	searcher := winningSearcher{engine: engine}
+	root, err := searcher.NewRoot(winInOne)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	// 同じルートで繰り返し探索すると、予算が積み上がる
+	for range 3 {
+		if _, err := searcher.Search(root, 10, nil); err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+	}
+	if root.searched != 30 {
+		t.Errorf("探索の予算の合計の不一致: got = %d, want = 30", root.searched)
+	}
+
+	result, err := search.Run(search.Searcher[ttt.State, ttt.Action, ttt.Mark, *winningRoot](searcher), winInOne, 10, nil)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if result.PolicyByAgent[ttt.Cross][winningAction] != 1.0 {
+		t.Errorf("方策の不一致: got = %v", result.PolicyByAgent[ttt.Cross])
+	}
+}
+
+// 同時手番の ActorCritic に変換した dpuct でも、同じ手を選ぶ事を確かめる。
+func TestNewSimultaneousActorCritic(t *testing.T) {
+	noop := ttt.Action{Row: -1, Col: -1}
+	seqEngine := ttt.NewEngine()
+	engine := simultaneous.FromSequential(seqEngine, noop)
+
+	mcts := dpuct.Engine[ttt.State, ttt.Action, ttt.Mark]{
+		Game:         engine,
+		PUCBFunc:     pucb.NewAlphaGoFunc(1.25),
+		NextNodesCap: 9,
+		VirtualValue: 0.5,
+	}
+	mcts.SetUniformPolicyFunc()
+	mcts.SetPlayout(simultaneous.FromSequentialActorCritic(seqEngine, sequential.NewRandomActorCritic[ttt.State, ttt.Action, ttt.Mark](), noop))
+
+	rngs, err := randx.NewPCGs(2)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	accr := search.NewSimultaneousActorCritic("dpuct", mcts.Searcher(), 3000, rngs, game.MaxSelectFunc[ttt.Action, ttt.Mark])
+	legalActionsByAgent := engine.Rule.LegalActionsByAgentFunc(winInOne)
+	policyByAgent, valueByAgent, statsByAgent, err := accr.PolicyValueStatsFunc(winInOne, legalActionsByAgent)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if len(policyByAgent) != 2 || len(valueByAgent) != 2 || len(statsByAgent) != 2 {
+		t.Fatalf("エージェント数の不一致: policy = %d, value = %d, stats = %d", len(policyByAgent), len(valueByAgent), len(statsByAgent))
+	}
+
+	action, err := accr.SelectFunc(policyByAgent[ttt.Cross], ttt.Cross, 0, rngs[0])
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if action != winningAction {
+		t.Errorf("選んだ行動の不一致: got = %v, want = %v", action, winningAction)
+	}
+
+	if got := policyByAgent[ttt.Nought]; len(got) != 1 || got[noop] != 1.0 {
+		t.Errorf("手番でないエージェントの方策の不一致: got = %v", got)
+	}
+}
@@ -0,0 +1,488 @@
+// Package selfplay は、探索による自己対局、学習、評価対局によるモデルの選抜を繰り返す、
+// AlphaZero形式の学習パイプラインを提供する。
+//
+// 1イテレーションは、以下の段階からなる。各段階の終了時に、CheckpointDirへ状態を保存し、
+// 保存した状態を Restore で復元すると、次の段階から再開する。
+//  1. SelfPlay: 最良モデル(Best)で探索しながら自己対局し、記録をリプレイバッファに追加する
+//  2. Train:    Bestの複製(Candidate)を、リプレイバッファのステップで学習する
+//  3. Gate:     CandidateとBestを評価対局させ、Candidateの平均スコアが閾値以上ならBestを置き換える
+package selfplay
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"path/filepath"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/mcts/puct"
+	"github.com/sw965/crow/model/mlp/binary"
+	"github.com/sw965/crow/replay"
+	"github.com/sw965/omw/atomicfile"
+	"github.com/sw965/omw/encoding/gobx"
+	"github.com/sw965/omw/mathx/bitsx"
+	"github.com/sw965/omw/mathx/randx"
+)
+
+const (
+	bestName      game.ActorCriticName = "best"
+	candidateName game.ActorCriticName = "candidate"
+)
+
+// CheckpointFileName は、CheckpointDir内に保存するチェックポイントのファイル名。
+const CheckpointFileName = "checkpoint.gob"
+
+type Config struct {
+	// Iterations は、Runで実行するイテレーション数。
+	Iterations int
+	// GamesPerIteration は、1イテレーションの自己対局数。
+	GamesPerIteration int
+	// Simulations は、1手あたりの探索のシミュレーション数。
+	Simulations int
+	// SearchWorkers は、探索の並列数。
+	SearchWorkers int
+	// TemperatureSteps は、温度1で訪問比率に従って手を選ぶ手数。以降は最多訪問の手を選ぶ。
+	TemperatureSteps int
+	// ElmoAlpha は、価値のターゲットにおける対局結果の比率。
+	// ターゲットは ElmoAlpha * 対局結果 + (1 - ElmoAlpha) * 探索値 になる(Record.ElmoSteps 参照)。
+	ElmoAlpha float32
+	// BufferCapacity は、リプレイバッファに保持するステップ数の上限。古いステップから捨てる。
+	BufferCapacity int
+	// Epochs は、1イテレーションの学習のエポック数。
+	Epochs        int
+	MiniBatchSize int
+	LR            float32
+	TrainWorkers  int
+	// EvalGames は、評価対局での、手番の並び1組あたりの対局数。
+	EvalGames int
+	// GateThreshold は、CandidateがBestを置き換える為に必要な、評価対局でのCandidateの平均スコア。[0, 1] の範囲。
+	GateThreshold float32
+	// CheckpointDir が空の場合、チェックポイントを保存しない。
+	CheckpointDir string
+
+	SharedHyperparameters binary.SharedHyperparameters
+}
+
+func NewDefaultConfig() Config {
+	return Config{
+		Iterations:            10,
+		GamesPerIteration:     64,
+		Simulations:           128,
+		SearchWorkers:         4,
+		TemperatureSteps:      8,
+		ElmoAlpha:             0.5,
+		BufferCapacity:        100000,
+		Epochs:                4,
+		MiniBatchSize:         128,
+		LR:                    0.1,
+		TrainWorkers:          4,
+		EvalGames:             16,
+		GateThreshold:         0.55,
+		SharedHyperparameters: binary.NewSharedHyperparameters(),
+	}
+}
+
+func (c Config) Validate() error {
+	positives := []struct {
+		name string
+		v    int
+	}{
+		{"Iterations", c.Iterations},
+		{"GamesPerIteration", c.GamesPerIteration},
+		{"Simulations", c.Simulations},
+		{"SearchWorkers", c.SearchWorkers},
+		{"BufferCapacity", c.BufferCapacity},
+		{"Epochs", c.Epochs},
+		{"MiniBatchSize", c.MiniBatchSize},
+		{"TrainWorkers", c.TrainWorkers},
+		{"EvalGames", c.EvalGames},
+	}
+	for _, p := range positives {
+		if p.v <= 0 {
+			return fmt.Errorf("%sが不正: %s = %d: %s > 0 であるべき", p.name, p.name, p.v, p.name)
+		}
+	}
+
+	if c.TemperatureSteps < 0 {
+		return fmt.Errorf("TemperatureStepsが不正: TemperatureSteps = %d: TemperatureSteps >= 0 であるべき", c.TemperatureSteps)
+	}
+
+	if c.LR <= 0 {
+		return fmt.Errorf("LRが不正(LR <= 0): LR = %g: LR > 0 であるべき", c.LR)
+	}
+
+	if math.IsNaN(float64(c.GateThreshold)) || c.GateThreshold < 0 || c.GateThreshold > 1 {
+		return fmt.Errorf("GateThresholdが不正: GateThreshold = %g: 0 <= GateThreshold <= 1 であるべき", c.GateThreshold)
+	}
+	return nil
+}
+
+// Stage は、イテレーション内の段階。
+type Stage string
+
+const (
+	SelfPlayStage Stage = "selfplay"
+	TrainStage    Stage = "train"
+	GateStage     Stage = "gate"
+)
+
+// Checkpoint は、段階の終了時点のパイプラインの状態。Stage は、最後に終了した段階。
+type Checkpoint[S any, Ac, Ag comparable] struct {
+	Iteration int
+	Stage     Stage
+	Best      binary.TwoHeadModel
+	Candidate binary.TwoHeadModel
+	Buffer    replay.Snapshot[S, Ac, Ag]
+}
+
+func LoadCheckpoint[S any, Ac, Ag comparable](path string) (Checkpoint[S, Ac, Ag], error) {
+	return gobx.Load[Checkpoint[S, Ac, Ag]](path)
+}
+
+// IterationResult は、1イテレーションの結果。
+type IterationResult struct {
+	Iteration int
+	// NumGames は、このイテレーションの自己対局数。SelfPlay の終了後から再開した場合は0。
+	NumGames   int
+	BufferSize int
+	// CandidateScore は、評価対局でのCandidateの平均スコア。
+	CandidateScore float32
+	Promoted       bool
+}
+
+type Pipeline[S any, Ac, Ag comparable] struct {
+	Config Config
+	Game   sequential.Engine[S, Ac, Ag]
+	// MCTS は、探索の設定(PUCBFunc, NextNodesCap, VirtualValue等)の雛形。
+	// Game, PolicyFunc, LeafNodeEvalByAgentFunc は、パイプラインがモデルから設定する。
+	MCTS          puct.Engine[S, Ac, Ag]
+	Encoder       binary.StateEncoder[S]
+	Codec         game.ActionCodec[Ac]
+	InitStateFunc func() S
+
+	Best      binary.TwoHeadModel
+	Candidate binary.TwoHeadModel
+	// Buffer は、Config.BufferCapacity を上限とするリプレイバッファ。
+	Buffer    *replay.ReplayBuffer[S, Ac, Ag]
+	Iteration int
+
+	// stage は、現在のイテレーションで最後に終了した段階。空か GateStage の場合、次のイテレーションは SelfPlay から始まる。
+	stage Stage
+	rng   *rand.Rand
+}
+
+func NewPipeline[S any, Ac, Ag comparable](config Config, engine sequential.Engine[S, Ac, Ag], mcts puct.Engine[S, Ac, Ag], encoder binary.StateEncoder[S], codec game.ActionCodec[Ac], initStateFunc func() S, model binary.TwoHeadModel) (*Pipeline[S, Ac, Ag], error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := engine.Validate(); err != nil {
+		return nil, err
+	}
+
+	if encoder == nil {
+		return nil, errors.New("encoderがnilです")
+	}
+
+	if codec == nil {
+		return nil, errors.New("codecがnilです")
+	}
+
+	if initStateFunc == nil {
+		return nil, errors.New("initStateFuncがnilです")
+	}
+
+	candidate, err := model.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	buffer, err := replay.NewReplayBuffer[S, Ac, Ag](replay.Config[S, Ag]{MaxSamples: config.BufferCapacity})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pipeline[S, Ac, Ag]{
+		Config:        config,
+		Game:          engine,
+		MCTS:          mcts,
+		Encoder:       encoder,
+		Codec:         codec,
+		InitStateFunc: initStateFunc,
+		Best:          model,
+		Candidate:     candidate,
+		Buffer:        buffer,
+		rng:           randx.NewPCG(),
+	}, nil
+}
+
+// Restore は、チェックポイントの状態を復元する。以降の RunIteration は、cp.Stage の次の段階から再開する。
+func (p *Pipeline[S, Ac, Ag]) Restore(cp Checkpoint[S, Ac, Ag]) error {
+	switch cp.Stage {
+	case SelfPlayStage, TrainStage, GateStage:
+	default:
+		return fmt.Errorf("Stageが不正: Stage = %q", cp.Stage)
+	}
+
+	p.Iteration = cp.Iteration
+	p.stage = cp.Stage
+	p.Best = cp.Best
+	p.Candidate = cp.Candidate
+	p.Buffer.Restore(cp.Buffer)
+	return nil
+}
+
+// SaveCheckpoint は、現在の状態を CheckpointDir に保存する。CheckpointDir が空の場合は何もしない。
+// 書き込みは原子的に行う為、保存の途中で終了しても、前回のチェックポイントは壊れない。
+func (p *Pipeline[S, Ac, Ag]) SaveCheckpoint(stage Stage) error {
+	if p.Config.CheckpointDir == "" {
+		return nil
+	}
+
+	cp := Checkpoint[S, Ac, Ag]{
+		Iteration: p.Iteration,
+		Stage:     stage,
+		Best:      p.Best,
+		Candidate: p.Candidate,
+		Buffer:    p.Buffer.Snapshot(),
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cp); err != nil {
+		return err
+	}
+	return atomicfile.WriteFrom(filepath.Join(p.Config.CheckpointDir, CheckpointFileName), &buf, 0644)
+}
+
+// newActorCritic は、modelを方策と評価関数に使って探索するActorCriticを返す。
+// 探索の乱数器はActorCritic毎に持つ為、同じActorCriticで複数の対局を並行に行ってはならない。
+func (p *Pipeline[S, Ac, Ag]) newActorCritic(model *binary.TwoHeadModel, name game.ActorCriticName) (sequential.ActorCritic[S, Ac, Ag], error) {
+	hiddenEncoder := binary.NewHiddenEncoder(model, p.Encoder)
+	policyFunc, err := binary.NewPolicyFunc(&model.PolicyHead, hiddenEncoder, p.Codec)
+	if err != nil {
+		return sequential.ActorCritic[S, Ac, Ag]{}, err
+	}
+
+	evalFunc, err := binary.NewLeafNodeEvalByAgentFunc(&model.ValueHead, hiddenEncoder, p.Game.Rule.CurrentAgentFunc, p.Game.Agents)
+	if err != nil {
+		return sequential.ActorCritic[S, Ac, Ag]{}, err
+	}
+
+	mcts := p.MCTS
+	mcts.Game = p.Game
+	mcts.PolicyFunc = policyFunc
+	mcts.LeafNodeEvalByAgentFunc = evalFunc
+	if err := mcts.Validate(); err != nil {
+		return sequential.ActorCritic[S, Ac, Ag]{}, err
+	}
+
+	searchRngs, err := randx.NewPCGs(p.Config.SearchWorkers)
+	if err != nil {
+		return sequential.ActorCritic[S, Ac, Ag]{}, err
+	}
+
+	selectFunc, err := game.NewTemperatureScheduleSelectFunc[Ac, Ag](1.0, p.Config.TemperatureSteps)
+	if err != nil {
+		return sequential.ActorCritic[S, Ac, Ag]{}, err
+	}
+
+	return sequential.ActorCritic[S, Ac, Ag]{
+		Name:            name,
+		PolicyValueFunc: mcts.NewPolicyValueFunc(p.Config.Simulations, searchRngs),
+		SelectFunc:      selectFunc,
+	}, nil
+}
+
+func (p *Pipeline[S, Ac, Ag]) newInits(n int) []S {
+	inits := make([]S, n)
+	for i := range inits {
+		inits[i] = p.InitStateFunc()
+	}
+	return inits
+}
+
+// SelfPlay は、Bestで自己対局し、記録のステップをリプレイバッファに追加する。
+// 探索の内部で並列化する為、対局自体は1局ずつ行う。
+func (p *Pipeline[S, Ac, Ag]) SelfPlay() ([]sequential.Record[S, Ac, Ag], error) {
+	accr, err := p.newActorCritic(&p.Best, bestName)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := p.Game.RecordPlayouts(p.newInits(p.Config.GamesPerIteration), accr, []*rand.Rand{p.rng}, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	// 容量を超えた分は、リプレイバッファが古いステップから捨てる
+	for _, record := range records {
+		p.Buffer.AddSequentialSteps(record.ElmoSteps(p.Config.ElmoAlpha))
+	}
+	return records, nil
+}
+
+// trainingData は、リプレイバッファのステップを、モデルの入力とラベルに変換する。
+// 方策のラベルは、探索の訪問比率に従ってサンプリングした行動のインデックスとする。
+func (p *Pipeline[S, Ac, Ag]) trainingData() (bitsx.Matrices, []int, []int, error) {
+	xs, labels, err := replay.TrainingData(
+		p.Buffer.Samples(),
+		replay.NewStateEncodeFunc[S, Ac, Ag](p.Encoder.Encode),
+		replay.NewPolicyLabelFunc[S, Ac, Ag](p.Codec, p.rng),
+		replay.NewValueLabelFunc[S, Ac, Ag](p.Candidate.ValueHead.ValueToLabel),
+	)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return xs, labels[0], labels[1], nil
+}
+
+// Train は、Bestの複製をCandidateとし、リプレイバッファで学習する。
+func (p *Pipeline[S, Ac, Ag]) Train() error {
+	if p.Buffer.Len() == 0 {
+		return errors.New("リプレイバッファが空です: 学習前にSelfPlayを実行するべき")
+	}
+
+	candidate, err := p.Best.Clone()
+	if err != nil {
+		return err
+	}
+	p.Candidate = candidate
+
+	if err := p.Candidate.SetSharedHyperparameters(&p.Config.SharedHyperparameters); err != nil {
+		return err
+	}
+
+	trainer, err := binary.NewTwoHeadTrainer(p.Candidate, p.Config.TrainWorkers)
+	if err != nil {
+		return err
+	}
+	trainer.MiniBatchSize = p.Config.MiniBatchSize
+	trainer.LR = p.Config.LR
+
+	for range p.Config.Epochs {
+		// 方策のラベルはサンプリングする為、エポック毎に作り直す
+		xs, policyLabels, valueLabels, err := p.trainingData()
+		if err != nil {
+			return err
+		}
+
+		if err := trainer.Train(xs, policyLabels, valueLabels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Evaluate は、CandidateとBestを、手番を入れ替えて評価対局させ、Candidateの平均スコアを返す。
+func (p *Pipeline[S, Ac, Ag]) Evaluate() (float32, error) {
+	candidate, err := p.newActorCritic(&p.Candidate, candidateName)
+	if err != nil {
+		return 0.0, err
+	}
+
+	best, err := p.newActorCritic(&p.Best, bestName)
+	if err != nil {
+		return 0.0, err
+	}
+
+	// 各ActorCriticの探索の乱数器を共有しない様に、対局は1局ずつ行う
+	recorder, err := p.Game.NewCrossPlayoutRecorder(p.newInits(p.Config.EvalGames), []sequential.ActorCritic[S, Ac, Ag]{candidate, best}, 1)
+	if err != nil {
+		return 0.0, err
+	}
+
+	if _, err := recorder.Collect(); err != nil {
+		return 0.0, err
+	}
+
+	avgs, err := recorder.AverageScoreByActorCriticName()
+	if err != nil {
+		return 0.0, err
+	}
+	return avgs[candidateName], nil
+}
+
+// Gate は、評価対局を行い、Candidateの平均スコアが GateThreshold 以上であれば、BestをCandidateで置き換える。
+func (p *Pipeline[S, Ac, Ag]) Gate() (float32, bool, error) {
+	score, err := p.Evaluate()
+	if err != nil {
+		return 0.0, false, err
+	}
+
+	promoted := score >= p.Config.GateThreshold
+	if promoted {
+		best, err := p.Candidate.Clone()
+		if err != nil {
+			return 0.0, false, err
+		}
+		p.Best = best
+	}
+	return score, promoted, nil
+}
+
+// RunIteration は、SelfPlay, Train, Gate を1回ずつ実行し、各段階の終了時にチェックポイントを保存する。
+// Restore した場合は、チェックポイントの次の段階から実行する。
+func (p *Pipeline[S, Ac, Ag]) RunIteration() (IterationResult, error) {
+	numGames := 0
+	if p.stage != SelfPlayStage && p.stage != TrainStage {
+		records, err := p.SelfPlay()
+		if err != nil {
+			return IterationResult{}, err
+		}
+		numGames = len(records)
+
+		p.stage = SelfPlayStage
+		if err := p.SaveCheckpoint(SelfPlayStage); err != nil {
+			return IterationResult{}, err
+		}
+	}
+
+	if p.stage == SelfPlayStage {
+		if err := p.Train(); err != nil {
+			return IterationResult{}, err
+		}
+
+		p.stage = TrainStage
+		if err := p.SaveCheckpoint(TrainStage); err != nil {
+			return IterationResult{}, err
+		}
+	}
+
+	score, promoted, err := p.Gate()
+	if err != nil {
+		return IterationResult{}, err
+	}
+
+	result := IterationResult{
+		Iteration:      p.Iteration,
+		NumGames:       numGames,
+		BufferSize:     p.Buffer.Len(),
+		CandidateScore: score,
+		Promoted:       promoted,
+	}
+
+	p.Iteration++
+	p.stage = GateStage
+	if err := p.SaveCheckpoint(GateStage); err != nil {
+		return IterationResult{}, err
+	}
+	return result, nil
+}
+
+// Run は、Iteration が Config.Iterations に達するまでイテレーションを実行する。
+// Restore した場合は、残りのイテレーションだけを実行する。
+func (p *Pipeline[S, Ac, Ag]) Run() ([]IterationResult, error) {
+	results := make([]IterationResult, 0, max(p.Config.Iterations-p.Iteration, 0))
+	for p.Iteration < p.Config.Iterations {
+		result, err := p.RunIteration()
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
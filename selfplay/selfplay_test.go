@@ -0,0 +1,225 @@
+package selfplay_test
+
+import (
+	"math/rand/v2"
+	"path/filepath"
+	"testing"
+
+	"github.com/sw965/crow/internal/ttt"
+	"github.com/sw965/crow/mcts/puct"
+	"github.com/sw965/crow/model/mlp/binary"
+	"github.com/sw965/crow/pucb"
+	"github.com/sw965/crow/selfplay"
+)
+
+func newTTTPipeline(t *testing.T, config selfplay.Config) *selfplay.Pipeline[ttt.State, ttt.Action, ttt.Mark] {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	model := binary.TwoHeadModel{XRows: ttt.EncodedRows, XCols: ttt.EncodedCols}
+	if err := model.AppendDenseLayer(32, rng); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if err := model.SetPolicyHead(32, 9, rng); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if err := model.SetValueHead(32, 8, 0.0, 1.0, rng); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	mcts := puct.Engine[ttt.State, ttt.Action, ttt.Mark]{
+		PUCBFunc:     pucb.NewAlphaGoFunc(1.25),
+		NextNodesCap: 9,
+		VirtualValue: 0.5,
+	}
+
+	pipeline, err := selfplay.NewPipeline(
+		config,
+		ttt.NewEngine(),
+		mcts,
+		binary.StateEncoderFunc[ttt.State](ttt.EncodeState),
+		ttt.NewActionCodec(),
+		ttt.NewInitialState,
+		model,
+	)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	return pipeline
+}
+
+func newTestConfig(t *testing.T) selfplay.Config {
+	t.Helper()
+	config := selfplay.NewDefaultConfig()
+	config.Iterations = 2
+	config.GamesPerIteration = 4
+	config.Simulations = 16
+	config.SearchWorkers = 2
+	config.TemperatureSteps = 4
+	config.BufferCapacity = 30
+	config.Epochs = 2
+	config.MiniBatchSize = 16
+	config.TrainWorkers = 2
+	config.EvalGames = 2
+	config.CheckpointDir = t.TempDir()
+	return config
+}
+
+func TestPipelineRun(t *testing.T) {
+	config := newTestConfig(t)
+	pipeline := newTTTPipeline(t, config)
+
+	results, err := pipeline.Run()
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if len(results) != config.Iterations {
+		t.Fatalf("len(results)の不一致: got = %d, want = %d", len(results), config.Iterations)
+	}
+
+	for i, result := range results {
+		if result.Iteration != i {
+			t.Errorf("results[%d].Iterationの不一致: got = %d, want = %d", i, result.Iteration, i)
+		}
+		if result.NumGames != config.GamesPerIteration {
+			t.Errorf("results[%d].NumGamesの不一致: got = %d, want = %d", i, result.NumGames, config.GamesPerIteration)
+		}
+		// 三目並べは1局で5手以上なので、2イテレーション目には容量に達する
+		if result.BufferSize > config.BufferCapacity {
+			t.Errorf("results[%d].BufferSizeが容量を超えている: got = %d, want <= %d", i, result.BufferSize, config.BufferCapacity)
+		}
+		if result.CandidateScore < 0.0 || result.CandidateScore > 1.0 {
+			t.Errorf("results[%d].CandidateScoreが範囲外: got = %f", i, result.CandidateScore)
+		}
+		if result.Promoted != (result.CandidateScore >= config.GateThreshold) {
+			t.Errorf("results[%d].Promotedの不一致: score = %f, promoted = %t", i, result.CandidateScore, result.Promoted)
+		}
+	}
+
+	if pipeline.Buffer.Len() != config.BufferCapacity {
+		t.Errorf("Buffer.Len()の不一致: got = %d, want = %d", pipeline.Buffer.Len(), config.BufferCapacity)
+	}
+
+	t.Run("正常_チェックポイントから復元", func(t *testing.T) {
+		path := filepath.Join(config.CheckpointDir, selfplay.CheckpointFileName)
+		cp, err := selfplay.LoadCheckpoint[ttt.State, ttt.Action, ttt.Mark](path)
+		if err != nil {
+			t.Fatalf("読み込み失敗: %v", err)
+		}
+
+		if cp.Iteration != config.Iterations || cp.Stage != selfplay.GateStage {
+			t.Errorf("チェックポイントの不一致: got = (%d, %s), want = (%d, %s)", cp.Iteration, cp.Stage, config.Iterations, selfplay.GateStage)
+		}
+		if len(cp.Buffer.Samples) != pipeline.Buffer.Len() {
+			t.Errorf("len(Buffer.Samples)の不一致: got = %d, want = %d", len(cp.Buffer.Samples), pipeline.Buffer.Len())
+		}
+
+		restored := newTTTPipeline(t, config)
+		if err := restored.Restore(cp); err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		// 全てのイテレーションが終了している為、Runは何もしない
+		results, err := restored.Run()
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if len(results) != 0 {
+			t.Errorf("len(results)の不一致: got = %d, want = 0", len(results))
+		}
+
+		// 復元したBestで、探索付きの対局が続けられる
+		if _, err := restored.SelfPlay(); err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+	})
+}
+
+// TrainStage のチェックポイントから再開すると、自己対局と学習をやり直さずに Gate から実行する事を確かめる。
+func TestPipelineResume(t *testing.T) {
+	config := newTestConfig(t)
+	config.BufferCapacity = 1000
+	pipeline := newTTTPipeline(t, config)
+
+	if _, err := pipeline.SelfPlay(); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if err := pipeline.Train(); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if err := pipeline.SaveCheckpoint(selfplay.TrainStage); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	cp, err := selfplay.LoadCheckpoint[ttt.State, ttt.Action, ttt.Mark](filepath.Join(config.CheckpointDir, selfplay.CheckpointFileName))
+	if err != nil {
+		t.Fatalf("読み込み失敗: %v", err)
+	}
+	bufferSize := len(cp.Buffer.Samples)
+
+	restored := newTTTPipeline(t, config)
+	if err := restored.Restore(cp); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	result, err := restored.RunIteration()
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if result.NumGames != 0 {
+		t.Errorf("NumGamesの不一致: got = %d, want = 0", result.NumGames)
+	}
+	if result.BufferSize != bufferSize || restored.Buffer.Len() != bufferSize {
+		t.Errorf("バッファのサイズの不一致: got = (%d, %d), want = %d", result.BufferSize, restored.Buffer.Len(), bufferSize)
+	}
+	if restored.Iteration != 1 {
+		t.Errorf("Iterationの不一致: got = %d, want = 1", restored.Iteration)
+	}
+
+	// 残りの1イテレーションは、自己対局から実行する
+	results, err := restored.Run()
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if len(results) != 1 || results[0].Iteration != 1 || results[0].NumGames != config.GamesPerIteration {
+		t.Errorf("残りのイテレーションの結果の不一致: got = %+v", results)
+	}
+
+	t.Run("異常_不正なStage", func(t *testing.T) {
+		cp.Stage = "unknown"
+		if err := restored.Restore(cp); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*selfplay.Config)
+		wantErr bool
+	}{
+		{name: "正常", modify: func(c *selfplay.Config) {}},
+		{name: "異常_Simulationsが0", modify: func(c *selfplay.Config) { c.Simulations = 0 }, wantErr: true},
+		{name: "異常_LRが負", modify: func(c *selfplay.Config) { c.LR = -1.0 }, wantErr: true},
+		{name: "異常_TemperatureStepsが負", modify: func(c *selfplay.Config) { c.TemperatureSteps = -1 }, wantErr: true},
+		{name: "異常_GateThresholdが1より大きい", modify: func(c *selfplay.Config) { c.GateThreshold = 1.5 }, wantErr: true},
+		{name: "異常_GateThresholdが負", modify: func(c *selfplay.Config) { c.GateThreshold = -0.1 }, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config := selfplay.NewDefaultConfig()
+			tc.modify(&config)
+			err := config.Validate()
+			if tc.wantErr && err == nil {
+				t.Fatal("エラーを期待したが、nilが返された")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,525 @@
+// Package tablebase は、2人の逐次手番ゲームの到達可能な全ての局面を後退解析(retrograde analysis)し、
+// 手番から見た勝ち・引き分け・負けと、終局までの手数(DTE, distance to end)を求めた完全解析表を作る。
+//
+// 局面は HashFunc で64ビットのキーに写して管理する。表はキーの昇順の配列と、
+// 結果と手数を2バイトに詰めた配列だけを持つ為、ディスクに小さく保存できる。
+// 作った表は、puct の LeafNodeEvalByAgentFunc や、最善手を指す ActorCritic として使える。
+package tablebase
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/mcts/puct"
+	"github.com/sw965/omw/encoding/gobx"
+)
+
+// HashFunc は、局面を64ビットのキーに写す。到達可能な異なる局面は、異なるキーに写すべき。
+// 衝突は Build が Rule.EqualFunc で検出してエラーにする。
+type HashFunc[S any] func(S) uint64
+
+// Outcome は、手番のエージェントから見た、双方が最善を尽くした場合の結果。
+type Outcome uint8
+
+const (
+	Loss Outcome = iota
+	Draw
+	Win
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Loss:
+		return "負け"
+	case Draw:
+		return "引き分け"
+	case Win:
+		return "勝ち"
+	default:
+		return fmt.Sprintf("Outcome(%d)", o)
+	}
+}
+
+func (o Outcome) flip() Outcome {
+	return Win - o
+}
+
+// UnknownDTE は、循環により終局しない引き分けの DTE。
+const UnknownDTE = -1
+
+// MaxDTE は、表に保存できる DTE の上限。
+const MaxDTE = 1<<14 - 2
+
+// Entry は、1つの局面の解析結果。
+type Entry struct {
+	Outcome Outcome
+	// DTE は、終局までの手数。勝ちの場合は最短、負けの場合は最長の手数。
+	// 引き分けの場合は、引き分けの子局面を辿った最短の手数で、循環する場合は UnknownDTE。
+	DTE int
+}
+
+// pack は、上位2ビットに結果、下位14ビットに DTE+1 を詰める。
+func (e Entry) pack() uint16 {
+	return uint16(e.Outcome)<<14 | uint16(e.DTE+1)
+}
+
+func unpack(v uint16) Entry {
+	return Entry{Outcome: Outcome(v >> 14), DTE: int(v&(1<<14-1)) - 1}
+}
+
+// Table は、完全解析表。Probe は複数のgoroutineから呼び出せる。
+type Table[S any, Ac, Ag comparable] struct {
+	engine   *sequential.Engine[S, Ac, Ag]
+	hashFunc HashFunc[S]
+	// hashes は昇順で、entries[i] は hashes[i] の局面の解析結果。
+	hashes  []uint64
+	entries []uint16
+}
+
+// node は、Build の中での局面。
+type node[Ag comparable] struct {
+	agent    Ag
+	children []int
+	parents  []int
+	// remaining は、まだ結果の決まっていない子の数。
+	remaining int
+	resolved  bool
+	entry     Entry
+	// minDrawDTE は、引き分けの子の DTE+1 の最小値。無い場合は -1。
+	minDrawDTE int
+	// maxLossDTE は、負けの子の DTE+1 の最大値。
+	maxLossDTE int
+}
+
+// Build は、inits から到達可能な全ての局面を列挙し、後退解析した表を返す。
+// maxStates は列挙する局面数の上限で、超えた場合はエラーを返す。0の場合は無制限。
+func Build[S any, Ac, Ag comparable](engine *sequential.Engine[S, Ac, Ag], hashFunc HashFunc[S], inits []S, maxStates int) (*Table[S, Ac, Ag], error) {
+	if engine == nil {
+		return nil, errors.New("engineがnilです")
+	}
+
+	if err := engine.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(engine.Agents) != 2 {
+		return nil, fmt.Errorf("エージェント数が不正: len(Agents) = %d: 2 であるべき", len(engine.Agents))
+	}
+
+	if hashFunc == nil {
+		return nil, errors.New("hashFuncがnilです")
+	}
+
+	if maxStates < 0 {
+		return nil, fmt.Errorf("maxStatesが不正: maxStates = %d: maxStates >= 0 であるべき", maxStates)
+	}
+
+	states, nodes, hashes, err := enumerate(engine, hashFunc, inits, maxStates)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := retrograde(engine, states, nodes); err != nil {
+		return nil, err
+	}
+
+	order := make([]int, len(nodes))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(i, j int) int {
+		switch {
+		case hashes[i] < hashes[j]:
+			return -1
+		case hashes[i] > hashes[j]:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	t := &Table[S, Ac, Ag]{
+		engine:   engine,
+		hashFunc: hashFunc,
+		hashes:   make([]uint64, len(nodes)),
+		entries:  make([]uint16, len(nodes)),
+	}
+	for k, i := range order {
+		t.hashes[k] = hashes[i]
+		t.entries[k] = nodes[i].entry.pack()
+	}
+	return t, nil
+}
+
+// enumerate は、inits から幅優先で局面を列挙し、局面間の親子関係を返す。
+func enumerate[S any, Ac, Ag comparable](engine *sequential.Engine[S, Ac, Ag], hashFunc HashFunc[S], inits []S, maxStates int) ([]S, []node[Ag], []uint64, error) {
+	var states []S
+	var nodes []node[Ag]
+	var hashes []uint64
+	indexByHash := map[uint64]int{}
+
+	add := func(s S) (int, error) {
+		h := hashFunc(s)
+		if i, ok := indexByHash[h]; ok {
+			if !engine.Rule.EqualFunc(states[i], s) {
+				return 0, fmt.Errorf("HashFuncが衝突しました: hash = %d", h)
+			}
+			return i, nil
+		}
+
+		if maxStates > 0 && len(states) >= maxStates {
+			return 0, fmt.Errorf("局面数が上限を超えました: maxStates = %d", maxStates)
+		}
+
+		i := len(states)
+		indexByHash[h] = i
+		states = append(states, s)
+		nodes = append(nodes, node[Ag]{agent: engine.Rule.CurrentAgentFunc(s), minDrawDTE: -1})
+		hashes = append(hashes, h)
+		return i, nil
+	}
+
+	for _, s := range inits {
+		if _, err := add(s); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	for i := 0; i < len(states); i++ {
+		isEnd, err := engine.IsTerminal(states[i])
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if isEnd {
+			continue
+		}
+
+		legalActions := engine.Rule.LegalActionsFunc(states[i])
+		if len(legalActions) == 0 {
+			return nil, nil, nil, fmt.Errorf("終局していないのに合法手がありません: state = %v", states[i])
+		}
+
+		for _, a := range legalActions {
+			next, err := engine.Rule.TransitionFunc(states[i], a)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			j, err := add(next)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			// 同じ子に行く合法手が複数ある場合も、親子関係は1つにする
+			if slices.Contains(nodes[i].children, j) {
+				continue
+			}
+			nodes[i].children = append(nodes[i].children, j)
+			nodes[j].parents = append(nodes[j].parents, i)
+		}
+		nodes[i].remaining = len(nodes[i].children)
+	}
+	return states, nodes, hashes, nil
+}
+
+// retrograde は、終局から幅優先で結果を遡って決める。最後まで決まらなかった局面は、循環による引き分けとする。
+func retrograde[S any, Ac, Ag comparable](engine *sequential.Engine[S, Ac, Ag], states []S, nodes []node[Ag]) error {
+	var queue []int
+	for i := range nodes {
+		if len(nodes[i].children) != 0 {
+			continue
+		}
+
+		outcome, err := terminalOutcome(engine, states[i], nodes[i].agent)
+		if err != nil {
+			return err
+		}
+		nodes[i].entry = Entry{Outcome: outcome, DTE: 0}
+		nodes[i].resolved = true
+		queue = append(queue, i)
+	}
+
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		child := nodes[c]
+
+		for _, p := range child.parents {
+			parent := &nodes[p]
+			if parent.resolved {
+				continue
+			}
+
+			// 子の結果を、親の手番のエージェントから見た結果にする
+			outcome := child.entry.Outcome
+			if child.agent != parent.agent {
+				outcome = outcome.flip()
+			}
+
+			dte := child.entry.DTE + 1
+			switch outcome {
+			case Draw:
+				if parent.minDrawDTE < 0 || dte < parent.minDrawDTE {
+					parent.minDrawDTE = dte
+				}
+			case Loss:
+				parent.maxLossDTE = max(parent.maxLossDTE, dte)
+			}
+
+			parent.remaining--
+			switch {
+			case outcome == Win:
+				parent.entry = Entry{Outcome: Win, DTE: dte}
+			case parent.remaining > 0:
+				continue
+			case parent.minDrawDTE >= 0:
+				parent.entry = Entry{Outcome: Draw, DTE: parent.minDrawDTE}
+			default:
+				// 全ての子が負けなので、最も長く粘れる手数
+				parent.entry = Entry{Outcome: Loss, DTE: parent.maxLossDTE}
+			}
+
+			if parent.entry.DTE > MaxDTE {
+				return fmt.Errorf("DTEが上限を超えました: DTE = %d: DTE <= %d であるべき", parent.entry.DTE, MaxDTE)
+			}
+			parent.resolved = true
+			queue = append(queue, p)
+		}
+	}
+
+	for i := range nodes {
+		if !nodes[i].resolved {
+			nodes[i].entry = Entry{Outcome: Draw, DTE: UnknownDTE}
+			nodes[i].resolved = true
+		}
+	}
+	return nil
+}
+
+// terminalOutcome は、終局の局面 state の、agent から見た結果を返す。
+func terminalOutcome[S any, Ac, Ag comparable](engine *sequential.Engine[S, Ac, Ag], state S, agent Ag) (Outcome, error) {
+	scores, err := engine.EvaluateResultScoreByAgent(state)
+	if err != nil {
+		return 0, err
+	}
+
+	var opponent Ag
+	for _, a := range engine.Agents {
+		if a != agent {
+			opponent = a
+		}
+	}
+
+	switch {
+	case scores[agent] > scores[opponent]:
+		return Win, nil
+	case scores[agent] < scores[opponent]:
+		return Loss, nil
+	default:
+		return Draw, nil
+	}
+}
+
+// Len は、表の局面数を返す。
+func (t *Table[S, Ac, Ag]) Len() int {
+	return len(t.hashes)
+}
+
+// Probe は、state の解析結果を返す。表に無い局面の場合は false を返す。
+// 局面はキーだけで引く為、表に無い局面(inits から到達できない局面)のキーが表の局面と衝突した場合、
+// その局面の解析結果を、エラー無く返してしまう。Build が検出する衝突は、到達可能な局面同士だけ。
+func (t *Table[S, Ac, Ag]) Probe(state S) (Entry, bool) {
+	i, ok := slices.BinarySearch(t.hashes, t.hashFunc(state))
+	if !ok {
+		return Entry{}, false
+	}
+	return unpack(t.entries[i]), true
+}
+
+func (t *Table[S, Ac, Ag]) probe(state S) (Entry, error) {
+	entry, ok := t.Probe(state)
+	if !ok {
+		return Entry{}, notInTableError(state)
+	}
+	return entry, nil
+}
+
+func notInTableError[S any](state S) error {
+	return fmt.Errorf("表に無い局面です: state = %v", state)
+}
+
+// better は、手番から見て、子の結果 a が b より良いかを返す。
+// 勝ちなら短く、負けなら長く、引き分けなら短い(循環する引き分けは最後)手数を良いとする。
+func better(a, b Entry) bool {
+	if a.Outcome != b.Outcome {
+		return a.Outcome > b.Outcome
+	}
+
+	switch a.Outcome {
+	case Win:
+		return a.DTE < b.DTE
+	case Loss:
+		return a.DTE > b.DTE
+	default:
+		if a.DTE == UnknownDTE || b.DTE == UnknownDTE {
+			return b.DTE == UnknownDTE && a.DTE != UnknownDTE
+		}
+		return a.DTE < b.DTE
+	}
+}
+
+// BestActions は、state で最善の行動を全て返す。勝ちの局面では最短で勝つ行動、負けの局面では最長で負ける行動を選ぶ。
+func (t *Table[S, Ac, Ag]) BestActions(state S) ([]Ac, error) {
+	agent := t.engine.Rule.CurrentAgentFunc(state)
+	var best []Ac
+	var bestEntry Entry
+	for _, a := range t.engine.Rule.LegalActionsFunc(state) {
+		next, err := t.engine.Rule.TransitionFunc(state, a)
+		if err != nil {
+			return nil, err
+		}
+
+		entry, err := t.probe(next)
+		if err != nil {
+			return nil, err
+		}
+
+		// 子の結果を、state の手番から見た結果にする
+		if t.engine.Rule.CurrentAgentFunc(next) != agent {
+			entry.Outcome = entry.Outcome.flip()
+		}
+
+		switch {
+		case len(best) == 0 || better(entry, bestEntry):
+			best = []Ac{a}
+			bestEntry = entry
+		case !better(bestEntry, entry):
+			best = append(best, a)
+		}
+	}
+
+	if len(best) == 0 {
+		return nil, errors.New("合法手がありません")
+	}
+	return best, nil
+}
+
+// ResultScoreByAgent は、state から双方が最善を尽くした場合の、各エージェントの結果スコアを返す。
+// entry は、Probe で引いた state の解析結果。同じ局面を何度も引かない様に、引いた結果を受け取る。
+// 順位は engine.ResultScoreByAgentFunc で結果スコアにし、nil の場合は game.StandardResultScoreByAgentFunc を使う。
+func (t *Table[S, Ac, Ag]) ResultScoreByAgent(state S, entry Entry) (game.ResultScoreByAgent[Ag], error) {
+	agent := t.engine.Rule.CurrentAgentFunc(state)
+	var opponent Ag
+	for _, a := range t.engine.Agents {
+		if a != agent {
+			opponent = a
+		}
+	}
+
+	var ranks game.RankByAgent[Ag]
+	switch entry.Outcome {
+	case Win:
+		ranks = game.RankByAgent[Ag]{agent: 1, opponent: 2}
+	case Loss:
+		ranks = game.RankByAgent[Ag]{opponent: 1, agent: 2}
+	default:
+		ranks = game.RankByAgent[Ag]{agent: 1, opponent: 1}
+	}
+
+	if t.engine.ResultScoreByAgentFunc != nil {
+		return t.engine.ResultScoreByAgentFunc(ranks)
+	}
+	return game.StandardResultScoreByAgentFunc(ranks)
+}
+
+// LeafNodeEvalByAgentFunc は、表の結果スコアを評価値として返す puct.LeafNodeEvalByAgentFunc を返す。
+// 表に無い局面は fallback で評価する。fallback が nil の場合はエラーを返す。
+func (t *Table[S, Ac, Ag]) LeafNodeEvalByAgentFunc(fallback puct.LeafNodeEvalByAgentFunc[S, Ag]) puct.LeafNodeEvalByAgentFunc[S, Ag] {
+	return func(state S, rng *rand.Rand) (puct.LeafNodeEvalByAgent[Ag], error) {
+		entry, ok := t.Probe(state)
+		if !ok {
+			if fallback != nil {
+				return fallback(state, rng)
+			}
+			return nil, notInTableError(state)
+		}
+
+		scores, err := t.ResultScoreByAgent(state, entry)
+		if err != nil {
+			return nil, err
+		}
+		return puct.LeafNodeEvalByAgent[Ag](scores), nil
+	}
+}
+
+// NewActorCritic は、最善の行動に一様な確率を、それ以外の合法手に0を割り当て、手番の結果スコアを価値とする、厳密な ActorCritic を返す。
+func (t *Table[S, Ac, Ag]) NewActorCritic(name game.ActorCriticName) sequential.ActorCritic[S, Ac, Ag] {
+	return sequential.ActorCritic[S, Ac, Ag]{
+		Name: name,
+		PolicyValueFunc: func(state S, legalActions []Ac) (game.Policy[Ac], float32, error) {
+			best, err := t.BestActions(state)
+			if err != nil {
+				return nil, 0.0, err
+			}
+
+			policy := make(game.Policy[Ac], len(legalActions))
+			for _, a := range legalActions {
+				policy[a] = 0.0
+			}
+			for _, a := range best {
+				policy[a] = 1.0 / float32(len(best))
+			}
+
+			entry, err := t.probe(state)
+			if err != nil {
+				return nil, 0.0, err
+			}
+
+			scores, err := t.ResultScoreByAgent(state, entry)
+			if err != nil {
+				return nil, 0.0, err
+			}
+			return policy, scores[t.engine.Rule.CurrentAgentFunc(state)], nil
+		},
+		SelectFunc: game.WeightedRandomSelectFunc[Ac, Ag],
+	}
+}
+
+// file は、表の保存形式。
+type file struct {
+	Hashes  []uint64
+	Entries []uint16
+}
+
+func (t *Table[S, Ac, Ag]) Save(path string) error {
+	return gobx.Save(file{Hashes: t.hashes, Entries: t.entries}, path)
+}
+
+// Load は、Save で保存した表を読み込む。engine と hashFunc は、表を作った時と同じものであるべき。
+func Load[S any, Ac, Ag comparable](path string, engine *sequential.Engine[S, Ac, Ag], hashFunc HashFunc[S]) (*Table[S, Ac, Ag], error) {
+	if engine == nil {
+		return nil, errors.New("engineがnilです")
+	}
+
+	if hashFunc == nil {
+		return nil, errors.New("hashFuncがnilです")
+	}
+
+	f, err := gobx.Load[file](path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(f.Hashes) != len(f.Entries) {
+		return nil, fmt.Errorf("表が壊れています: len(Hashes) = %d, len(Entries) = %d", len(f.Hashes), len(f.Entries))
+	}
+
+	if !slices.IsSorted(f.Hashes) {
+		return nil, errors.New("表が壊れています: Hashesが昇順ではありません")
+	}
+	return &Table[S, Ac, Ag]{engine: engine, hashFunc: hashFunc, hashes: f.Hashes, entries: f.Entries}, nil
+}
@@ -0,0 +1,352 @@
+package tablebase_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/sw965/crow/game"
+	"github.com/sw965/crow/game/sequential"
+	"github.com/sw965/crow/internal/ttt"
+	"github.com/sw965/crow/mcts/puct"
+	"github.com/sw965/crow/pucb"
+	"github.com/sw965/crow/tablebase"
+	"github.com/sw965/omw/mathx/randx"
+)
+
+type table = tablebase.Table[ttt.State, ttt.Action, ttt.Mark]
+
+// tttHash は、盤面を3進数で表し、手番を最下位ビットに加える。
+func tttHash(s ttt.State) uint64 {
+	var h uint64
+	for r := range 3 {
+		for c := range 3 {
+			h = h*3 + uint64(s.Board[r][c])
+		}
+	}
+	return h<<1 | uint64(s.Turn&1)
+}
+
+func buildTTT(t *testing.T) (sequential.Engine[ttt.State, ttt.Action, ttt.Mark], *table) {
+	t.Helper()
+	engine := ttt.NewEngine()
+	tb, err := tablebase.Build(&engine, tttHash, []ttt.State{ttt.NewInitialState()}, 0)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	return engine, tb
+}
+
+// winInOne は、Crossが(0,2)に置けば勝つ局面。
+var winInOne = ttt.State{
+	Board: ttt.Board{
+		{ttt.Cross, ttt.Cross, ttt.EmptyMark},
+		{ttt.Nought, ttt.Nought, ttt.EmptyMark},
+		{ttt.EmptyMark, ttt.EmptyMark, ttt.EmptyMark},
+	},
+	Turn: ttt.Cross,
+}
+
+func TestBuild(t *testing.T) {
+	_, tb := buildTTT(t)
+
+	// 三目並べの到達可能な局面数
+	if got := tb.Len(); got != 5478 {
+		t.Errorf("局面数の不一致: got = %d, want = 5478", got)
+	}
+
+	tests := []struct {
+		name  string
+		state ttt.State
+		want  tablebase.Entry
+	}{
+		{name: "理論値_初期局面は9手で引き分け", state: ttt.NewInitialState(), want: tablebase.Entry{Outcome: tablebase.Draw, DTE: 9}},
+		{name: "正常_1手で勝ち", state: winInOne, want: tablebase.Entry{Outcome: tablebase.Win, DTE: 1}},
+		{
+			name: "正常_終局は手番の負け",
+			state: ttt.State{
+				Board: ttt.Board{
+					{ttt.Cross, ttt.Cross, ttt.Cross},
+					{ttt.Nought, ttt.Nought, ttt.EmptyMark},
+					{ttt.EmptyMark, ttt.EmptyMark, ttt.EmptyMark},
+				},
+				Turn: ttt.Nought,
+			},
+			want: tablebase.Entry{Outcome: tablebase.Loss, DTE: 0},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := tb.Probe(tc.state)
+			if !ok {
+				t.Fatal("表に局面が無い")
+			}
+			if got != tc.want {
+				t.Errorf("解析結果の不一致: got = %+v, want = %+v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("準正常_到達不能な局面", func(t *testing.T) {
+		s := ttt.State{Board: ttt.Board{{ttt.Cross, ttt.Cross, ttt.Cross}, {ttt.Cross}}, Turn: ttt.Nought}
+		if _, ok := tb.Probe(s); ok {
+			t.Error("到達不能な局面が表にある")
+		}
+	})
+
+	t.Run("異常_HashFuncが衝突", func(t *testing.T) {
+		engine := ttt.NewEngine()
+		hash := func(ttt.State) uint64 { return 0 }
+		if _, err := tablebase.Build(&engine, hash, []ttt.State{ttt.NewInitialState()}, 0); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+
+	t.Run("異常_maxStatesを超える", func(t *testing.T) {
+		engine := ttt.NewEngine()
+		if _, err := tablebase.Build(&engine, tttHash, []ttt.State{ttt.NewInitialState()}, 100); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+func TestBestActions(t *testing.T) {
+	_, tb := buildTTT(t)
+
+	got, err := tb.BestActions(winInOne)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	want := ttt.Action{Row: 0, Col: 2}
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("最善手の不一致: got = %v, want = [%v]", got, want)
+	}
+
+	// 初期局面では全ての手が引き分けで、最善手は9手とも
+	got, err = tb.BestActions(ttt.NewInitialState())
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if len(got) != 9 {
+		t.Errorf("初期局面の最善手の数の不一致: got = %d, want = 9", len(got))
+	}
+}
+
+// 表の ActorCritic は、ランダムな相手に先手でも後手でも負けない事を確かめる。
+func TestActorCritic(t *testing.T) {
+	engine, tb := buildTTT(t)
+	oracle := tb.NewActorCritic("oracle")
+	random := sequential.NewRandomActorCritic[ttt.State, ttt.Action, ttt.Mark]()
+
+	rngs, err := randx.NewPCGs(4)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	inits := make([]ttt.State, 200)
+	for i := range inits {
+		inits[i] = ttt.NewInitialState()
+	}
+
+	for _, oracleMark := range []ttt.Mark{ttt.Cross, ttt.Nought} {
+		// oracleMark の手番では表の最善手、相手の手番では一様ランダムに指す
+		mixed := sequential.ActorCritic[ttt.State, ttt.Action, ttt.Mark]{
+			Name: "mixed",
+			PolicyValueFunc: func(s ttt.State, legalActions []ttt.Action) (game.Policy[ttt.Action], float32, error) {
+				if s.Turn == oracleMark {
+					return oracle.PolicyValueFunc(s, legalActions)
+				}
+				return random.PolicyValueFunc(s, legalActions)
+			},
+			SelectFunc: game.WeightedRandomSelectFunc[ttt.Action, ttt.Mark],
+		}
+
+		finals, err := engine.Playouts(inits, mixed, rngs)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		for i, s := range finals {
+			ranks, err := engine.RankByAgentFunc(s)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if ranks[oracleMark] != 1 {
+				t.Fatalf("性質_%v: finals[%d]: 表の ActorCritic が負けた: ranks = %v", oracleMark, i, ranks)
+			}
+		}
+	}
+
+	policy, value, err := oracle.PolicyValueFunc(winInOne, engine.Rule.LegalActionsFunc(winInOne))
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if policy[ttt.Action{Row: 0, Col: 2}] != 1.0 || value != 1.0 {
+		t.Errorf("方策と価値の不一致: policy = %v, value = %f", policy, value)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	engine, tb := buildTTT(t)
+	path := filepath.Join(t.TempDir(), "ttt.gob")
+	if err := tb.Save(path); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	loaded, err := tablebase.Load(path, &engine, tttHash)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if loaded.Len() != tb.Len() {
+		t.Fatalf("局面数の不一致: got = %d, want = %d", loaded.Len(), tb.Len())
+	}
+
+	for _, s := range []ttt.State{ttt.NewInitialState(), winInOne} {
+		want, _ := tb.Probe(s)
+		got, ok := loaded.Probe(s)
+		if !ok || got != want {
+			t.Errorf("読み込んだ表の解析結果の不一致: got = %+v, want = %+v", got, want)
+		}
+	}
+
+	t.Run("異常_存在しないファイル", func(t *testing.T) {
+		if _, err := tablebase.Load(filepath.Join(t.TempDir(), "none.gob"), &engine, tttHash); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+// 表を葉の評価に使う探索は、少ない探索回数でも勝つ手を最も多く訪問する事を確かめる。
+func TestLeafNodeEvalByAgentFunc(t *testing.T) {
+	engine, tb := buildTTT(t)
+	mcts := puct.Engine[ttt.State, ttt.Action, ttt.Mark]{
+		Game:                    engine,
+		PUCBFunc:                pucb.NewAlphaGoFunc(1.25),
+		LeafNodeEvalByAgentFunc: tb.LeafNodeEvalByAgentFunc(nil),
+		NextNodesCap:            9,
+		VirtualValue:            0.5,
+	}
+	mcts.SetUniformPolicyFunc()
+
+	rootNode, err := mcts.NewNode(winInOne)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	rngs, err := randx.NewPCGs(2)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if _, err := mcts.Search(rootNode, 200, rngs); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	var bestAction ttt.Action
+	bestVisits := -1
+	for action, calc := range rootNode.VirtualSelector() {
+		if calc.Visits() > bestVisits {
+			bestVisits = calc.Visits()
+			bestAction = action
+		}
+	}
+
+	if want := (ttt.Action{Row: 0, Col: 2}); bestAction != want {
+		t.Errorf("最多訪問の行動の不一致: got = %v, want = %v", bestAction, want)
+	}
+
+	t.Run("正常_1回の評価で表を1回だけ引く", func(t *testing.T) {
+		calls := 0
+		countingHash := func(s ttt.State) uint64 {
+			calls++
+			return tttHash(s)
+		}
+
+		counted, err := tablebase.Build(&engine, countingHash, []ttt.State{ttt.NewInitialState()}, 0)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		calls = 0
+		if _, err := counted.LeafNodeEvalByAgentFunc(nil)(winInOne, rngs[0]); err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("HashFuncの呼び出し回数の不一致: got = %d, want = 1", calls)
+		}
+	})
+
+	t.Run("異常_表に無くfallbackがnil", func(t *testing.T) {
+		s := ttt.State{Board: ttt.Board{{ttt.Cross, ttt.Cross, ttt.Cross}, {ttt.Cross}}, Turn: ttt.Nought}
+		if _, err := tb.LeafNodeEvalByAgentFunc(nil)(s, rngs[0]); err == nil {
+			t.Fatal("エラーを期待したが、nilが返された")
+		}
+	})
+}
+
+// cycleState は、A と B を行き来できるゲームの局面。A から X、B から Y に進むと、進んだ側の負けで終局する。
+// 双方とも負ける手を避けて行き来し続けるので、A と B は循環による引き分けになる。
+type cycleState int
+
+const (
+	cycleA cycleState = iota
+	cycleB
+	cycleX
+	cycleY
+)
+
+func TestCycle(t *testing.T) {
+	type player int
+	engine := sequential.Engine[cycleState, cycleState, player]{
+		Rule: sequential.Rule[cycleState, cycleState, player]{
+			LegalActionsFunc: func(s cycleState) []cycleState {
+				switch s {
+				case cycleA:
+					return []cycleState{cycleB, cycleX}
+				case cycleB:
+					return []cycleState{cycleA, cycleY}
+				default:
+					return nil
+				}
+			},
+			TransitionFunc:   func(_ cycleState, a cycleState) (cycleState, error) { return a, nil },
+			EqualFunc:        func(s1, s2 cycleState) bool { return s1 == s2 },
+			CurrentAgentFunc: func(s cycleState) player { return player(s % 2) },
+		},
+		RankByAgentFunc: func(s cycleState) (game.RankByAgent[player], error) {
+			switch s {
+			case cycleX:
+				return game.RankByAgent[player]{0: 2, 1: 1}, nil
+			case cycleY:
+				return game.RankByAgent[player]{0: 1, 1: 2}, nil
+			default:
+				return game.RankByAgent[player]{}, nil
+			}
+		},
+		Agents: []player{0, 1},
+	}
+	engine.SetStandardResultScoreByAgentFunc()
+
+	tb, err := tablebase.Build(&engine, func(s cycleState) uint64 { return uint64(s) }, []cycleState{cycleA}, 0)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	for _, s := range []cycleState{cycleA, cycleB} {
+		got, ok := tb.Probe(s)
+		want := tablebase.Entry{Outcome: tablebase.Draw, DTE: tablebase.UnknownDTE}
+		if !ok || got != want {
+			t.Errorf("state = %d: 解析結果の不一致: got = %+v, want = %+v", s, got, want)
+		}
+
+		best, err := tb.BestActions(s)
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if len(best) != 1 || best[0] != 1-s {
+			t.Errorf("state = %d: 最善手の不一致: got = %v, want = [%d]", s, best, 1-s)
+		}
+	}
+}